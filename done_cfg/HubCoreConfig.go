@@ -21,23 +21,32 @@ import (
 const DefaultServerCertFile = "hubCert.pem"
 const DefaultServerKeyFile = "hubKey.pem"
 
+// CoreServiceID is the agent and thing ID of events published by the Hub core
+const CoreServiceID = "core"
+
+// ServerCertRenewedEvent is published by the core when the server certificate is renewed.
+// The payload is the new certificate in PEM format.
+const ServerCertRenewedEvent = "serverCertRenewed"
+
 // HubCoreConfig with core server, auth, cert and launcher configuration
 // Used for launching the core.
 // Use NewHubCoreConfig to create a default config
 // FIXME: this is temporary, each service must handle their own config yaml
 type HubCoreConfig struct {
 	Env            plugin.AppEnvironment
-	CaCertFile     string                  `yaml:"caCertFile"`     // default: caCert.pem
-	CaKeyFile      string                  `yaml:"caKeyFile"`      // default: caKey.pem
-	ServerCertFile string                  `yaml:"serverCertFile"` // default: hubCert.pem
-	ServerKeyFile  string                  `yaml:"serverKeyFile"`  // default: hubKey.pem
-	CaCert         *x509.Certificate       `yaml:"-"`              // preset, load, or error
-	CaKey          keys.IHiveKey           `yaml:"-"`              // preset, load, or error
-	ServerTLS      *tls.Certificate        `yaml:"-"`              // preset, load, or generate
-	ServerKey      keys.IHiveKey           `yaml:"-"`
-	NatsServer     buscfg.NatsServerConfig `yaml:"natsserver"`
-	Auth           authcfg.AuthConfig      `yaml:"auth"`
-	EnableMDNS     bool                    `yaml:"enableMDNS"`
+	CaCertFile     string            `yaml:"caCertFile"`     // default: caCert.pem
+	CaKeyFile      string            `yaml:"caKeyFile"`      // default: caKey.pem
+	ServerCertFile string            `yaml:"serverCertFile"` // default: hubCert.pem
+	ServerKeyFile  string            `yaml:"serverKeyFile"`  // default: hubKey.pem
+	CaCert         *x509.Certificate `yaml:"-"`              // preset, load, or error
+	CaKey          keys.IHiveKey     `yaml:"-"`              // preset, load, or error
+	ServerTLS      *tls.Certificate  `yaml:"-"`              // preset, load, or generate
+	ServerKey      keys.IHiveKey     `yaml:"-"`
+	// renews the server certificate. Created by Setup.
+	ServerCertManager *certs.ServerCertManager `yaml:"-"`
+	NatsServer        buscfg.NatsServerConfig  `yaml:"natsserver"`
+	Auth              authcfg.AuthConfig       `yaml:"auth"`
+	EnableMDNS        bool                     `yaml:"enableMDNS"`
 }
 
 // Setup ensures the hub core configuration exists along with certificate and key files.
@@ -86,6 +95,7 @@ func (cfg *HubCoreConfig) Setup(env *plugin.AppEnvironment, new bool) error {
 	cfg.NatsServer.CaCert = cfg.CaCert
 	cfg.NatsServer.CaKey = cfg.CaKey
 	cfg.NatsServer.ServerTLS = cfg.ServerTLS
+	cfg.NatsServer.GetServerTLS = cfg.ServerCertManager.GetCertificate
 
 	// 4: Setup message server config
 
@@ -105,7 +115,8 @@ func (cfg *HubCoreConfig) Setup(env *plugin.AppEnvironment, new bool) error {
 // SetupCerts load or generate certificates.
 // If certificates are preloaded then do nothing.
 // If a CA doesn't exist then generate and save a new self-signed cert valid for localhost,127.0.0.1 and outbound IP
-// The server certificates is always regenerated and saved.
+// The server certificates is always regenerated and saved. The ServerCertManager renews
+// it before it expires.
 // This panics if certs cannot be setup.
 func (cfg *HubCoreConfig) setupCerts() {
 	var err error
@@ -189,18 +200,13 @@ func (cfg *HubCoreConfig) setupCerts() {
 	names := []string{"localhost", "127.0.0.1", hostName, outboundIP.String()}
 
 	// regenerate a new server cert, valid for 1 year
-	serverCert, err := certs.CreateServerCert(
-		serverID, ou, 365, cfg.ServerKey, names, cfg.CaCert, cfg.CaKey)
+	cfg.ServerCertManager = certs.NewServerCertManager(
+		serverID, ou, names, 365, cfg.ServerKey, cfg.CaCert, cfg.CaKey, serverCertPath, 0)
+	err = cfg.ServerCertManager.Renew()
 	if err != nil {
 		panic("Unable to create a server cert: " + err.Error())
 	}
-	cfg.ServerTLS = certs.X509CertToTLS(serverCert, cfg.ServerKey)
-
-	slog.Warn("Writing server cert", "serverCertPath", serverCertPath)
-	err = certs.SaveX509CertToPEM(serverCert, serverCertPath)
-	if err != nil {
-		slog.Error("writing server cert failed: ", "err", err)
-	}
+	cfg.ServerTLS = cfg.ServerCertManager.GetTLSCert()
 	//err = certs.SaveTLSCertToPEM(cfg.ServerTLS, serverCertPath, serverKeyPath)
 }
 
@@ -33,7 +33,7 @@ func ConnectToHub(fullURL string, clientID string, certDir string, core string,
 	// 1. determine the actual address
 	if fullURL == "" {
 		// return after first result
-		fullURL, _ = discovery.LocateHub(time.Second, true)
+		fullURL, _ = discovery.LocateHub(time.Second, true, false)
 	}
 	if clientID == "" {
 		return nil, fmt.Errorf("missing clientID")
@@ -0,0 +1,191 @@
+package clidone
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/hiveot/hub/done_tool/things"
+)
+
+// ExposedThing is the agent's runtime of a Thing it publishes, based on its TD.
+// This follows the ExposedThing of the WoT Scripting API. Incoming action and
+// configuration requests are validated against the TD schema before they are passed
+// to the handler registered for their name. Property values are tracked so that only
+// changed values are published.
+//
+// Use ExposedThings.Produce to create an instance.
+type ExposedThing struct {
+	hc *HubClient
+	// the TD can be replaced by ExposedThings.Produce; use getTD to read it
+	td *things.TD
+	// latest and changed property values
+	props *things.PropertyValues
+
+	actionHandlers map[string]func(tv *things.ThingValue) ([]byte, error)
+	configHandlers map[string]func(tv *things.ThingValue) error
+	mux            sync.RWMutex
+}
+
+// EmitEvent publishes an event of the Thing.
+// The value is validated against the event data schema, if defined.
+//
+//	name of the event as defined in the TD
+//	value is the serialized event value, or nil if the event has no data
+func (et *ExposedThing) EmitEvent(name string, value []byte) error {
+	td := et.getTD()
+	ev := td.GetEvent(name)
+	if ev == nil {
+		return fmt.Errorf("EmitEvent: Thing '%s' has no event '%s'", td.ID, name)
+	}
+	if ev.Data != nil {
+		err := ev.Data.ValidateData(value)
+		if err != nil {
+			return fmt.Errorf("EmitEvent '%s': %w", name, err)
+		}
+	}
+	return et.hc.PubEvent(td.ID, name, value)
+}
+
+// GetID returns the ID of the Thing
+func (et *ExposedThing) GetID() string {
+	return et.getTD().ID
+}
+
+// GetPropertyValue returns the latest value of a property
+func (et *ExposedThing) GetPropertyValue(name string) (value string, found bool) {
+	return et.props.GetValue(name)
+}
+
+// GetTD returns the TD document of the Thing
+func (et *ExposedThing) GetTD() *things.TD {
+	return et.getTD()
+}
+
+// getTD returns the current TD document under lock
+func (et *ExposedThing) getTD() *things.TD {
+	et.mux.RLock()
+	defer et.mux.RUnlock()
+	return et.td
+}
+
+// handleActionRequest validates the action input and passes the request to its handler
+func (et *ExposedThing) handleActionRequest(tv *things.ThingValue) ([]byte, error) {
+	et.mux.RLock()
+	action := et.td.GetAction(tv.Name)
+	handler := et.actionHandlers[tv.Name]
+	et.mux.RUnlock()
+	if action == nil || handler == nil {
+		return nil, fmt.Errorf("Thing '%s' has no action '%s'", tv.ThingID, tv.Name)
+	}
+	if action.Input != nil {
+		err := action.Input.ValidateData(tv.Data)
+		if err != nil {
+			return nil, fmt.Errorf("action '%s': %w", tv.Name, err)
+		}
+	}
+	return handler(tv)
+}
+
+// handleConfigRequest validates the new property value and passes the request to its handler.
+// The handler should update the property value once it is applied.
+func (et *ExposedThing) handleConfigRequest(tv *things.ThingValue) error {
+	et.mux.RLock()
+	prop := et.td.GetProperty(tv.Name)
+	handler := et.configHandlers[tv.Name]
+	et.mux.RUnlock()
+	if prop == nil || handler == nil {
+		return fmt.Errorf("Thing '%s' has no configurable property '%s'", tv.ThingID, tv.Name)
+	}
+	if prop.ReadOnly {
+		return fmt.Errorf("property '%s' is read-only", tv.Name)
+	}
+	err := prop.DataSchema.ValidateData(tv.Data)
+	if err != nil {
+		return fmt.Errorf("property '%s': %w", tv.Name, err)
+	}
+	return handler(tv)
+}
+
+// PublishChanges publishes the property values that changed since the last publication.
+// This does nothing if no values have changed. The changes are kept if publication
+// fails, so they are included in the next publication.
+func (et *ExposedThing) PublishChanges() error {
+	if !et.props.HasChanges() {
+		return nil
+	}
+	changed := et.props.GetChanged(false)
+	err := et.hc.PubProps(et.GetID(), changed)
+	if err == nil {
+		et.props.ClearChanged(changed)
+	}
+	return err
+}
+
+// PublishTD publishes the TD document and all property values of the Thing
+func (et *ExposedThing) PublishTD() error {
+	td := et.getTD()
+	err := et.hc.PubTD(td)
+	if err == nil {
+		latest := et.props.GetLatest()
+		err = et.hc.PubProps(td.ID, latest)
+		if err == nil {
+			et.props.ClearChanged(latest)
+		}
+	}
+	return err
+}
+
+// SetActionHandler sets the handler of requests for an action.
+// The request is only passed to the handler if its input matches the action's schema.
+// The handler returns the serialized reply, if any.
+func (et *ExposedThing) SetActionHandler(
+	name string, handler func(tv *things.ThingValue) ([]byte, error)) {
+
+	et.mux.Lock()
+	defer et.mux.Unlock()
+	if et.td.GetAction(name) == nil {
+		slog.Warn("SetActionHandler; action is not defined in the TD",
+			slog.String("thingID", et.td.ID), slog.String("name", name))
+	}
+	et.actionHandlers[name] = handler
+}
+
+// SetConfigHandler sets the handler of configuration requests for a property.
+// The request is only passed to the handler if the value matches the property's schema.
+// Properties without handler can't be configured.
+func (et *ExposedThing) SetConfigHandler(name string, handler func(tv *things.ThingValue) error) {
+	et.mux.Lock()
+	defer et.mux.Unlock()
+	if et.td.GetProperty(name) == nil {
+		slog.Warn("SetConfigHandler; property is not defined in the TD",
+			slog.String("thingID", et.td.ID), slog.String("name", name))
+	}
+	et.configHandlers[name] = handler
+}
+
+// setTD replaces the TD document while keeping the handlers and property values
+func (et *ExposedThing) setTD(td *things.TD) {
+	et.mux.Lock()
+	defer et.mux.Unlock()
+	et.td = td
+}
+
+// SetPropertyValue updates the value of a property.
+// Changed values are published by PublishChanges.
+func (et *ExposedThing) SetPropertyValue(name string, value string) {
+	et.props.SetValue(name, value)
+}
+
+// NewExposedThing creates the runtime for a Thing published by the client.
+// Use ExposedThings.Produce instead to have requests passed to the thing.
+func NewExposedThing(hc *HubClient, td *things.TD) *ExposedThing {
+	et := &ExposedThing{
+		hc:             hc,
+		td:             td,
+		props:          things.NewPropertyValues(),
+		actionHandlers: make(map[string]func(tv *things.ThingValue) ([]byte, error)),
+		configHandlers: make(map[string]func(tv *things.ThingValue) error),
+	}
+	return et
+}
@@ -0,0 +1,126 @@
+package clidone
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	"github.com/hiveot/hub/done_tool/things"
+)
+
+// ExposedThings drives the Things published by a device agent or service.
+//
+// This replaces the agent's hand-wired request handlers. Action and configuration
+// requests are passed to the ExposedThing they are addressed to, and the TDs and
+// property values are republished when the connection is restored.
+//
+// This takes over the action, config and connection handlers of the Hub client.
+type ExposedThings struct {
+	hc *HubClient
+	// connection handler of the agent, if any
+	connectionHandler func(status transport.HubTransportStatus)
+
+	things map[string]*ExposedThing
+	mux    sync.RWMutex
+}
+
+// Get returns the exposed thing with the given ID, or nil if it doesn't exist
+func (ets *ExposedThings) Get(thingID string) *ExposedThing {
+	ets.mux.RLock()
+	defer ets.mux.RUnlock()
+	return ets.things[thingID]
+}
+
+// onActionRequest passes an action request to the thing it is addressed to
+func (ets *ExposedThings) onActionRequest(tv *things.ThingValue) ([]byte, error) {
+	et := ets.Get(tv.ThingID)
+	if et == nil {
+		return nil, fmt.Errorf("unknown thing '%s'", tv.ThingID)
+	}
+	return et.handleActionRequest(tv)
+}
+
+// onConfigRequest passes a configuration request to the thing it is addressed to
+func (ets *ExposedThings) onConfigRequest(tv *things.ThingValue) error {
+	et := ets.Get(tv.ThingID)
+	if et == nil {
+		return fmt.Errorf("unknown thing '%s'", tv.ThingID)
+	}
+	return et.handleConfigRequest(tv)
+}
+
+// onConnect republishes the TDs and property values after the connection is restored
+func (ets *ExposedThings) onConnect(status transport.HubTransportStatus) {
+	if status.ConnectionStatus == transport.Connected {
+		ets.PublishAll()
+	}
+	if ets.connectionHandler != nil {
+		ets.connectionHandler(status)
+	}
+}
+
+// Produce creates an exposed thing from its TD.
+// If the thing already exists then its TD is replaced and its handlers are kept.
+// Publish the TD with PublishTD when the thing is ready.
+func (ets *ExposedThings) Produce(td *things.TD) *ExposedThing {
+	ets.mux.Lock()
+	defer ets.mux.Unlock()
+	et, found := ets.things[td.ID]
+	if found {
+		et.setTD(td)
+	} else {
+		et = NewExposedThing(ets.hc, td)
+		ets.things[td.ID] = et
+	}
+	return et
+}
+
+// PublishAll publishes the TDs and property values of all exposed things
+func (ets *ExposedThings) PublishAll() {
+	ets.mux.RLock()
+	exposed := make([]*ExposedThing, 0, len(ets.things))
+	for _, et := range ets.things {
+		exposed = append(exposed, et)
+	}
+	ets.mux.RUnlock()
+	for _, et := range exposed {
+		err := et.PublishTD()
+		if err != nil {
+			slog.Error("PublishAll; failed publishing TD",
+				slog.String("thingID", et.GetID()), slog.String("err", err.Error()))
+		}
+	}
+}
+
+// Remove an exposed thing. Requests for this thing are rejected.
+func (ets *ExposedThings) Remove(thingID string) {
+	ets.mux.Lock()
+	defer ets.mux.Unlock()
+	delete(ets.things, thingID)
+}
+
+// SetConnectionHandler sets the agent's handler of connection status changes.
+// The Hub client's connection handler is used by ExposedThings so it can't be set directly.
+func (ets *ExposedThings) SetConnectionHandler(handler func(status transport.HubTransportStatus)) {
+	ets.connectionHandler = handler
+}
+
+// Start handling requests for the exposed things and publish their TDs.
+func (ets *ExposedThings) Start() {
+	ets.hc.SetActionHandler(ets.onActionRequest)
+	ets.hc.SetConfigHandler(ets.onConfigRequest)
+	ets.hc.SetConnectionHandler(ets.onConnect)
+	ets.PublishAll()
+}
+
+// NewExposedThings creates the runtime for the things exposed by an agent.
+//
+//	hc is the agent's Hub connection. Use Start after the things are produced.
+func NewExposedThings(hc *HubClient) *ExposedThings {
+	ets := &ExposedThings{
+		hc:     hc,
+		things: make(map[string]*ExposedThing),
+	}
+	return ets
+}
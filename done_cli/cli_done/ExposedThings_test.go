@@ -0,0 +1,127 @@
+package clidone_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	vocab "github.com/hiveot/hub/done_api/api_go"
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/hiveot/hub/done_tool/things"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const deviceID = "device1"
+const thingID = "thing1"
+
+// createTestTD returns a TD with a configurable level property and a dim action
+func createTestTD() *things.TD {
+	td := things.NewTD(thingID, "test thing", "")
+	level := td.AddProperty("level", "", "Level", vocab.WoTDataTypeInteger)
+	level.ReadOnly = false
+	level.NumberMaximum = 100
+	td.AddAction("dim", "", "Dim", "",
+		&things.DataSchema{Type: vocab.WoTDataTypeInteger, NumberMinimum: 1})
+	return td
+}
+
+// startExposedThings starts the test server and a device that exposes the test thing.
+// This returns a user that can send requests to the thing.
+func startExposedThings(t *testing.T) (
+	ets *clidone.ExposedThings, user *clidone.HubClient, stopFn func()) {
+
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	device, err := ts.AddConnectDevice(deviceID)
+	require.NoError(t, err)
+	user, err = ts.AddConnectUser("user1", authapi.ClientRoleManager)
+	require.NoError(t, err)
+
+	ets = clidone.NewExposedThings(device)
+	ets.Produce(createTestTD())
+	ets.Start()
+	// allow the subscriptions to reach the server
+	time.Sleep(10 * time.Millisecond)
+	return ets, user, func() {
+		user.Disconnect()
+		device.Disconnect()
+		ts.Stop()
+	}
+}
+
+// Requests are validated before they are passed to the handler of the exposed thing
+func TestActionAndConfigRequests(t *testing.T) {
+	ets, user, stopFn := startExposedThings(t)
+	defer stopFn()
+	et := ets.Get(thingID)
+	require.NotNil(t, et)
+
+	et.SetActionHandler("dim", func(tv *things.ThingValue) ([]byte, error) {
+		return tv.Data, nil
+	})
+	et.SetConfigHandler("level", func(tv *things.ThingValue) error {
+		et.SetPropertyValue(tv.Name, string(tv.Data))
+		return nil
+	})
+
+	reply, err := user.PubAction(deviceID, thingID, "dim", []byte("50"))
+	require.NoError(t, err)
+	assert.Equal(t, "50", string(reply))
+	_, err = user.PubAction(deviceID, thingID, "dim", []byte("0"))
+	assert.Error(t, err)
+	_, err = user.PubAction(deviceID, thingID, "unknown", []byte("1"))
+	assert.Error(t, err)
+	_, err = user.PubAction(deviceID, "thing2", "dim", []byte("1"))
+	assert.Error(t, err)
+
+	err = user.PubConfig(deviceID, thingID, "level", []byte("80"))
+	require.NoError(t, err)
+	value, found := et.GetPropertyValue("level")
+	assert.True(t, found)
+	assert.Equal(t, "80", value)
+	err = user.PubConfig(deviceID, thingID, "level", []byte("101"))
+	assert.Error(t, err)
+
+	// removed things no longer accept requests
+	ets.Remove(thingID)
+	_, err = user.PubAction(deviceID, thingID, "dim", []byte("50"))
+	assert.Error(t, err)
+}
+
+// Producing an existing thing replaces its TD and keeps its handlers
+func TestProduceReplacesTD(t *testing.T) {
+	ets, user, stopFn := startExposedThings(t)
+	defer stopFn()
+	et := ets.Get(thingID)
+	et.SetActionHandler("dim", func(tv *things.ThingValue) ([]byte, error) {
+		return nil, nil
+	})
+
+	// replace the TD while requests are handled
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			_, err := user.PubAction(deviceID, thingID, "dim", []byte("50"))
+			assert.NoError(t, err)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		et2 := ets.Produce(createTestTD())
+		assert.Equal(t, et, et2)
+	}
+	wg.Wait()
+
+	// the new TD no longer has the action
+	td := things.NewTD(thingID, "test thing", "")
+	ets.Produce(td)
+	assert.Equal(t, td, et.GetTD())
+	_, err := user.PubAction(deviceID, thingID, "dim", []byte("50"))
+	assert.Error(t, err)
+}
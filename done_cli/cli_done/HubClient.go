@@ -12,9 +12,12 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
 	"github.com/hiveot/hub/done_tool/keys"
+	"github.com/hiveot/hub/done_tool/metrics"
 	"github.com/hiveot/hub/done_tool/ser"
 	"github.com/hiveot/hub/done_tool/things"
 )
@@ -31,6 +34,15 @@ const KPFileExt = ".key"
 // in the keys directory.
 const PubKeyFileExt = ".pub"
 
+// TokenRefreshRetryInterval is the interval between attempts to refresh the token
+// after a failed refresh.
+const TokenRefreshRetryInterval = time.Minute
+
+// rotateKeyAttempts is the nr of attempts to connect with a rotated key, as the server
+// applies the new key in the background.
+const rotateKeyAttempts = 20
+const rotateKeyRetryDelay = 100 * time.Millisecond
+
 // HubClient wrapper around the underlying message bus transport.
 type HubClient struct {
 	//serverURL string
@@ -46,6 +58,16 @@ type HubClient struct {
 
 	// keep retrying connection on error (default true)
 	retryConnect atomic.Bool
+	// refresh the auth token before it expires (default true)
+	tokenRefresh atomic.Bool
+	// token file to update with the refreshed token, if connected with a token file
+	tokenFile string
+	// timer of the next token refresh
+	refreshTimer *time.Timer
+	// refreshMux serializes token refreshes and key rotation
+	refreshMux sync.Mutex
+	// closed is set by Disconnect and stops the token refresh
+	closed bool
 
 	// mux is used to protect access to handlers and capTable
 	mux sync.RWMutex
@@ -59,6 +81,12 @@ type HubClient struct {
 	connectionHandler func(status transport.HubTransportStatus)
 	eventHandler      func(msg *things.ThingValue)
 	rpcHandler        func(msg *things.ThingValue) (reply []byte, err error)
+	// optional handler that is notified of handled capability requests
+	rpcAuditHandler func(capID string, method string, senderID string, args []byte, err error)
+
+	// metrics of the handled RPC requests by capability and method
+	rpcRequests *metrics.Counter
+	rpcDuration *metrics.Histogram
 }
 
 // MakeAddress creates a message address optionally with wildcards
@@ -108,12 +136,17 @@ func (hc *HubClient) SplitAddress(addr string) (msgType, agentID, thingID, name
 	sep, _, _ := hc.transport.AddressTokens()
 	parts := strings.Split(addr, sep)
 
-	// inbox topics are short
+	// inbox topics are short, except for notifications which use the full address
 	if len(parts) >= 1 && strings.HasPrefix(addr, transport.MessageTypeINBOX) {
 		msgType = parts[0]
 		if len(parts) >= 2 {
 			agentID = parts[1]
 		}
+		if len(parts) >= 5 {
+			thingID = parts[2]
+			name = parts[3]
+			senderID = parts[4]
+		}
 		return
 	}
 	if len(parts) < 4 {
@@ -140,6 +173,13 @@ func (hc *HubClient) ClientKP() keys.IHiveKey {
 	return hc.kp
 }
 
+// Collect writes the metrics of the RPC requests handled by this client.
+// This implements the metrics.Collector interface.
+func (hc *HubClient) Collect(mw *metrics.MetricWriter) {
+	hc.rpcRequests.Collect(mw)
+	hc.rpcDuration.Collect(mw)
+}
+
 // ConnectWithToken connects to the Hub server using a user JWT credentials secret
 // The token clientID must match that of the client
 //
@@ -147,7 +187,13 @@ func (hc *HubClient) ClientKP() keys.IHiveKey {
 //	jwtToken is the token obtained with login or refresh.
 func (hc *HubClient) ConnectWithToken(kp keys.IHiveKey, jwtToken string) error {
 	err := hc.transport.ConnectWithToken(kp, jwtToken)
+	hc.mux.Lock()
 	hc.kp = kp
+	hc.closed = false
+	hc.mux.Unlock()
+	if err == nil {
+		hc.scheduleTokenRefresh(jwtToken)
+	}
 	return err
 }
 
@@ -170,14 +216,26 @@ func (hc *HubClient) ConnectWithTokenFile(keysDir string) error {
 	if err != nil {
 		return fmt.Errorf("ConnectWithTokenFile failed: %w", err)
 	}
-	hc.kp = kp
 	err = hc.transport.ConnectWithToken(kp, string(token))
+	hc.mux.Lock()
+	hc.kp = kp
+	hc.closed = false
+	hc.mux.Unlock()
+	if err == nil {
+		hc.mux.Lock()
+		hc.tokenFile = tokenFile
+		hc.mux.Unlock()
+		hc.scheduleTokenRefresh(string(token))
+	}
 	return err
 }
 
 // ConnectWithPassword connects to the Hub server using the clientID and password.
 func (hc *HubClient) ConnectWithPassword(password string) error {
 	err := hc.transport.ConnectWithPassword(password)
+	hc.mux.Lock()
+	hc.closed = false
+	hc.mux.Unlock()
 	return err
 }
 
@@ -186,8 +244,16 @@ func (hc *HubClient) CreateKeyPair() keys.IHiveKey {
 	return hc.transport.CreateKeyPair()
 }
 
-// Disconnect the client from the hub and unsubscribe from all topics
+// Disconnect the client from the hub and unsubscribe from all topics.
+// This stops the token refresh, including a refresh that is in progress.
 func (hc *HubClient) Disconnect() {
+	hc.mux.Lock()
+	hc.closed = true
+	if hc.refreshTimer != nil {
+		hc.refreshTimer.Stop()
+		hc.refreshTimer = nil
+	}
+	hc.mux.Unlock()
 	hc.transport.Disconnect()
 }
 
@@ -257,6 +323,242 @@ func (hc *HubClient) onConnect(status transport.HubTransportStatus) {
 	}
 }
 
+// onRefreshTimer refreshes the auth token, saves it to the token file if one is used,
+// and passes it to the transport. The connection handler is notified when the transport
+// has reconnected with the new token.
+// A failed refresh is retried until the token has expired or the client disconnects.
+func (hc *HubClient) onRefreshTimer(expiry time.Time) {
+	hc.refreshMux.Lock()
+	defer hc.refreshMux.Unlock()
+	hc.mux.RLock()
+	tokenFile := hc.tokenFile
+	kp := hc.kp
+	closed := hc.closed
+	hc.mux.RUnlock()
+	if closed {
+		return
+	}
+
+	resp := authapi.RefreshTokenResp{}
+	err := hc.PubRPCRequest(authapi.AuthServiceName, authapi.AuthProfileCapability,
+		authapi.RefreshTokenMethod, nil, &resp)
+	if err == nil && tokenFile != "" {
+		err = replaceFiles(replacedFile{path: tokenFile, data: resp.Token, perm: 0400})
+	}
+	if err == nil {
+		err = hc.transport.ReconnectWithToken(kp, resp.Token)
+	}
+	if err != nil {
+		slog.Error("onRefreshTimer: token refresh failed",
+			slog.String("clientID", hc.clientID), slog.String("err", err.Error()))
+		hc.mux.Lock()
+		if !hc.closed && time.Until(expiry) > TokenRefreshRetryInterval {
+			hc.refreshTimer = time.AfterFunc(TokenRefreshRetryInterval, func() {
+				hc.onRefreshTimer(expiry)
+			})
+		}
+		hc.mux.Unlock()
+		return
+	}
+	// the client can disconnect while the transport reconnects
+	hc.mux.RLock()
+	closed = hc.closed
+	hc.mux.RUnlock()
+	if closed {
+		hc.transport.Disconnect()
+		return
+	}
+	slog.Info("onRefreshTimer: token refreshed", slog.String("clientID", hc.clientID))
+	hc.scheduleTokenRefresh(resp.Token)
+}
+
+// RotateKey replaces the client's key pair with a newly generated key.
+//
+// This registers the new public key with the auth service, reconnects using the new
+// key, obtains a token for the new key and reconnects using the new key and token.
+// The {clientID}.key, {clientID}.pub and {clientID}.token files in keysDir are replaced.
+//
+// Once the new public key is registered, the server no longer accepts the old key and
+// closes the connection that uses it.
+// If obtaining the new token fails then the new key files are still saved and an
+// error is returned.
+// The token refresh is paused during the rotation and rescheduled afterwards.
+//
+//	keysDir is the directory with the client's key and token files
+func (hc *HubClient) RotateKey(keysDir string) (err error) {
+	if keysDir == "" {
+		return fmt.Errorf("RotateKey: keys directory must be provided")
+	}
+	keyFile := path.Join(keysDir, hc.clientID+KPFileExt)
+	pubFile := path.Join(keysDir, hc.clientID+PubKeyFileExt)
+	tokenFile := path.Join(keysDir, hc.clientID+TokenFileExt)
+	newKP := hc.transport.CreateKeyPair()
+
+	slog.Info("RotateKey", slog.String("clientID", hc.clientID))
+	// a refresh must not reconnect with the old key while it is replaced
+	hc.refreshMux.Lock()
+	defer hc.refreshMux.Unlock()
+	hc.mux.Lock()
+	if hc.refreshTimer != nil {
+		hc.refreshTimer.Stop()
+		hc.refreshTimer = nil
+	}
+	hc.mux.Unlock()
+	defer func() {
+		if err != nil {
+			hc.scheduleTokenRefresh(hc.transport.GetStatus().Token)
+		}
+	}()
+	args := authapi.UpdatePubKeyArgs{NewPubKey: newKP.ExportPublic()}
+	updateErr := hc.PubRPCRequest(authapi.AuthServiceName, authapi.AuthProfileCapability,
+		authapi.UpdatePubKeyMethod, &args, nil)
+	// The connection with the old key can close before the response is received,
+	// so the update succeeded if the new key is accepted.
+	for i := 1; ; i++ {
+		err = hc.transport.ReconnectWithToken(newKP, "")
+		if err == nil || i >= rotateKeyAttempts {
+			break
+		}
+		time.Sleep(rotateKeyRetryDelay)
+	}
+	if err != nil {
+		if updateErr != nil {
+			err = updateErr
+		}
+		return fmt.Errorf("RotateKey: updating the public key failed: %w", err)
+	}
+	hc.mux.Lock()
+	hc.kp = newKP
+	hc.tokenFile = tokenFile
+	hc.mux.Unlock()
+	keyFiles := []replacedFile{
+		{path: keyFile, data: newKP.ExportPrivate(), perm: 0400},
+		{path: pubFile, data: newKP.ExportPublic(), perm: 0644},
+	}
+	resp := authapi.RefreshTokenResp{}
+	err = hc.PubRPCRequest(authapi.AuthServiceName, authapi.AuthProfileCapability,
+		authapi.RefreshTokenMethod, nil, &resp)
+	if err != nil {
+		// without the new key the client is locked out
+		_ = replaceFiles(keyFiles...)
+		return fmt.Errorf("RotateKey: obtaining a token for the new key failed: %w", err)
+	}
+	err = replaceFiles(append(keyFiles,
+		replacedFile{path: tokenFile, data: resp.Token, perm: 0400})...)
+	if err != nil {
+		return fmt.Errorf("RotateKey: %w", err)
+	}
+	err = hc.transport.ReconnectWithToken(newKP, resp.Token)
+	if err != nil {
+		return fmt.Errorf("RotateKey: %w", err)
+	}
+	hc.scheduleTokenRefresh(resp.Token)
+	return nil
+}
+
+// scheduleTokenRefresh sets the timer to refresh the token before it expires.
+// The token is refreshed when three quarters of its remaining validity have passed.
+// Tokens without expiry are not refreshed, nor are tokens of a disconnected client.
+func (hc *HubClient) scheduleTokenRefresh(token string) {
+	if !hc.tokenRefresh.Load() {
+		return
+	}
+	expiry, err := hc.transport.GetTokenExpiry(token)
+	if err != nil || expiry.IsZero() {
+		return
+	}
+	refreshIn := time.Until(expiry) * 3 / 4
+	hc.mux.Lock()
+	defer hc.mux.Unlock()
+	if hc.closed {
+		return
+	}
+	if hc.refreshTimer != nil {
+		hc.refreshTimer.Stop()
+	}
+	hc.refreshTimer = time.AfterFunc(refreshIn, func() {
+		hc.onRefreshTimer(expiry)
+	})
+}
+
+// replacedFile is the new content of a file replaced by replaceFiles
+type replacedFile struct {
+	path string
+	data string
+	perm os.FileMode
+}
+
+// renameFile renames a file. It can be replaced to test failures in replaceFiles.
+var renameFile = os.Rename
+
+// replaceFiles replaces the content of a set of files.
+// All content is written to temporary files first, which are then renamed to the
+// target files. This ensures files are never left partially written, and that none
+// of the files are replaced if writing any of them fails. If renaming fails then the
+// files that were already replaced are restored to their original content.
+func replaceFiles(files ...replacedFile) (err error) {
+	tmpPaths := make([]string, 0, len(files))
+	for _, f := range files {
+		var file *os.File
+		file, err = os.CreateTemp(path.Dir(f.path), path.Base(f.path)+"-")
+		if err != nil {
+			break
+		}
+		tmpPaths = append(tmpPaths, file.Name())
+		_, err = file.WriteString(f.data)
+		_ = file.Close()
+		if err == nil {
+			err = os.Chmod(file.Name(), f.perm)
+		}
+		if err != nil {
+			break
+		}
+	}
+	// keep the original content to restore it if a rename fails
+	originals := make([]*replacedFile, len(files))
+	for i := 0; err == nil && i < len(files); i++ {
+		originals[i], err = readReplacedFile(files[i].path)
+	}
+	renamed := 0
+	for err == nil && renamed < len(files) {
+		err = renameFile(tmpPaths[renamed], files[renamed].path)
+		if err == nil {
+			renamed++
+		}
+	}
+	if err != nil {
+		for _, tmpPath := range tmpPaths[renamed:] {
+			_ = os.Remove(tmpPath)
+		}
+		for i := 0; i < renamed; i++ {
+			if originals[i] == nil {
+				_ = os.Remove(files[i].path)
+			} else if err2 := replaceFiles(*originals[i]); err2 != nil {
+				slog.Error("replaceFiles: failed restoring file",
+					slog.String("path", files[i].path), slog.String("err", err2.Error()))
+			}
+		}
+		return fmt.Errorf("replaceFiles: %w", err)
+	}
+	return nil
+}
+
+// readReplacedFile returns the current content and permissions of a file,
+// or nil if the file doesn't exist.
+func readReplacedFile(filePath string) (*replacedFile, error) {
+	info, err := os.Stat(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &replacedFile{path: filePath, data: string(data), perm: info.Mode().Perm()}, nil
+}
+
 // Handlers of events and requests. These are dispatched to their appropriate handlers
 func (hc *HubClient) onEvent(addr string, payload []byte) {
 	messageType, agentID, thingID, name, senderID, err := hc.SplitAddress(addr)
@@ -302,7 +604,14 @@ func (hc *HubClient) onRequest(addr string, payload []byte) (reply []byte, err e
 			slog.String("capability", thingID),
 			slog.String("method", name),
 		)
+		start := time.Now()
 		reply, err = rpcHandler(tv)
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		hc.rpcRequests.Inc(thingID, name, result)
+		hc.rpcDuration.Observe(time.Since(start).Seconds(), thingID, name)
 
 	} else if messageType == transport.MessageTypeConfig && configHandler != nil {
 		slog.Info("Received config request",
@@ -399,6 +708,27 @@ func (hc *HubClient) PubEvents(thingID string, eventMap map[string]string) error
 	return nil
 }
 
+// PubNotification publishes a message to the inbox of a single client.
+// Unlike events, notifications can only be received by the addressed client.
+// The notification is received by the client's event handler with the message type
+// set to transport.MessageTypeINBOX, the agentID set to the client's ID and the
+// senderID set to this client's ID.
+//
+//	clientID is the ID of the client to notify
+//	thingID of the Thing the notification is about
+//	name of the notification
+//	payload is the serialized notification value
+func (hc *HubClient) PubNotification(clientID string, thingID string, name string, payload []byte) error {
+	if clientID == "" || thingID == "" || name == "" {
+		err := fmt.Errorf("PubNotification missing clientID, thingID or name")
+		slog.Error(err.Error())
+		return err
+	}
+	addr := hc.MakeAddress(transport.MessageTypeINBOX, clientID, thingID, name, hc.clientID)
+	err := hc.transport.PubEvent(addr, payload)
+	return err
+}
+
 // PubProps publishes a 'properties' (transport.EventNameProps) event containing a map of
 // property name and values.
 // If the given properties map is empty then nothing will be published.
@@ -525,6 +855,30 @@ func (hc *HubClient) SetRetryConnect(enable bool) {
 	hc.retryConnect.Store(enable)
 }
 
+// SetTokenRefresh enables/disables the automatic refresh of the auth token.
+// The default is enabled. When connected with a token file, the file is updated
+// with the refreshed token. The connection handler is notified of the reconnect, where
+// the status holds the new token.
+// This must be set before connecting.
+func (hc *HubClient) SetTokenRefresh(enable bool) {
+	hc.tokenRefresh.Store(enable)
+}
+
+// SetRPCAuditHandler sets the handler that is notified after a capability request
+// registered with SetRPCCapability has been handled.
+// Intended for recording state-changing requests in an audit log.
+//
+//	capID and method identify the request
+//	senderID is the client that sent the request
+//	args is the serialized request argument
+//	err is the result of the request, nil on success
+func (hc *HubClient) SetRPCAuditHandler(
+	handler func(capID string, method string, senderID string, args []byte, err error)) {
+	hc.mux.Lock()
+	hc.rpcAuditHandler = handler
+	hc.mux.Unlock()
+}
+
 // SetRPCHandler sets the handler of all incoming RPC requests
 // This will subscribe to RPC requests directed to this client's agentID.
 // The result or error will be sent back to the caller.
@@ -593,6 +947,12 @@ func (hc *HubClient) SetRPCCapability(capID string, capMethods map[string]interf
 				SenderID: tv.SenderID,
 			}
 			respData, err := HandleRequestMessage(ctx, capMethod, tv.Data)
+			hc.mux.RLock()
+			auditHandler := hc.rpcAuditHandler
+			hc.mux.RUnlock()
+			if auditHandler != nil {
+				auditHandler(tv.ThingID, tv.Name, tv.SenderID, tv.Data, err)
+			}
 			return respData, err
 		}
 		hc.SetRPCHandler(multiCapHandler)
@@ -616,6 +976,18 @@ func (hc *HubClient) SubEvents(agentID string, thingID string, eventName string)
 	return err
 }
 
+// SubNotifications subscribes to notifications sent to this client's inbox
+// using PubNotification. Notifications are passed to the event handler.
+//
+//	thingID is the ID of the Thing the notification is about, or "" for any Things.
+//	name is the name of the notification, or "" for any notification
+func (hc *HubClient) SubNotifications(thingID string, name string) error {
+	subAddr := hc.MakeAddress(
+		transport.MessageTypeINBOX, hc.clientID, thingID, name, "")
+	err := hc.transport.Subscribe(subAddr)
+	return err
+}
+
 // NewHubClientFromTransport returns a new Hub Client instance for the given transport.
 //
 //   - message bus transport to use, eg NatsTransport or MqttTransport instance
@@ -625,8 +997,13 @@ func NewHubClientFromTransport(transport transport.IHubTransport, clientID strin
 		clientID:  clientID,
 		transport: transport,
 		capTable:  make(map[string]map[string]interface{}),
+		rpcRequests: metrics.NewCounter("hiveot_rpc_requests",
+			"RPC requests handled by the service", "capability", "method", "result"),
+		rpcDuration: metrics.NewHistogram("hiveot_rpc_duration_seconds",
+			"Duration of handling RPC requests", nil, "capability", "method"),
 	}
 	hc.retryConnect.Store(true)
+	hc.tokenRefresh.Store(true)
 	transport.SetConnectHandler(hc.onConnect)
 	return &hc
 }
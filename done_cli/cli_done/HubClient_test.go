@@ -0,0 +1,169 @@
+package clidone
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	"github.com/hiveot/hub/done_tool/keys"
+	"github.com/hiveot/hub/done_tool/ser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenValidity is the short validity of the tokens issued by the fake transport
+const tokenValidity = 200 * time.Millisecond
+
+// newToken returns a fake token that holds its expiry time
+func newToken() string {
+	return strconv.FormatInt(time.Now().Add(tokenValidity).UnixMilli(), 10)
+}
+
+// fakeTransport issues short-lived tokens and counts the reconnects with a refreshed token
+type fakeTransport struct {
+	connected  atomic.Bool
+	reconnects atomic.Int32
+	// refreshGate, if set, blocks token refresh requests until it is closed
+	refreshGate chan struct{}
+	// refreshStarted receives a value when a token refresh request is received
+	refreshStarted chan struct{}
+	mux            sync.Mutex
+}
+
+func (tp *fakeTransport) AddressTokens() (sep, wc, rem string) { return ".", "*", ">" }
+func (tp *fakeTransport) ConnectWithPassword(password string) error {
+	tp.connected.Store(true)
+	return nil
+}
+func (tp *fakeTransport) ConnectWithToken(kp keys.IHiveKey, token string) error {
+	tp.connected.Store(true)
+	return nil
+}
+func (tp *fakeTransport) CreateKeyPair() keys.IHiveKey { return keys.NewNkeysKey() }
+func (tp *fakeTransport) Disconnect()                  { tp.connected.Store(false) }
+func (tp *fakeTransport) GetStatus() transport.HubTransportStatus {
+	return transport.HubTransportStatus{}
+}
+func (tp *fakeTransport) GetTokenExpiry(token string) (time.Time, error) {
+	expiryMSE, err := strconv.ParseInt(token, 10, 64)
+	return time.UnixMilli(expiryMSE), err
+}
+func (tp *fakeTransport) PubEvent(address string, payload []byte) error { return nil }
+
+// PubRequest answers token refresh requests with a new token
+func (tp *fakeTransport) PubRequest(address string, payload []byte) ([]byte, error) {
+	tp.mux.Lock()
+	gate, started := tp.refreshGate, tp.refreshStarted
+	tp.mux.Unlock()
+	if started != nil {
+		started <- struct{}{}
+	}
+	if gate != nil {
+		<-gate
+	}
+	return ser.Marshal(authapi.RefreshTokenResp{Token: newToken()})
+}
+func (tp *fakeTransport) ReconnectWithToken(kp keys.IHiveKey, token string) error {
+	tp.connected.Store(true)
+	tp.reconnects.Add(1)
+	return nil
+}
+func (tp *fakeTransport) SetConnectHandler(cb func(status transport.HubTransportStatus)) {}
+func (tp *fakeTransport) SetEventHandler(cb func(addr string, payload []byte))           {}
+func (tp *fakeTransport) SetRequestHandler(
+	cb func(addr string, payload []byte) (reply []byte, err error, donotreply bool)) {
+}
+func (tp *fakeTransport) Subscribe(address string) error { return nil }
+func (tp *fakeTransport) Unsubscribe(address string)     {}
+
+// The token is refreshed before it expires until the client disconnects
+func TestTokenRefresh(t *testing.T) {
+	tp := &fakeTransport{}
+	hc := NewHubClientFromTransport(tp, "client1")
+	err := hc.ConnectWithToken(tp.CreateKeyPair(), newToken())
+	require.NoError(t, err)
+
+	time.Sleep(tokenValidity * 3)
+	assert.GreaterOrEqual(t, tp.reconnects.Load(), int32(2))
+
+	hc.Disconnect()
+	reconnects := tp.reconnects.Load()
+	time.Sleep(tokenValidity * 2)
+	// a refresh in progress can reconnect once but closes the connection again
+	assert.LessOrEqual(t, tp.reconnects.Load(), reconnects+1)
+	assert.False(t, tp.connected.Load())
+}
+
+// A refresh in progress doesn't reconnect or reschedule after the client disconnects
+func TestDisconnectDuringRefresh(t *testing.T) {
+	tp := &fakeTransport{
+		refreshGate:    make(chan struct{}),
+		refreshStarted: make(chan struct{}, 1),
+	}
+	hc := NewHubClientFromTransport(tp, "client1")
+	err := hc.ConnectWithToken(tp.CreateKeyPair(), newToken())
+	require.NoError(t, err)
+
+	select {
+	case <-tp.refreshStarted:
+	case <-time.After(tokenValidity * 2):
+		t.Fatal("token refresh didn't start")
+	}
+	hc.Disconnect()
+	close(tp.refreshGate)
+	time.Sleep(tokenValidity * 2)
+
+	// the connection made with the refreshed token is closed again
+	assert.False(t, tp.connected.Load())
+	assert.LessOrEqual(t, tp.reconnects.Load(), int32(1))
+	hc.mux.RLock()
+	assert.Nil(t, hc.refreshTimer)
+	hc.mux.RUnlock()
+}
+
+// Files are replaced together or not at all
+func TestReplaceFiles(t *testing.T) {
+	testDir := t.TempDir()
+	keyFile := path.Join(testDir, "client1.key")
+	pubFile := path.Join(testDir, "client1.pub")
+	err := os.WriteFile(keyFile, []byte("oldkey"), 0400)
+	require.NoError(t, err)
+
+	err = replaceFiles(
+		replacedFile{path: keyFile, data: "newkey", perm: 0400},
+		replacedFile{path: pubFile, data: "newpub", perm: 0644})
+	require.NoError(t, err)
+	data, _ := os.ReadFile(keyFile)
+	assert.Equal(t, "newkey", string(data))
+	data, _ = os.ReadFile(pubFile)
+	assert.Equal(t, "newpub", string(data))
+
+	// the key is restored when replacing the pub file fails after the key was replaced
+	renameFile = func(oldPath, newPath string) error {
+		if newPath == pubFile {
+			return os.ErrPermission
+		}
+		return os.Rename(oldPath, newPath)
+	}
+	defer func() { renameFile = os.Rename }()
+	err = replaceFiles(
+		replacedFile{path: keyFile, data: "otherkey", perm: 0400},
+		replacedFile{path: pubFile, data: "otherpub", perm: 0644})
+	assert.Error(t, err)
+	data, _ = os.ReadFile(keyFile)
+	assert.Equal(t, "newkey", string(data))
+	data, _ = os.ReadFile(pubFile)
+	assert.Equal(t, "newpub", string(data))
+	info, err := os.Stat(keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0400), info.Mode().Perm())
+	// no temporary files are left behind
+	entries, _ := os.ReadDir(testDir)
+	assert.Len(t, entries, 2)
+}
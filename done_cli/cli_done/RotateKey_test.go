@@ -0,0 +1,74 @@
+package clidone_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	authcli "github.com/hiveot/hub/done_mod/mod_auth/auth_cli"
+	"github.com/hiveot/hub/done_tool/keys"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The rotated key is registered and saved, and the old key is no longer accepted
+func TestRotateKey(t *testing.T) {
+	const userID = "user1"
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+	oldKP, oldToken, err := ts.AddClient(authapi.ClientTypeUser, userID, authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	keysDir := t.TempDir()
+	keyFile := path.Join(keysDir, userID+clidone.KPFileExt)
+	pubFile := path.Join(keysDir, userID+clidone.PubKeyFileExt)
+	tokenFile := path.Join(keysDir, userID+clidone.TokenFileExt)
+	err = oldKP.ExportPrivateToFile(keyFile)
+	require.NoError(t, err)
+	err = os.WriteFile(tokenFile, []byte(oldToken), 0400)
+	require.NoError(t, err)
+
+	hc := clidone.NewHubClient(ts.ServerURL, userID, ts.CaCert)
+	err = hc.ConnectWithTokenFile(keysDir)
+	require.NoError(t, err)
+	defer hc.Disconnect()
+	err = hc.RotateKey(keysDir)
+	require.NoError(t, err)
+
+	// the key and token files are replaced and the new public key is registered
+	newKP, err := keys.NewKeyFromFile(keyFile)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldKP.ExportPublic(), newKP.ExportPublic())
+	pubKey, err := os.ReadFile(pubFile)
+	require.NoError(t, err)
+	assert.Equal(t, newKP.ExportPublic(), string(pubKey))
+	newToken, err := os.ReadFile(tokenFile)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldToken, string(newToken))
+	assert.Equal(t, string(newToken), hc.GetStatus().Token)
+	ctx := clidone.ServiceContext{SenderID: authapi.DefaultAdminUserID}
+	resp, err := ts.AuthService.MngClients.GetClientProfile(ctx,
+		authapi.GetClientProfileArgs{ClientID: userID})
+	require.NoError(t, err)
+	assert.Equal(t, newKP.ExportPublic(), resp.Profile.PubKey)
+
+	// the client continues on its new connection
+	profile, err := authcli.NewProfileClient(hc).GetProfile()
+	require.NoError(t, err)
+	assert.Equal(t, userID, profile.ClientID)
+
+	// only the new key is accepted
+	hc2 := clidone.NewHubClient(ts.ServerURL, userID, ts.CaCert)
+	err = hc2.ConnectWithToken(oldKP, oldToken)
+	assert.Error(t, err)
+	hc2.Disconnect()
+	hc3 := clidone.NewHubClient(ts.ServerURL, userID, ts.CaCert)
+	err = hc3.ConnectWithTokenFile(keysDir)
+	assert.NoError(t, err)
+	hc3.Disconnect()
+}
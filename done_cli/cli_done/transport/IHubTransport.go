@@ -3,6 +3,7 @@ package transport
 import (
 	"crypto/x509"
 	"errors"
+	"time"
 
 	"github.com/hiveot/hub/done_tool/keys"
 )
@@ -50,6 +51,9 @@ type HubTransportStatus struct {
 	ClientID         string
 	ConnectionStatus ConnectionStatus
 	LastError        error
+	// Token is the authentication token of the connection, if any.
+	// This changes when the token is refreshed.
+	Token string
 }
 
 // IHubTransport defines the interface of the transport that connects to the messaging server.
@@ -84,6 +88,10 @@ type IHubTransport interface {
 	// GetStatus returns the current transport connection status
 	GetStatus() HubTransportStatus
 
+	// GetTokenExpiry returns the expiry time of an authentication token.
+	// This returns a zero time if the token doesn't expire.
+	GetTokenExpiry(token string) (expiry time.Time, err error)
+
 	// PubEvent publishes an event style message without waiting for a response.
 	//	address to publish on
 	//	payload with serialized message to publish
@@ -95,6 +103,14 @@ type IHubTransport interface {
 	//  returns a reply with serialized response message
 	PubRequest(address string, payload []byte) (reply []byte, err error)
 
+	// ReconnectWithToken replaces the key and authentication token of the connection.
+	// If the server only accepts the token when connecting, the connection is
+	// re-established and subscriptions are restored.
+	// This requires a prior connection with ConnectWithToken.
+	//  kp is the client's key pair, which changes when the key is rotated
+	//  token is the refreshed token
+	ReconnectWithToken(kp keys.IHiveKey, token string) error
+
 	// SetConnectHandler sets the notification handler of connection status changes
 	SetConnectHandler(cb func(status HubTransportStatus))
 
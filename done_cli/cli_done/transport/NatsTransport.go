@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hiveot/hub/done_tool/keys"
@@ -37,7 +39,16 @@ type NatsTransport struct {
 	// TLS configuration to use in connecting
 	tlsConfig *tls.Config
 	timeout   time.Duration
-	status    HubTransportStatus
+	// status of the connection, protected by mux
+	status HubTransportStatus
+	// key used to connect with a token, for reconnecting with a refreshed token
+	kp nkeys.KeyPair
+	// subscribed subjects, restored after reconnecting with a refreshed token
+	subjects []string
+	// stream subscriptions, which can't be restored after reconnecting
+	streamSubs []*nats.Subscription
+	// mux protects the connection, status and subscriptions
+	mux sync.RWMutex
 
 	connectHandler func(status HubTransportStatus)
 	eventHandler   func(addr string, payload []byte)
@@ -66,11 +77,20 @@ func (nt *NatsTransport) ConnectWithConn(nconn *nats.Conn) (err error) {
 	}
 	nconn.SetDisconnectErrHandler(nt.onDisconnect)
 	nconn.SetReconnectHandler(nt.onConnected)
+	nt.mux.Lock()
 	nt.nc = nconn
 	nt.js, err = nconn.JetStream()
+	nt.mux.Unlock()
 	return err
 }
 
+// conn returns the current server connection
+func (nt *NatsTransport) conn() *nats.Conn {
+	nt.mux.RLock()
+	defer nt.mux.RUnlock()
+	return nt.nc
+}
+
 // ConnectWithJWT connects to the Hub server using a NATS user JWT credentials secret
 // The connection uses the client ID in the JWT token.
 //
@@ -86,7 +106,7 @@ func (nt *NatsTransport) ConnectWithJWT(myKey nkeys.KeyPair, jwtToken string) (e
 	//}
 	//clientID := claims.Claims().Name
 	jwtSeed, _ := myKey.Seed()
-	nt.nc, err = nats.Connect(nt.serverURL,
+	nc, err := nats.Connect(nt.serverURL,
 		nats.ConnectHandler(nt.onConnected),
 		nats.DisconnectErrHandler(nt.onDisconnect),
 		nats.ReconnectHandler(nt.onConnected),
@@ -97,7 +117,12 @@ func (nt *NatsTransport) ConnectWithJWT(myKey nkeys.KeyPair, jwtToken string) (e
 		nats.Token(jwtToken), // JWT token isn't passed through in callout
 		nats.Timeout(time.Second*time.Duration(DefaultTimeoutSec)))
 	if err == nil {
-		nt.js, err = nt.nc.JetStream()
+		nt.mux.Lock()
+		nt.nc = nc
+		nt.kp = myKey
+		nt.status.Token = jwtToken
+		nt.js, err = nc.JetStream()
+		nt.mux.Unlock()
 	}
 	return err
 }
@@ -116,7 +141,7 @@ func (nt *NatsTransport) ConnectWithKey(myKey nkeys.KeyPair) error {
 		return myKey.Sign(nonce)
 	}
 	pubKey, _ := myKey.PublicKey()
-	nt.nc, err = nats.Connect(nt.serverURL,
+	nc, err := nats.Connect(nt.serverURL,
 		nats.ConnectHandler(nt.onConnected),
 		nats.DisconnectErrHandler(nt.onDisconnect),
 		nats.ReconnectHandler(nt.onConnected),
@@ -128,7 +153,11 @@ func (nt *NatsTransport) ConnectWithKey(myKey nkeys.KeyPair) error {
 		nats.Timeout(time.Second*time.Duration(DefaultTimeoutSec)))
 
 	if err == nil {
-		nt.js, err = nt.nc.JetStream()
+		nt.mux.Lock()
+		nt.nc = nc
+		nt.kp = myKey
+		nt.js, err = nc.JetStream()
+		nt.mux.Unlock()
 	}
 	return err
 }
@@ -136,7 +165,7 @@ func (nt *NatsTransport) ConnectWithKey(myKey nkeys.KeyPair) error {
 // ConnectWithPassword connects to the Hub server using a login ID and password.
 func (nt *NatsTransport) ConnectWithPassword(password string) (err error) {
 
-	nt.nc, err = nats.Connect(nt.serverURL,
+	nc, err := nats.Connect(nt.serverURL,
 		nats.ConnectHandler(nt.onConnected),
 		nats.DisconnectErrHandler(nt.onDisconnect),
 		nats.ReconnectHandler(nt.onConnected),
@@ -147,9 +176,12 @@ func (nt *NatsTransport) ConnectWithPassword(password string) (err error) {
 		nats.CustomInboxPrefix(MessageTypeINBOX+"."+nt.clientID),
 		nats.Timeout(time.Second*time.Duration(DefaultTimeoutSec)))
 	if err == nil {
-		nt.js, err = nt.nc.JetStream()
-	} else {
-
+		nt.mux.Lock()
+		nt.nc = nc
+		// a password connection can't be reconnected with a token
+		nt.kp = nil
+		nt.js, err = nc.JetStream()
+		nt.mux.Unlock()
 	}
 	return err
 }
@@ -184,37 +216,60 @@ func (nt *NatsTransport) CreateKeyPair() (kp keys.IHiveKey) {
 
 // Disconnect from the Hub server and release all subscriptions
 func (nt *NatsTransport) Disconnect() {
-	nt.nc.Close()
+	nt.conn().Close()
 }
 
 // GetStatus Return the transport connection info
 func (nt *NatsTransport) GetStatus() HubTransportStatus {
+	nt.mux.RLock()
+	defer nt.mux.RUnlock()
 	return nt.status
 }
 
+// GetTokenExpiry returns the expiry time of a JWT token.
+// Tokens that aren't a JWT, eg the public key used in nkey mode, don't expire.
+func (nt *NatsTransport) GetTokenExpiry(token string) (expiry time.Time, err error) {
+	claims, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		return expiry, nil
+	}
+	if claims.Expires > 0 {
+		expiry = time.Unix(claims.Expires, 0)
+	}
+	return expiry, nil
+}
+
 // JS Returns the JetStream client (nats specific)
 func (nt *NatsTransport) JS() nats.JetStreamContext {
+	nt.mux.RLock()
+	defer nt.mux.RUnlock()
 	return nt.js
 }
 
 // handle connected to the server
 func (nt *NatsTransport) onConnected(c *nats.Conn) {
+	nt.mux.Lock()
 	nt.status.ConnectionStatus = Connected
 	nt.status.LastError = nil
-	nt.connectHandler(nt.status)
+	status := nt.status
+	nt.mux.Unlock()
+	nt.connectHandler(status)
 }
 
 // handle disconnect from the server
 func (nt *NatsTransport) onDisconnect(c *nats.Conn, err error) {
 	// FIXME: how to differentiate between intentional and unintended disconnect?
 	// Is it important?
+	nt.mux.Lock()
 	nt.status.ConnectionStatus = Disconnected
 	if err != nil {
 		nt.status.LastError = err
 	} else {
 		nt.status.LastError = nil
 	}
-	nt.connectHandler(nt.status)
+	status := nt.status
+	nt.mux.Unlock()
+	nt.connectHandler(status)
 }
 
 // onMessage handles incoming request and event messages
@@ -283,7 +338,7 @@ func (nt *NatsTransport) ParseResponse(data []byte, resp interface{}) error {
 // PubEvent publishes a message and returns
 func (nt *NatsTransport) PubEvent(subject string, payload []byte) error {
 	slog.Debug("PubEvent", "subject", subject)
-	err := nt.nc.Publish(subject, payload)
+	err := nt.conn().Publish(subject, payload)
 	return err
 }
 
@@ -291,7 +346,7 @@ func (nt *NatsTransport) PubEvent(subject string, payload []byte) error {
 func (nt *NatsTransport) PubRequest(
 	subject string, payload []byte) (data []byte, err error) {
 
-	resp, err := nt.nc.Request(subject, payload, nt.timeout)
+	resp, err := nt.conn().Request(subject, payload, nt.timeout)
 	if err != nil {
 		return nil, err
 	}
@@ -305,6 +360,68 @@ func (nt *NatsTransport) PubRequest(
 	return resp.Data, err
 }
 
+// ReconnectWithToken connects to the server with a refreshed token and closes the old
+// connection. The NATS server only accepts a token when connecting and closes the
+// connection when its token expires, so a new connection is needed.
+// Subscriptions are restored on the new connection before the old one is closed.
+// As with ConnectWithToken, a token that isn't a JWT results in a connection with nkey.
+//
+// The consumers of stream subscriptions belong to the old connection and can't be
+// restored, so this returns an error while SubStream subscriptions are active.
+func (nt *NatsTransport) ReconnectWithToken(keyPair keys.IHiveKey, token string) error {
+	myKey, isNKey := keyPair.PrivateKey().(nkeys.KeyPair)
+	nt.mux.RLock()
+	oldConn := nt.nc
+	connectedWithToken := nt.kp != nil
+	subjects := append([]string{}, nt.subjects...)
+	hasStreamSubs := false
+	for _, nsub := range nt.streamSubs {
+		hasStreamSubs = hasStreamSubs || nsub.IsValid()
+	}
+	nt.mux.RUnlock()
+	if !isNKey {
+		return fmt.Errorf("ReconnectWithToken: client '%s' key isn't an nkey", nt.clientID)
+	} else if oldConn == nil || !connectedWithToken {
+		return fmt.Errorf("ReconnectWithToken: client '%s' isn't connected with a token", nt.clientID)
+	} else if hasStreamSubs {
+		return fmt.Errorf("ReconnectWithToken: client '%s' has stream subscriptions", nt.clientID)
+	}
+	slog.Info("ReconnectWithToken", slog.String("clientID", nt.clientID))
+	// the old connection is replaced, so it must not report its disconnect
+	oldConn.SetDisconnectErrHandler(nil)
+	oldConn.SetReconnectHandler(nil)
+	_, err := jwt.Decode(token)
+	if err != nil {
+		err = nt.ConnectWithKey(myKey)
+	} else {
+		err = nt.ConnectWithJWT(myKey, token)
+	}
+	if err != nil {
+		oldConn.SetDisconnectErrHandler(nt.onDisconnect)
+		oldConn.SetReconnectHandler(nt.onConnected)
+		return fmt.Errorf("ReconnectWithToken: %w", err)
+	}
+	// the nkey connection doesn't use the token but the status reports the latest token
+	nt.mux.Lock()
+	nt.status.Token = token
+	newConn := nt.nc
+	nt.mux.Unlock()
+	for _, subject := range subjects {
+		_, err = newConn.Subscribe(subject, nt.onMessage)
+		if err != nil {
+			slog.Error("ReconnectWithToken: failed restoring subscription",
+				slog.String("subject", subject), slog.String("err", err.Error()))
+		}
+	}
+	// make sure the server has the subscriptions before the old connection is closed
+	err = newConn.Flush()
+	if err != nil {
+		slog.Warn("ReconnectWithToken: flush failed", slog.String("err", err.Error()))
+	}
+	oldConn.Close()
+	return nil
+}
+
 // startEventMessageHandler listens for incoming event messages from a stream
 // and invoke a callback handler.
 // this returns when the subscription is no longer valid
@@ -386,12 +503,17 @@ func (nt *NatsTransport) SetRequestHandler(
 // Incoming messages are passed to the event or request handler, depending on whether
 // a reply-to address and correlation-ID is set.
 func (nt *NatsTransport) Subscribe(subject string) (err error) {
-	nsub, err := nt.nc.Subscribe(subject, nt.onMessage)
+	nsub, err := nt.conn().Subscribe(subject, nt.onMessage)
 	isValid := nsub.IsValid()
 	if err != nil || !isValid {
 		err = fmt.Errorf("subscribe to '%s' failed: %w", subject, err)
 	} else {
-		// subscribe successful
+		// subscribe successful. Subjects are restored once after reconnecting.
+		nt.mux.Lock()
+		if !slices.Contains(nt.subjects, subject) {
+			nt.subjects = append(nt.subjects, subject)
+		}
+		nt.mux.Unlock()
 	}
 	return err
 }
@@ -488,6 +610,12 @@ func (nt *NatsTransport) SubStream(name string, receiveLatest bool, cb func(msg
 		return nil, fmt.Errorf("error to PullSubscribe to stream %s: %w", name, err)
 	}
 
+	nt.mux.Lock()
+	nt.streamSubs = slices.DeleteFunc(nt.streamSubs, func(s *nats.Subscription) bool {
+		return !s.IsValid()
+	})
+	nt.streamSubs = append(nt.streamSubs, nsub)
+	nt.mux.Unlock()
 	err = startEventMessageHandler(nsub, cb)
 	return nsub, err
 }
@@ -495,7 +623,7 @@ func (nt *NatsTransport) SubStream(name string, receiveLatest bool, cb func(msg
 // NewNatsTransport creates a new instance of the hub client for use
 // with the NATS messaging server
 //
-//	url starts with "nats://" schema for using tcp.
+//	url starts with "nats://" or "tls://" schema for using tcp, or "wss://" for websockets.
 //	clientID to connect as
 //	keyPair is the serialized keypair or use "" to create a new set.
 //	caCert of the server to validate the server or nil to not check the server cert
@@ -0,0 +1,138 @@
+package transport_test
+
+import (
+	"testing"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPassword = "password123"
+
+// Clients connect with a password and report their connection status
+func TestConnectWithPassword(t *testing.T) {
+	const userID = "user1"
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+	ctx := clidone.ServiceContext{SenderID: authapi.DefaultAdminUserID}
+	_, err = ts.AuthService.MngClients.AddUser(ctx, authapi.AddUserArgs{
+		UserID: userID, DisplayName: userID, Password: testPassword, Role: authapi.ClientRoleViewer})
+	require.NoError(t, err)
+
+	tp := transport.NewNatsTransport(ts.ServerURL, userID, ts.CaCert)
+	statusChan := make(chan transport.HubTransportStatus, 2)
+	tp.SetConnectHandler(func(status transport.HubTransportStatus) {
+		statusChan <- status
+	})
+	err = tp.ConnectWithPassword(testPassword)
+	require.NoError(t, err)
+	select {
+	case status := <-statusChan:
+		assert.Equal(t, transport.Connected, status.ConnectionStatus)
+	case <-time.After(time.Second):
+		t.Fatal("no connected status received")
+	}
+	assert.Equal(t, transport.Connected, tp.GetStatus().ConnectionStatus)
+	// a password connection can't be replaced with a token connection
+	err = tp.ReconnectWithToken(tp.CreateKeyPair(), "")
+	assert.Error(t, err)
+	tp.Disconnect()
+
+	tp2 := transport.NewNatsTransport(ts.ServerURL, userID, ts.CaCert)
+	tp2.SetConnectHandler(func(status transport.HubTransportStatus) {})
+	err = tp2.ConnectWithPassword("wrongpassword")
+	assert.Error(t, err)
+}
+
+// Subscriptions remain after reconnecting with a refreshed token
+func TestReconnectWithToken(t *testing.T) {
+	const deviceID = "device1"
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+	user, err := ts.AddConnectUser("user1", authapi.ClientRoleOperator)
+	require.NoError(t, err)
+	defer user.Disconnect()
+	kp, token, err := ts.AddClient(authapi.ClientTypeDevice, deviceID, authapi.ClientRoleDevice)
+	require.NoError(t, err)
+
+	tp := transport.NewNatsTransport(ts.ServerURL, deviceID, ts.CaCert)
+	tp.SetConnectHandler(func(status transport.HubTransportStatus) {})
+	tp.SetRequestHandler(func(addr string, payload []byte) ([]byte, error, bool) {
+		return payload, nil, false
+	})
+	err = tp.ConnectWithToken(kp, token)
+	require.NoError(t, err)
+	defer tp.Disconnect()
+	// devices receive the actions addressed to them
+	err = tp.Subscribe(transport.MakeSubject(transport.MessageTypeAction, deviceID, "", "", ""))
+	require.NoError(t, err)
+
+	err = tp.ReconnectWithToken(kp, token)
+	require.NoError(t, err)
+	assert.Equal(t, transport.Connected, tp.GetStatus().ConnectionStatus)
+	reply, err := user.PubAction(deviceID, "thing1", "action1", []byte("1"))
+	require.NoError(t, err, "subscription was not restored")
+	assert.Equal(t, "1", string(reply))
+}
+
+// Subscribed events are still received once after reconnecting with a refreshed token
+func TestEventsAfterRefresh(t *testing.T) {
+	const userID = "user1"
+	const deviceID = "device1"
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+	device, err := ts.AddConnectDevice(deviceID)
+	require.NoError(t, err)
+	defer device.Disconnect()
+	kp, token, err := ts.AddClient(authapi.ClientTypeUser, userID, authapi.ClientRoleViewer)
+	require.NoError(t, err)
+
+	tp := transport.NewNatsTransport(ts.ServerURL, userID, ts.CaCert)
+	tp.SetConnectHandler(func(status transport.HubTransportStatus) {})
+	eventChan := make(chan string, 10)
+	tp.SetEventHandler(func(addr string, payload []byte) {
+		eventChan <- string(payload)
+	})
+	err = tp.ConnectWithToken(kp, token)
+	require.NoError(t, err)
+	defer tp.Disconnect()
+	// subscribing twice to the same subject is restored as a single subscription
+	subject := transport.MakeSubject(transport.MessageTypeEvent, deviceID, "", "", "")
+	err = tp.Subscribe(subject)
+	require.NoError(t, err)
+	err = tp.Subscribe(subject)
+	require.NoError(t, err)
+
+	ctx := clidone.ServiceContext{SenderID: userID}
+	resp, err := ts.AuthService.MngProfile.RefreshToken(ctx)
+	require.NoError(t, err)
+	err = tp.ReconnectWithToken(kp, resp.Token)
+	require.NoError(t, err)
+	assert.Equal(t, resp.Token, tp.GetStatus().Token)
+
+	err = device.PubEvent("thing1", "event1", []byte("1"))
+	require.NoError(t, err)
+	select {
+	case payload := <-eventChan:
+		assert.Equal(t, "1", payload)
+	case <-time.After(time.Second):
+		t.Fatal("event not received after refresh")
+	}
+	select {
+	case <-eventChan:
+		t.Fatal("event received more than once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -15,13 +15,16 @@ export async function locateHub(): Promise<{ hubURL: string, core: string }> {
                 reject("service not found");
                 return;
             }
-            // from nodejs, only websockets can be used for the capnp connection
+            // from nodejs, only websockets can be used for the nats connection
             let addr = service.addresses[0];
             let kv = service.txt;
             let core = kv["core"];
+            let wssURL = kv["wssurl"];
             let wssPort = kv["wss"];
-            let wssPath = kv["path"];
-            if (wssPort) {
+            let wssPath = kv["path"] || "";
+            if (wssURL) {
+                addr = wssURL;
+            } else if (wssPort) {
                 addr = "wss://" + addr + ":" + wssPort + wssPath;
             } else {
                 addr = kv["rawurl"]
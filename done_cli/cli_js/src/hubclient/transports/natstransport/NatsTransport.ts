@@ -9,7 +9,7 @@ const log = new tslog.Logger()
 
 
 export class NatsTransport implements IHubTransport {
-    // expect nats://addr:port/ 
+    // nats.ws only supports websockets: expect wss://addr:port/
     fullURL: string
     clientID: string
     caCertPem: string
@@ -26,6 +26,10 @@ export class NatsTransport implements IHubTransport {
     constructor(
         fullURL: string, clientID: string, caCertPem: string) {
 
+        if (!fullURL.startsWith("wss://") && !fullURL.startsWith("ws://")) {
+            log.warn("NatsTransport: websocket URL expected, got: " + fullURL +
+                ". Enable the hub's wsPort and use its wss:// address.")
+        }
         this.fullURL = fullURL
         this.clientID = clientID
         this.caCertPem = caCertPem
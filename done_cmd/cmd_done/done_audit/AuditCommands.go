@@ -0,0 +1,79 @@
+package doneaudit
+
+import (
+	"fmt"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	auditapi "github.com/hiveot/hub/done_mod/mod_audit/audit_api"
+	auditcli "github.com/hiveot/hub/done_mod/mod_audit/audit_cli"
+	"github.com/hiveot/hub/done_tool/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// AuditListCommand lists the audit log
+func AuditListCommand(hc **clidone.HubClient) *cli.Command {
+	args := auditapi.QueryArgs{Limit: auditapi.DefaultQueryLimit}
+	return &cli.Command{
+		Name:     "audit",
+		Usage:    "List the audit log of state-changing requests, newest first",
+		Category: "audit",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:        "limit",
+				Usage:       "Nr of records to show",
+				Value:       args.Limit,
+				Destination: &args.Limit,
+			},
+			&cli.StringFlag{
+				Name:        "sender",
+				Usage:       "Only show requests from this client",
+				Destination: &args.SenderID,
+			},
+			&cli.StringFlag{
+				Name:        "service",
+				Usage:       "Only show requests handled by this service",
+				Destination: &args.ServiceID,
+			},
+			&cli.StringFlag{
+				Name:        "method",
+				Usage:       "Only show requests with this method",
+				Destination: &args.Method,
+			},
+		},
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() > 0 {
+				return fmt.Errorf("too many arguments")
+			}
+			err := HandleListAudit(*hc, args)
+			return err
+		},
+	}
+}
+
+// HandleListAudit shows the audit records that match the query
+func HandleListAudit(hc *clidone.HubClient, args auditapi.QueryArgs) error {
+	auditCl := auditcli.NewAuditClient(hc)
+	records, err := auditCl.Query(args)
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+		return err
+	}
+
+	fmt.Println("Time                  Service      Sender               Method               Result   Arguments")
+	fmt.Println("----                  -------      ------               ------               ------   ---------")
+	for _, rec := range records {
+		result := "ok"
+		if rec.Error != "" {
+			result = "error: " + rec.Error
+		}
+		fmt.Printf("%-21s %-12s %-20s %-20s %-8s %s\n",
+			utils.FormatMSE(rec.TimestampMSE, false),
+			rec.ServiceID,
+			rec.SenderID,
+			rec.Method,
+			result,
+			rec.Args,
+		)
+	}
+	return nil
+}
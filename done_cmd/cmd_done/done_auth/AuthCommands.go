@@ -89,6 +89,80 @@ func AuthAddServiceCommand(hc **clidone.HubClient, certsDir *string) *cli.Comman
 	}
 }
 
+// AuthClearLockoutCommand clears the failed login attempts of an account or address
+func AuthClearLockoutCommand(hc **clidone.HubClient) *cli.Command {
+	return &cli.Command{
+		Name:      "unlock",
+		Usage:     "Clear the failed logins and lockout of an account or remote address",
+		ArgsUsage: "<loginID|address>",
+		Category:  "auth",
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 1 {
+				err := fmt.Errorf("expected 1 argument")
+				return err
+			}
+			id := cCtx.Args().Get(0)
+			err := HandleClearLockout(*hc, id)
+			return err
+		},
+	}
+}
+
+// AuthListLockoutsCommand lists accounts and addresses with failed logins
+func AuthListLockoutsCommand(hc **clidone.HubClient) *cli.Command {
+	return &cli.Command{
+		Name:     "lockouts",
+		Usage:    "List accounts and remote addresses with failed logins",
+		Category: "auth",
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() > 0 {
+				err := fmt.Errorf("too many arguments")
+				return err
+			}
+			err := HandleListLockouts(*hc)
+			return err
+		},
+	}
+}
+
+// AuthListTokensCommand lists the issued tokens
+func AuthListTokensCommand(hc **clidone.HubClient) *cli.Command {
+	return &cli.Command{
+		Name:      "tokens",
+		Usage:     "List the unexpired tokens issued to a client or all clients",
+		ArgsUsage: "[<clientID>]",
+		Category:  "auth",
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() > 1 {
+				err := fmt.Errorf("too many arguments")
+				return err
+			}
+			clientID := cCtx.Args().First()
+			err := HandleListTokens(*hc, clientID)
+			return err
+		},
+	}
+}
+
+// AuthRevokeTokenCommand revokes an issued token
+func AuthRevokeTokenCommand(hc **clidone.HubClient) *cli.Command {
+	return &cli.Command{
+		Name:      "revoke",
+		Usage:     "Revoke an issued token. The token is rejected from now on",
+		ArgsUsage: "<tokenID>",
+		Category:  "auth",
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 1 {
+				err := fmt.Errorf("expected 1 argument")
+				return err
+			}
+			tokenID := cCtx.Args().Get(0)
+			err := HandleRevokeToken(*hc, tokenID)
+			return err
+		},
+	}
+}
+
 // AuthListClientsCommand lists user profiles
 func AuthListClientsCommand(hc **clidone.HubClient) *cli.Command {
 	return &cli.Command{
@@ -240,6 +314,82 @@ func HandleAddService(
 	return err
 }
 
+// HandleClearLockout clears the failed logins of an account or remote address
+func HandleClearLockout(hc *clidone.HubClient, id string) (err error) {
+	authn := authcli.NewManageClients(hc)
+	err = authn.ClearLockout(id)
+
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+	} else {
+		fmt.Println("Lockout of " + id + " cleared")
+	}
+	return err
+}
+
+// HandleListLockouts shows a list of accounts and addresses with failed logins
+func HandleListLockouts(hc *clidone.HubClient) (err error) {
+	authn := authcli.NewManageClients(hc)
+	lockouts, err := authn.GetLockouts()
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+		return err
+	}
+
+	fmt.Println("Login ID/Address     Kind       Failures  Last Failure          Locked Until")
+	fmt.Println("----------------     ----       --------  ------------          ------------")
+	for _, lockout := range lockouts {
+		lockedUntil := "-"
+		if lockout.LockedUntilMSE > 0 {
+			lockedUntil = utils.FormatMSE(lockout.LockedUntilMSE, false)
+		}
+		fmt.Printf("%-20s %-10s %8d  %-21s %s\n",
+			lockout.ID,
+			lockout.Kind,
+			lockout.Failures,
+			utils.FormatMSE(lockout.LastFailureMSE, false),
+			lockedUntil,
+		)
+	}
+	return err
+}
+
+// HandleListTokens shows a list of the tokens issued to a client or all clients
+func HandleListTokens(hc *clidone.HubClient, clientID string) (err error) {
+	authn := authcli.NewManageClients(hc)
+	tokens, err := authn.ListTokens(clientID)
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+		return err
+	}
+
+	fmt.Println("Token ID                                               Client ID            Issued                Expires               Revoked")
+	fmt.Println("--------                                               ---------            ------                -------               -------")
+	for _, token := range tokens {
+		fmt.Printf("%-54s %-20s %-21s %-21s %v\n",
+			token.TokenID,
+			token.ClientID,
+			utils.FormatMSE(token.IssuedMSE, false),
+			utils.FormatMSE(token.ExpiryMSE, false),
+			token.Revoked,
+		)
+	}
+	return err
+}
+
+// HandleRevokeToken revokes an issued token
+func HandleRevokeToken(hc *clidone.HubClient, tokenID string) (err error) {
+	authn := authcli.NewManageClients(hc)
+	err = authn.RevokeToken(tokenID)
+
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+	} else {
+		fmt.Println("Token " + tokenID + " revoked")
+	}
+	return err
+}
+
 // HandleListClients shows a list of user profiles
 func HandleListClients(hc *clidone.HubClient) (err error) {
 
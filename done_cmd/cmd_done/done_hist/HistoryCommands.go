@@ -6,7 +6,9 @@ import (
 
 	clidone "github.com/hiveot/hub/done_cli/cli_done"
 	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	dircli "github.com/hiveot/hub/done_mod/mod_dir/dir_cli"
 	histcli "github.com/hiveot/hub/done_mod/mod_hist/hist_cli"
+	"github.com/hiveot/hub/done_tool/things"
 	"github.com/hiveot/hub/done_tool/utils"
 	"github.com/urfave/cli/v2"
 )
@@ -111,6 +113,26 @@ func HistoryLatestCommand(hc **clidone.HubClient) *cli.Command {
 //	return err
 //}
 
+// getTD returns the TD of a thing for formatting its values.
+// This returns an empty TD if the TD is not available.
+func getTD(hc *clidone.HubClient, agentID, thingID string) *things.TD {
+	td := &things.TD{}
+	tv, err := dircli.NewReadDirectoryClient(hc).GetTD(agentID, thingID)
+	if err == nil {
+		_ = json.Unmarshal(tv.Data, td)
+	}
+	return td
+}
+
+// formatValue returns the value with its unit as described in the TD, if available
+func formatValue(td *things.TD, tv *things.ThingValue) string {
+	schema := td.GetValueSchema(tv.Name)
+	if schema == nil {
+		return string(tv.Data)
+	}
+	return schema.FormatValueWithUnit(tv.Data)
+}
+
 // HandleListEvents lists the history content
 func HandleListEvents(hc *clidone.HubClient, agentID, thingID string, name string, limit int) error {
 	rd := histcli.NewReadHistoryClient(hc)
@@ -118,12 +140,13 @@ func HandleListEvents(hc *clidone.HubClient, agentID, thingID string, name strin
 	if err != nil {
 		return err
 	}
+	td := getTD(hc, agentID, thingID)
 	fmt.Println("AgentID        ThingID            Timestamp                      Event                Value (truncated)")
 	fmt.Println("-----------    -------            ---------                      -----                ---------------- ")
 	count := 0
 	for tv, valid, err := cursor.First(); err == nil && valid && count < limit; tv, valid, err = cursor.Next() {
 		count++
-		value := string(tv.Data)
+		value := formatValue(td, tv)
 		// show number of properties
 		if tv.Name == transport.EventNameProps {
 			props := make(map[string]string)
@@ -184,6 +207,7 @@ func HandleListLatestEvents(
 	rd := histcli.NewReadHistoryClient(hc)
 
 	props, err := rd.GetLatest(agentID, thingID, nil)
+	td := getTD(hc, agentID, thingID)
 
 	fmt.Println("Event ID                  AgentID         ThingID              Value                            Created")
 	fmt.Println("--------                  -------         -------              -----                            -------")
@@ -193,7 +217,7 @@ func HandleListLatestEvents(
 			tv.Name,
 			tv.AgentID,
 			tv.ThingID,
-			fmt.Sprintf("%.32s", tv.Data),
+			fmt.Sprintf("%.32s", formatValue(td, tv)),
 			//utime.Format("02 Jan 2006 15:04:05 -0700"),
 			utils.FormatMSE(tv.CreatedMSec, false),
 		)
@@ -14,20 +14,31 @@ import (
 
 // ProvisionPreApproveCommand
 // prov preapprove  <deviceID> <pubKey> [<mac>]
+// prov preapprove --secret <secret> <deviceID> [<pubKey>] [<mac>]
 func ProvisionPreApproveCommand(hc **clidone.HubClient) *cli.Command {
+	secret := ""
+
 	return &cli.Command{
 		Name:      "idppreapprove",
 		Usage:     "Preapprove a device for automated provisioning",
-		ArgsUsage: "<deviceID> <pubKey> [<mac>]",
+		ArgsUsage: "[--secret <secret>] <deviceID> <pubKey> [<mac>]",
 		Category:  "provisioning",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "secret",
+				Usage:       "out-of-band secret of the device. The pubKey is optional when used.",
+				Value:       secret,
+				Destination: &secret,
+			},
+		},
 		Action: func(cCtx *cli.Context) error {
-			if cCtx.NArg() < 2 {
+			if cCtx.NArg() < 2 && !(secret != "" && cCtx.NArg() == 1) {
 				return fmt.Errorf("expected 2 or 3 arguments. Got %d instead", cCtx.NArg())
 			}
 			deviceID := cCtx.Args().First()
 			pubKey := cCtx.Args().Get(1)
 			mac := cCtx.Args().Get(2)
-			err := HandlePreApprove(*hc, deviceID, pubKey, mac)
+			err := HandlePreApprove(*hc, deviceID, pubKey, mac, secret)
 			fmt.Println("preapprved device: ", deviceID)
 			return err
 		},
@@ -69,7 +80,7 @@ func ProvisionRequestCommand(hc **clidone.HubClient) *cli.Command {
 	return &cli.Command{
 		Name:      "idpsubmit",
 		Usage:     "Submit a provisioning request",
-		ArgsUsage: "<deviceID> <pubKey> [<mac>]",
+		ArgsUsage: "[--secret <secret>] <deviceID> <pubKey> [<mac>]",
 		Category:  "provisioning",
 		Action: func(cCtx *cli.Context) error {
 			if cCtx.NArg() < 2 {
@@ -92,13 +103,15 @@ func ProvisionRequestCommand(hc **clidone.HubClient) *cli.Command {
 //
 //	deviceID is the ID of the device to pre-approve
 //	pubKey device's public key
-func HandlePreApprove(hc *clidone.HubClient, deviceID string, pubKey string, mac string) error {
+//	secret is the optional out-of-band secret the device must prove to hold
+func HandlePreApprove(hc *clidone.HubClient, deviceID string, pubKey string, mac string, secret string) error {
 	cl := provcli.NewIdProvManageClient(hc)
 	approvals := []provapi.PreApprovedClient{{
 		ClientID:   deviceID,
 		ClientType: authapi.ClientTypeDevice,
 		MAC:        mac,
 		PubKey:     pubKey,
+		Secret:     secret,
 	}}
 
 	err := cl.PreApproveDevices(approvals)
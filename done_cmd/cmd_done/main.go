@@ -6,6 +6,7 @@ import (
 	"os"
 
 	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	doneaudit "github.com/hiveot/hub/done_cmd/cmd_done/done_audit"
 	doneauth "github.com/hiveot/hub/done_cmd/cmd_done/done_auth"
 	donecert "github.com/hiveot/hub/done_cmd/cmd_done/done_cert"
 	donedir "github.com/hiveot/hub/done_cmd/cmd_done/done_dir"
@@ -120,6 +121,12 @@ func main() {
 			doneauth.AuthListClientsCommand(&hc),
 			doneauth.AuthRemoveClientCommand(&hc),
 			doneauth.AuthSetPasswordCommand(&hc),
+			doneauth.AuthListLockoutsCommand(&hc),
+			doneauth.AuthClearLockoutCommand(&hc),
+			doneauth.AuthListTokensCommand(&hc),
+			doneauth.AuthRevokeTokenCommand(&hc),
+
+			doneaudit.AuditListCommand(&hc),
 
 			donerun.LauncherListCommand(&hc),
 			donerun.LauncherStartCommand(&hc),
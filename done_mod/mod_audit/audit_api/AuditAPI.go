@@ -0,0 +1,67 @@
+package auditapi
+
+// ServiceName is the agent name of the audit service
+const ServiceName = "audit"
+
+// ReadAuditCap is the capability to query the audit log
+const ReadAuditCap = "readAudit"
+
+// RecordAuditCap is the capability to add records to the audit log.
+// Only services can add records.
+const RecordAuditCap = "recordAudit"
+
+// RecordMethod is the request name that services use to add records of the
+// state-changing requests they handled to the audit log.
+// The ServiceID of the records is set to the sender of the request.
+const RecordMethod = "record"
+
+type RecordArgs struct {
+	Records []AuditRecord `json:"records"`
+}
+
+// RedactedValue replaces secrets in the recorded request arguments
+const RedactedValue = "***"
+
+// DefaultQueryLimit is the max nr of records returned by a query if no limit is given
+const DefaultQueryLimit = 100
+
+// AuditRecord describes a request that changed the state of a service
+type AuditRecord struct {
+	// TimestampMSE is the time the request was handled in msec since epoch
+	TimestampMSE int64 `json:"timestampMSE"`
+	// ServiceID is the agent that handled the request.
+	// This is set by the audit service to the sender of the record.
+	ServiceID string `json:"serviceID"`
+	// Capability and Method of the request
+	Capability string `json:"capability"`
+	Method     string `json:"method"`
+	// SenderID is the client that sent the request
+	SenderID string `json:"senderID"`
+	// Args holds the JSON encoded request arguments with secrets redacted
+	Args string `json:"args,omitempty"`
+	// Error holds the error message if the request failed, or "" on success
+	Error string `json:"error,omitempty"`
+}
+
+// QueryMethod is the request name to read records from the audit log.
+// Records are returned newest first.
+// The caller must be an administrator.
+const QueryMethod = "query"
+
+type QueryArgs struct {
+	// Optional, only include records of requests handled by this service
+	ServiceID string `json:"serviceID,omitempty"`
+	// Optional, only include records of requests sent by this client
+	SenderID string `json:"senderID,omitempty"`
+	// Optional, only include records of requests with this method
+	Method string `json:"method,omitempty"`
+	// Optional, only include records at or after this time in msec since epoch
+	StartMSE int64 `json:"startMSE,omitempty"`
+	// Optional, only include records at or before this time in msec since epoch
+	EndMSE int64 `json:"endMSE,omitempty"`
+	// Max nr of records to return. Default is DefaultQueryLimit
+	Limit int `json:"limit,omitempty"`
+}
+type QueryResp struct {
+	Records []AuditRecord `json:"records"`
+}
@@ -0,0 +1,37 @@
+package auditcli
+
+import (
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	auditapi "github.com/hiveot/hub/done_mod/mod_audit/audit_api"
+)
+
+// AuditClient is a marshaller for querying the audit log.
+// The caller must be an administrator.
+type AuditClient struct {
+	// ID of the service that handles the requests
+	agentID string
+	// Audit query capability
+	capID string
+	// Connection to the hub
+	hc *clidone.HubClient
+}
+
+// Query returns the audit records that match the query, newest first
+func (cl *AuditClient) Query(args auditapi.QueryArgs) ([]auditapi.AuditRecord, error) {
+	resp := auditapi.QueryResp{}
+	err := cl.hc.PubRPCRequest(
+		cl.agentID, cl.capID, auditapi.QueryMethod, &args, &resp)
+	return resp.Records, err
+}
+
+// NewAuditClient returns a client to query the audit log
+//
+//	hc is the hub client connection to use.
+func NewAuditClient(hc *clidone.HubClient) *AuditClient {
+	cl := AuditClient{
+		hc:      hc,
+		agentID: auditapi.ServiceName,
+		capID:   auditapi.ReadAuditCap,
+	}
+	return &cl
+}
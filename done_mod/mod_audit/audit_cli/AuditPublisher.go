@@ -0,0 +1,214 @@
+package auditcli
+
+import (
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	auditapi "github.com/hiveot/hub/done_mod/mod_audit/audit_api"
+)
+
+// MaxPendingRecords is the max nr of records that are held while the audit service
+// is unavailable. When exceeded the oldest records are dropped.
+const MaxPendingRecords = 10000
+
+// auditBatchSize is the max nr of records sent in a single request
+const auditBatchSize = 100
+
+// auditRetryInterval is the time between attempts to send records after a failure
+const auditRetryInterval = 5 * time.Second
+
+// secretArgParts are parts of argument names whose values are redacted
+var secretArgParts = []string{"password", "secret", "private"}
+
+// secretArgNames are argument names whose values are redacted
+var secretArgNames = []string{"token"}
+
+// AuditPublisher sends the audit records of a service's requests to the audit service.
+// Records are queued and sent in the background, so requests aren't delayed. While
+// the audit service is unavailable, for example during startup, the records are held
+// and sent when it becomes available.
+type AuditPublisher struct {
+	hc *clidone.HubClient
+	// the capability methods to audit
+	capMethods map[string][]string
+	// records waiting to be sent
+	pending []auditapi.AuditRecord
+	// nr of pending records dropped because the max was exceeded
+	dropped int
+	mux     sync.Mutex
+	// signals the sender that records are pending
+	notifyChan chan struct{}
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+}
+
+// onRequest queues the audit record of a handled request
+func (pub *AuditPublisher) onRequest(capID string, method string, senderID string, args []byte, err error) {
+	methods, found := pub.capMethods[capID]
+	if !found || !slices.Contains(methods, method) {
+		return
+	}
+	rec := auditapi.AuditRecord{
+		TimestampMSE: time.Now().UnixMilli(),
+		ServiceID:    pub.hc.ClientID(),
+		Capability:   capID,
+		Method:       method,
+		SenderID:     senderID,
+		Args:         RedactArgs(args),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	pub.mux.Lock()
+	pub.pending = append(pub.pending, rec)
+	if len(pub.pending) > MaxPendingRecords {
+		dropped := len(pub.pending) - MaxPendingRecords
+		pub.pending = pub.pending[dropped:]
+		pub.dropped += dropped
+		slog.Error("onRequest: audit service unavailable. Dropped audit records",
+			slog.Int("dropped", dropped))
+	}
+	pub.mux.Unlock()
+	select {
+	case pub.notifyChan <- struct{}{}:
+	default:
+	}
+}
+
+// send sends the pending records to the audit service in batches.
+// This returns false if sending failed, in which case the records remain pending.
+func (pub *AuditPublisher) send() bool {
+	for {
+		pub.mux.Lock()
+		n := min(len(pub.pending), auditBatchSize)
+		batch := slices.Clone(pub.pending[:n])
+		droppedBefore := pub.dropped
+		pub.mux.Unlock()
+		if n == 0 {
+			return true
+		}
+		args := auditapi.RecordArgs{Records: batch}
+		err := pub.hc.PubRPCRequest(
+			auditapi.ServiceName, auditapi.RecordAuditCap, auditapi.RecordMethod, &args, nil)
+		if err != nil {
+			slog.Warn("send: failed sending audit records. Retrying later.",
+				slog.Int("batch", n), slog.String("err", err.Error()))
+			return false
+		}
+		// remove the sent records, except those already dropped while sending
+		pub.mux.Lock()
+		sent := max(0, n-(pub.dropped-droppedBefore))
+		pub.pending = pub.pending[sent:]
+		pub.mux.Unlock()
+	}
+}
+
+// run sends pending records until stopped
+func (pub *AuditPublisher) run(stopChan chan struct{}) {
+	defer pub.wg.Done()
+	retryTimer := time.NewTimer(auditRetryInterval)
+	retryTimer.Stop()
+	defer retryTimer.Stop()
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-pub.notifyChan:
+		case <-retryTimer.C:
+		}
+		if !pub.send() {
+			retryTimer.Reset(auditRetryInterval)
+		}
+	}
+}
+
+// Stop sending records. Records that are still pending are lost.
+func (pub *AuditPublisher) Stop() {
+	pub.hc.SetRPCAuditHandler(nil)
+	pub.mux.Lock()
+	stopChan := pub.stopChan
+	pub.stopChan = nil
+	pub.mux.Unlock()
+	if stopChan != nil {
+		close(stopChan)
+		pub.wg.Wait()
+	}
+}
+
+// EnableAudit sends an audit record to the audit service for each handled request
+// of the given capability methods. Intended for services to record their
+// state-changing requests in the audit log. Secrets in the request arguments are
+// redacted before sending.
+//
+// This uses the hub client's RPC audit handler, so it can only be used once per client.
+// Use Stop on the returned publisher when the service stops.
+//
+//	hc is the service connection whose capability requests to audit
+//	capMethods maps capability IDs to the methods to audit
+func EnableAudit(hc *clidone.HubClient, capMethods map[string][]string) *AuditPublisher {
+	pub := &AuditPublisher{
+		hc:         hc,
+		capMethods: capMethods,
+		pending:    make([]auditapi.AuditRecord, 0),
+		notifyChan: make(chan struct{}, 1),
+		stopChan:   make(chan struct{}),
+	}
+	pub.wg.Add(1)
+	go pub.run(pub.stopChan)
+	hc.SetRPCAuditHandler(pub.onRequest)
+	return pub
+}
+
+// RedactArgs returns the JSON encoded request arguments with the values of secrets,
+// like passwords and tokens, replaced with RedactedValue.
+func RedactArgs(args []byte) string {
+	if len(args) == 0 {
+		return ""
+	}
+	var argsValue interface{}
+	err := json.Unmarshal(args, &argsValue)
+	if err != nil {
+		// not json, don't risk recording a secret
+		return auditapi.RedactedValue
+	}
+	redacted, _ := json.Marshal(redactValue(argsValue))
+	return string(redacted)
+}
+
+// redactValue replaces secrets in maps and lists, recursively
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if isSecretArg(k) {
+				v[k] = auditapi.RedactedValue
+			} else {
+				v[k] = redactValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
+
+// isSecretArg returns true if the argument with the given name holds a secret
+func isSecretArg(name string) bool {
+	name = strings.ToLower(name)
+	if slices.Contains(secretArgNames, name) {
+		return true
+	}
+	for _, part := range secretArgParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
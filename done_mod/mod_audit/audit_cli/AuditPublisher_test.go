@@ -0,0 +1,33 @@
+package auditcli_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	auditapi "github.com/hiveot/hub/done_mod/mod_audit/audit_api"
+	auditcli "github.com/hiveot/hub/done_mod/mod_audit/audit_cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactArgs(t *testing.T) {
+	args := `{"clientID":"user1","password":"secret1","newPassword":"secret2",
+		"Token":"abc","keys":[{"privateKey":"key1","name":"key"}],"count":3}`
+
+	redacted := auditcli.RedactArgs([]byte(args))
+	value := make(map[string]interface{})
+	err := json.Unmarshal([]byte(redacted), &value)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", value["clientID"])
+	assert.Equal(t, auditapi.RedactedValue, value["password"])
+	assert.Equal(t, auditapi.RedactedValue, value["newPassword"])
+	assert.Equal(t, auditapi.RedactedValue, value["Token"])
+	assert.Equal(t, float64(3), value["count"])
+	key := value["keys"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, auditapi.RedactedValue, key["privateKey"])
+	assert.Equal(t, "key", key["name"])
+
+	// arguments that aren't json are redacted entirely
+	assert.Equal(t, auditapi.RedactedValue, auditcli.RedactArgs([]byte("password=secret")))
+	assert.Equal(t, "", auditcli.RedactArgs(nil))
+}
@@ -0,0 +1,195 @@
+package auditsrv
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"sync"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	auditapi "github.com/hiveot/hub/done_mod/mod_audit/audit_api"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	authcli "github.com/hiveot/hub/done_mod/mod_auth/auth_cli"
+	"github.com/hiveot/hub/done_tool/buckets"
+	"github.com/hiveot/hub/done_tool/buckets/bolts"
+	"github.com/hiveot/hub/done_tool/ser"
+)
+
+// auditBucketID is the ID of the bucket that holds the audit records
+const auditBucketID = "audit"
+
+// serviceCacheValidity is the time a verified service sender is remembered
+const serviceCacheValidity = time.Minute
+
+// AuditService records the audit records sent by services in an append-only log.
+// Records are stored with a time ordered key and are never updated or removed.
+type AuditService struct {
+	// Hub connection
+	hc *clidone.HubClient
+	// backend storage
+	storeDir string
+	store    buckets.IBucketStore
+	// sequence nr to keep keys of records with the same timestamp unique
+	seq int
+	mux sync.Mutex
+	// expiry of senders that are verified to be services
+	services map[string]time.Time
+}
+
+// makeKey returns the storage key of a record. Keys sort by time.
+func makeKey(timestampMSE int64, seq int) string {
+	return fmt.Sprintf("%016d-%06d", timestampMSE, seq)
+}
+
+// isService returns true if the client is a registered service.
+// Administrators can also send RPC requests, so the client type is checked with the
+// auth service. The result is cached for serviceCacheValidity.
+func (svc *AuditService) isService(clientID string) bool {
+	now := time.Now()
+	svc.mux.Lock()
+	expiry, found := svc.services[clientID]
+	svc.mux.Unlock()
+	if found && now.Before(expiry) {
+		return true
+	}
+	prof, err := authcli.NewManageClients(svc.hc).GetProfile(clientID)
+	if err != nil || prof.ClientType != authapi.ClientTypeService {
+		return false
+	}
+	svc.mux.Lock()
+	svc.services[clientID] = now.Add(serviceCacheValidity)
+	svc.mux.Unlock()
+	return true
+}
+
+// Record stores the audit records sent by a service
+func (svc *AuditService) Record(ctx clidone.ServiceContext, args *auditapi.RecordArgs) error {
+	if !svc.isService(ctx.SenderID) {
+		slog.Warn("Record; refused audit records from a client that is not a service",
+			slog.String("senderID", ctx.SenderID))
+		return fmt.Errorf("only services can add audit records")
+	}
+	bucket := svc.store.GetBucket(auditBucketID)
+	defer bucket.Close()
+	for _, rec := range args.Records {
+		// only the sender can be trusted as the service that handled the request
+		rec.ServiceID = ctx.SenderID
+		if rec.TimestampMSE == 0 {
+			rec.TimestampMSE = time.Now().UnixMilli()
+		}
+		value, _ := ser.Marshal(&rec)
+
+		svc.mux.Lock()
+		svc.seq = (svc.seq + 1) % 1000000
+		key := makeKey(rec.TimestampMSE, svc.seq)
+		svc.mux.Unlock()
+		err := bucket.Set(key, value)
+		if err != nil {
+			slog.Error("Record; failed storing audit record",
+				slog.String("senderID", ctx.SenderID), slog.String("err", err.Error()))
+			return err
+		}
+	}
+	return nil
+}
+
+// Query returns the audit records that match the query, newest first
+func (svc *AuditService) Query(
+	ctx clidone.ServiceContext, args *auditapi.QueryArgs) (resp *auditapi.QueryResp, err error) {
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = auditapi.DefaultQueryLimit
+	}
+	resp = &auditapi.QueryResp{Records: make([]auditapi.AuditRecord, 0)}
+	bucket := svc.store.GetBucket(auditBucketID)
+	defer bucket.Close()
+	cursor, err := bucket.Cursor(context.Background())
+	if err != nil {
+		// the bucket doesn't exist until the first record is added
+		return resp, nil
+	}
+	defer cursor.Release()
+
+	_, v, valid := cursor.Last()
+	if args.EndMSE > 0 {
+		// position at the last record before the end time
+		_, _, valid = cursor.Seek(makeKey(args.EndMSE+1, 0))
+		if valid {
+			_, v, valid = cursor.Prev()
+		} else {
+			_, v, valid = cursor.Last()
+		}
+	}
+	for ; valid && len(resp.Records) < limit; _, v, valid = cursor.Prev() {
+		rec := auditapi.AuditRecord{}
+		if ser.Unmarshal(v, &rec) != nil {
+			continue
+		}
+		if args.StartMSE > 0 && rec.TimestampMSE < args.StartMSE {
+			break
+		}
+		if (args.ServiceID != "" && rec.ServiceID != args.ServiceID) ||
+			(args.SenderID != "" && rec.SenderID != args.SenderID) ||
+			(args.Method != "" && rec.Method != args.Method) {
+			continue
+		}
+		resp.Records = append(resp.Records, rec)
+	}
+	return resp, nil
+}
+
+// Start the service
+// This opens the store and sets the permissions for services to add records and for
+// administrators to query the log.
+func (svc *AuditService) Start(hc *clidone.HubClient) (err error) {
+	slog.Warn("Starting the audit service", "clientID", hc.ClientID())
+	svc.hc = hc
+	storePath := path.Join(svc.storeDir, "audit.kvbtree")
+	svc.store = bolts.NewBoltStore(storePath)
+	err = svc.store.Open()
+	if err != nil {
+		return err
+	}
+	serviceProfile := authcli.NewProfileClient(svc.hc)
+	// only services can add records
+	err = serviceProfile.SetServicePermissions(auditapi.RecordAuditCap, []string{
+		authapi.ClientRoleService})
+	if err != nil {
+		return err
+	}
+	// only administrators can read the audit log
+	err = serviceProfile.SetServicePermissions(auditapi.ReadAuditCap, []string{
+		authapi.ClientRoleAdmin})
+	if err != nil {
+		return err
+	}
+	svc.hc.SetRPCCapability(auditapi.RecordAuditCap,
+		map[string]interface{}{
+			auditapi.RecordMethod: svc.Record,
+		})
+	svc.hc.SetRPCCapability(auditapi.ReadAuditCap,
+		map[string]interface{}{
+			auditapi.QueryMethod: svc.Query,
+		})
+	return nil
+}
+
+// Stop the service
+func (svc *AuditService) Stop() {
+	slog.Warn("Stopping the audit service")
+	_ = svc.store.Close()
+}
+
+// NewAuditService creates a new audit service instance
+//
+//	storeDir is the directory of the audit store
+func NewAuditService(storeDir string) *AuditService {
+	svc := &AuditService{
+		storeDir: storeDir,
+		services: make(map[string]time.Time),
+	}
+	return svc
+}
@@ -0,0 +1,142 @@
+package auditsrv_test
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	auditapi "github.com/hiveot/hub/done_mod/mod_audit/audit_api"
+	auditcli "github.com/hiveot/hub/done_mod/mod_audit/audit_cli"
+	auditsrv "github.com/hiveot/hub/done_mod/mod_audit/audit_srv"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startAudit starts the audit service on the test hub
+func startAudit(t *testing.T, ts *testenv.TestServer) (stopFn func()) {
+	svc := auditsrv.NewAuditService(path.Join(ts.TestDir, "stores", auditapi.ServiceName))
+	stopFn, err := ts.StartService(auditapi.ServiceName, svc)
+	require.NoError(t, err)
+	return stopFn
+}
+
+// query the audit log until the expected nr of records is found or a timeout occurs
+func queryRecords(t *testing.T, cl *auditcli.AuditClient, args auditapi.QueryArgs, count int) []auditapi.AuditRecord {
+	var records []auditapi.AuditRecord
+	var err error
+	for i := 0; i < 100; i++ {
+		records, err = cl.Query(args)
+		require.NoError(t, err)
+		if len(records) >= count {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return records
+}
+
+func TestRecordAndQuery(t *testing.T) {
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+	defer startAudit(t, ts)()
+
+	svc1, err := ts.AddConnectService("svc1")
+	require.NoError(t, err)
+	defer svc1.Disconnect()
+	admin, err := ts.AddConnectUser("admin1", authapi.ClientRoleAdmin)
+	require.NoError(t, err)
+	defer admin.Disconnect()
+
+	// records are added in time order
+	records := []auditapi.AuditRecord{
+		{TimestampMSE: 1000, ServiceID: "fake", Method: "m1", SenderID: "user1"},
+		{TimestampMSE: 2000, Method: "m2", SenderID: "user2"},
+		{TimestampMSE: 3000, Method: "m1", SenderID: "user2"},
+		{TimestampMSE: 4000, Method: "m2", SenderID: "user1"},
+	}
+	err = svc1.PubRPCRequest(auditapi.ServiceName, auditapi.RecordAuditCap,
+		auditapi.RecordMethod, &auditapi.RecordArgs{Records: records}, nil)
+	require.NoError(t, err)
+
+	cl := auditcli.NewAuditClient(admin)
+	// newest first, with the sender as service
+	result, err := cl.Query(auditapi.QueryArgs{})
+	require.NoError(t, err)
+	require.Len(t, result, 4)
+	assert.Equal(t, int64(4000), result[0].TimestampMSE)
+	assert.Equal(t, "svc1", result[3].ServiceID)
+
+	result, err = cl.Query(auditapi.QueryArgs{SenderID: "user2"})
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	assert.Equal(t, int64(3000), result[0].TimestampMSE)
+
+	result, err = cl.Query(auditapi.QueryArgs{Method: "m1", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, int64(3000), result[0].TimestampMSE)
+
+	result, err = cl.Query(auditapi.QueryArgs{StartMSE: 2000, EndMSE: 3000})
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	assert.Equal(t, int64(3000), result[0].TimestampMSE)
+	assert.Equal(t, int64(2000), result[1].TimestampMSE)
+
+	result, err = cl.Query(auditapi.QueryArgs{ServiceID: "fake"})
+	require.NoError(t, err)
+	assert.Len(t, result, 0)
+
+	// clients that aren't services can't add records
+	err = admin.PubRPCRequest(auditapi.ServiceName, auditapi.RecordAuditCap,
+		auditapi.RecordMethod, &auditapi.RecordArgs{Records: records}, nil)
+	assert.Error(t, err)
+}
+
+// Records of requests handled while the audit service is down are sent when it is up
+func TestAuditBuffered(t *testing.T) {
+	const capID = "cap1"
+	const method = "setPassword"
+	type SetPasswordArgs struct {
+		Password string `json:"password"`
+	}
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+
+	svc1, err := ts.AddConnectService("svc1")
+	require.NoError(t, err)
+	defer svc1.Disconnect()
+	svc1.SetRPCCapability(capID, map[string]interface{}{
+		method: func(ctx clidone.ServiceContext, args *SetPasswordArgs) error {
+			return nil
+		},
+	})
+	pub := auditcli.EnableAudit(svc1, map[string][]string{capID: {method}})
+	defer pub.Stop()
+
+	admin, err := ts.AddConnectUser("admin1", authapi.ClientRoleAdmin)
+	require.NoError(t, err)
+	defer admin.Disconnect()
+	args := SetPasswordArgs{Password: "secret"}
+	err = admin.PubRPCRequest("svc1", capID, method, &args, nil)
+	require.NoError(t, err)
+
+	// the next request sends the held record along with its own
+	defer startAudit(t, ts)()
+	err = admin.PubRPCRequest("svc1", capID, method, &args, nil)
+	require.NoError(t, err)
+
+	records := queryRecords(t, auditcli.NewAuditClient(admin), auditapi.QueryArgs{}, 2)
+	require.Len(t, records, 2)
+	assert.Equal(t, "svc1", records[0].ServiceID)
+	assert.Equal(t, "admin1", records[0].SenderID)
+	assert.Contains(t, records[0].Args, auditapi.RedactedValue)
+	assert.NotContains(t, records[0].Args, "secret")
+}
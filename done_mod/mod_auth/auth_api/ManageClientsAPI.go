@@ -127,3 +127,103 @@ type UpdateClientRoleArgs struct {
 	ClientID string `json:"clientID"`
 	Role     string `json:"role"`
 }
+
+// Defaults for protection against brute-force password guessing
+const (
+	// DefaultMaxLoginFailures is the nr of failed login attempts before a lockout
+	DefaultMaxLoginFailures = 5
+	// DefaultLockoutMinutes is the duration of a lockout after too many failed logins
+	DefaultLockoutMinutes = 15
+)
+
+// Kinds of login lockouts
+const (
+	LockoutKindAccount = "account"
+	LockoutKindAddress = "address"
+)
+
+// LoginLockout holds the failed login attempts of an account or remote address
+type LoginLockout struct {
+	// ID is the clientID of the account or the remote address
+	ID string `json:"id"`
+	// Kind of lockout, LockoutKindAccount or LockoutKindAddress
+	Kind string `json:"kind"`
+	// Failures is the nr of consecutive failed login attempts
+	Failures int `json:"failures"`
+	// LastFailureMSE is the timestamp in msec-since-epoch of the last failed attempt
+	LastFailureMSE int64 `json:"lastFailureMSE"`
+	// LockedUntilMSE is the timestamp in msec-since-epoch the lockout ends, or 0 if not locked
+	LockedUntilMSE int64 `json:"lockedUntilMSE,omitempty"`
+}
+
+// ClearLockoutMethod is the request name to clear the failed login attempts of an
+// account or remote address.
+// The caller must be an administrator.
+const ClearLockoutMethod = "clearLockout"
+
+type ClearLockoutArgs struct {
+	// ID of the account or remote address to clear
+	ID string `json:"id"`
+}
+
+// GetLockoutsMethod is the request name to get the accounts and remote addresses
+// that have failed login attempts.
+// The caller must be an administrator.
+const GetLockoutsMethod = "getLockouts"
+
+type GetLockoutsResp struct {
+	Lockouts []LoginLockout `json:"lockouts"`
+}
+
+// VerifyLoginMethod is the request name to verify a login password on behalf of a client.
+// Intended for login front-ends such as the web server. Failed attempts are counted
+// per account and per remote address, and lead to a temporary lockout.
+// The caller must be an administrator or service.
+const VerifyLoginMethod = "verifyLogin"
+
+type VerifyLoginArgs struct {
+	ClientID   string `json:"clientID"`
+	Password   string `json:"password"`
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+}
+
+// DefaultTokenFile is the recommended filename for the registry of issued tokens
+const DefaultTokenFile = "tokens.json"
+
+// TokenInfo describes an issued authentication token
+type TokenInfo struct {
+	// TokenID is the unique ID of the token
+	TokenID string `json:"tokenID"`
+	// ClientID of the client the token was issued to
+	ClientID string `json:"clientID"`
+	// IssuedMSE is the timestamp in msec-since-epoch the token was issued
+	IssuedMSE int64 `json:"issuedMSE"`
+	// ExpiryMSE is the timestamp in msec-since-epoch the token expires
+	ExpiryMSE int64 `json:"expiryMSE"`
+	// Revoked is set when the token is no longer accepted
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// ListTokensMethod is the request name to list the unexpired tokens issued to clients.
+// In NATS nkey mode the token ID is the client's public key.
+// The caller must be an administrator.
+const ListTokensMethod = "listTokens"
+
+type ListTokensArgs struct {
+	// ClientID to list the tokens of, or "" for all clients
+	ClientID string `json:"clientID,omitempty"`
+}
+type ListTokensResp struct {
+	Tokens []TokenInfo `json:"tokens"`
+}
+
+// RevokeTokenMethod is the request name to revoke an issued token.
+// The token is rejected by the server from then on and connections that were
+// authenticated with the token are closed. In NATS nkey mode this revokes the
+// client's public key. The client needs a new key to connect again.
+// The caller must be an administrator.
+const RevokeTokenMethod = "revokeToken"
+
+type RevokeTokenArgs struct {
+	TokenID string `json:"tokenID"`
+}
@@ -56,7 +56,8 @@ const (
 //
 // *	      sub       _INBOX  {clientID}   -       	(built-in rule)
 // *	      pub       rpc     auth         profile 	(built-in rule)
-// *          pub       any     -            -        senderID must be clientID except for inbox
+// *          pub       any     -            -        senderID must be clientID except for replies
+// *          pub       _INBOX  -            -        request replies or senderID is clientID (built-in rule)
 //
 // viewer     sub       event   -            -
 // operator   pub       action  -            -
@@ -9,6 +9,7 @@ import (
 // AuthConfig contains the auth service configuration
 type AuthConfig struct {
 	PasswordFile             string `yaml:"passwordFile,omitempty"`
+	TokenFile                string `yaml:"tokenFile,omitempty"`
 	DeviceTokenValidityDays  int    `yaml:"deviceTokenValidityDays,omitempty"`
 	ServiceTokenValidityDays int    `yaml:"serviceTokenValidityDays,omitempty"`
 	UserTokenValidityDays    int    `yaml:"userTokenValidityDays,omitempty"`
@@ -16,6 +17,8 @@ type AuthConfig struct {
 	KeysDir                  string `yaml:"certsDir,omitempty"`
 	AdminAccountID           string `yaml:"adminAccountID,omitempty"`
 	LauncherAccountID        string `yaml:"launcherAccountID,omitempty"`
+	MaxLoginFailures         int    `yaml:"maxLoginFailures,omitempty"`
+	LockoutMinutes           int    `yaml:"lockoutMinutes,omitempty"`
 }
 
 // Setup ensures config is valid
@@ -27,6 +30,12 @@ func (cfg *AuthConfig) Setup(keysDir, storesDir string) error {
 	if !path.IsAbs(cfg.PasswordFile) {
 		cfg.PasswordFile = path.Join(storesDir, "auth", cfg.PasswordFile)
 	}
+	if cfg.TokenFile == "" {
+		cfg.TokenFile = authapi.DefaultTokenFile
+	}
+	if !path.IsAbs(cfg.TokenFile) {
+		cfg.TokenFile = path.Join(storesDir, "auth", cfg.TokenFile)
+	}
 
 	if cfg.DeviceTokenValidityDays == 0 {
 		cfg.DeviceTokenValidityDays = authapi.DefaultDeviceTokenValidityDays
@@ -37,6 +46,12 @@ func (cfg *AuthConfig) Setup(keysDir, storesDir string) error {
 	if cfg.UserTokenValidityDays == 0 {
 		cfg.UserTokenValidityDays = authapi.DefaultUserTokenValidityDays
 	}
+	if cfg.MaxLoginFailures == 0 {
+		cfg.MaxLoginFailures = authapi.DefaultMaxLoginFailures
+	}
+	if cfg.LockoutMinutes == 0 {
+		cfg.LockoutMinutes = authapi.DefaultLockoutMinutes
+	}
 	cfg.KeysDir = keysDir
 	cfg.AdminAccountID = authapi.DefaultAdminUserID
 	cfg.LauncherAccountID = authapi.DefaultLauncherServiceID
@@ -76,6 +76,15 @@ func (cl *ManageClients) AddUser(
 	return resp.Token, err
 }
 
+// ClearLockout clears the failed login attempts of an account or remote address
+// The caller must be an administrator.
+func (cl *ManageClients) ClearLockout(id string) error {
+	req := authapi.ClearLockoutArgs{ID: id}
+	err := cl.hc.PubRPCRequest(
+		cl.agentID, cl.capID, authapi.ClearLockoutMethod, &req, nil)
+	return err
+}
+
 // GetCount returns the number of clients in the store
 func (cl *ManageClients) GetCount() (n int, err error) {
 	resp := authapi.GetCountResp{}
@@ -89,6 +98,15 @@ func (cl *ManageClients) GetCount() (n int, err error) {
 //	//FIXME
 //}
 
+// GetLockouts returns the accounts and remote addresses with failed login attempts
+// The caller must be an administrator.
+func (cl *ManageClients) GetLockouts() (lockouts []authapi.LoginLockout, err error) {
+	resp := authapi.GetLockoutsResp{}
+	err = cl.hc.PubRPCRequest(
+		cl.agentID, cl.capID, authapi.GetLockoutsMethod, nil, &resp)
+	return resp.Lockouts, err
+}
+
 // GetProfile returns a client's profile
 // Users can only get their own profile.
 // Managers can get other clients profiles.
@@ -98,7 +116,7 @@ func (cl *ManageClients) GetProfile(clientID string) (profile authapi.ClientProf
 	}
 	resp := authapi.GetProfileResp{}
 	err = cl.hc.PubRPCRequest(
-		cl.agentID, cl.capID, authapi.GetProfilesMethod, &req, &resp)
+		cl.agentID, cl.capID, authapi.GetClientProfileMethod, &req, &resp)
 	return resp.Profile, err
 }
 
@@ -111,8 +129,20 @@ func (cl *ManageClients) GetProfiles() (profiles []authapi.ClientProfile, err er
 	return resp.Profiles, err
 }
 
+// ListTokens returns the unexpired tokens issued to a client
+// The caller must be an administrator.
+//
+//	clientID whose tokens to list or "" for all clients
+func (cl *ManageClients) ListTokens(clientID string) (tokens []authapi.TokenInfo, err error) {
+	req := authapi.ListTokensArgs{ClientID: clientID}
+	resp := authapi.ListTokensResp{}
+	err = cl.hc.PubRPCRequest(
+		cl.agentID, cl.capID, authapi.ListTokensMethod, &req, &resp)
+	return resp.Tokens, err
+}
+
 // RemoveClient removes a client and disables authentication
-// Existing tokens are immediately expired (tbd)
+// Existing tokens of the client are revoked.
 func (cl *ManageClients) RemoveClient(clientID string) error {
 	req := authapi.RemoveClientArgs{
 		ClientID: clientID,
@@ -122,6 +152,15 @@ func (cl *ManageClients) RemoveClient(clientID string) error {
 	return err
 }
 
+// RevokeToken revokes an issued token. The server rejects the token from now on.
+// The caller must be an administrator.
+func (cl *ManageClients) RevokeToken(tokenID string) error {
+	req := authapi.RevokeTokenArgs{TokenID: tokenID}
+	err := cl.hc.PubRPCRequest(
+		cl.agentID, cl.capID, authapi.RevokeTokenMethod, &req, nil)
+	return err
+}
+
 // SetClientPassword sets a new password for a client
 func (cl *ManageClients) SetClientPassword(clientID string, newPass string) error {
 	req := &authapi.SetClientPasswordArgs{
@@ -155,6 +194,23 @@ func (cl *ManageClients) UpdateClientRole(clientID string, newRole string) error
 	return err
 }
 
+// VerifyLogin verifies a client's login password on behalf of a login front-end.
+// Failed attempts are counted towards a temporary lockout of the account and remote address.
+//
+//	clientID is the login ID of the client
+//	password to verify
+//	remoteAddr is the remote address of the client, if known
+func (cl *ManageClients) VerifyLogin(clientID string, password string, remoteAddr string) error {
+	req := authapi.VerifyLoginArgs{
+		ClientID:   clientID,
+		Password:   password,
+		RemoteAddr: remoteAddr,
+	}
+	err := cl.hc.PubRPCRequest(
+		cl.agentID, cl.capID, authapi.VerifyLoginMethod, &req, nil)
+	return err
+}
+
 // NewManageClients returns an authn client management client
 //
 //	hc is the hub client connection to use
@@ -18,6 +18,10 @@ type AuthManageClients struct {
 	msgServer modbus.IMsgServer
 	// messaging client for receiving requests
 	hc *clidone.HubClient
+	// protection against password guessing
+	guard *LoginGuard
+	// issuer of tokens
+	tokens *AuthTokens
 	// subscription to receive requests
 	//mngSub transport.ISubscription
 }
@@ -58,7 +62,7 @@ func (svc *AuthManageClients) AddDevice(
 			PubKey:     args.PubKey,
 			Role:       authapi.ClientRoleDevice,
 		}
-		resp.Token, err = svc.msgServer.CreateToken(authInfo)
+		resp.Token, err = svc.tokens.CreateToken(authInfo)
 	}
 	return resp, err
 }
@@ -94,7 +98,7 @@ func (svc *AuthManageClients) AddService(
 			PubKey:     args.PubKey,
 			Role:       authapi.ClientRoleService,
 		}
-		resp.Token, _ = svc.msgServer.CreateToken(authInfo)
+		resp.Token, _ = svc.tokens.CreateToken(authInfo)
 	}
 	err = svc.onChange()
 	return resp, err
@@ -140,7 +144,7 @@ func (svc *AuthManageClients) AddUser(
 			PubKey:     args.PubKey,
 			Role:       args.Role,
 		}
-		resp.Token, err = svc.msgServer.CreateToken(authInfo)
+		resp.Token, err = svc.tokens.CreateToken(authInfo)
 	}
 	if err == nil {
 		err = svc.onChange()
@@ -148,6 +152,13 @@ func (svc *AuthManageClients) AddUser(
 	return resp, err
 }
 
+// ClearLockout clears the failed login attempts of an account or remote address
+func (svc *AuthManageClients) ClearLockout(ctx clidone.ServiceContext, args authapi.ClearLockoutArgs) error {
+	slog.Info("ClearLockout", slog.String("senderID", ctx.SenderID), slog.String("id", args.ID))
+	svc.guard.ClearLockout(args.ID)
+	return nil
+}
+
 // GetAuthClientList is for use with the messaging server
 func (svc *AuthManageClients) GetAuthClientList() []modbus.ClientAuthInfo {
 	return svc.store.GetAuthClientList()
@@ -168,6 +179,19 @@ func (svc *AuthManageClients) GetClientProfile(ctx clidone.ServiceContext,
 	return resp, err
 }
 
+// GetLockouts returns the accounts and remote addresses with failed login attempts
+func (svc *AuthManageClients) GetLockouts() (authapi.GetLockoutsResp, error) {
+	resp := authapi.GetLockoutsResp{Lockouts: svc.guard.GetLockouts()}
+	return resp, nil
+}
+
+// ListTokens returns the unexpired tokens issued to a client, or all clients
+func (svc *AuthManageClients) ListTokens(
+	ctx clidone.ServiceContext, args authapi.ListTokensArgs) (authapi.ListTokensResp, error) {
+	resp := authapi.ListTokensResp{Tokens: svc.tokens.ListTokens(args.ClientID)}
+	return resp, nil
+}
+
 // GetProfiles provide a list of known clients and their info.
 func (svc *AuthManageClients) GetProfiles() (authapi.GetProfilesResp, error) {
 	profiles, err := svc.store.GetProfiles()
@@ -194,20 +218,34 @@ func (svc *AuthManageClients) onChange() error {
 			Role:         e.Role,
 		})
 	}
+	if svc.guard != nil {
+		clients = svc.guard.FilterAuthClients(clients)
+	}
 	err := svc.msgServer.ApplyAuth(clients)
 	return err
 }
 
 // RemoveClient removes a client and disables authentication
+// The tokens issued to the client are revoked.
 func (svc *AuthManageClients) RemoveClient(ctx clidone.ServiceContext, args authapi.RemoveClientArgs) error {
 	slog.Info("RemoveClient", "clientID", args.ClientID)
 	err := svc.store.Remove(args.ClientID)
+	if err == nil {
+		err = svc.tokens.RevokeClient(args.ClientID)
+	}
 	if err == nil {
 		err = svc.onChange()
 	}
 	return err
 }
 
+// RevokeToken revokes an issued token. The server rejects the token from now on.
+func (svc *AuthManageClients) RevokeToken(ctx clidone.ServiceContext, args authapi.RevokeTokenArgs) error {
+	slog.Info("RevokeToken",
+		slog.String("senderID", ctx.SenderID), slog.String("tokenID", args.TokenID))
+	return svc.tokens.RevokeToken(args.TokenID)
+}
+
 func (svc *AuthManageClients) SetClientPassword(ctx clidone.ServiceContext, args authapi.SetClientPasswordArgs) error {
 	slog.Info("SetClientPassword", "clientID", args.ClientID)
 	err := svc.store.SetPassword(args.ClientID, args.Password)
@@ -232,13 +270,18 @@ func (svc *AuthManageClients) Start() (err error) {
 				authapi.AddDeviceMethod:         svc.AddDevice,
 				authapi.AddServiceMethod:        svc.AddService,
 				authapi.AddUserMethod:           svc.AddUser,
+				authapi.ClearLockoutMethod:      svc.ClearLockout,
 				authapi.GetCountMethod:          svc.GetCount,
 				authapi.GetClientProfileMethod:  svc.GetClientProfile,
+				authapi.GetLockoutsMethod:       svc.GetLockouts,
 				authapi.GetProfilesMethod:       svc.GetProfiles,
+				authapi.ListTokensMethod:        svc.ListTokens,
 				authapi.RemoveClientMethod:      svc.RemoveClient,
+				authapi.RevokeTokenMethod:       svc.RevokeToken,
 				authapi.UpdateClientMethod:      svc.UpdateClient,
 				authapi.SetClientPasswordMethod: svc.SetClientPassword,
 				authapi.UpdateClientRoleMethod:  svc.UpdateClientRole,
+				authapi.VerifyLoginMethod:       svc.VerifyLogin,
 			})
 	}
 	return err
@@ -268,21 +311,47 @@ func (svc *AuthManageClients) UpdateClientRole(ctx clidone.ServiceContext, args
 	return err
 }
 
+// VerifyLogin verifies a login password on behalf of a login front-end.
+// Failed attempts are counted towards a lockout of the account and remote address.
+func (svc *AuthManageClients) VerifyLogin(ctx clidone.ServiceContext, args authapi.VerifyLoginArgs) error {
+	err := svc.guard.CheckLogin(args.ClientID, args.RemoteAddr)
+	if err != nil {
+		return err
+	}
+	_, err = svc.store.VerifyPassword(args.ClientID, args.Password)
+	if err != nil {
+		slog.Warn("VerifyLogin failed",
+			slog.String("senderID", ctx.SenderID),
+			slog.String("clientID", args.ClientID),
+			slog.String("remoteAddr", args.RemoteAddr))
+		svc.guard.LoginFailed(args.ClientID, args.RemoteAddr)
+		return err
+	}
+	svc.guard.LoginSucceeded(args.ClientID)
+	return nil
+}
+
 // NewAuthManageClients creates the capability to manage authentication clients
 //
 //		store for storing clients
 //		msgServer for applying changes to the server
 //	 hc hub client for subscribing to receive requests
+//	 guard for protection against password guessing, or nil when not receiving requests
+//	 tokens for issuing and revoking authentication tokens
 func NewAuthManageClients(
 	store authapi.IAuthnStore,
 	hc *clidone.HubClient,
 	msgServer modbus.IMsgServer,
+	guard *LoginGuard,
+	tokens *AuthTokens,
 ) *AuthManageClients {
 
 	svc := &AuthManageClients{
 		store:     store,
 		hc:        hc,
 		msgServer: msgServer,
+		guard:     guard,
+		tokens:    tokens,
 	}
 	return svc
 }
@@ -21,6 +21,10 @@ type AuthManageProfile struct {
 	msgServer modbus.IMsgServer
 	// CA certificate for validating cert
 	caCert *x509.Certificate
+	// protection against password guessing
+	guard *LoginGuard
+	// issuer of tokens
+	tokens *AuthTokens
 }
 
 // GetProfile returns a client's profile
@@ -35,17 +39,23 @@ func (svc *AuthManageProfile) GetProfile(ctx clidone.ServiceContext) (
 func (svc *AuthManageProfile) NewToken(
 	ctx clidone.ServiceContext, args authapi.NewTokenArgs) (resp *authapi.NewTokenResp, err error) {
 
+	err = svc.guard.CheckLogin(ctx.SenderID, "")
+	if err != nil {
+		return resp, err
+	}
 	clientProfile, err := svc.store.VerifyPassword(ctx.SenderID, args.Password)
 	if err != nil {
+		svc.guard.LoginFailed(ctx.SenderID, "")
 		return resp, err
 	}
+	svc.guard.LoginSucceeded(ctx.SenderID)
 	authInfo := modbus.ClientAuthInfo{
 		ClientID:   clientProfile.ClientID,
 		ClientType: clientProfile.ClientType,
 		PubKey:     clientProfile.PubKey,
 		Role:       clientProfile.Role,
 	}
-	newToken, err := svc.msgServer.CreateToken(authInfo)
+	newToken, err := svc.tokens.CreateToken(authInfo)
 	resp = &authapi.NewTokenResp{Token: newToken}
 	return resp, err
 }
@@ -54,7 +64,7 @@ func (svc *AuthManageProfile) NewToken(
 // this invokes a reload of server authn
 func (svc *AuthManageProfile) onChange() {
 	// wait with applying credential changes to allow a response to be send
-	go svc.msgServer.ApplyAuth(svc.store.GetAuthClientList())
+	go svc.msgServer.ApplyAuth(svc.guard.FilterAuthClients(svc.store.GetAuthClientList()))
 }
 
 // RefreshToken issues a new token for the authenticated user.
@@ -77,7 +87,7 @@ func (svc *AuthManageProfile) RefreshToken(ctx clidone.ServiceContext) (*authapi
 		PubKey:     clientProfile.PubKey,
 		Role:       clientProfile.Role,
 	}
-	newToken, err := svc.msgServer.CreateToken(authInfo)
+	newToken, err := svc.tokens.CreateToken(authInfo)
 	if err != nil {
 		slog.Warn("RefreshToken",
 			"clientID", clientProfile.ClientID, "err", err.Error())
@@ -178,11 +188,15 @@ func (svc *AuthManageProfile) UpdatePubKey(
 //
 //	store holds the authentication client records
 //	caCert is an optional CA used to verify certificates. Use nil to not authn using client certs
+//	guard for protection against password guessing
+//	tokens for issuing authentication tokens
 func NewAuthManageProfile(
 	store authapi.IAuthnStore,
 	caCert *x509.Certificate,
 	hc *clidone.HubClient,
 	msgServer modbus.IMsgServer,
+	guard *LoginGuard,
+	tokens *AuthTokens,
 ) *AuthManageProfile {
 
 	svc := &AuthManageProfile{
@@ -190,6 +204,8 @@ func NewAuthManageProfile(
 		hc:        hc,
 		msgServer: msgServer,
 		caCert:    caCert,
+		guard:     guard,
+		tokens:    tokens,
 	}
 	return svc
 }
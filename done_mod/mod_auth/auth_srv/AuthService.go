@@ -8,6 +8,7 @@ import (
 	"path"
 
 	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	auditcli "github.com/hiveot/hub/done_mod/mod_audit/audit_cli"
 	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
 	authcfg "github.com/hiveot/hub/done_mod/mod_auth/auth_cfg"
 	authstr "github.com/hiveot/hub/done_mod/mod_auth/auth_str"
@@ -26,6 +27,12 @@ type AuthService struct {
 	MngClients *AuthManageClients
 	MngRoles   *AuthManageRoles
 	MngProfile *AuthManageProfile
+	// protection against password guessing
+	guard *LoginGuard
+	// issued token registry for revocation
+	tokens *AuthTokens
+	// sends audit records of changes
+	audit *auditcli.AuditPublisher
 }
 
 // Start the service and activate the binding to handle requests
@@ -37,6 +44,11 @@ func (svc *AuthService) Start() (err error) {
 	if err != nil {
 		return err
 	}
+	svc.tokens = NewAuthTokens(authstr.NewTokenFileStore(svc.cfg.TokenFile), svc.msgServer)
+	err = svc.tokens.Start()
+	if err != nil {
+		return err
+	}
 
 	// before being able to connect, the AuthService and its key must be known
 	tcpAddr, _, udsAddr := svc.msgServer.GetServerURLs()
@@ -46,7 +58,7 @@ func (svc *AuthService) Start() (err error) {
 	myPubKey := myKP.ExportPublic()
 
 	// use a temporary instance of the client manager to add itself
-	mngClients := NewAuthManageClients(svc.store, nil, svc.msgServer)
+	mngClients := NewAuthManageClients(svc.store, nil, svc.msgServer, nil, svc.tokens)
 	args1 := authapi.AddServiceArgs{
 		ServiceID:   clientID,
 		DisplayName: "Auth Service",
@@ -66,9 +78,16 @@ func (svc *AuthService) Start() (err error) {
 	if err != nil {
 		return err
 	}
-	svc.MngClients = NewAuthManageClients(svc.store, svc.hc, svc.msgServer)
+	svc.guard = NewLoginGuard(svc.cfg.MaxLoginFailures, svc.cfg.LockoutMinutes)
+	svc.MngClients = NewAuthManageClients(svc.store, svc.hc, svc.msgServer, svc.guard, svc.tokens)
 	svc.MngRoles = NewAuthManageRoles(svc.store, svc.hc, svc.msgServer)
-	svc.MngProfile = NewAuthManageProfile(svc.store, nil, svc.hc, svc.msgServer)
+	svc.MngProfile = NewAuthManageProfile(svc.store, nil, svc.hc, svc.msgServer, svc.guard, svc.tokens)
+	// withhold passwords of locked accounts from the message server
+	svc.guard.SetLockChangeHandler(func() {
+		_ = svc.MngClients.onChange()
+	})
+	// count failed password logins made directly to the message server
+	svc.msgServer.SetAuthErrorHandler(svc.onAuthError)
 
 	err = svc.MngClients.Start()
 	if err == nil {
@@ -77,6 +96,31 @@ func (svc *AuthService) Start() (err error) {
 	if err == nil {
 		err = svc.MngProfile.Start()
 	}
+	// record changes to clients, roles and profiles in the audit log
+	svc.audit = auditcli.EnableAudit(svc.hc, map[string][]string{
+		authapi.AuthManageClientsCapability: {
+			authapi.AddDeviceMethod,
+			authapi.AddServiceMethod,
+			authapi.AddUserMethod,
+			authapi.ClearLockoutMethod,
+			authapi.RemoveClientMethod,
+			authapi.RevokeTokenMethod,
+			authapi.SetClientPasswordMethod,
+			authapi.UpdateClientMethod,
+			authapi.UpdateClientRoleMethod,
+		},
+		authapi.AuthManageRolesCapability: {
+			authapi.CreateRoleReq,
+			authapi.DeleteRoleReq,
+		},
+		authapi.AuthProfileCapability: {
+			authapi.NewTokenMethod,
+			authapi.SetServicePermissionsMethod,
+			authapi.UpdateNameMethod,
+			authapi.UpdatePasswordMethod,
+			authapi.UpdatePubKeyMethod,
+		},
+	})
 	if err != nil {
 		svc.MngClients.Stop()
 		svc.MngRoles.Stop()
@@ -132,9 +176,27 @@ func (svc *AuthService) Start() (err error) {
 	return err
 }
 
+// onAuthError counts a failed login reported by the message server.
+// Only failures of known clients are counted. Key and token logins report the public
+// key instead of the clientID.
+func (svc *AuthService) onAuthError(loginID string, remoteAddr string) {
+	_, err := svc.store.GetProfile(loginID)
+	if err != nil {
+		return
+	}
+	slog.Warn("onAuthError: login to message server failed",
+		slog.String("loginID", loginID), slog.String("remoteAddr", remoteAddr))
+	svc.guard.LoginFailed(loginID, remoteAddr)
+}
+
 // Stop the service, unsubscribe and disconnect from the server
 func (svc *AuthService) Stop() {
 	slog.Warn("Stopping AuthService")
+	svc.msgServer.SetAuthErrorHandler(nil)
+	if svc.audit != nil {
+		svc.audit.Stop()
+		svc.audit = nil
+	}
 	if svc.MngClients != nil {
 		svc.MngClients.Stop()
 		svc.MngClients = nil
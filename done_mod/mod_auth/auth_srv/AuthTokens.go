@@ -0,0 +1,105 @@
+package authservice
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	authstr "github.com/hiveot/hub/done_mod/mod_auth/auth_str"
+	modbus "github.com/hiveot/hub/done_mod/mod_bus"
+)
+
+// AuthTokens issues authentication tokens and keeps track of them for revocation.
+//
+// In NATS nkey mode the token is the client's public key, which is also its ID.
+// Revoking it disables the key. The client needs a new key to connect again.
+type AuthTokens struct {
+	// registry of issued tokens
+	store *authstr.TokenFileStore
+	// message server that creates and validates the tokens
+	msgServer modbus.IMsgServer
+}
+
+// applyRevoked gives the list of revoked tokens to the message server
+func (svc *AuthTokens) applyRevoked() {
+	svc.msgServer.SetRevokedTokens(svc.store.GetRevoked())
+}
+
+// CreateToken creates a token for the client and registers it in the token registry.
+// This fails if the token has the ID of a revoked token, as is the case in nkey mode
+// when the client's key was revoked.
+func (svc *AuthTokens) CreateToken(authInfo modbus.ClientAuthInfo) (string, error) {
+	token, err := svc.msgServer.CreateToken(authInfo)
+	if err != nil {
+		return token, err
+	}
+	tokenID, issuedMSE, expiryMSE, err := svc.msgServer.DecodeToken(token)
+	if info, found := svc.store.Get(tokenID); err == nil && found && info.Revoked {
+		return "", fmt.Errorf("CreateToken: the key of client '%s' is revoked", authInfo.ClientID)
+	}
+	if issuedMSE == 0 {
+		issuedMSE = time.Now().UnixMilli()
+	}
+	if err == nil && tokenID != "" {
+		err = svc.store.Add(authapi.TokenInfo{
+			TokenID:   tokenID,
+			ClientID:  authInfo.ClientID,
+			IssuedMSE: issuedMSE,
+			ExpiryMSE: expiryMSE,
+		})
+	}
+	if err != nil {
+		// the token is still usable, it just can't be revoked
+		slog.Error("CreateToken: failed registering token",
+			slog.String("clientID", authInfo.ClientID), slog.String("err", err.Error()))
+	}
+	return token, nil
+}
+
+// ListTokens returns the unexpired tokens issued to a client or "" for all clients
+func (svc *AuthTokens) ListTokens(clientID string) []authapi.TokenInfo {
+	return svc.store.List(clientID)
+}
+
+// RevokeClient revokes all tokens issued to a client
+func (svc *AuthTokens) RevokeClient(clientID string) error {
+	n, err := svc.store.RevokeClient(clientID)
+	if n > 0 {
+		slog.Info("RevokeClient: revoked tokens",
+			slog.String("clientID", clientID), slog.Int("count", n))
+		svc.applyRevoked()
+	}
+	return err
+}
+
+// RevokeToken revokes a single token.
+// The server rejects the token from now on.
+func (svc *AuthTokens) RevokeToken(tokenID string) error {
+	err := svc.store.Revoke(tokenID)
+	if err == nil {
+		svc.applyRevoked()
+	}
+	return err
+}
+
+// Start loads the token registry and applies the revoked tokens to the message server
+func (svc *AuthTokens) Start() error {
+	err := svc.store.Open()
+	if err == nil {
+		svc.applyRevoked()
+	}
+	return err
+}
+
+// NewAuthTokens creates the token issuer
+//
+//	store is the registry of issued tokens
+//	msgServer creates and validates the tokens
+func NewAuthTokens(store *authstr.TokenFileStore, msgServer modbus.IMsgServer) *AuthTokens {
+	svc := &AuthTokens{
+		store:     store,
+		msgServer: msgServer,
+	}
+	return svc
+}
@@ -0,0 +1,61 @@
+package authservice_test
+
+import (
+	"testing"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A revoked token closes the client's connection and refuses new connections
+func TestRevokeToken(t *testing.T) {
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+	ctx := clidone.ServiceContext{SenderID: authapi.DefaultAdminUserID}
+	mngClients := ts.AuthService.MngClients
+
+	kp, token, err := ts.AddClient(authapi.ClientTypeUser, "user1", authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	hc := clidone.NewHubClient(ts.ServerURL, "user1", ts.CaCert)
+	hc.SetRetryConnect(false)
+	err = hc.ConnectWithToken(kp, token)
+	require.NoError(t, err)
+	defer hc.Disconnect()
+
+	resp, err := mngClients.ListTokens(ctx, authapi.ListTokensArgs{ClientID: "user1"})
+	require.NoError(t, err)
+	require.Len(t, resp.Tokens, 1)
+	tokenID := resp.Tokens[0].TokenID
+	assert.NotEmpty(t, tokenID)
+
+	err = mngClients.RevokeToken(ctx, authapi.RevokeTokenArgs{TokenID: tokenID})
+	require.NoError(t, err)
+
+	// the open connection is closed
+	connected := true
+	for i := 0; i < 100 && connected; i++ {
+		time.Sleep(time.Millisecond * 10)
+		connected = hc.GetStatus().ConnectionStatus == transport.Connected
+	}
+	assert.False(t, connected, "connection with revoked token is still open")
+
+	// new connections are refused
+	hc2 := clidone.NewHubClient(ts.ServerURL, "user1", ts.CaCert)
+	hc2.SetRetryConnect(false)
+	err = hc2.ConnectWithToken(kp, token)
+	assert.Error(t, err)
+	hc2.Disconnect()
+
+	// no new token is issued for the revoked key
+	_, err = mngClients.AddUser(ctx, authapi.AddUserArgs{
+		UserID: "user1", PubKey: kp.ExportPublic(), Role: authapi.ClientRoleViewer})
+	assert.Error(t, err)
+}
@@ -0,0 +1,273 @@
+package authservice
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	modbus "github.com/hiveot/hub/done_mod/mod_bus"
+)
+
+// loginBaseDelay is the delay after the first failed login. It doubles with each next failure.
+const loginBaseDelay = 500 * time.Millisecond
+
+// loginMaxDelay is the maximum delay between failed login attempts
+const loginMaxDelay = 5 * time.Minute
+
+// maxLoginEntries is the maximum nr of accounts and addresses whose failures are tracked.
+// When reached, the entry with the oldest failure is removed.
+const maxLoginEntries = 10000
+
+// LoginGuard protects password logins against brute-force guessing.
+// Failed attempts are counted per account and per remote address. After each failure
+// the next attempt is refused until an exponentially increasing delay has passed.
+// When the max nr of failures is reached the account or address is locked out for
+// the lockout duration. Failures are forgotten when no further failure occurs within
+// the lockout duration.
+//
+// Password connections to the message server are verified by the server itself. The
+// server reports failed attempts, which are counted with LoginFailed, but it cannot
+// delay the next attempt. Instead, the password of locked accounts is withheld from
+// the server until the lockout ends. See FilterAuthClients.
+type LoginGuard struct {
+	maxFailures int
+	lockout     time.Duration
+	// failed logins by kind:ID
+	failures map[string]*authapi.LoginLockout
+	mux      sync.Mutex
+	// handler invoked when an account lockout starts or ends
+	onLockChange func()
+}
+
+// check returns an error if a login attempt is not allowed for the given entry
+// An expired lockout is removed.
+func (g *LoginGuard) check(key string, now time.Time) error {
+	entry, found := g.failures[key]
+	if !found {
+		return nil
+	}
+	if entry.LockedUntilMSE > 0 {
+		lockedUntil := time.UnixMilli(entry.LockedUntilMSE)
+		if now.Before(lockedUntil) {
+			return fmt.Errorf("%s '%s' is locked until %s",
+				entry.Kind, entry.ID, lockedUntil.Format(time.TimeOnly))
+		}
+		// lockout has ended
+		delete(g.failures, key)
+		return nil
+	}
+	if g.isStale(entry, now) {
+		delete(g.failures, key)
+		return nil
+	}
+	nextAttempt := time.UnixMilli(entry.LastFailureMSE).Add(loginDelay(entry.Failures))
+	if now.Before(nextAttempt) {
+		return fmt.Errorf("too many failed login attempts for %s '%s'. Retry in %s",
+			entry.Kind, entry.ID, nextAttempt.Sub(now).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// CheckLogin returns an error if a login attempt for the account from the remote
+// address is currently not allowed.
+//
+//	clientID is the login ID of the account
+//	remoteAddr is the remote address of the client or "" if not known
+func (g *LoginGuard) CheckLogin(clientID string, remoteAddr string) error {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	now := time.Now()
+	err := g.check(lockoutKey(authapi.LockoutKindAccount, clientID), now)
+	if err == nil && remoteAddr != "" {
+		err = g.check(lockoutKey(authapi.LockoutKindAddress, remoteHost(remoteAddr)), now)
+	}
+	if err != nil {
+		slog.Warn("CheckLogin: login refused",
+			slog.String("clientID", clientID),
+			slog.String("remoteAddr", remoteAddr),
+			slog.String("err", err.Error()))
+	}
+	return err
+}
+
+// ClearLockout removes the failed logins of an account or remote address.
+// The lock change handler is only invoked if the account was locked.
+func (g *LoginGuard) ClearLockout(id string) {
+	g.mux.Lock()
+	entry, found := g.failures[lockoutKey(authapi.LockoutKindAccount, id)]
+	wasLocked := found && entry.LockedUntilMSE > time.Now().UnixMilli()
+	delete(g.failures, lockoutKey(authapi.LockoutKindAccount, id))
+	delete(g.failures, lockoutKey(authapi.LockoutKindAddress, id))
+	g.mux.Unlock()
+	if wasLocked && g.onLockChange != nil {
+		g.onLockChange()
+	}
+}
+
+// FilterAuthClients removes the password hash of locked accounts from the list of
+// clients to apply to the message server.
+func (g *LoginGuard) FilterAuthClients(clients []modbus.ClientAuthInfo) []modbus.ClientAuthInfo {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	nowMSE := time.Now().UnixMilli()
+	for i, client := range clients {
+		entry, found := g.failures[lockoutKey(authapi.LockoutKindAccount, client.ClientID)]
+		if found && entry.LockedUntilMSE > nowMSE {
+			clients[i].PasswordHash = ""
+		}
+	}
+	return clients
+}
+
+// GetLockouts returns the accounts and addresses with failed login attempts
+func (g *LoginGuard) GetLockouts() []authapi.LoginLockout {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	now := time.Now()
+	lockouts := make([]authapi.LoginLockout, 0, len(g.failures))
+	for _, entry := range g.failures {
+		if !g.isStale(entry, now) {
+			lockouts = append(lockouts, *entry)
+		}
+	}
+	return lockouts
+}
+
+// LoginFailed records a failed login attempt.
+// This starts a lockout when the max nr of failures is reached.
+func (g *LoginGuard) LoginFailed(clientID string, remoteAddr string) {
+	g.mux.Lock()
+	now := time.Now()
+	accountLocked := g.addFailure(authapi.LockoutKindAccount, clientID, now)
+	if remoteAddr != "" {
+		g.addFailure(authapi.LockoutKindAddress, remoteHost(remoteAddr), now)
+	}
+	g.mux.Unlock()
+
+	if accountLocked && g.onLockChange != nil {
+		g.onLockChange()
+		// release the account when the lockout ends
+		time.AfterFunc(g.lockout, g.onLockChange)
+	}
+}
+
+// addFailure increments the failure count of the entry.
+// This returns true if the entry is now locked.
+func (g *LoginGuard) addFailure(kind string, id string, now time.Time) bool {
+	key := lockoutKey(kind, id)
+	entry, found := g.failures[key]
+	if found && g.isStale(entry, now) {
+		// earlier failures or lockout have expired
+		delete(g.failures, key)
+		found = false
+	}
+	if !found {
+		if len(g.failures) >= maxLoginEntries {
+			g.evict(now)
+		}
+		entry = &authapi.LoginLockout{ID: id, Kind: kind}
+		g.failures[key] = entry
+	}
+	entry.Failures++
+	entry.LastFailureMSE = now.UnixMilli()
+	if entry.Failures >= g.maxFailures && entry.LockedUntilMSE == 0 {
+		entry.LockedUntilMSE = now.Add(g.lockout).UnixMilli()
+		slog.Warn("LoginFailed: too many failed logins. Locking out.",
+			slog.String("kind", kind), slog.String("id", id),
+			slog.Int("failures", entry.Failures))
+		return true
+	}
+	return false
+}
+
+// evict removes expired entries. If none have expired then the entry with the oldest
+// failure is removed to make room for a new entry.
+func (g *LoginGuard) evict(now time.Time) {
+	oldestKey := ""
+	var oldestMSE int64
+	for key, entry := range g.failures {
+		if g.isStale(entry, now) {
+			delete(g.failures, key)
+		} else if oldestKey == "" || entry.LastFailureMSE < oldestMSE {
+			oldestKey = key
+			oldestMSE = entry.LastFailureMSE
+		}
+	}
+	if len(g.failures) >= maxLoginEntries {
+		delete(g.failures, oldestKey)
+	}
+}
+
+// isStale returns true if the lockout of the entry has ended, or if the entry isn't
+// locked and its last failure is older than the lockout duration.
+func (g *LoginGuard) isStale(entry *authapi.LoginLockout, now time.Time) bool {
+	if entry.LockedUntilMSE > 0 {
+		return now.UnixMilli() >= entry.LockedUntilMSE
+	}
+	return now.Sub(time.UnixMilli(entry.LastFailureMSE)) > g.lockout
+}
+
+// LoginSucceeded clears the failed attempts of the account.
+// The failures of the remote address remain, as a successful login on one account
+// should not reset guessing attempts on other accounts.
+func (g *LoginGuard) LoginSucceeded(clientID string) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	delete(g.failures, lockoutKey(authapi.LockoutKindAccount, clientID))
+}
+
+// SetLockChangeHandler sets the handler that is invoked when an account lockout
+// starts or ends. Intended to re-apply the client passwords to the message server.
+func (g *LoginGuard) SetLockChangeHandler(handler func()) {
+	g.onLockChange = handler
+}
+
+// loginDelay returns the delay before a next login attempt is allowed.
+// The delay doubles with each failure up to loginMaxDelay.
+func loginDelay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	delay := loginMaxDelay
+	// limit the shift to avoid overflow
+	if failures <= 16 {
+		delay = min(loginBaseDelay<<(failures-1), loginMaxDelay)
+	}
+	return delay
+}
+
+// lockoutKey returns the key of a lockout entry
+func lockoutKey(kind string, id string) string {
+	return kind + ":" + id
+}
+
+// remoteHost returns the host part of a remote address
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// NewLoginGuard creates a guard against brute-force password guessing.
+//
+//	maxFailures is the nr of failed attempts before locking out, or 0 for default
+//	lockoutMinutes is the duration of a lockout, or 0 for default
+func NewLoginGuard(maxFailures int, lockoutMinutes int) *LoginGuard {
+	if maxFailures <= 0 {
+		maxFailures = authapi.DefaultMaxLoginFailures
+	}
+	if lockoutMinutes <= 0 {
+		lockoutMinutes = authapi.DefaultLockoutMinutes
+	}
+	g := &LoginGuard{
+		maxFailures: maxFailures,
+		lockout:     time.Duration(lockoutMinutes) * time.Minute,
+		failures:    make(map[string]*authapi.LoginLockout),
+	}
+	return g
+}
@@ -0,0 +1,79 @@
+package authservice_test
+
+import (
+	"testing"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	authservice "github.com/hiveot/hub/done_mod/mod_auth/auth_srv"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Failed password logins to the message server count towards a lockout
+func TestDirectLoginFailed(t *testing.T) {
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+
+	_, _, err = ts.AddClient(authapi.ClientTypeUser, "user1", authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	ctx := clidone.ServiceContext{SenderID: authapi.DefaultAdminUserID}
+	err = ts.AuthService.MngClients.SetClientPassword(ctx,
+		authapi.SetClientPasswordArgs{ClientID: "user1", Password: "password1"})
+	require.NoError(t, err)
+
+	hc := clidone.NewHubClient(ts.ServerURL, "user1", ts.CaCert)
+	hc.SetRetryConnect(false)
+	err = hc.ConnectWithPassword("badpassword")
+	require.Error(t, err)
+
+	// the server reports the failure asynchronously
+	var lockouts []authapi.LoginLockout
+	for i := 0; i < 20 && len(lockouts) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+		resp, _ := ts.AuthService.MngClients.GetLockouts()
+		lockouts = resp.Lockouts
+	}
+	require.NotEmpty(t, lockouts)
+	found := false
+	for _, lockout := range lockouts {
+		if lockout.Kind == authapi.LockoutKindAccount && lockout.ID == "user1" {
+			found = true
+			assert.Equal(t, 1, lockout.Failures)
+		}
+	}
+	assert.True(t, found)
+}
+
+// Many failures lock out the account without overflowing the delay
+func TestLoginGuardLockout(t *testing.T) {
+	g := authservice.NewLoginGuard(100, 1)
+	for i := 0; i < 99; i++ {
+		g.LoginFailed("user1", "")
+	}
+	err := g.CheckLogin("user1", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Retry in")
+
+	g.LoginFailed("user1", "")
+	err = g.CheckLogin("user1", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "locked")
+
+	lockChanges := 0
+	g.SetLockChangeHandler(func() { lockChanges++ })
+	g.ClearLockout("user1")
+	err = g.CheckLogin("user1", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, lockChanges)
+
+	// clearing the failures of an account that isn't locked doesn't change the lock
+	g.LoginFailed("user1", "")
+	g.ClearLockout("user1")
+	assert.Equal(t, 1, lockChanges)
+}
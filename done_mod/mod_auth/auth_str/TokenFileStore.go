@@ -0,0 +1,178 @@
+package authstr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+)
+
+// TokenFileStore is a registry of issued tokens and their revocation status.
+// Expired tokens are removed when the store is loaded or saved.
+type TokenFileStore struct {
+	tokens    map[string]authapi.TokenInfo // map [tokenID]info
+	storePath string
+	mutex     sync.RWMutex
+}
+
+// isExpired returns true if the token has an expiry time that has passed
+func isExpired(info authapi.TokenInfo, nowMSE int64) bool {
+	return info.ExpiryMSE > 0 && info.ExpiryMSE < nowMSE
+}
+
+// Add an issued token to the registry
+func (tokenStore *TokenFileStore) Add(info authapi.TokenInfo) error {
+	if info.TokenID == "" || info.ClientID == "" {
+		return fmt.Errorf("tokenID or clientID are missing")
+	}
+	tokenStore.mutex.Lock()
+	defer tokenStore.mutex.Unlock()
+	tokenStore.tokens[info.TokenID] = info
+	return tokenStore.save()
+}
+
+// Get returns the info of a registered token
+func (tokenStore *TokenFileStore) Get(tokenID string) (info authapi.TokenInfo, found bool) {
+	tokenStore.mutex.RLock()
+	defer tokenStore.mutex.RUnlock()
+	info, found = tokenStore.tokens[tokenID]
+	return info, found
+}
+
+// GetRevoked returns the IDs of unexpired tokens that are revoked
+func (tokenStore *TokenFileStore) GetRevoked() []string {
+	tokenStore.mutex.RLock()
+	defer tokenStore.mutex.RUnlock()
+	nowMSE := time.Now().UnixMilli()
+	revoked := make([]string, 0)
+	for tokenID, info := range tokenStore.tokens {
+		if info.Revoked && !isExpired(info, nowMSE) {
+			revoked = append(revoked, tokenID)
+		}
+	}
+	return revoked
+}
+
+// List returns the unexpired tokens issued to a client
+//
+//	clientID whose tokens to list or "" for the tokens of all clients
+func (tokenStore *TokenFileStore) List(clientID string) []authapi.TokenInfo {
+	tokenStore.mutex.RLock()
+	defer tokenStore.mutex.RUnlock()
+	nowMSE := time.Now().UnixMilli()
+	tokens := make([]authapi.TokenInfo, 0)
+	for _, info := range tokenStore.tokens {
+		if (clientID == "" || info.ClientID == clientID) && !isExpired(info, nowMSE) {
+			tokens = append(tokens, info)
+		}
+	}
+	return tokens
+}
+
+// Open the store and load the registered tokens
+// If the file does not exist, it will be created.
+func (tokenStore *TokenFileStore) Open() error {
+	tokenStore.mutex.Lock()
+	defer tokenStore.mutex.Unlock()
+
+	dataBytes, err := os.ReadFile(tokenStore.storePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return tokenStore.save()
+	} else if err != nil {
+		return fmt.Errorf("error reading token file: %w", err)
+	} else if len(dataBytes) > 0 {
+		tokens := make(map[string]authapi.TokenInfo)
+		err = json.Unmarshal(dataBytes, &tokens)
+		if err != nil {
+			return fmt.Errorf("error while parsing token file: %w", err)
+		}
+		tokenStore.tokens = tokens
+		tokenStore.removeExpired()
+	}
+	return nil
+}
+
+// Revoke marks a token as revoked
+func (tokenStore *TokenFileStore) Revoke(tokenID string) error {
+	tokenStore.mutex.Lock()
+	defer tokenStore.mutex.Unlock()
+	info, found := tokenStore.tokens[tokenID]
+	if !found {
+		return fmt.Errorf("token '%s' not found", tokenID)
+	}
+	info.Revoked = true
+	tokenStore.tokens[tokenID] = info
+	return tokenStore.save()
+}
+
+// RevokeClient marks all tokens of a client as revoked
+// This returns the number of tokens that were revoked.
+func (tokenStore *TokenFileStore) RevokeClient(clientID string) (int, error) {
+	tokenStore.mutex.Lock()
+	defer tokenStore.mutex.Unlock()
+	n := 0
+	for tokenID, info := range tokenStore.tokens {
+		if info.ClientID == clientID && !info.Revoked {
+			info.Revoked = true
+			tokenStore.tokens[tokenID] = info
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, tokenStore.save()
+}
+
+// removeExpired removes the expired tokens from the registry
+func (tokenStore *TokenFileStore) removeExpired() {
+	nowMSE := time.Now().UnixMilli()
+	for tokenID, info := range tokenStore.tokens {
+		if isExpired(info, nowMSE) {
+			delete(tokenStore.tokens, tokenID)
+		}
+	}
+}
+
+// save the tokens to file, after removing expired tokens.
+// if the storage folder doesn't exist it will be created
+func (tokenStore *TokenFileStore) save() error {
+	tokenStore.removeExpired()
+	folder := path.Dir(tokenStore.storePath)
+	err := os.MkdirAll(folder, 0700)
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(tokenStore.tokens)
+	file, err := os.CreateTemp(folder, "hub-tokenstore")
+	if err != nil {
+		return fmt.Errorf("failed open temp token file: %w", err)
+	}
+	_, err = file.Write(data)
+	_ = file.Close()
+	if err == nil {
+		err = os.Rename(file.Name(), tokenStore.storePath)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return fmt.Errorf("writing token file failed: %w", err)
+	}
+	return nil
+}
+
+// NewTokenFileStore creates a new instance of a file based token registry.
+// Call Open to load the existing tokens.
+//
+//	filepath location of the file store. See also DefaultTokenFile for the recommended name
+func NewTokenFileStore(filepath string) *TokenFileStore {
+	store := &TokenFileStore{
+		storePath: filepath,
+		tokens:    make(map[string]authapi.TokenInfo),
+	}
+	return store
+}
@@ -0,0 +1,49 @@
+package authstr_test
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	authstr "github.com/hiveot/hub/done_mod/mod_auth/auth_str"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Expired tokens are not listed and are removed when the store is loaded
+func TestExpiredTokens(t *testing.T) {
+	storePath := path.Join(t.TempDir(), "tokens.json")
+	nowMSE := time.Now().UnixMilli()
+	tokens := map[string]authapi.TokenInfo{
+		"token1": {TokenID: "token1", ClientID: "user1", ExpiryMSE: nowMSE + 60000},
+		"token2": {TokenID: "token2", ClientID: "user1", ExpiryMSE: nowMSE - 1, Revoked: true},
+		// nkey tokens don't expire
+		"token3": {TokenID: "token3", ClientID: "user2"},
+	}
+	data, _ := json.Marshal(tokens)
+	err := os.WriteFile(storePath, data, 0600)
+	require.NoError(t, err)
+
+	store := authstr.NewTokenFileStore(storePath)
+	err = store.Open()
+	require.NoError(t, err)
+	_, found := store.Get("token2")
+	assert.False(t, found)
+	assert.Len(t, store.List(""), 2)
+	assert.Len(t, store.List("user1"), 1)
+	assert.Empty(t, store.GetRevoked())
+
+	// tokens that expire after loading are no longer listed
+	err = store.Add(authapi.TokenInfo{TokenID: "token4", ClientID: "user1", ExpiryMSE: time.Now().UnixMilli() + 100})
+	require.NoError(t, err)
+	err = store.Revoke("token4")
+	require.NoError(t, err)
+	assert.Len(t, store.List("user1"), 2)
+	assert.Len(t, store.GetRevoked(), 1)
+	time.Sleep(150 * time.Millisecond)
+	assert.Len(t, store.List("user1"), 1)
+	assert.Empty(t, store.GetRevoked())
+}
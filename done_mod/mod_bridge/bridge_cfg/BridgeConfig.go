@@ -0,0 +1,108 @@
+package bridgecfg
+
+import (
+	"strings"
+
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
+)
+
+// ThingIDSeparator separates the remote agentID from the remote thingID in the
+// thingID under which a remote Thing appears locally: {remoteAgentID}:{remoteThingID}
+const ThingIDSeparator = ":"
+
+// RemoteHubConfig describes the hub to bridge to.
+type RemoteHubConfig struct {
+	// URL of the remote hub, eg "nats://remotehub:4222". Default "" is auto-discovery.
+	URL string `yaml:"url"`
+
+	// ClientID to login to the remote hub. Default is the bridge's clientID.
+	ClientID string `yaml:"clientID,omitempty"`
+
+	// CertsDir contains the remote hub's CA certificate (caCert.pem) and the
+	// {clientID}.key and {clientID}.token credentials to login with.
+	// Relative paths are relative to the bridge's certs directory. Default is "remote".
+	CertsDir string `yaml:"certsDir,omitempty"`
+
+	// Password to login with instead of the token file. Not recommended.
+	Password string `yaml:"password,omitempty"`
+}
+
+// BridgeRule selects the messages to pass between the hubs.
+// Empty fields match anything. The agent and thing IDs are those of the remote hub.
+//
+// Events, including $td and $properties events, are forwarded from the remote hub
+// to the local hub. Actions and config requests are forwarded from the local hub to
+// the remote hub.
+type BridgeRule struct {
+	// MsgType is the message type to forward: "event", "action", "config" or "" for all.
+	MsgType string `yaml:"msgType,omitempty"`
+	// AgentID of the remote agent whose Things to forward
+	AgentID string `yaml:"agentID,omitempty"`
+	// ThingID of the remote Thing to forward
+	ThingID string `yaml:"thingID,omitempty"`
+	// Name of the event, action or property to forward
+	Name string `yaml:"name,omitempty"`
+}
+
+// Match returns true if the message matches this rule
+func (rule *BridgeRule) Match(msgType, agentID, thingID, name string) bool {
+	return (rule.MsgType == "" || rule.MsgType == msgType) &&
+		(rule.AgentID == "" || rule.AgentID == agentID) &&
+		(rule.ThingID == "" || rule.ThingID == thingID) &&
+		(rule.Name == "" || rule.Name == name)
+}
+
+// BridgeConfig holds the configuration of the federation bridge
+type BridgeConfig struct {
+	// Remote hub to bridge to
+	Remote RemoteHubConfig `yaml:"remote"`
+
+	// Rules of messages to forward. A message is forwarded if it matches any rule.
+	// Without rules nothing is forwarded.
+	Rules []BridgeRule `yaml:"rules"`
+}
+
+// Match returns true if the message of the remote agent and thing matches a rule
+func (cfg *BridgeConfig) Match(msgType, agentID, thingID, name string) bool {
+	for _, rule := range cfg.Rules {
+		if rule.Match(msgType, agentID, thingID, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// EventRules returns the rules that apply to events. Used to subscribe to remote events.
+func (cfg *BridgeConfig) EventRules() []BridgeRule {
+	rules := make([]BridgeRule, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		if rule.MsgType == "" || rule.MsgType == transport.MessageTypeEvent {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// LocalThingID returns the thingID under which a remote Thing appears on the local hub
+func LocalThingID(remoteAgentID, remoteThingID string) string {
+	return remoteAgentID + ThingIDSeparator + remoteThingID
+}
+
+// RemoteThingID splits the local thingID of a bridged Thing into its remote agentID and thingID.
+// This returns false if the thingID is not that of a bridged Thing.
+func RemoteThingID(localThingID string) (remoteAgentID, remoteThingID string, found bool) {
+	remoteAgentID, remoteThingID, found = strings.Cut(localThingID, ThingIDSeparator)
+	found = found && remoteAgentID != "" && remoteThingID != ""
+	return remoteAgentID, remoteThingID, found
+}
+
+// NewBridgeConfig returns a new bridge configuration with defaults
+func NewBridgeConfig() BridgeConfig {
+	cfg := BridgeConfig{
+		Remote: RemoteHubConfig{
+			CertsDir: "remote",
+		},
+		Rules: make([]BridgeRule, 0),
+	}
+	return cfg
+}
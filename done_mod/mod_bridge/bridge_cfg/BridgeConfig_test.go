@@ -0,0 +1,58 @@
+package bridgecfg_test
+
+import (
+	"testing"
+
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	bridgecfg "github.com/hiveot/hub/done_mod/mod_bridge/bridge_cfg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	cfg := bridgecfg.NewBridgeConfig()
+	// without rules nothing is forwarded
+	assert.False(t, cfg.Match(transport.MessageTypeEvent, "agent1", "thing1", "temperature"))
+
+	cfg.Rules = []bridgecfg.BridgeRule{
+		{MsgType: transport.MessageTypeEvent, AgentID: "agent1"},
+		{MsgType: transport.MessageTypeAction, AgentID: "agent2", ThingID: "thing2", Name: "switch"},
+	}
+	// empty rule fields match anything
+	assert.True(t, cfg.Match(transport.MessageTypeEvent, "agent1", "thing1", "temperature"))
+	assert.True(t, cfg.Match(transport.MessageTypeEvent, "agent1", "thing3", transport.EventNameTD))
+	assert.False(t, cfg.Match(transport.MessageTypeAction, "agent1", "thing1", "switch"))
+	assert.False(t, cfg.Match(transport.MessageTypeEvent, "agent2", "thing2", "temperature"))
+
+	// all fields of a rule must match
+	assert.True(t, cfg.Match(transport.MessageTypeAction, "agent2", "thing2", "switch"))
+	assert.False(t, cfg.Match(transport.MessageTypeAction, "agent2", "thing2", "dim"))
+	assert.False(t, cfg.Match(transport.MessageTypeAction, "agent2", "thing3", "switch"))
+	assert.False(t, cfg.Match(transport.MessageTypeConfig, "agent2", "thing2", "switch"))
+
+	// only rules for events are used to subscribe
+	cfg.Rules = append(cfg.Rules, bridgecfg.BridgeRule{AgentID: "agent3"})
+	eventRules := cfg.EventRules()
+	assert.Len(t, eventRules, 2)
+	assert.Equal(t, "agent1", eventRules[0].AgentID)
+	assert.Equal(t, "agent3", eventRules[1].AgentID)
+}
+
+func TestRemoteThingID(t *testing.T) {
+	localThingID := bridgecfg.LocalThingID("agent1", "thing1")
+	agentID, thingID, found := bridgecfg.RemoteThingID(localThingID)
+	assert.True(t, found)
+	assert.Equal(t, "agent1", agentID)
+	assert.Equal(t, "thing1", thingID)
+
+	// the remote thingID can contain the separator
+	agentID, thingID, found = bridgecfg.RemoteThingID(bridgecfg.LocalThingID("agent1", "urn:thing1"))
+	assert.True(t, found)
+	assert.Equal(t, "agent1", agentID)
+	assert.Equal(t, "urn:thing1", thingID)
+
+	// things that aren't bridged
+	for _, id := range []string{"thing1", ":thing1", "agent1:", ""} {
+		_, _, found = bridgecfg.RemoteThingID(id)
+		assert.False(t, found, id)
+	}
+}
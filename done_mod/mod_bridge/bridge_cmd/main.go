@@ -0,0 +1,48 @@
+// Package main with the federation bridge between hubs
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	bridgecfg "github.com/hiveot/hub/done_mod/mod_bridge/bridge_cfg"
+	bridgesrv "github.com/hiveot/hub/done_mod/mod_bridge/bridge_srv"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/plugin"
+)
+
+// Connect the bridge to the remote hub and start the service.
+// Preconditions:
+//  1. The remote hub CA certificate and login credentials of the bridge must be in
+//     the remote certs directory, as set in the bridge configuration.
+func main() {
+	env := plugin.GetAppEnvironment("", true)
+	logging.SetLogging(env.LogLevel, "")
+	slog.Warn("Starting bridge service", "clientID", env.ClientID, "loglevel", env.LogLevel)
+
+	cfg := bridgecfg.NewBridgeConfig()
+	err := env.LoadConfig(&cfg)
+	if err != nil {
+		slog.Error("bridge: Failed loading configuration", "err", err)
+		os.Exit(1)
+	}
+	remoteID := cfg.Remote.ClientID
+	if remoteID == "" {
+		remoteID = env.ClientID
+	}
+	remoteCertsDir := cfg.Remote.CertsDir
+	if !path.IsAbs(remoteCertsDir) {
+		remoteCertsDir = path.Join(env.CertsDir, remoteCertsDir)
+	}
+	remoteHC, err := clidone.ConnectToHub(
+		cfg.Remote.URL, remoteID, remoteCertsDir, "", cfg.Remote.Password)
+	if err != nil {
+		slog.Error("bridge: Failed connecting to the remote hub",
+			"url", cfg.Remote.URL, "err", err)
+		os.Exit(1)
+	}
+	svc := bridgesrv.NewBridgeService(cfg, remoteHC)
+	plugin.StartPlugin(svc, &env)
+}
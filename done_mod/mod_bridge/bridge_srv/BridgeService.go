@@ -0,0 +1,143 @@
+package bridgesrv
+
+import (
+	"fmt"
+	"log/slog"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	bridgecfg "github.com/hiveot/hub/done_mod/mod_bridge/bridge_cfg"
+	"github.com/hiveot/hub/done_tool/ser"
+	"github.com/hiveot/hub/done_tool/things"
+)
+
+// BridgeService links two independent hubs.
+//
+// Remote Things that match the rules appear on the local hub with the bridge's clientID
+// as agentID and thingID {remoteAgentID}:{remoteThingID}. The bridge can only publish
+// events under its own agentID, so the remote agentID is included in the thingID.
+//
+// Events of the remote hub, including TD documents, are republished on the local hub.
+// Action and config requests for the bridged Things are passed to the remote hub.
+type BridgeService struct {
+	cfg bridgecfg.BridgeConfig
+	// connection to the local hub
+	hc *clidone.HubClient
+	// connection to the remote hub
+	remoteHC *clidone.HubClient
+}
+
+// onLocalAction passes an action request for a bridged Thing to the remote hub
+func (svc *BridgeService) onLocalAction(msg *things.ThingValue) (reply []byte, err error) {
+	agentID, thingID, err := svc.toRemote(msg)
+	if err != nil {
+		return nil, err
+	}
+	return svc.remoteHC.PubAction(agentID, thingID, msg.Name, msg.Data)
+}
+
+// onLocalConfig passes a config request for a bridged Thing to the remote hub
+func (svc *BridgeService) onLocalConfig(msg *things.ThingValue) error {
+	agentID, thingID, err := svc.toRemote(msg)
+	if err != nil {
+		return err
+	}
+	return svc.remoteHC.PubConfig(agentID, thingID, msg.Name, msg.Data)
+}
+
+// onRemoteEvent republishes an event of the remote hub on the local hub.
+// TD documents are republished with the local thingID.
+func (svc *BridgeService) onRemoteEvent(msg *things.ThingValue) {
+	// don't echo the bridge's own messages
+	if msg.AgentID == svc.remoteHC.ClientID() ||
+		!svc.cfg.Match(transport.MessageTypeEvent, msg.AgentID, msg.ThingID, msg.Name) {
+		return
+	}
+	localThingID := bridgecfg.LocalThingID(msg.AgentID, msg.ThingID)
+	payload := msg.Data
+	if msg.Name == transport.EventNameTD {
+		// keep the unknown TD fields intact
+		var td map[string]interface{}
+		err := ser.Unmarshal(msg.Data, &td)
+		if err != nil {
+			slog.Warn("onRemoteEvent: invalid TD",
+				slog.String("agentID", msg.AgentID),
+				slog.String("thingID", msg.ThingID),
+				slog.String("err", err.Error()))
+			return
+		}
+		td["id"] = localThingID
+		payload, _ = ser.Marshal(td)
+	}
+	err := svc.hc.PubEvent(localThingID, msg.Name, payload)
+	if err != nil {
+		slog.Warn("onRemoteEvent: failed republishing event",
+			slog.String("thingID", localThingID),
+			slog.String("name", msg.Name),
+			slog.String("err", err.Error()))
+	}
+}
+
+// toRemote returns the remote agentID and thingID of a request for a bridged Thing.
+// This returns an error if the Thing isn't bridged or the rules don't allow the request.
+func (svc *BridgeService) toRemote(msg *things.ThingValue) (agentID, thingID string, err error) {
+	agentID, thingID, found := bridgecfg.RemoteThingID(msg.ThingID)
+	if !found {
+		err = fmt.Errorf("thing '%s' is not a bridged thing", msg.ThingID)
+	} else if !svc.cfg.Match(msg.ValueType, agentID, thingID, msg.Name) {
+		err = fmt.Errorf("%s '%s' of thing '%s' is not forwarded by the bridge",
+			msg.ValueType, msg.Name, msg.ThingID)
+	}
+	if err != nil {
+		slog.Warn("bridge request denied",
+			slog.String("senderID", msg.SenderID), slog.String("err", err.Error()))
+		return "", "", err
+	}
+	slog.Info("forwarding request to the remote hub",
+		slog.String("msgType", msg.ValueType),
+		slog.String("senderID", msg.SenderID),
+		slog.String("agentID", agentID),
+		slog.String("thingID", thingID),
+		slog.String("name", msg.Name))
+	return agentID, thingID, nil
+}
+
+// Start the bridge.
+// This subscribes to the remote events that match the rules, and handles the action
+// and config requests for the bridged Things.
+func (svc *BridgeService) Start(hc *clidone.HubClient) (err error) {
+	slog.Warn("Starting BridgeService", "clientID", hc.ClientID(),
+		"remoteClientID", svc.remoteHC.ClientID())
+	svc.hc = hc
+	if len(svc.cfg.Rules) == 0 {
+		slog.Warn("BridgeService has no rules. Nothing is forwarded.")
+	}
+	svc.remoteHC.SetEventHandler(svc.onRemoteEvent)
+	for _, rule := range svc.cfg.EventRules() {
+		err = svc.remoteHC.SubEvents(rule.AgentID, rule.ThingID, rule.Name)
+		if err != nil {
+			return fmt.Errorf("failed subscribing to remote events: %w", err)
+		}
+	}
+	svc.hc.SetActionHandler(svc.onLocalAction)
+	svc.hc.SetConfigHandler(svc.onLocalConfig)
+	return nil
+}
+
+// Stop the bridge and disconnect from the remote hub
+func (svc *BridgeService) Stop() {
+	slog.Warn("Stopping BridgeService")
+	svc.remoteHC.Disconnect()
+}
+
+// NewBridgeService creates a bridge service
+//
+//	cfg is the bridge configuration with the forwarding rules
+//	remoteHC is the connection to the remote hub. It is disconnected when the bridge stops.
+func NewBridgeService(cfg bridgecfg.BridgeConfig, remoteHC *clidone.HubClient) *BridgeService {
+	svc := &BridgeService{
+		cfg:      cfg,
+		remoteHC: remoteHC,
+	}
+	return svc
+}
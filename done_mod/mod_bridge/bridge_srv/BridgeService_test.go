@@ -0,0 +1,129 @@
+package bridgesrv_test
+
+import (
+	"testing"
+	"time"
+
+	vocab "github.com/hiveot/hub/done_api/api_go"
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	bridgecfg "github.com/hiveot/hub/done_mod/mod_bridge/bridge_cfg"
+	bridgesrv "github.com/hiveot/hub/done_mod/mod_bridge/bridge_srv"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/ser"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/hiveot/hub/done_tool/things"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const bridgeID = "bridge1"
+const deviceID = "device1"
+const thingID = "thing1"
+
+// startBridge starts a local and a remote test hub and the bridge between them.
+// This returns a device on the remote hub and a user on the local hub.
+func startBridge(t *testing.T, cfg bridgecfg.BridgeConfig) (
+	device *clidone.HubClient, user *clidone.HubClient, stopFn func()) {
+
+	logging.SetLogging("warning", "")
+	localTS, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	remoteTS, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+
+	remoteHC, err := remoteTS.AddConnectService(bridgeID)
+	require.NoError(t, err)
+	stopSvc, err := localTS.StartService(bridgeID, bridgesrv.NewBridgeService(cfg, remoteHC))
+	require.NoError(t, err)
+
+	device, err = remoteTS.AddConnectDevice(deviceID)
+	require.NoError(t, err)
+	user, err = localTS.AddConnectUser("user1", authapi.ClientRoleOperator)
+	require.NoError(t, err)
+	return device, user, func() {
+		user.Disconnect()
+		device.Disconnect()
+		stopSvc()
+		remoteTS.Stop()
+		localTS.Stop()
+	}
+}
+
+// Remote events appear on the local hub under the bridge, with the TD id rewritten
+func TestRemoteEvents(t *testing.T) {
+	cfg := bridgecfg.NewBridgeConfig()
+	cfg.Rules = []bridgecfg.BridgeRule{
+		{MsgType: transport.MessageTypeEvent, AgentID: deviceID, ThingID: thingID}}
+	device, user, stopFn := startBridge(t, cfg)
+	defer stopFn()
+
+	rxChan := make(chan *things.ThingValue, 10)
+	user.SetEventHandler(func(msg *things.ThingValue) {
+		rxChan <- msg
+	})
+	err := user.SubEvents(bridgeID, "", "")
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+
+	localThingID := bridgecfg.LocalThingID(deviceID, thingID)
+	td := things.NewTD(thingID, "remote thing", vocab.ThingSensor)
+	err = device.PubTD(td)
+	require.NoError(t, err)
+	// events of things without a rule are not forwarded
+	err = device.PubEvent("thing2", "temperature", []byte("20"))
+	require.NoError(t, err)
+	err = device.PubEvent(thingID, "temperature", []byte("21"))
+	require.NoError(t, err)
+
+	received := make(map[string]*things.ThingValue)
+	for len(received) < 2 {
+		select {
+		case msg := <-rxChan:
+			received[msg.ThingID+"/"+msg.Name] = msg
+		case <-time.After(time.Second):
+			t.Fatalf("received %d of 2 events", len(received))
+		}
+	}
+	tdMsg := received[localThingID+"/"+transport.EventNameTD]
+	require.NotNil(t, tdMsg)
+	assert.Equal(t, bridgeID, tdMsg.AgentID)
+	localTD := things.TD{}
+	err = ser.Unmarshal(tdMsg.Data, &localTD)
+	require.NoError(t, err)
+	assert.Equal(t, localThingID, localTD.ID)
+	assert.Equal(t, td.Title, localTD.Title)
+
+	eventMsg := received[localThingID+"/temperature"]
+	require.NotNil(t, eventMsg)
+	assert.Equal(t, "21", string(eventMsg.Data))
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, rxChan)
+}
+
+// Actions for bridged things are passed to the remote agent if a rule allows it
+func TestLocalActions(t *testing.T) {
+	cfg := bridgecfg.NewBridgeConfig()
+	cfg.Rules = []bridgecfg.BridgeRule{
+		{MsgType: transport.MessageTypeAction, AgentID: deviceID, Name: "switch"}}
+	device, user, stopFn := startBridge(t, cfg)
+	defer stopFn()
+
+	device.SetActionHandler(func(msg *things.ThingValue) ([]byte, error) {
+		assert.Equal(t, thingID, msg.ThingID)
+		return msg.Data, nil
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	localThingID := bridgecfg.LocalThingID(deviceID, thingID)
+	reply, err := user.PubAction(bridgeID, localThingID, "switch", []byte("on"))
+	require.NoError(t, err)
+	assert.Equal(t, "on", string(reply))
+
+	// actions without a rule and things that aren't bridged are refused
+	_, err = user.PubAction(bridgeID, localThingID, "dim", []byte("50"))
+	assert.Error(t, err)
+	_, err = user.PubAction(bridgeID, thingID, "switch", []byte("on"))
+	assert.Error(t, err)
+}
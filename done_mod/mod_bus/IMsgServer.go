@@ -66,7 +66,14 @@ type IMsgServer interface {
 	//  authInfo with client info used to create and verify the token
 	CreateToken(authInfo ClientAuthInfo) (token string, err error)
 
-	// GetServerURLs returns the server URLs
+	// DecodeToken returns the ID and validity of a token created with CreateToken.
+	// The NATS nkey public key serves as its own ID and has no issue or expiry time.
+	//
+	//  token to decode
+	//  Returns the unique tokenID and the issue and expiry time in msec since epoch
+	DecodeToken(token string) (tokenID string, issuedMSE int64, expiryMSE int64, err error)
+
+	// GetServerURLs returns the server URLs. wssURL is empty if websockets are disabled.
 	GetServerURLs() (tlsURL string, wssURL string, udsURL string)
 
 	// SetRolePermissions sets the roles used in authorization.
@@ -77,6 +84,19 @@ type IMsgServer interface {
 	//  rolePerm is a map of [role]permissions. Use nil to revert back to the default role permissions.
 	SetRolePermissions(rolePerm map[string][]RolePermission)
 
+	// SetAuthErrorHandler sets the handler that is invoked when a client fails to
+	// authenticate with the server. Intended to count failed password logins.
+	//
+	//  handler is invoked with the login ID and remote address, or nil to remove the handler
+	SetAuthErrorHandler(handler func(loginID string, remoteAddr string))
+
+	// SetRevokedTokens sets the IDs of tokens that are no longer accepted.
+	// This replaces the previous list of revoked tokens. Connections that were
+	// authenticated with a revoked token are closed.
+	//
+	//  tokenIDs are the IDs obtained with DecodeToken
+	SetRevokedTokens(tokenIDs []string)
+
 	// SetServicePermissions sets the roles that are allowed to use a service capability.
 	// This amends the role permissions with the service capabilities.
 	// Intended for registering services.
@@ -0,0 +1,252 @@
+package buscfg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/hiveot/hub/done_tool/certs"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nkeys"
+)
+
+// DefaultLeafNodeKeyFile is the file with the nkey a hub uses to connect as a leaf node
+const DefaultLeafNodeKeyFile = "leafnode.key"
+
+// SiteSubjectPrefix is the subject prefix under which the events of a site hub are
+// imported into the application account: {prefix}.{siteName}.event.>
+// The server relays them to the event subject with the site's agent prefix.
+const SiteSubjectPrefix = "_site"
+
+// LeafNodeConfig configures the leaf node connections between hubs at different sites.
+//
+// A site hub connects as a leaf node to a central hub. The central hub accepts the
+// connections of the sites it knows, each bound to its own account. Events published
+// at a site are passed to the central hub, where the site's agents appear with the
+// site's agent prefix, eg agent "zwave" of site "building1" appears as "building1-zwave".
+// Actions and RPC requests are not passed to the sites.
+type LeafNodeConfig struct {
+	// Port to listen on for leaf node connections of site hubs. Default 0 is disabled.
+	Port int `yaml:"port,omitempty"`
+	// Sites that are allowed to connect to this hub as a leaf node
+	Sites []LeafNodeSite `yaml:"sites,omitempty"`
+	// Remotes are the hubs this hub connects to as a leaf node
+	Remotes []LeafNodeRemote `yaml:"remotes,omitempty"`
+}
+
+// LeafNodeSite describes a site hub that is allowed to connect as a leaf node
+type LeafNodeSite struct {
+	// Name of the site. Used as the name of the site's account.
+	Name string `yaml:"name"`
+	// PubKey is the public nkey of the site hub's leaf node key
+	PubKey string `yaml:"pubKey"`
+	// AgentPrefix is prepended to the agent IDs of the site. Default is "{name}-"
+	AgentPrefix string `yaml:"agentPrefix,omitempty"`
+}
+
+// LeafNodeRemote describes a hub to connect to as a leaf node
+type LeafNodeRemote struct {
+	// URL of the remote hub leaf node listener, eg "tls://central:7422"
+	URL string `yaml:"url"`
+	// KeyFile holds the nkey seed to authenticate with. Default is DefaultLeafNodeKeyFile.
+	KeyFile string `yaml:"keyFile,omitempty"`
+	// CaCertFile holds the CA certificate of the remote hub. Default is this hub's CA.
+	CaCertFile string `yaml:"caCertFile,omitempty"`
+
+	KP     nkeys.KeyPair     `yaml:"-"` // preset, load, or generate
+	CaCert *x509.Certificate `yaml:"-"` // preset, load, or the hub CA
+}
+
+// ClusterConfig configures the routes between the servers of a hub cluster.
+// Cluster servers share the hub CA and authenticate each other with their server certificate.
+type ClusterConfig struct {
+	// Name of the cluster. Required to enable clustering.
+	Name string `yaml:"name,omitempty"`
+	// ServerName is the unique name of this server in the cluster.
+	// Default is "{host}-{port}", which is unique for servers on the same host.
+	ServerName string `yaml:"serverName,omitempty"`
+	// Port to listen on for routes. Default is 6222.
+	Port int `yaml:"port,omitempty"`
+	// Routes are the URLs of the other cluster servers, eg "nats-route://hub2:6222"
+	Routes []string `yaml:"routes,omitempty"`
+}
+
+// GetAgentPrefix returns the prefix of the agent IDs of the site
+func (site *LeafNodeSite) GetAgentPrefix() string {
+	if site.AgentPrefix == "" {
+		return site.Name + "-"
+	}
+	return site.AgentPrefix
+}
+
+// setupLeafNodes loads or creates the keys and CA certificates of the leaf node remotes.
+// Remotes without a CA use the hub's CA.
+//
+//	keysDir is the default location of key and certificate files
+//	writeChanges persists generated keys
+func (cfg *NatsServerConfig) setupLeafNodes(keysDir string, writeChanges bool) (err error) {
+	for _, site := range cfg.LeafNodes.Sites {
+		if site.Name == "" || strings.ContainsAny(site.Name, ". *>") {
+			return fmt.Errorf("invalid leaf node site name '%s'", site.Name)
+		} else if !nkeys.IsValidPublicUserKey(site.PubKey) {
+			return fmt.Errorf("leaf node site '%s' has an invalid public key", site.Name)
+		}
+	}
+	for i := range cfg.LeafNodes.Remotes {
+		remote := &cfg.LeafNodes.Remotes[i]
+		if remote.KP == nil {
+			keyFile := remote.KeyFile
+			if keyFile == "" {
+				keyFile = DefaultLeafNodeKeyFile
+			}
+			if !path.IsAbs(keyFile) {
+				keyFile = path.Join(keysDir, keyFile)
+			}
+			// LoadCreateUserKP uses the {clientID}.key convention
+			remote.KP, err = cfg.LoadCreateUserKP(
+				strings.TrimSuffix(path.Base(keyFile), ".key"), path.Dir(keyFile), writeChanges)
+			if err != nil {
+				return fmt.Errorf("failed loading the leaf node key: %w", err)
+			}
+		}
+		if remote.CaCert == nil && remote.CaCertFile != "" {
+			caCertFile := remote.CaCertFile
+			if !path.IsAbs(caCertFile) {
+				caCertFile = path.Join(keysDir, caCertFile)
+			}
+			remote.CaCert, err = certs.LoadX509CertFromPEM(caCertFile)
+			if err != nil {
+				return fmt.Errorf("failed loading the CA of leaf node remote '%s': %w", remote.URL, err)
+			}
+		}
+		if remote.CaCert == nil {
+			remote.CaCert = cfg.CaCert
+		}
+	}
+	return nil
+}
+
+// createAccountsConfig returns the accounts section of the server config file.
+// Each site has an account that exports its events to the application account, where they
+// are imported with the SiteSubjectPrefix.
+func (cfg *NatsServerConfig) createAccountsConfig() string {
+	imports := ""
+	siteAccounts := ""
+	for _, site := range cfg.LeafNodes.Sites {
+		imports += fmt.Sprintf(`
+			{stream: {account: "%s", subject: "event.>"}, prefix: "%s.%s"}`,
+			site.Name, SiteSubjectPrefix, site.Name)
+		siteAccounts += fmt.Sprintf(`
+	"%s": {
+		exports: [ {stream: "event.>"} ]
+	}`, site.Name)
+	}
+	return `
+accounts {
+	` + cfg.AppAccountName + `: {
+		jetstream: enabled
+		imports: [` + imports + `
+		]
+	}` + siteAccounts + `
+}`
+}
+
+// applyClusterOptions configures the cluster routes, if a cluster name is set.
+//
+//	tlsConfig is the server TLS configuration, used for mutual TLS between cluster servers
+func (cfg *NatsServerConfig) applyClusterOptions(natsOpts *server.Options, tlsConfig *tls.Config) error {
+	if cfg.Cluster.Name == "" {
+		return nil
+	}
+	if cfg.Cluster.Port == 0 {
+		cfg.Cluster.Port = 6222
+	}
+	if cfg.Cluster.ServerName == "" {
+		cfg.Cluster.ServerName = fmt.Sprintf("%s-%d", cfg.Host, cfg.Cluster.Port)
+	}
+	// jetstream in a cluster requires a unique server name
+	natsOpts.ServerName = cfg.Cluster.ServerName
+	natsOpts.Cluster.Name = cfg.Cluster.Name
+	natsOpts.Cluster.Host = cfg.Host
+	natsOpts.Cluster.Port = cfg.Cluster.Port
+	if tlsConfig != nil {
+		// servers connect to each other using their server certificate as client certificate
+		routeTLS := tlsConfig.Clone()
+		routeTLS.ClientAuth = tls.RequireAndVerifyClientCert
+		// routes verify the server certificate against the host of the route URL
+		routeTLS.ServerName = ""
+		routeTLS.GetClientCertificate = func(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cfg.GetServerTLS != nil {
+				return cfg.GetServerTLS(nil)
+			}
+			return cfg.ServerTLS, nil
+		}
+		natsOpts.Cluster.TLSConfig = routeTLS
+	}
+	for _, route := range cfg.Cluster.Routes {
+		routeURL, err := url.Parse(route)
+		if err != nil {
+			return fmt.Errorf("invalid cluster route '%s': %w", route, err)
+		}
+		natsOpts.Routes = append(natsOpts.Routes, routeURL)
+	}
+	return nil
+}
+
+// applyLeafNodeOptions configures the leaf node listener for sites and the remotes
+// to connect to. The nkey users of the sites are stored in LeafNodeUsers.
+//
+//	tlsConfig is the server TLS configuration, used by the leaf node listener
+func (cfg *NatsServerConfig) applyLeafNodeOptions(natsOpts *server.Options, tlsConfig *tls.Config) error {
+	cfg.LeafNodeUsers = nil
+	if cfg.LeafNodes.Port > 0 {
+		natsOpts.LeafNode.Host = cfg.Host
+		natsOpts.LeafNode.Port = cfg.LeafNodes.Port
+		natsOpts.LeafNode.TLSConfig = tlsConfig
+	}
+	for _, site := range cfg.LeafNodes.Sites {
+		var siteAcct *server.Account
+		for _, acct := range natsOpts.Accounts {
+			if acct.Name == site.Name {
+				siteAcct = acct
+			}
+		}
+		if siteAcct == nil {
+			return fmt.Errorf("missing account of leaf node site '%s'", site.Name)
+		}
+		// site users can only be used for leaf node connections
+		cfg.LeafNodeUsers = append(cfg.LeafNodeUsers, &server.NkeyUser{
+			Nkey:    site.PubKey,
+			Account: siteAcct,
+			AllowedConnectionTypes: map[string]struct{}{
+				"LEAFNODE": {},
+			},
+		})
+	}
+	for _, remote := range cfg.LeafNodes.Remotes {
+		remoteURL, err := url.Parse(remote.URL)
+		if err != nil {
+			return fmt.Errorf("invalid leaf node remote '%s': %w", remote.URL, err)
+		}
+		seed, _ := remote.KP.Seed()
+		remoteOpts := &server.RemoteLeafOpts{
+			LocalAccount: cfg.AppAccountName,
+			URLs:         []*url.URL{remoteURL},
+			Nkey:         string(seed),
+		}
+		if remote.CaCert != nil {
+			caCertPool := x509.NewCertPool()
+			caCertPool.AddCert(remote.CaCert)
+			remoteOpts.TLS = true
+			remoteOpts.TLSConfig = &tls.Config{
+				RootCAs:    caCertPool,
+				MinVersion: tls.VersionTLS13,
+			}
+		}
+		natsOpts.LeafNode.Remotes = append(natsOpts.LeafNode.Remotes, remoteOpts)
+	}
+	return nil
+}
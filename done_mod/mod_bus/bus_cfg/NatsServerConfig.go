@@ -22,7 +22,7 @@ const NoAuthUserID = "unauthenticated"
 type NatsServerConfig struct {
 	Host            string            `yaml:"host,omitempty"`            // default: localhost
 	Port            int               `yaml:"port,omitempty"`            // default: 4222
-	WSPort          int               `yaml:"wsPort,omitempty"`          // default: 0 (disabled)
+	WSPort          int               `yaml:"wsPort,omitempty"`          // websocket port, default: 0 (disabled)
 	LogLevel        string            `yaml:"logLevel,omitempty"`        // default: warn
 	LogFile         string            `yaml:"logFile,omitempty"`         // default: no logfile
 	Debug           bool              `yaml:"debug,omitempty"`           // default: false
@@ -33,12 +33,21 @@ type NatsServerConfig struct {
 	CaCert          *x509.Certificate `yaml:"-"` // preset, load, or error
 	CaKey           keys.IHiveKey     `yaml:"-"` // preset, load, or error
 	ServerTLS       *tls.Certificate  `yaml:"-"` // preset, load, or generate
-	AppAccountKP    nkeys.KeyPair     `yaml:"-"` // preset, load, or generate
-	AdminUserKP     nkeys.KeyPair     `yaml:"-"` // generated
-	CoreServiceKP   nkeys.KeyPair     `yaml:"-"` // generated
-	SystemAccountKP nkeys.KeyPair     `yaml:"-"` // generated
-	SystemUserKP    nkeys.KeyPair     `yaml:"-"` // generated
-	AppAcct         *server.Account   `yaml:"-"`
+	// GetServerTLS optionally provides the server certificate for each connection. Used for renewals.
+	GetServerTLS    func(*tls.ClientHelloInfo) (*tls.Certificate, error) `yaml:"-"`
+	AppAccountKP    nkeys.KeyPair                                        `yaml:"-"` // preset, load, or generate
+	AdminUserKP     nkeys.KeyPair                                        `yaml:"-"` // generated
+	CoreServiceKP   nkeys.KeyPair                                        `yaml:"-"` // generated
+	SystemAccountKP nkeys.KeyPair                                        `yaml:"-"` // generated
+	SystemUserKP    nkeys.KeyPair                                        `yaml:"-"` // generated
+	AppAcct         *server.Account                                      `yaml:"-"`
+
+	// LeafNodes connects hubs at different sites
+	LeafNodes LeafNodeConfig `yaml:"leafNodes,omitempty"`
+	// Cluster of servers of a single hub
+	Cluster ClusterConfig `yaml:"cluster,omitempty"`
+	// LeafNodeUsers are the nkey users of the leaf node sites. Set by CreateNatsNKeyOptions.
+	LeafNodeUsers []*server.NkeyUser `yaml:"-"`
 }
 
 // Setup the nats server config.
@@ -63,9 +72,6 @@ func (cfg *NatsServerConfig) Setup(keysDir, storesDir string, writeChanges bool)
 	if cfg.Port == 0 {
 		cfg.Port = 4222
 	}
-	if cfg.WSPort == 0 {
-		//appCfg.WSPort = 8222
-	}
 	if cfg.DataDir == "" {
 		cfg.DataDir = path.Join(storesDir, "natsserver")
 	}
@@ -138,7 +144,9 @@ func (cfg *NatsServerConfig) Setup(keysDir, storesDir string, writeChanges bool)
 		cfg.SystemUserKP, _ = cfg.LoadCreateUserKP(cfg.AppAccountName+"System", keysDir, writeChanges)
 	}
 
-	return nil
+	// Step 5: load or generate the leaf node keys
+	err = cfg.setupLeafNodes(keysDir, writeChanges)
+	return err
 }
 
 // CreateNatsNKeyOptions create a Nats options struct for use with NKey authentication.
@@ -149,12 +157,8 @@ func (cfg *NatsServerConfig) CreateNatsNKeyOptions() (server.Options, error) {
 
 	// create the config to load
 	// Frustratingly, this is the only way to enable jetstream on an account that persists after options reload
-	cfgContent := ` 
-accounts { 
-	` + cfg.AppAccountName + `: {
-		jetstream: enabled
-	}
-}`
+	// The same goes for the imports of leaf node site events.
+	cfgContent := cfg.createAccountsConfig()
 
 	err := os.WriteFile(tmpFile, []byte(cfgContent), 0600)
 	if err != nil {
@@ -205,11 +209,12 @@ accounts {
 	natsOpts.Debug = cfg.Debug
 	natsOpts.Logtime = true
 
+	var tlsConfig *tls.Config
 	if cfg.CaCert != nil && cfg.ServerTLS != nil {
 		caCertPool := x509.NewCertPool()
 		caCertPool.AddCert(cfg.CaCert)
 		clientCertList := []tls.Certificate{*cfg.ServerTLS}
-		tlsConfig := &tls.Config{
+		tlsConfig = &tls.Config{
 			ServerName:   "HiveOT Hub",
 			ClientCAs:    caCertPool,
 			RootCAs:      caCertPool,
@@ -217,10 +222,33 @@ accounts {
 			ClientAuth:   tls.VerifyClientCertIfGiven,
 			MinVersion:   tls.VersionTLS13,
 		}
+		// renewed certificates are used for new connections without restarting
+		if cfg.GetServerTLS != nil {
+			tlsConfig.Certificates = nil
+			tlsConfig.GetCertificate = cfg.GetServerTLS
+		}
 		natsOpts.AuthTimeout = 101 // for debugging auth
 		natsOpts.TLSTimeout = 100  // for debugging auth
 		natsOpts.TLSConfig = tlsConfig
 	}
+	// The websocket listener uses the same server certificate.
+	// Websocket clients authenticate the same way as tcp clients, using nkeys, passwords
+	// or the auth callout, as long as no websocket specific auth is configured.
+	if cfg.WSPort > 0 {
+		natsOpts.Websocket = server.WebsocketOpts{
+			Host:        cfg.Host,
+			Port:        cfg.WSPort,
+			TLSConfig:   tlsConfig,
+			NoTLS:       tlsConfig == nil,
+			Compression: true,
+		}
+	}
+	// multi-site hubs and clusters
+	err = cfg.applyLeafNodeOptions(&natsOpts, tlsConfig)
+	if err == nil {
+		err = cfg.applyClusterOptions(&natsOpts, tlsConfig)
+	}
+	natsOpts.Nkeys = append(natsOpts.Nkeys, cfg.LeafNodeUsers...)
 	return natsOpts, err
 }
 
@@ -1,19 +1,25 @@
 package main
 
 import (
+	"crypto/x509"
 	"flag"
 	"fmt"
+	"log/slog"
 	"net/url"
 	"os"
 	"strconv"
 	"time"
 
 	donecfg "github.com/hiveot/hub/done_cfg"
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
 	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
 	authservice "github.com/hiveot/hub/done_mod/mod_auth/auth_srv"
 	bussrv "github.com/hiveot/hub/done_mod/mod_bus/bus_srv"
+	"github.com/hiveot/hub/done_tool/certs"
 	"github.com/hiveot/hub/done_tool/discovery"
 	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/metrics"
 	"github.com/hiveot/hub/done_tool/plugin"
 )
 
@@ -52,16 +58,30 @@ func main() {
 		fmt.Println("ERROR:", err.Error())
 		os.Exit(1)
 	}
-	err = run(hubCfg)
+	err = run(hubCfg, env.MetricsAddr)
 	if err != nil {
 		_, _ = fmt.Fprint(os.Stderr, err.Error()+"\n")
 		os.Exit(1)
 	}
 }
 
+// connectCore returns an in-process Hub connection for the core to publish events
+func connectCore(msgServer *bussrv.NatsMsgServer) (*clidone.HubClient, error) {
+	nc, err := msgServer.ConnectInProc(donecfg.CoreServiceID, nil)
+	if err != nil {
+		return nil, err
+	}
+	tp := transport.NewNatsTransport("", donecfg.CoreServiceID, nil)
+	err = tp.ConnectWithConn(nc)
+	hc := clidone.NewHubClientFromTransport(tp, donecfg.CoreServiceID)
+	return hc, err
+}
+
 // run starts the server and core services
 // This does not return until a signal is received
-func run(cfg *donecfg.HubCoreConfig) error {
+//
+//	metricsAddr is the optional address to serve the server metrics on
+func run(cfg *donecfg.HubCoreConfig, metricsAddr string) error {
 	var err error
 
 	msgServer := bussrv.NewNatsMsgServer(&cfg.NatsServer, authapi.DefaultRolePermissions)
@@ -74,27 +94,64 @@ func run(cfg *donecfg.HubCoreConfig) error {
 	// Start the auth service. NATS requires brcypt passwords
 	authSvc, _ := authservice.StartAuthService(cfg.Auth, msgServer, cfg.CaCert)
 
+	// renew the server certificate before it expires and let clients know
+	coreHC, err := connectCore(msgServer)
+	if err != nil {
+		return fmt.Errorf("unable to connect the core: %w", err)
+	}
+	cfg.ServerCertManager.SetRenewedHandler(func(cert *x509.Certificate) {
+		err2 := coreHC.PubEvent(donecfg.CoreServiceID, donecfg.ServerCertRenewedEvent,
+			[]byte(certs.X509CertToPEM(cert)))
+		if err2 != nil {
+			slog.Error("failed publishing the renewed server certificate", "err", err2.Error())
+		}
+	})
+	cfg.ServerCertManager.Start(0)
+
+	// serve the messaging server statistics and the RPC requests of the core client
+	if metricsAddr != "" {
+		metrics.DefaultRegistry.Register(msgServer)
+		metrics.DefaultRegistry.Register(coreHC)
+		metricsSrv, err := metrics.StartMetricsServer(metricsAddr, metrics.DefaultRegistry)
+		if err != nil {
+			return err
+		}
+		defer metricsSrv.Close()
+	}
+
 	// start discovery
-	serverURL, _, _ := msgServer.GetServerURLs()
+	serverURL, wssURL, _ := msgServer.GetServerURLs()
 	if cfg.EnableMDNS {
 		urlInfo, err := url.Parse(serverURL)
 		if err != nil {
 			return err
 		}
 		port, _ := strconv.Atoi(urlInfo.Port())
+		params := map[string]string{
+			discovery.ParamRawURL: serverURL,
+			discovery.ParamCore:   "nats",
+		}
+		// websocket clients such as browsers and the JS client use the wss address
+		if wssURL != "" {
+			params[discovery.ParamWSSURL] = wssURL
+			params[discovery.ParamWSSPort] = strconv.Itoa(cfg.NatsServer.WSPort)
+			params[discovery.ParamWSSPath] = ""
+		}
 		svc, err := discovery.ServeDiscovery(
-			"natscore", "hiveot", urlInfo.Host, port, map[string]string{
-				"rawurl": serverURL,
-				"core":   "nats",
-			})
+			"natscore", "hiveot", urlInfo.Host, port, params)
 		_ = svc
 		_ = err
 	}
 
 	// wait until signal
 	fmt.Println("NATS Hub Core started. ClientURL=" + serverURL)
+	if wssURL != "" {
+		fmt.Println("Websocket URL=" + wssURL)
+	}
 	plugin.WaitForSignal()
 
+	cfg.ServerCertManager.Stop()
+	coreHC.Disconnect()
 	authSvc.Stop()
 	msgServer.Stop()
 	// give background tasks time to stop
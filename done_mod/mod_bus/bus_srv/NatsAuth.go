@@ -2,8 +2,10 @@ package bussrv
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
 	"time"
 
 	"github.com/hiveot/hub/done_cli/cli_done/transport"
@@ -12,10 +14,17 @@ import (
 	"github.com/hiveot/hub/done_tool/keys"
 	"github.com/nats-io/jwt/v2"
 	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nkeys"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// AuthMonitorServiceID is the ID of the in-process connection that receives authentication errors
+const AuthMonitorServiceID = "authmonitor"
+
+// authErrorSubject is the system subject on which the server reports authentication errors
+const authErrorSubject = "$SYS.SERVER.*.CLIENT.AUTH.ERR"
+
 // ServicePermissions defines for each role the service capability that can be used
 //var ServicePermissions = map[string][]modbus.RolePermission{}
 
@@ -24,7 +33,12 @@ import (
 //
 //	Role permissions can be changed with 'SetRolePermissions'.
 //	Service permissions can be set with 'SetServicePermissions'
+//
+// In nkey mode the public key serves as the token. Keys that are revoked are not
+// applied, which closes the client's existing connections.
 func (srv *NatsMsgServer) ApplyAuth(clients []modbus.ClientAuthInfo) error {
+	srv.authMux.Lock()
+	defer srv.authMux.Unlock()
 
 	// password users authenticate with password while nkey users authenticate with key-pairs.
 	// clients can use both.
@@ -67,7 +81,10 @@ func (srv *NatsMsgServer) ApplyAuth(clients []modbus.ClientAuthInfo) error {
 			})
 		}
 
-		if clientInfo.PubKey != "" {
+		if clientInfo.PubKey != "" && srv.isRevoked(clientInfo.PubKey) {
+			slog.Info("ApplyAuth: public key of client is revoked",
+				slog.String("clientID", clientInfo.ClientID))
+		} else if clientInfo.PubKey != "" {
 			// add an nkey entry
 			nkeyUsers = append(nkeyUsers, &server.NkeyUser{
 				Nkey:        clientInfo.PubKey,
@@ -76,6 +93,8 @@ func (srv *NatsMsgServer) ApplyAuth(clients []modbus.ClientAuthInfo) error {
 			})
 		}
 	}
+	// keep the leaf node sites
+	nkeyUsers = append(nkeyUsers, srv.Config.LeafNodeUsers...)
 	srv.NatsOpts.Users = pwUsers
 	srv.NatsOpts.Nkeys = nkeyUsers
 	srv.authClients = authClients
@@ -132,7 +151,8 @@ func (srv *NatsMsgServer) CreateJWTToken(authInfo modbus.ClientAuthInfo) (newTok
 	// build a jwt response; user_nkey (clientPub) is the subject
 	uc := jwt.NewUserClaims(authInfo.PubKey)
 
-	// can't use claim ID as it is replaced by a hash by Encode(kp)
+	// can't set the claim ID as it is replaced by a hash by Encode(kp).
+	// This hash serves as the token ID, see DecodeToken.
 	uc.Name = authInfo.ClientID
 	uc.Tags.Add("clientType", authInfo.ClientType)
 	uc.IssuedAt = time.Now().Unix()
@@ -169,9 +189,30 @@ func (srv *NatsMsgServer) CreateJWTToken(authInfo modbus.ClientAuthInfo) (newTok
 	return newToken, err
 }
 
+// DecodeToken returns the ID and validity of a token created with CreateToken.
+// In NKey mode the token is the public key, which also serves as its ID. It has no
+// issue or expiry time.
+func (srv *NatsMsgServer) DecodeToken(token string) (
+	tokenID string, issuedMSE int64, expiryMSE int64, err error) {
+
+	if srv.NatsOpts.AuthCallout == nil {
+		if !nkeys.IsValidPublicUserKey(token) {
+			return "", 0, 0, fmt.Errorf("DecodeToken: token is not a public key")
+		}
+		return token, 0, 0, nil
+	}
+	uc, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("DecodeToken: unable to decode jwt token: %w", err)
+	}
+	return uc.ID, uc.IssuedAt * 1000, uc.Expires * 1000, nil
+}
+
 // GetClientAuth returns the client auth info for the given ID
 func (srv *NatsMsgServer) GetClientAuth(clientID string) (modbus.ClientAuthInfo, error) {
+	srv.authMux.Lock()
 	clientAuth, found := srv.authClients[clientID]
+	srv.authMux.Unlock()
 	if !found {
 		return clientAuth, fmt.Errorf("client %s not known", clientID)
 	}
@@ -214,11 +255,15 @@ func (srv *NatsMsgServer) MakePermissions(clientInfo modbus.ClientAuthInfo) *ser
 		Subscribe: &subPerm,
 		Response:  nil,
 	}
-	// all clients can subscribe to their own inbox and publish to other inboxes
+	// all clients can subscribe to their own inbox and publish to other inboxes.
+	// Request replies use the nats inbox format: _INBOX.{clientID}.{nuid}.{token}.
+	// Notifications to other inboxes must carry the clientID of the publisher as
+	// senderID, so the sender can't be forged.
 	subInbox := transport.MessageTypeINBOX + "." + clientInfo.ClientID + ".>"
 	subPerm.Allow = append(subPerm.Allow, subInbox)
-	pubInbox := transport.MessageTypeINBOX + ".>"
-	pubPerm.Allow = append(pubPerm.Allow, pubInbox)
+	replyInbox := transport.MessageTypeINBOX + ".*.*.*"
+	pubInbox := transport.MakeSubject(transport.MessageTypeINBOX, "", "", "", clientInfo.ClientID)
+	pubPerm.Allow = append(pubPerm.Allow, replyInbox, pubInbox)
 
 	// generate subjects based on role permissions
 	rolePerm, found := srv.rolePermissions[clientInfo.Role]
@@ -276,6 +321,98 @@ func (srv *NatsMsgServer) MakePermissions(clientInfo modbus.ClientAuthInfo) *ser
 	return perm
 }
 
+// onAuthError passes an authentication error reported by the server to the handler
+func (srv *NatsMsgServer) onAuthError(msg *nats.Msg) {
+	srv.authErrorMux.RLock()
+	handler := srv.authErrorHandler
+	srv.authErrorMux.RUnlock()
+	if handler == nil {
+		return
+	}
+	ev := server.DisconnectEventMsg{}
+	err := json.Unmarshal(msg.Data, &ev)
+	if err != nil {
+		slog.Error("onAuthError: invalid event", slog.String("err", err.Error()))
+		return
+	}
+	handler(ev.Client.User, ev.Client.Host)
+}
+
+// SetAuthErrorHandler sets the handler of authentication errors reported by the server.
+// Nkey and JWT authentication errors report the public key instead of a login ID.
+func (srv *NatsMsgServer) SetAuthErrorHandler(handler func(loginID string, remoteAddr string)) {
+	srv.authErrorMux.Lock()
+	srv.authErrorHandler = handler
+	srv.authErrorMux.Unlock()
+}
+
+// disconnectRevoked closes the connections that were authenticated with a revoked
+// JWT token. Used in callout mode.
+func (srv *NatsMsgServer) disconnectRevoked() {
+	connz, err := srv.ns.Connz(&server.ConnzOptions{Username: true, Limit: math.MaxInt32})
+	if err != nil {
+		slog.Error("disconnectRevoked: failed reading connections", slog.String("err", err.Error()))
+		return
+	}
+	for _, conn := range connz.Conns {
+		if conn.JWT == "" {
+			continue
+		}
+		uc, err2 := jwt.DecodeUserClaims(conn.JWT)
+		if err2 == nil && srv.isRevoked(uc.ID) {
+			slog.Info("disconnectRevoked: closing connection with revoked token",
+				slog.String("clientID", uc.Name), slog.Uint64("cid", conn.Cid))
+			_ = srv.ns.DisconnectClientByID(conn.Cid)
+		}
+	}
+}
+
+// isRevoked returns true if the token with the given ID is revoked.
+// In nkey mode the tokenID is the client's public key.
+func (srv *NatsMsgServer) isRevoked(tokenID string) bool {
+	srv.revokedMux.RLock()
+	defer srv.revokedMux.RUnlock()
+	return srv.revokedTokens[tokenID]
+}
+
+// SetRevokedTokens sets the IDs of tokens that are no longer accepted.
+// Connections that were authenticated with a revoked token are closed.
+//
+// In nkey mode the tokenID is the public key of the client. Clients whose key is
+// revoked can no longer connect until they are given a new key.
+func (srv *NatsMsgServer) SetRevokedTokens(tokenIDs []string) {
+	revoked := make(map[string]bool, len(tokenIDs))
+	for _, tokenID := range tokenIDs {
+		revoked[tokenID] = true
+	}
+	srv.revokedMux.Lock()
+	srv.revokedTokens = revoked
+	srv.revokedMux.Unlock()
+	if srv.ns == nil {
+		// not yet running
+		return
+	}
+	if srv.NatsOpts.AuthCallout != nil {
+		srv.disconnectRevoked()
+		return
+	}
+	// remove the revoked keys from the server.
+	srv.authMux.Lock()
+	hasClients := srv.authClients != nil
+	clients := make([]modbus.ClientAuthInfo, 0, len(srv.authClients))
+	for _, clientInfo := range srv.authClients {
+		clients = append(clients, clientInfo)
+	}
+	srv.authMux.Unlock()
+	if hasClients {
+		err := srv.ApplyAuth(clients)
+		if err != nil {
+			slog.Error("SetRevokedTokens: failed applying revoked keys",
+				slog.String("err", err.Error()))
+		}
+	}
+}
+
 // SetRolePermissions sets a custom map of user role->[]permissions
 func (srv *NatsMsgServer) SetRolePermissions(
 	rolePerms map[string][]modbus.RolePermission) {
@@ -308,6 +445,7 @@ func (srv *NatsMsgServer) SetServicePermissions(
 // ValidateJWTToken verifies a NATS JWT token
 //   - verify if jwtToken is a valid token
 //   - validate the token isn't expired
+//   - verify the token ID isn't revoked
 //   - verify the user's public key's nonce based signature
 //     this can only be signed when the user has its private key
 //   - verify the issuer is the signing/account key.
@@ -329,6 +467,9 @@ func (srv *NatsMsgServer) ValidateJWTToken(
 	} else if len(warns) > 0 {
 		err = fmt.Errorf("jwt auth failed: %s", warns[0])
 	}
+	if srv.isRevoked(arc.ID) {
+		return fmt.Errorf("jwt token of client '%s' has been revoked", clientID)
+	}
 	// the subject contains the public user nkey
 	// TBD: does requiring the client to be on file improve security?
 	userAuth, err := srv.GetClientAuth(clientID)
@@ -438,7 +579,26 @@ func (srv *NatsMsgServer) ValidateToken(
 		if token == "" || clientID == "" {
 			return fmt.Errorf("invalid token for client '%s'", clientID)
 		}
+		if srv.isRevoked(token) {
+			return fmt.Errorf("token of client '%s' has been revoked", clientID)
+		}
 		return nil
 	}
 	return srv.ValidateJWTToken(clientID, token, signedNonce, nonce)
 }
+
+// startAuthErrorMonitor subscribes to the authentication errors reported by the server
+// using an in-process connection with the system account.
+func (srv *NatsMsgServer) startAuthErrorMonitor() error {
+	nc, err := srv.ConnectInProc(AuthMonitorServiceID, srv.Config.SystemUserKP)
+	if err != nil {
+		return fmt.Errorf("startAuthErrorMonitor: %w", err)
+	}
+	_, err = nc.Subscribe(authErrorSubject, srv.onAuthError)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("startAuthErrorMonitor: %w", err)
+	}
+	srv.authErrorConn = nc
+	return nil
+}
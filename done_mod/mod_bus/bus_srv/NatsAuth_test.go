@@ -0,0 +1,77 @@
+package bussrv_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	stateapi "github.com/hiveot/hub/done_mod/mod_state/state_api"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/hiveot/hub/done_tool/things"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Clients reply to requests and notify other clients, but can't forge the sender
+func TestInboxPermissions(t *testing.T) {
+	const deviceID = "device1"
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+
+	user1, err := ts.AddConnectUser("user1", authapi.ClientRoleOperator)
+	require.NoError(t, err)
+	defer user1.Disconnect()
+	rxChan := make(chan *things.ThingValue, 10)
+	user1.SetEventHandler(func(msg *things.ThingValue) {
+		rxChan <- msg
+	})
+	err = user1.SubNotifications("", "")
+	require.NoError(t, err)
+
+	// the device replies to the inbox of the user
+	device, err := ts.AddConnectDevice(deviceID)
+	require.NoError(t, err)
+	defer device.Disconnect()
+	device.SetActionHandler(func(msg *things.ThingValue) ([]byte, error) {
+		return msg.Data, nil
+	})
+	time.Sleep(10 * time.Millisecond)
+	reply, err := user1.PubAction(deviceID, "thing1", "switch", []byte("on"))
+	require.NoError(t, err)
+	assert.Equal(t, "on", string(reply))
+
+	// notifications carry the sender
+	err = device.PubNotification("user1", "thing1", "alert", []byte("1"))
+	require.NoError(t, err)
+	select {
+	case msg := <-rxChan:
+		assert.Equal(t, deviceID, msg.SenderID)
+		assert.Equal(t, "alert", msg.Name)
+	case <-time.After(time.Second):
+		t.Fatal("notification not received")
+	}
+
+	// a state change notification can't be sent in the name of the state service
+	kp, token, err := ts.AddClient(authapi.ClientTypeDevice, "device2", authapi.ClientRoleDevice)
+	require.NoError(t, err)
+	tp := transport.NewNatsTransport(ts.ServerURL, "device2", ts.CaCert)
+	tp.SetConnectHandler(func(status transport.HubTransportStatus) {})
+	err = tp.ConnectWithToken(kp, token)
+	require.NoError(t, err)
+	defer tp.Disconnect()
+	forged := transport.MakeSubject(transport.MessageTypeINBOX,
+		"user1", "user1", stateapi.StateChangedEvent, stateapi.ServiceName)
+	_ = tp.PubEvent(forged, []byte(`{"key":"key1"}`))
+	// reply subjects are not delivered as notifications
+	_ = tp.PubEvent(strings.TrimSuffix(forged, "."+stateapi.ServiceName), []byte(`{"key":"key1"}`))
+	select {
+	case msg := <-rxChan:
+		t.Fatalf("forged notification received from '%s'", msg.SenderID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,174 @@
+package bussrv_test
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	buscfg "github.com/hiveot/hub/done_mod/mod_bus/bus_cfg"
+	bussrv "github.com/hiveot/hub/done_mod/mod_bus/bus_srv"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startHub sets up and starts an in-process hub server in the given directory
+func startHub(t *testing.T, homeDir string, cfg *buscfg.NatsServerConfig) *bussrv.NatsMsgServer {
+	cfg.Host = "127.0.0.1"
+	err := cfg.Setup(homeDir, path.Join(homeDir, "stores"), false)
+	require.NoError(t, err)
+	srv := bussrv.NewNatsMsgServer(cfg, authapi.DefaultRolePermissions)
+	err = srv.Start()
+	require.NoError(t, err)
+	return srv
+}
+
+// freePort returns a port that is free to listen on
+func freePort(t *testing.T) int {
+	port, err := testenv.GetFreePort()
+	require.NoError(t, err)
+	return port
+}
+
+// Run a central hub and a site hub that connects to it as a leaf node.
+// Events of the site's agents must appear at the central hub with the site prefix.
+func TestLeafNodeSiteEvents(t *testing.T) {
+	logging.SetLogging("warning", "")
+	slog.Info("--- TestLeafNodeSiteEvents ---")
+	const siteName = "building1"
+	leafPort := freePort(t)
+	siteKP, _ := nkeys.CreateUser()
+	sitePub, _ := siteKP.PublicKey()
+
+	centralCfg := &buscfg.NatsServerConfig{Port: -1}
+	centralCfg.LeafNodes.Port = leafPort
+	centralCfg.LeafNodes.Sites = []buscfg.LeafNodeSite{{Name: siteName, PubKey: sitePub}}
+	central := startHub(t, t.TempDir(), centralCfg)
+	defer central.Stop()
+
+	siteCfg := &buscfg.NatsServerConfig{Port: -1}
+	siteCfg.LeafNodes.Remotes = []buscfg.LeafNodeRemote{{
+		URL:    fmt.Sprintf("tls://127.0.0.1:%d", leafPort),
+		KP:     siteKP,
+		CaCert: centralCfg.CaCert,
+	}}
+	site := startHub(t, t.TempDir(), siteCfg)
+	defer site.Stop()
+
+	// subscribe to site events at the central hub
+	centralConn, err := central.ConnectInProc("central", nil)
+	require.NoError(t, err)
+	defer centralConn.Close()
+	rxChan := make(chan *nats.Msg, 1)
+	_, err = centralConn.Subscribe("event."+siteName+"-zwave.>", func(msg *nats.Msg) {
+		rxChan <- msg
+	})
+	require.NoError(t, err)
+
+	// the leaf node connection is established asynchronously
+	siteConn, err := site.ConnectInProc("zwave", nil)
+	require.NoError(t, err)
+	defer siteConn.Close()
+	var rxMsg *nats.Msg
+	for i := 0; i < 50 && rxMsg == nil; i++ {
+		err = siteConn.Publish("event.zwave.thing1.temperature.zwave", []byte("21.5"))
+		require.NoError(t, err)
+		select {
+		case rxMsg = <-rxChan:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	require.NotNil(t, rxMsg, "site event not received at the central hub")
+	assert.Equal(t, "event.building1-zwave.thing1.temperature.zwave", rxMsg.Subject)
+	assert.Equal(t, "21.5", string(rxMsg.Data))
+
+	// central hub events are not passed to the site
+	siteRx := make(chan *nats.Msg, 1)
+	_, err = siteConn.Subscribe("event.>", func(msg *nats.Msg) {
+		siteRx <- msg
+	})
+	require.NoError(t, err)
+	err = centralConn.Publish("event.central.thing1.temperature.central", []byte("20"))
+	require.NoError(t, err)
+	select {
+	case msg := <-siteRx:
+		assert.Fail(t, "central event received at the site", msg.Subject)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// Run two servers of a hub cluster on the same host.
+// Events published at one server must be received at the other.
+func TestClusterEvents(t *testing.T) {
+	logging.SetLogging("warning", "")
+	slog.Info("--- TestClusterEvents ---")
+	routePorts := []int{freePort(t), freePort(t)}
+	cfgs := make([]*buscfg.NatsServerConfig, 2)
+	for i := range cfgs {
+		cfgs[i] = &buscfg.NatsServerConfig{Host: "127.0.0.1", Port: -1}
+		cfgs[i].Cluster = buscfg.ClusterConfig{
+			Name:   "hiveot",
+			Port:   routePorts[i],
+			Routes: []string{fmt.Sprintf("nats-route://127.0.0.1:%d", routePorts[1-i])},
+		}
+		if i > 0 {
+			// cluster servers share the hub CA and server certificate
+			cfgs[i].CaCert, cfgs[i].CaKey = cfgs[0].CaCert, cfgs[0].CaKey
+			cfgs[i].ServerTLS = cfgs[0].ServerTLS
+		}
+		homeDir := t.TempDir()
+		err := cfgs[i].Setup(homeDir, path.Join(homeDir, "stores"), false)
+		require.NoError(t, err)
+	}
+	// jetstream in a cluster waits for the other servers, so start them together
+	servers := make([]*bussrv.NatsMsgServer, 2)
+	startErrs := make([]error, 2)
+	wg := sync.WaitGroup{}
+	for i := range servers {
+		servers[i] = bussrv.NewNatsMsgServer(cfgs[i], authapi.DefaultRolePermissions)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			startErrs[i] = servers[i].Start()
+		}(i)
+	}
+	wg.Wait()
+	defer servers[0].Stop()
+	defer servers[1].Stop()
+	require.NoError(t, startErrs[0])
+	require.NoError(t, startErrs[1])
+	// the default server names are unique
+	assert.NotEqual(t, cfgs[0].Cluster.ServerName, cfgs[1].Cluster.ServerName)
+
+	conn1, err := servers[0].ConnectInProc("service1", nil)
+	require.NoError(t, err)
+	defer conn1.Close()
+	conn2, err := servers[1].ConnectInProc("service2", nil)
+	require.NoError(t, err)
+	defer conn2.Close()
+	rxChan := make(chan *nats.Msg, 1)
+	_, err = conn1.Subscribe("event.>", func(msg *nats.Msg) {
+		rxChan <- msg
+	})
+	require.NoError(t, err)
+
+	// the route is established asynchronously
+	var rxMsg *nats.Msg
+	for i := 0; i < 50 && rxMsg == nil; i++ {
+		err = conn2.Publish("event.zwave.thing1.temperature.zwave", []byte("21.5"))
+		require.NoError(t, err)
+		select {
+		case rxMsg = <-rxChan:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	require.NotNil(t, rxMsg, "event not received at the other cluster server")
+	assert.Equal(t, "21.5", string(rxMsg.Data))
+}
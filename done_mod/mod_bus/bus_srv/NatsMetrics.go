@@ -0,0 +1,44 @@
+package bussrv
+
+import (
+	"log/slog"
+
+	"github.com/hiveot/hub/done_tool/metrics"
+)
+
+// Collect writes the messaging server statistics.
+// This implements the metrics.Collector interface.
+func (srv *NatsMsgServer) Collect(mw *metrics.MetricWriter) {
+	if srv.ns == nil {
+		return
+	}
+	varz, err := srv.ns.Varz(nil)
+	if err != nil {
+		slog.Error("failed reading the server statistics", "err", err.Error())
+		return
+	}
+	mw.WriteGauge("hiveot_nats_connections",
+		"Current number of client connections", float64(varz.Connections))
+	mw.WriteCounter("hiveot_nats_connections_accepted",
+		"Client connections accepted since the server started", float64(varz.TotalConnections))
+	mw.WriteGauge("hiveot_nats_leafnodes",
+		"Current number of leaf node connections", float64(varz.Leafs))
+	mw.WriteGauge("hiveot_nats_routes",
+		"Current number of cluster routes", float64(varz.Routes))
+	mw.WriteGauge("hiveot_nats_subscriptions",
+		"Current number of subscriptions", float64(varz.Subscriptions))
+	mw.WriteCounter("hiveot_nats_in_messages",
+		"Messages received by the server", float64(varz.InMsgs))
+	mw.WriteCounter("hiveot_nats_out_messages",
+		"Messages sent by the server", float64(varz.OutMsgs))
+	mw.WriteCounter("hiveot_nats_in_bytes",
+		"Message bytes received by the server", float64(varz.InBytes))
+	mw.WriteCounter("hiveot_nats_out_bytes",
+		"Message bytes sent by the server", float64(varz.OutBytes))
+	mw.WriteCounter("hiveot_nats_slow_consumers",
+		"Clients that were disconnected for not keeping up", float64(varz.SlowConsumers))
+	mw.WriteGauge("hiveot_nats_memory_bytes",
+		"Resident memory of the server process", float64(varz.Mem))
+	mw.WriteGauge("hiveot_nats_cpu_percent",
+		"CPU usage of the server process", varz.CPU)
+}
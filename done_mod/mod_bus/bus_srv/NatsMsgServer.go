@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/hiveot/hub/done_cli/cli_done/transport"
@@ -30,16 +31,30 @@ type NatsMsgServer struct {
 
 	// map of known clients by ID for quick lookup during auth
 	authClients map[string]modbus.ClientAuthInfo
+	// mutex to serialize applying the auth clients
+	authMux sync.Mutex
 
 	// map of permissions for each role
 	rolePermissions map[string][]modbus.RolePermission
 	// map of permissions for each service
 	servicePermissions map[string][]modbus.RolePermission
+	// IDs of tokens that are no longer accepted. In nkey mode these are public keys.
+	revokedTokens map[string]bool
+	revokedMux    sync.RWMutex
 
 	// connection urls the server is listening on
 	tlsURL string
 	wssURL string
 	udsURL string
+
+	// in-process connection that relays events of leaf node sites
+	siteRelayConn *nats.Conn
+
+	// in-process system connection that receives authentication errors
+	authErrorConn *nats.Conn
+	// handler of authentication errors
+	authErrorHandler func(loginID string, remoteAddr string)
+	authErrorMux     sync.RWMutex
 }
 
 // ConnectInProc establishes a nats connection to the server for core services.
@@ -105,6 +120,7 @@ func (srv *NatsMsgServer) Core() string {
 }
 
 // GetServerURLs is the URL used to connect to this server. This is set on Start
+// The wssURL is empty if the websocket listener is disabled.
 func (srv *NatsMsgServer) GetServerURLs() (tlsURL string, wssURL string, udsURL string) {
 	return srv.tlsURL, srv.wssURL, srv.udsURL
 }
@@ -133,9 +149,20 @@ func (srv *NatsMsgServer) Start() (err error) {
 		err = errors.New("nats: not ready for connection")
 		return err
 	}
-	outboundIP := net.GetOutboundIP("")
 	srv.tlsURL = srv.ns.ClientURL()
-	srv.wssURL = fmt.Sprintf("wss://%s:%d", outboundIP.String(), srv.Config.WSPort)
+	srv.wssURL = ""
+	if srv.Config.WSPort > 0 {
+		// the address must match the server certificate
+		wsHost := srv.Config.Host
+		if wsHost == "" || wsHost == "0.0.0.0" {
+			wsHost = net.GetOutboundIP("").String()
+		}
+		scheme := "wss"
+		if srv.NatsOpts.Websocket.NoTLS {
+			scheme = "ws"
+		}
+		srv.wssURL = fmt.Sprintf("%s://%s:%d", scheme, wsHost, srv.Config.WSPort)
+	}
 	srv.udsURL = "" // not supported?
 
 	// the app account must have JS enabled
@@ -179,12 +206,25 @@ func (srv *NatsMsgServer) Start() (err error) {
 		}
 		_, err = js.AddStream(cfg)
 	}
-
+	if err == nil {
+		err = srv.startSiteRelay()
+	}
+	if err == nil {
+		err = srv.startAuthErrorMonitor()
+	}
 	return err
 }
 
 // Stop the server
 func (srv *NatsMsgServer) Stop() {
+	if srv.siteRelayConn != nil {
+		srv.siteRelayConn.Close()
+		srv.siteRelayConn = nil
+	}
+	if srv.authErrorConn != nil {
+		srv.authErrorConn.Close()
+		srv.authErrorConn = nil
+	}
 	srv.ns.Shutdown()
 }
 
@@ -195,6 +235,7 @@ func NewNatsMsgServer(
 	srv := &NatsMsgServer{Config: cfg,
 		rolePermissions:    rolePermissions,
 		servicePermissions: make(map[string][]modbus.RolePermission, 0),
+		revokedTokens:      make(map[string]bool),
 	}
 	return srv
 }
@@ -0,0 +1,56 @@
+package bussrv
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	buscfg "github.com/hiveot/hub/done_mod/mod_bus/bus_cfg"
+	"github.com/nats-io/nats.go"
+)
+
+// SiteRelayServiceID is the ID of the in-process connection that relays site events
+const SiteRelayServiceID = "siterelay"
+
+// startSiteRelay relays the events of leaf node sites to the event subjects of the
+// application account, with the site's agent prefix added to the agent ID.
+//
+// Site events are imported as {SiteSubjectPrefix}.{site}.event.{agentID}.{thingID}.{name}.{clientID}
+// and published as event.{prefix}{agentID}.{thingID}.{name}.{clientID}.
+// Subject mappings can't do this as they can only replace whole tokens.
+func (srv *NatsMsgServer) startSiteRelay() error {
+	sites := srv.Config.LeafNodes.Sites
+	if len(sites) == 0 {
+		return nil
+	}
+	nc, err := srv.ConnectInProc(SiteRelayServiceID, nil)
+	if err != nil {
+		return fmt.Errorf("startSiteRelay: %w", err)
+	}
+	for _, site := range sites {
+		prefix := site.GetAgentPrefix()
+		siteSubject := buscfg.SiteSubjectPrefix + "." + site.Name + "."
+		_, err = nc.Subscribe(siteSubject+"event.*.>", func(msg *nats.Msg) {
+			// event.{agentID}.{remainder}
+			parts := strings.SplitN(strings.TrimPrefix(msg.Subject, siteSubject), ".", 3)
+			relayMsg := &nats.Msg{
+				Subject: parts[0] + "." + prefix + parts[1] + "." + parts[2],
+				Header:  msg.Header,
+				Data:    msg.Data,
+			}
+			err2 := nc.PublishMsg(relayMsg)
+			if err2 != nil {
+				slog.Error("failed relaying site event",
+					slog.String("subject", msg.Subject), slog.String("err", err2.Error()))
+			}
+		})
+		if err != nil {
+			nc.Close()
+			return fmt.Errorf("startSiteRelay: %w", err)
+		}
+		slog.Info("relaying site events",
+			slog.String("site", site.Name), slog.String("agentPrefix", prefix))
+	}
+	srv.siteRelayConn = nc
+	return nil
+}
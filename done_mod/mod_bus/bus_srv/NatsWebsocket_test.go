@@ -0,0 +1,40 @@
+package bussrv_test
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	authcli "github.com/hiveot/hub/done_mod/mod_auth/auth_cli"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/testenv"
+)
+
+// Connect a hub client over the websocket listener and make a request to the auth service.
+func TestWebsocketConnect(t *testing.T) {
+	logging.SetLogging("warning", "")
+	slog.Info("--- TestWebsocketConnect ---")
+	const user1ID = "user1"
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+	require.True(t, strings.HasPrefix(ts.WSServerURL, "wss://"), ts.WSServerURL)
+
+	kp, token, err := ts.AddClient(authapi.ClientTypeUser, user1ID, authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	hc := clidone.NewHubClient(ts.WSServerURL, user1ID, ts.CaCert)
+	hc.SetTokenRefresh(false)
+	err = hc.ConnectWithToken(kp, token)
+	require.NoError(t, err)
+	defer hc.Disconnect()
+
+	profile, err := authcli.NewProfileClient(hc).GetProfile()
+	require.NoError(t, err)
+	assert.Equal(t, user1ID, profile.ClientID)
+	assert.Equal(t, authapi.ClientRoleViewer, profile.Role)
+}
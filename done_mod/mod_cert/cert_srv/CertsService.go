@@ -11,6 +11,7 @@ import (
 	"time"
 
 	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	auditcli "github.com/hiveot/hub/done_mod/mod_audit/audit_cli"
 	certapi "github.com/hiveot/hub/done_mod/mod_cert/cert_api"
 	"github.com/hiveot/hub/done_tool/certs"
 	"github.com/hiveot/hub/done_tool/keys"
@@ -31,6 +32,8 @@ type CertsService struct {
 
 	// messaging client for receiving requests
 	hc *clidone.HubClient
+	// sends audit records of issued certificates
+	audit *auditcli.AuditPublisher
 }
 
 // _createDeviceCert internal function to create a CA signed certificate for mutual authentication by IoT devices
@@ -213,6 +216,14 @@ func (svc *CertsService) Start(hc *clidone.HubClient) (err error) {
 			certapi.CreateUserCertMethod:    svc.CreateUserCert,
 			certapi.VerifyCertMethod:        svc.VerifyCert,
 		})
+	// record issued certificates in the audit log
+	svc.audit = auditcli.EnableAudit(svc.hc, map[string][]string{
+		certapi.ManageCertsCapability: {
+			certapi.CreateDeviceCertMethod,
+			certapi.CreateServiceCertMethod,
+			certapi.CreateUserCertMethod,
+		},
+	})
 
 	return err
 }
@@ -220,6 +231,10 @@ func (svc *CertsService) Start(hc *clidone.HubClient) (err error) {
 // Stop the service and remove subscription
 func (svc *CertsService) Stop() {
 	slog.Warn("Stopping the certs service")
+	if svc.audit != nil {
+		svc.audit.Stop()
+		svc.audit = nil
+	}
 }
 
 // VerifyCert verifies whether the given certificate is a valid client certificate
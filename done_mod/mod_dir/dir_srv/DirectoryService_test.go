@@ -0,0 +1,101 @@
+package dirsrv_test
+
+import (
+	"encoding/json"
+	"path"
+	"testing"
+	"time"
+
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	dirapi "github.com/hiveot/hub/done_mod/mod_dir/dir_api"
+	dircli "github.com/hiveot/hub/done_mod/mod_dir/dir_cli"
+	dirsrv "github.com/hiveot/hub/done_mod/mod_dir/dir_srv"
+	"github.com/hiveot/hub/done_tool/buckets/bolts"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/plugin"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/hiveot/hub/done_tool/things"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startDirectory starts the test hub and the directory service
+func startDirectory(t *testing.T) (ts *testenv.TestServer, stopFn func()) {
+	logging.SetLogging("warning", "")
+	var store *bolts.BoltStore
+	ts, stopSvc := testenv.StartTestService(t, dirapi.ServiceName, func(ts *testenv.TestServer) plugin.IPlugin {
+		store = bolts.NewBoltStore(path.Join(ts.TestDir, "stores", dirapi.ServiceName, "directory.boltdb"))
+		err := store.Open()
+		require.NoError(t, err)
+		return dirsrv.NewDirectoryService(store)
+	})
+	return ts, func() {
+		stopSvc()
+		_ = store.Close()
+	}
+}
+
+// A published TD is stored in the directory and can be read by users
+func TestPublishAndReadTD(t *testing.T) {
+	const deviceID = "device1"
+	const thingID = "thing1"
+	ts, stopFn := startDirectory(t)
+	defer stopFn()
+
+	device, err := ts.AddConnectDevice(deviceID)
+	require.NoError(t, err)
+	defer device.Disconnect()
+	user, err := ts.AddConnectUser("user1", authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	defer user.Disconnect()
+
+	td := things.NewTD(thingID, "Thing 1", "sensor")
+	err = device.PubTD(td)
+	require.NoError(t, err)
+
+	// the directory receives the TD asynchronously
+	readDir := dircli.NewReadDirectoryClient(user)
+	var tv things.ThingValue
+	for i := 0; i < 20; i++ {
+		tv, err = readDir.GetTD(deviceID, thingID)
+		if err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	var td2 things.TD
+	err = json.Unmarshal(tv.Data, &td2)
+	require.NoError(t, err)
+	assert.Equal(t, thingID, td2.ID)
+
+	tds, err := readDir.GetTDs(0, 10)
+	require.NoError(t, err)
+	assert.NotEmpty(t, tds)
+}
+
+// Administrators can update the directory
+func TestUpdateRemoveTD(t *testing.T) {
+	ts, stopFn := startDirectory(t)
+	defer stopFn()
+
+	viewer, err := ts.AddConnectUser("viewer1", authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	defer viewer.Disconnect()
+	admin, err := ts.AddConnectUser("admin1", authapi.ClientRoleAdmin)
+	require.NoError(t, err)
+	defer admin.Disconnect()
+
+	tdDoc, _ := json.Marshal(things.NewTD("thing2", "Thing 2", "sensor"))
+	err = dircli.NewUpdateDirectoryClient(admin).UpdateTD("agent2", "thing2", tdDoc)
+	require.NoError(t, err)
+
+	tv, err := dircli.NewReadDirectoryClient(viewer).GetTD("agent2", "thing2")
+	require.NoError(t, err)
+	assert.Equal(t, "agent2", tv.AgentID)
+
+	err = dircli.NewUpdateDirectoryClient(admin).RemoveTD("agent2", "thing2")
+	require.NoError(t, err)
+	_, err = dircli.NewReadDirectoryClient(viewer).GetTD("agent2", "thing2")
+	assert.Error(t, err)
+}
@@ -72,15 +72,7 @@ func (svc *ReadDirectoryService) GetTD(
 func (svc *ReadDirectoryService) GetTDsRaw(
 	ctx clidone.ServiceContext, args *dirapi.GetTDsArgs) (map[string][]byte, error) {
 
-	cursor, err := svc.bucket.Cursor(context.Background())
-	if args.Offset > 0 {
-		// TODO: add support for cursor.Skip
-		cursor.NextN(uint(args.Offset))
-	}
-
-	docs, itemsRemaining := cursor.NextN(uint(args.Limit))
-	_ = itemsRemaining
-	return docs, err
+	return svc.readBatch(args.Offset, args.Limit)
 }
 
 // GetTDs returns a collection of TD documents
@@ -90,14 +82,8 @@ func (svc *ReadDirectoryService) GetTDs(
 	ctx clidone.ServiceContext, args *dirapi.GetTDsArgs) (res *dirapi.GetTDsResp, err error) {
 
 	batch := make([]things.ThingValue, 0, args.Limit)
-	cursor, err := svc.bucket.Cursor(context.Background())
-	if args.Offset > 0 {
-		// FIXME: add support for cursor.Skip
-		cursor.NextN(uint(args.Offset))
-	}
-	docs, itemsRemaining := cursor.NextN(uint(args.Limit))
+	docs, err := svc.readBatch(args.Offset, args.Limit)
 	// FIXME: the unmarshalled ThingValue will be remarshalled when sending it as a reply.
-	_ = itemsRemaining
 	for key, val := range docs {
 		tv := things.ThingValue{}
 		err = json.Unmarshal(val, &tv)
@@ -111,6 +97,28 @@ func (svc *ReadDirectoryService) GetTDs(
 	return res, err
 }
 
+// readBatch returns a copy of up to limit documents starting at offset.
+// The cursor is released before returning, as open read transactions block the store.
+func (svc *ReadDirectoryService) readBatch(offset int, limit int) (map[string][]byte, error) {
+	cursor, err := svc.bucket.Cursor(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Release()
+	docs := make(map[string][]byte)
+	// TODO: add support for cursor.Skip
+	key, val, valid := cursor.First()
+	for i := 0; valid && i < offset; i++ {
+		key, val, valid = cursor.Next()
+	}
+	for valid && len(docs) < limit {
+		// values are only valid while the cursor is open
+		docs[key] = append([]byte{}, val...)
+		key, val, valid = cursor.Next()
+	}
+	return docs, nil
+}
+
 //// ListTDs returns an array of TD documents in JSON text
 //func (srv *DirectoryKVStoreServer) ListTDs(_ context.Context, limit int, offset int) ([]string, error) {
 //	res := make([]string, 0)
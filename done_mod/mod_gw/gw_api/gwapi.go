@@ -0,0 +1,89 @@
+// Package gwapi with the REST API of the HTTP gateway service
+package gwapi
+
+import "github.com/hiveot/hub/done_tool/things"
+
+// ServiceName is the default clientID of the gateway service
+const ServiceName = "gateway"
+
+// DefaultPort is the default listening port of the https gateway
+const DefaultPort = 8445
+
+// DefaultSessionTimeoutMin is the time after which an unused session is closed
+const DefaultSessionTimeoutMin = 30
+
+// DefaultThingsLimit is the default and maximum nr of TDs returned by GetThingsPath
+const DefaultThingsLimit = 100
+
+// REST paths of the gateway.
+// Path variables are written as {agentID}, {thingID}, {name}, {capability} and {method}.
+const (
+	// LoginPath returns a bearer token for the basic auth credentials
+	//  POST, response LoginResp
+	LoginPath = "/login"
+	// LogoutPath closes the session of the client
+	//  POST
+	LogoutPath = "/logout"
+	// GetThingsPath returns the list of TD documents from the directory.
+	//  GET, query parameters: limit and offset. Response: array of TD documents
+	GetThingsPath = "/things"
+	// GetThingPath returns the TD document of a Thing
+	//  GET, response: TD document
+	GetThingPath = "/things/{agentID}/{thingID}"
+	// GetValuesPath returns the latest event and property values of a Thing from the history.
+	//  GET, query parameter: name, optionally repeated. Response: map of name to ThingValue
+	GetValuesPath = "/things/{agentID}/{thingID}/values"
+	// PostActionPath publishes an action request with the request body as payload
+	//  POST, response: the action reply data, if any
+	PostActionPath = "/things/{agentID}/{thingID}/actions/{name}"
+	// PutConfigPath publishes a configuration request with the request body as value
+	//  PUT
+	PutConfigPath = "/things/{agentID}/{thingID}/config/{name}"
+	// PostRPCPath invokes a service method with the JSON request body as arguments
+	//  POST, response: the JSON encoded method result, if any
+	PostRPCPath = "/rpc/{agentID}/{capability}/{method}"
+	// GetEventsPath is the SSE endpoint for event subscriptions.
+	// Each event is sent as a 'message' with a ThingValue JSON payload.
+	//  GET, query parameters: agentID, thingID and name to filter the events. Default is all.
+	GetEventsPath = "/events"
+)
+
+// Query parameters of the events path
+const (
+	ParamAgentID = "agentID"
+	ParamThingID = "thingID"
+	ParamName    = "name"
+)
+
+// LoginResp is the response of the login path
+type LoginResp struct {
+	// Token to include in the authorization header as "Bearer {token}"
+	Token string `json:"token"`
+	// ExpiryMSE is the token expiry time in msec since epoch
+	ExpiryMSE int64 `json:"expiry"`
+}
+
+// ThingValue is the REST presentation of an event, property or action value.
+// Unlike things.ThingValue, the data is passed as text instead of base64 encoded bytes.
+type ThingValue struct {
+	AgentID string `json:"agentID"`
+	ThingID string `json:"thingID"`
+	Name    string `json:"name"`
+	// Data is the serialized value as published
+	Data string `json:"data"`
+	// Timestamp the value was created in msec since Epoch
+	CreatedMSec int64  `json:"created,omitempty"`
+	SenderID    string `json:"senderID"`
+}
+
+// NewThingValue converts a things.ThingValue into its REST presentation
+func NewThingValue(tv *things.ThingValue) ThingValue {
+	return ThingValue{
+		AgentID:     tv.AgentID,
+		ThingID:     tv.ThingID,
+		Name:        tv.Name,
+		Data:        string(tv.Data),
+		CreatedMSec: tv.CreatedMSec,
+		SenderID:    tv.SenderID,
+	}
+}
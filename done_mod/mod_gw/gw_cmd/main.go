@@ -0,0 +1,48 @@
+// Package main with the HTTP gateway service
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"path"
+	"time"
+
+	donecfg "github.com/hiveot/hub/done_cfg"
+	gwapi "github.com/hiveot/hub/done_mod/mod_gw/gw_api"
+	gwsrv "github.com/hiveot/hub/done_mod/mod_gw/gw_srv"
+	"github.com/hiveot/hub/done_tool/certs"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/plugin"
+)
+
+// Start the service.
+// Preconditions:
+//  1. A loginID and keys for this service must already have been added.
+//     This can be done manually using the hubcli or simply be starting it using the launcher.
+//  2. The hub server certificate and key must be available in the certs directory.
+func main() {
+	port := uint(gwapi.DefaultPort)
+	timeoutMin := gwapi.DefaultSessionTimeoutMin
+
+	flag.UintVar(&port, "port", port, "Gateway https port")
+	flag.IntVar(&timeoutMin, "sessionTimeout", timeoutMin, "Minutes after which unused sessions are closed")
+	env := plugin.GetAppEnvironment("", true)
+	logging.SetLogging(env.LogLevel, "")
+	slog.Warn("Starting gateway service", "clientID", env.ClientID, "loglevel", env.LogLevel)
+
+	// the gateway uses the hub server certificate
+	serverCertPath := path.Join(env.CertsDir, donecfg.DefaultServerCertFile)
+	serverKeyPath := path.Join(env.CertsDir, donecfg.DefaultServerKeyFile)
+	// the core renews the server certificate before it expires
+	certReloader, err := certs.NewTLSCertReloader(serverCertPath, serverKeyPath)
+	if err != nil {
+		slog.Error("gateway: Failed loading server certificate", "err", err)
+		os.Exit(1)
+	}
+
+	svc := gwsrv.NewGatewayService(port, certReloader.GetTLSCert(), env.CaCert,
+		time.Duration(timeoutMin)*time.Minute)
+	svc.SetCertificateSource(certReloader.GetCertificate)
+	plugin.StartPlugin(svc, &env)
+}
@@ -0,0 +1,244 @@
+package gwsrv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	dircli "github.com/hiveot/hub/done_mod/mod_dir/dir_cli"
+	gwapi "github.com/hiveot/hub/done_mod/mod_gw/gw_api"
+	histcli "github.com/hiveot/hub/done_mod/mod_hist/hist_cli"
+)
+
+// sseKeepAliveInterval is the interval of SSE comments that keep proxies from closing the connection
+const sseKeepAliveInterval = 30 * time.Second
+
+// writeJSON writes the JSON encoded response
+func (svc *GatewayService) writeJSON(w http.ResponseWriter, resp interface{}) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		svc.tlsServer.WriteInternalError(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// writeHubError writes the error of a failed Hub request
+func (svc *GatewayService) writeHubError(w http.ResponseWriter, op string, err error) {
+	svc.tlsServer.WriteBadRequest(w, fmt.Sprintf("%s failed: %s", op, err.Error()))
+}
+
+// HandleGetEvents streams the subscribed events as server-sent events.
+// Each event is sent as a 'message' with a ThingValue JSON payload.
+// The agentID, thingID and name query parameters filter the events.
+func (svc *GatewayService) HandleGetEvents(clientID string, w http.ResponseWriter, r *http.Request) {
+	s := svc.getSession(clientID, w, r)
+	if s == nil {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		svc.tlsServer.WriteInternalError(w, "streaming is not supported")
+		return
+	}
+	agentID := svc.tlsServer.GetQueryString(r, gwapi.ParamAgentID, "")
+	thingID := svc.tlsServer.GetQueryString(r, gwapi.ParamThingID, "")
+	name := svc.tlsServer.GetQueryString(r, gwapi.ParamName, "")
+	l, err := s.AddListener(agentID, thingID, name)
+	if err != nil {
+		svc.writeHubError(w, "subscribe", err)
+		return
+	}
+	defer s.RemoveListener(l)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case tv, ok := <-l.c:
+			if !ok { // session was closed
+				return
+			}
+			data, _ := json.Marshal(gwapi.NewThingValue(tv))
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-ticker.C:
+			_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// HandleGetThing returns the TD document of a Thing
+func (svc *GatewayService) HandleGetThing(clientID string, w http.ResponseWriter, r *http.Request) {
+	s := svc.getSession(clientID, w, r)
+	if s == nil {
+		return
+	}
+	vars := mux.Vars(r)
+	tv, err := dircli.NewReadDirectoryClient(s.hc).GetTD(vars["agentID"], vars["thingID"])
+	if err != nil {
+		svc.tlsServer.WriteNotFound(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(tv.Data)
+}
+
+// HandleGetThings returns the list of TD documents in the directory
+func (svc *GatewayService) HandleGetThings(clientID string, w http.ResponseWriter, r *http.Request) {
+	s := svc.getSession(clientID, w, r)
+	if s == nil {
+		return
+	}
+	limit, offset, err := svc.tlsServer.GetQueryLimitOffset(r, gwapi.DefaultThingsLimit)
+	if err != nil {
+		svc.tlsServer.WriteBadRequest(w, err.Error())
+		return
+	}
+	tvs, err := dircli.NewReadDirectoryClient(s.hc).GetTDs(offset, limit)
+	if err != nil {
+		svc.writeHubError(w, "GetTDs", err)
+		return
+	}
+	tds := make([]json.RawMessage, 0, len(tvs))
+	for _, tv := range tvs {
+		tds = append(tds, tv.Data)
+	}
+	svc.writeJSON(w, tds)
+}
+
+// HandleGetValues returns the latest values of a Thing from the history service.
+// The optional 'name' query parameters limit the result to the given names.
+func (svc *GatewayService) HandleGetValues(clientID string, w http.ResponseWriter, r *http.Request) {
+	s := svc.getSession(clientID, w, r)
+	if s == nil {
+		return
+	}
+	vars := mux.Vars(r)
+	names := r.URL.Query()[gwapi.ParamName]
+	tvs, err := histcli.NewReadHistoryClient(s.hc).GetLatest(vars["agentID"], vars["thingID"], names)
+	if err != nil {
+		svc.writeHubError(w, "GetLatest", err)
+		return
+	}
+	values := make(map[string]gwapi.ThingValue, len(tvs))
+	for name, tv := range tvs {
+		values[name] = gwapi.NewThingValue(tv)
+	}
+	svc.writeJSON(w, values)
+}
+
+// HandleLogin returns a bearer token for the authenticated client.
+// Use basic auth to login.
+func (svc *GatewayService) HandleLogin(clientID string, w http.ResponseWriter, r *http.Request) {
+	s := svc.getSession(clientID, w, r)
+	if s == nil {
+		return
+	}
+	token, expiry, err := svc.createToken(clientID)
+	if err != nil {
+		svc.tlsServer.WriteInternalError(w, err.Error())
+		return
+	}
+	svc.writeJSON(w, gwapi.LoginResp{Token: token, ExpiryMSE: expiry.UnixMilli()})
+}
+
+// HandleLogout closes the session of the client
+func (svc *GatewayService) HandleLogout(clientID string, w http.ResponseWriter, r *http.Request) {
+	svc.sessions.Close(clientID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlePostAction publishes an action request with the request body as payload
+// and returns the reply.
+func (svc *GatewayService) HandlePostAction(clientID string, w http.ResponseWriter, r *http.Request) {
+	s := svc.getSession(clientID, w, r)
+	if s == nil {
+		return
+	}
+	vars := mux.Vars(r)
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		svc.tlsServer.WriteBadRequest(w, err.Error())
+		return
+	}
+	reply, err := s.hc.PubAction(vars["agentID"], vars["thingID"], vars["name"], payload)
+	if err != nil {
+		svc.writeHubError(w, "PubAction", err)
+		return
+	}
+	_, _ = w.Write(reply)
+}
+
+// HandlePostRPC invokes a service method with the JSON request body as arguments
+// and returns the JSON encoded result.
+func (svc *GatewayService) HandlePostRPC(clientID string, w http.ResponseWriter, r *http.Request) {
+	s := svc.getSession(clientID, w, r)
+	if s == nil {
+		return
+	}
+	vars := mux.Vars(r)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		svc.tlsServer.WriteBadRequest(w, err.Error())
+		return
+	}
+	var args interface{}
+	if len(body) > 0 {
+		if !json.Valid(body) {
+			svc.tlsServer.WriteBadRequest(w, "request body is not valid JSON")
+			return
+		}
+		args = json.RawMessage(body)
+	}
+	var reply json.RawMessage
+	err = s.hc.PubRPCRequest(vars["agentID"], vars["capability"], vars["method"], args, &reply)
+	// methods without a result reply with an empty message, which doesn't unmarshal
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Offset == 0 {
+		err = nil
+	}
+	if err != nil {
+		svc.writeHubError(w, "PubRPCRequest", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(reply)
+}
+
+// HandlePutConfig publishes a configuration request with the request body as value
+func (svc *GatewayService) HandlePutConfig(clientID string, w http.ResponseWriter, r *http.Request) {
+	s := svc.getSession(clientID, w, r)
+	if s == nil {
+		return
+	}
+	vars := mux.Vars(r)
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		svc.tlsServer.WriteBadRequest(w, err.Error())
+		return
+	}
+	err = s.hc.PubConfig(vars["agentID"], vars["thingID"], vars["name"], payload)
+	if err != nil {
+		svc.writeHubError(w, "PubConfig", err)
+		return
+	}
+	slog.Info("HandlePutConfig", "clientID", clientID, "name", vars["name"])
+	w.WriteHeader(http.StatusOK)
+}
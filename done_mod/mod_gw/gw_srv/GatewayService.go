@@ -0,0 +1,161 @@
+package gwsrv
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	gwapi "github.com/hiveot/hub/done_mod/mod_gw/gw_api"
+	"github.com/hiveot/hub/done_tool/tlsserver"
+)
+
+// GatewayService is a HTTPS gateway that maps REST requests to message bus operations.
+// Intended for integrations that can use https but not the message bus, like shell
+// scripts, Node-RED and cron jobs.
+//
+// Clients authenticate using basic auth or a bearer token obtained with the login path.
+// Requests are passed to the Hub using the client's own connection, so the client's
+// identity and permissions apply. The connection is established with the basic auth
+// credentials and kept in a session until it is unused for the session timeout.
+// Client certificates are refused as the gateway has no Hub credentials for them.
+type GatewayService struct {
+	// hub connection of the service, used to determine the hub URL
+	hc *clidone.HubClient
+	// server listening port
+	port uint
+	// server TLS certificate
+	serverCert *tls.Certificate
+	// optional source of renewed server certificates
+	getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	// hiveot CA that signed the server cert
+	caCert *x509.Certificate
+	// the key used to sign and verify bearer tokens issued by the gateway
+	signingKey *ecdsa.PrivateKey
+	// duration after which unused sessions are closed
+	sessionTimeout time.Duration
+
+	tlsServer *tlsserver.TLSServer
+	sessions  *GatewaySessions
+}
+
+// createToken returns a new bearer token for a client, valid for the session timeout.
+// The session must be kept alive by using it within that period.
+func (svc *GatewayService) createToken(clientID string) (token string, expiry time.Time, err error) {
+	expiry = time.Now().Add(svc.sessionTimeout)
+	claims := tlsserver.JwtClaims{
+		Username: clientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    gwapi.ServiceName,
+			Subject:   clientID,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiry),
+		},
+	}
+	token, err = jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(svc.signingKey)
+	return token, expiry, err
+}
+
+// getSession returns the session of an authenticated client.
+// This writes an unauthorized response and returns nil if the client has no session,
+// or a forbidden response if the client authenticated with a client certificate.
+func (svc *GatewayService) getSession(clientID string, w http.ResponseWriter, r *http.Request) *GatewaySession {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert := r.TLS.PeerCertificates[0]
+		// the certificate authenticator takes precedence, so the client is the certificate CN.
+		// Requests must be made with the client's own Hub identity, which the gateway
+		// can't obtain for a certificate.
+		if clientID != "" && cert.Subject.CommonName == clientID {
+			svc.tlsServer.WriteForbidden(w, fmt.Sprintf(
+				"client certificate of '%s' can't be used for a session. Use basic auth instead",
+				clientID))
+			return nil
+		}
+	}
+	s := svc.sessions.GetSession(clientID)
+	if s == nil {
+		svc.tlsServer.WriteUnauthorized(w, fmt.Sprintf(
+			"no session for client '%s'. Login using basic auth first", clientID))
+		return nil
+	}
+	return s
+}
+
+// SetCertificateSource sets the source of renewed server certificates.
+// Use before Start.
+func (svc *GatewayService) SetCertificateSource(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) {
+	svc.getCertificate = getCertificate
+}
+
+// Start the gateway https server.
+// The Hub URL and CA of the service connection are used to connect client sessions.
+func (svc *GatewayService) Start(hc *clidone.HubClient) error {
+	slog.Warn("Starting the gateway service", "clientID", hc.ClientID(), "port", svc.port)
+	svc.hc = hc
+	connStat := hc.GetStatus()
+	svc.sessions = NewGatewaySessions(connStat.HubURL, svc.caCert, svc.sessionTimeout)
+	svc.sessions.Start()
+
+	svc.tlsServer = tlsserver.NewTLSServer("", svc.port, svc.serverCert, svc.caCert)
+	if svc.getCertificate != nil {
+		svc.tlsServer.SetCertificateSource(svc.getCertificate)
+	}
+	svc.tlsServer.EnableBasicAuth(svc.sessions.ValidatePassword)
+	svc.tlsServer.EnableJwtAuth(&svc.signingKey.PublicKey)
+
+	svc.tlsServer.AddHandler(gwapi.LoginPath, svc.HandleLogin).Methods(http.MethodPost)
+	svc.tlsServer.AddHandler(gwapi.LogoutPath, svc.HandleLogout).Methods(http.MethodPost)
+	svc.tlsServer.AddHandler(gwapi.GetThingsPath, svc.HandleGetThings).Methods(http.MethodGet)
+	svc.tlsServer.AddHandler(gwapi.GetThingPath, svc.HandleGetThing).Methods(http.MethodGet)
+	svc.tlsServer.AddHandler(gwapi.GetValuesPath, svc.HandleGetValues).Methods(http.MethodGet)
+	svc.tlsServer.AddHandler(gwapi.PostActionPath, svc.HandlePostAction).Methods(http.MethodPost)
+	svc.tlsServer.AddHandler(gwapi.PutConfigPath, svc.HandlePutConfig).Methods(http.MethodPut)
+	svc.tlsServer.AddHandler(gwapi.PostRPCPath, svc.HandlePostRPC).Methods(http.MethodPost)
+	svc.tlsServer.AddHandler(gwapi.GetEventsPath, svc.HandleGetEvents).Methods(http.MethodGet)
+	err := svc.tlsServer.Start()
+	return err
+}
+
+// Stop the gateway and close all sessions
+func (svc *GatewayService) Stop() {
+	slog.Warn("Stopping the gateway service")
+	// closing the sessions ends the SSE connections, which would otherwise keep
+	// the server from shutting down.
+	if svc.sessions != nil {
+		svc.sessions.Stop()
+	}
+	if svc.tlsServer != nil {
+		svc.tlsServer.Stop()
+		svc.tlsServer = nil
+	}
+	svc.sessions = nil
+}
+
+// NewGatewayService creates a new gateway service instance
+//
+//	port is the https listening port
+//	serverCert is the TLS certificate of the server, signed by the CA
+//	caCert of the Hub, used to verify client certificates and to connect to the Hub
+//	sessionTimeout after which unused sessions are closed
+func NewGatewayService(port uint, serverCert *tls.Certificate, caCert *x509.Certificate,
+	sessionTimeout time.Duration) *GatewayService {
+
+	// tokens don't outlive the sessions, so a new key on each start is sufficient
+	signingKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	svc := &GatewayService{
+		port:           port,
+		serverCert:     serverCert,
+		caCert:         caCert,
+		signingKey:     signingKey,
+		sessionTimeout: sessionTimeout,
+	}
+	return svc
+}
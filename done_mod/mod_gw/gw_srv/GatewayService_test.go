@@ -0,0 +1,206 @@
+package gwsrv_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	gwapi "github.com/hiveot/hub/done_mod/mod_gw/gw_api"
+	gwsrv "github.com/hiveot/hub/done_mod/mod_gw/gw_srv"
+	"github.com/hiveot/hub/done_tool/certs"
+	"github.com/hiveot/hub/done_tool/keys"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/plugin"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/hiveot/hub/done_tool/tlsclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPassword = "password123"
+
+// the path of the RPC that returns the profile of the client making the request
+var getProfilePath = fmt.Sprintf("/rpc/%s/%s/%s",
+	authapi.AuthServiceName, authapi.AuthProfileCapability, authapi.GetProfileMethod)
+
+// startGateway starts the test hub and the gateway service on a free port.
+// This returns the address of the gateway.
+func startGateway(t *testing.T) (ts *testenv.TestServer, hostPort string, stopFn func()) {
+	logging.SetLogging("warning", "")
+	port, err := testenv.GetFreePort()
+	require.NoError(t, err)
+	ts, stopFn = testenv.StartTestService(t, gwapi.ServiceName, func(ts *testenv.TestServer) plugin.IPlugin {
+		return gwsrv.NewGatewayService(uint(port), ts.ServerTLS, ts.CaCert, time.Minute)
+	})
+	hostPort = fmt.Sprintf("%s:%d", testenv.TestServerHost, port)
+	return ts, hostPort, stopFn
+}
+
+// addPasswordUser adds a user that can login with testPassword
+func addPasswordUser(t *testing.T, ts *testenv.TestServer, userID string, role string) {
+	ctx := clidone.ServiceContext{SenderID: authapi.DefaultAdminUserID}
+	_, err := ts.AuthService.MngClients.AddUser(ctx, authapi.AddUserArgs{
+		UserID: userID, DisplayName: userID, Password: testPassword, Role: role})
+	require.NoError(t, err)
+}
+
+// newHttpClient returns a http client that trusts the test CA and optionally
+// authenticates with a client certificate.
+// Unlike TLSClient it doesn't share the default transport and supports streaming.
+func newHttpClient(caCert *x509.Certificate, clientCert *tls.Certificate) *http.Client {
+	caPool := x509.NewCertPool()
+	caPool.AddCert(caCert)
+	tlsConfig := &tls.Config{RootCAs: caPool}
+	if clientCert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*clientCert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+}
+
+// newClientCert returns a client certificate signed by the test CA
+func newClientCert(t *testing.T, ts *testenv.TestServer, clientID string, ou string) *tls.Certificate {
+	kp := keys.NewEcdsaKey()
+	cert, err := certs.CreateClientCert(clientID, ou, 1, kp, ts.CaCert, ts.CaKey)
+	require.NoError(t, err)
+	return certs.X509CertToTLS(cert, kp)
+}
+
+// getProfile requests the profile of the client through the gateway
+func getProfile(t *testing.T, cl *http.Client, hostPort string, setAuth func(req *http.Request)) (
+	profile authapi.ClientProfile, statusCode int) {
+
+	req, err := http.NewRequest(http.MethodPost, "https://"+hostPort+getProfilePath, nil)
+	require.NoError(t, err)
+	if setAuth != nil {
+		setAuth(req)
+	}
+	resp, err := cl.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		profileResp := authapi.GetProfileResp{}
+		err = json.NewDecoder(resp.Body).Decode(&profileResp)
+		require.NoError(t, err)
+		profile = profileResp.Profile
+	}
+	return profile, resp.StatusCode
+}
+
+// Basic auth clients make requests with their own identity and can login for a bearer token
+func TestBasicAuthAndLogin(t *testing.T) {
+	const userID = "user1"
+	ts, hostPort, stopFn := startGateway(t)
+	defer stopFn()
+	addPasswordUser(t, ts, userID, authapi.ClientRoleViewer)
+
+	cl := tlsclient.NewTLSClient(hostPort, ts.CaCert)
+	cl.ConnectWithBasicAuth(userID, testPassword)
+	defer cl.Close()
+	data, err := cl.Post(getProfilePath, nil)
+	require.NoError(t, err)
+	profileResp := authapi.GetProfileResp{}
+	err = json.Unmarshal(data, &profileResp)
+	require.NoError(t, err)
+	assert.Equal(t, userID, profileResp.Profile.ClientID)
+
+	data, err = cl.Post(gwapi.LoginPath, nil)
+	require.NoError(t, err)
+	loginResp := gwapi.LoginResp{}
+	err = json.Unmarshal(data, &loginResp)
+	require.NoError(t, err)
+	require.NotEmpty(t, loginResp.Token)
+
+	// the bearer token uses the session of the basic auth login
+	httpCl := newHttpClient(ts.CaCert, nil)
+	profile, status := getProfile(t, httpCl, hostPort, func(req *http.Request) {
+		req.Header.Set("Authorization", "bearer "+loginResp.Token)
+	})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, userID, profile.ClientID)
+
+	// a wrong password is refused
+	_, status = getProfile(t, httpCl, hostPort, func(req *http.Request) {
+		req.SetBasicAuth(userID, "wrongpassword")
+	})
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+// Certificate clients are refused as requests must be made with their own Hub identity
+func TestCertAuth(t *testing.T) {
+	ts, hostPort, stopFn := startGateway(t)
+	defer stopFn()
+
+	// the gateway has no Hub identity for certificate clients, so they must use basic auth
+	for _, ou := range []string{certs.OUAdmin, certs.OUService, certs.OUIoTDevice} {
+		clientCert := newClientCert(t, ts, "client-"+ou, ou)
+		cl := newHttpClient(ts.CaCert, clientCert)
+		_, status := getProfile(t, cl, hostPort, nil)
+		assert.Equal(t, http.StatusForbidden, status, "certificate OU %s", ou)
+	}
+}
+
+// Each SSE connection receives an event once, regardless of the nr of connections
+func TestEventsNotDuplicated(t *testing.T) {
+	const userID = "user1"
+	const thingID = "thing1"
+	const eventName = "temperature"
+	ts, hostPort, stopFn := startGateway(t)
+	defer stopFn()
+	addPasswordUser(t, ts, userID, authapi.ClientRoleViewer)
+	device, err := ts.AddConnectDevice("device1")
+	require.NoError(t, err)
+	defer device.Disconnect()
+
+	// openEvents opens an SSE connection and returns a channel with its data lines
+	cl := newHttpClient(ts.CaCert, nil)
+	openEvents := func(query string) chan string {
+		req, err := http.NewRequest(http.MethodGet, "https://"+hostPort+gwapi.GetEventsPath+query, nil)
+		require.NoError(t, err)
+		req.SetBasicAuth(userID, testPassword)
+		resp, err := cl.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		lines := make(chan string, 10)
+		go func() {
+			defer resp.Body.Close()
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				if data, found := strings.CutPrefix(scanner.Text(), "data: "); found {
+					lines <- data
+				}
+			}
+		}()
+		return lines
+	}
+	events1 := openEvents("")
+	events2 := openEvents("?" + gwapi.ParamThingID + "=" + thingID)
+	// allow the subscription to reach the server
+	time.Sleep(100 * time.Millisecond)
+
+	err = device.PubEvent(thingID, eventName, []byte("21"))
+	require.NoError(t, err)
+
+	for _, events := range []chan string{events1, events2} {
+		select {
+		case data := <-events:
+			tv := gwapi.ThingValue{}
+			err = json.Unmarshal([]byte(data), &tv)
+			require.NoError(t, err)
+			assert.Equal(t, thingID, tv.ThingID)
+			assert.Equal(t, "21", tv.Data)
+		case <-time.After(3 * time.Second):
+			t.Fatal("no event received")
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, events1, "duplicate event")
+	assert.Empty(t, events2, "duplicate event")
+}
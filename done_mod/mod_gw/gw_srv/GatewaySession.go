@@ -0,0 +1,146 @@
+package gwsrv
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	"github.com/hiveot/hub/done_tool/things"
+)
+
+// eventBufferSize is the nr of events buffered per SSE connection before events are dropped
+const eventBufferSize = 100
+
+// eventListener is an SSE connection that receives the events that match its filter
+type eventListener struct {
+	agentID string
+	thingID string
+	name    string
+	c       chan *things.ThingValue
+}
+
+// match returns true if the event passes the listener's filter
+func (l *eventListener) match(tv *things.ThingValue) bool {
+	return (l.agentID == "" || l.agentID == tv.AgentID) &&
+		(l.thingID == "" || l.thingID == tv.ThingID) &&
+		(l.name == "" || l.name == tv.Name)
+}
+
+// GatewaySession holds the Hub connection of a client of the gateway.
+// Requests are passed to the Hub using the client's own connection so the
+// client's permissions apply.
+type GatewaySession struct {
+	clientID string
+	// hash of the password used to connect, to avoid reconnecting on each request
+	passwordHash []byte
+	hc           *clidone.HubClient
+	// the connection is subscribed to all events by the first listener
+	subscribed bool
+
+	lastActivity time.Time
+	// SSE connections of this session
+	listeners []*eventListener
+	mux       sync.RWMutex
+}
+
+// AddListener adds an SSE event listener.
+// Use RemoveListener when the connection closes.
+//
+// The first listener subscribes the session to all events. The subscription
+// remains for the duration of the session as the transport doesn't unsubscribe.
+// Each listener filters the events it receives, so overlapping listeners don't
+// lead to duplicate events.
+//
+//	agentID, thingID and name filter the events. Use "" for all.
+func (s *GatewaySession) AddListener(agentID, thingID, name string) (*eventListener, error) {
+	l := &eventListener{
+		agentID: agentID,
+		thingID: thingID,
+		name:    name,
+		c:       make(chan *things.ThingValue, eventBufferSize),
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.subscribed {
+		err := s.hc.SubEvents("", "", "")
+		if err != nil {
+			return nil, err
+		}
+		s.subscribed = true
+	}
+	s.listeners = append(s.listeners, l)
+	return l, nil
+}
+
+// Close the session's Hub connection and its SSE connections
+func (s *GatewaySession) Close() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, l := range s.listeners {
+		close(l.c)
+	}
+	s.listeners = nil
+	s.hc.Disconnect()
+}
+
+// IsIdle returns true if the session is not used for the given duration.
+// Sessions with SSE connections are never idle.
+func (s *GatewaySession) IsIdle(timeout time.Duration) bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return len(s.listeners) == 0 && time.Since(s.lastActivity) > timeout
+}
+
+// onEvent passes an event to the matching SSE listeners.
+// Events are dropped for listeners that don't keep up.
+func (s *GatewaySession) onEvent(tv *things.ThingValue) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	for _, l := range s.listeners {
+		if l.match(tv) {
+			select {
+			case l.c <- tv:
+			default:
+				slog.Warn("onEvent; SSE listener is too slow. Event dropped",
+					slog.String("clientID", s.clientID),
+					slog.String("thingID", tv.ThingID),
+					slog.String("name", tv.Name))
+			}
+		}
+	}
+}
+
+// RemoveListener removes an SSE event listener
+func (s *GatewaySession) RemoveListener(l *eventListener) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i, l2 := range s.listeners {
+		if l2 == l {
+			s.listeners = append(s.listeners[:i], s.listeners[i+1:]...)
+			close(l.c)
+			break
+		}
+	}
+	s.lastActivity = time.Now()
+}
+
+// UpdateActivity sets the last activity time to now
+func (s *GatewaySession) UpdateActivity() {
+	s.mux.Lock()
+	s.lastActivity = time.Now()
+	s.mux.Unlock()
+}
+
+// NewGatewaySession creates a session for a connected Hub client
+func NewGatewaySession(hc *clidone.HubClient, passwordHash []byte) *GatewaySession {
+	s := &GatewaySession{
+		clientID:     hc.ClientID(),
+		passwordHash: passwordHash,
+		hc:           hc,
+		lastActivity: time.Now(),
+		listeners:    make([]*eventListener, 0),
+	}
+	hc.SetEventHandler(s.onEvent)
+	return s
+}
@@ -0,0 +1,128 @@
+package gwsrv
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"log/slog"
+	"sync"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+)
+
+// GatewaySessions manages the sessions of the gateway clients by clientID
+type GatewaySessions struct {
+	// Hub URL and CA for connecting client sessions
+	hubURL string
+	caCert *x509.Certificate
+	// close sessions that are not used for this duration
+	timeout time.Duration
+
+	sessions map[string]*GatewaySession
+	mux      sync.RWMutex
+	stopChan chan bool
+}
+
+// CloseIdle closes the sessions that have been idle longer than the timeout
+func (sm *GatewaySessions) CloseIdle() {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	for clientID, s := range sm.sessions {
+		if s.IsIdle(sm.timeout) {
+			slog.Info("CloseIdle; closing idle session", "clientID", clientID)
+			s.Close()
+			delete(sm.sessions, clientID)
+		}
+	}
+}
+
+// Close the session of a client, if it exists
+func (sm *GatewaySessions) Close(clientID string) {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	s, found := sm.sessions[clientID]
+	if found {
+		s.Close()
+		delete(sm.sessions, clientID)
+	}
+}
+
+// GetSession returns the session of a client or nil if the client has no session
+func (sm *GatewaySessions) GetSession(clientID string) *GatewaySession {
+	sm.mux.RLock()
+	defer sm.mux.RUnlock()
+	s := sm.sessions[clientID]
+	if s != nil {
+		s.UpdateActivity()
+	}
+	return s
+}
+
+// Start the periodic cleanup of idle sessions
+func (sm *GatewaySessions) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sm.CloseIdle()
+			case <-sm.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the cleanup and close all sessions
+func (sm *GatewaySessions) Stop() {
+	close(sm.stopChan)
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+	for _, s := range sm.sessions {
+		s.Close()
+	}
+	sm.sessions = make(map[string]*GatewaySession)
+}
+
+// ValidatePassword verifies the login credentials with the Hub.
+// This re-uses the session of the client if the password matches, or connects
+// to the Hub using the credentials and creates a new session.
+// Intended for use by the basic authenticator of the TLS server.
+func (sm *GatewaySessions) ValidatePassword(loginID string, password string) bool {
+	hash := sha256.Sum256([]byte(password))
+
+	s := sm.GetSession(loginID)
+	if s != nil && subtle.ConstantTimeCompare(s.passwordHash, hash[:]) == 1 {
+		return true
+	}
+	hc := clidone.NewHubClient(sm.hubURL, loginID, sm.caCert)
+	err := hc.ConnectWithPassword(password)
+	if err != nil {
+		slog.Warn("ValidatePassword; login failed",
+			slog.String("loginID", loginID), slog.String("err", err.Error()))
+		return false
+	}
+	// replace the existing session, if any
+	sm.Close(loginID)
+	sm.mux.Lock()
+	sm.sessions[loginID] = NewGatewaySession(hc, hash[:])
+	sm.mux.Unlock()
+	return true
+}
+
+// NewGatewaySessions creates the session manager for the gateway
+//
+//	hubURL and caCert of the Hub for connecting clients
+//	timeout after which unused sessions are closed
+func NewGatewaySessions(hubURL string, caCert *x509.Certificate, timeout time.Duration) *GatewaySessions {
+	sm := &GatewaySessions{
+		hubURL:   hubURL,
+		caCert:   caCert,
+		timeout:  timeout,
+		sessions: make(map[string]*GatewaySession),
+		stopChan: make(chan bool),
+	}
+	return sm
+}
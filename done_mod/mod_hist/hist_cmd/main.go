@@ -10,6 +10,7 @@ import (
 	histsrv "github.com/hiveot/hub/done_mod/mod_hist/hist_srv"
 	"github.com/hiveot/hub/done_tool/buckets/boltstore"
 	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/metrics"
 	"github.com/hiveot/hub/done_tool/plugin"
 )
 
@@ -32,5 +33,6 @@ func main() {
 		panic(err.Error())
 	}
 	svc := histsrv.NewHistoryService(store)
+	metrics.DefaultRegistry.Register(svc)
 	plugin.StartPlugin(svc, &env)
 }
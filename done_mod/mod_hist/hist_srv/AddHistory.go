@@ -8,6 +8,7 @@ import (
 
 	"github.com/hiveot/hub/done_cli/cli_done/transport"
 	"github.com/hiveot/hub/done_tool/buckets"
+	"github.com/hiveot/hub/done_tool/metrics"
 
 	"github.com/hiveot/hub/done_tool/things"
 )
@@ -20,6 +21,14 @@ type AddHistory struct {
 	onAddedValue func(ev *things.ThingValue)
 	//
 	retentionMgr *ManageHistory
+	// count of received values by result: stored, skipped or invalid
+	received *metrics.Counter
+}
+
+// Collect writes the number of received values by result, for tracking the ingest rate.
+// This implements the metrics.Collector interface.
+func (svc *AddHistory) Collect(mw *metrics.MetricWriter) {
+	svc.received.Collect(mw)
 }
 
 // encode a ThingValue into a single key value pair for easy storage and filtering.
@@ -92,10 +101,12 @@ func (svc *AddHistory) AddMessage(newtv *things.ThingValue) error {
 	retain, err := svc.validateValue(newtv)
 	if err != nil {
 		slog.Warn("invalid event", "name", newtv.Name, "err", err)
+		svc.received.Inc("invalid")
 		return err
 	}
 	if !retain {
 		slog.Debug("event value not retained", slog.String("name", newtv.Name))
+		svc.received.Inc("skipped")
 		return nil
 	}
 
@@ -114,6 +125,8 @@ func (svc *AddHistory) AddMessage(newtv *things.ThingValue) error {
 	err = bucket.Set(key, val)
 	if err != nil {
 		slog.Error("AddMessage storage error", "err", err)
+	} else {
+		svc.received.Inc("stored")
 	}
 	_ = bucket.Close()
 	if svc.onAddedValue != nil {
@@ -144,6 +157,7 @@ func (svc *AddHistory) AddMessages(tvList []*things.ThingValue) (err error) {
 		retain, err := svc.validateValue(eventValue)
 		if err != nil {
 			slog.Warn("Invalid event value", slog.String("name", eventValue.Name))
+			svc.received.Inc("invalid")
 			return err
 		}
 		if retain {
@@ -153,12 +167,17 @@ func (svc *AddHistory) AddMessages(tvList []*things.ThingValue) (err error) {
 			if svc.onAddedValue != nil {
 				svc.onAddedValue(eventValue)
 			}
+		} else {
+			svc.received.Inc("skipped")
 		}
 	}
 	// adding in bulk, opening and closing buckets only once for each things address
 	for thingAddr, kvpairs := range kvpairsByThingAddr {
 		bucket := svc.store.GetBucket(thingAddr)
-		_ = bucket.SetMultiple(kvpairs)
+		err2 := bucket.SetMultiple(kvpairs)
+		if err2 == nil {
+			svc.received.Add(float64(len(kvpairs)), "stored")
+		}
 		err = bucket.Close()
 	}
 	return nil
@@ -201,6 +220,8 @@ func NewAddHistory(
 		store:        store,
 		retentionMgr: retentionMgr,
 		onAddedValue: onAddedValue,
+		received: metrics.NewCounter("hiveot_history_received",
+			"Values received by the history service", "result"),
 	}
 
 	return svc
@@ -8,6 +8,7 @@ import (
 	authcli "github.com/hiveot/hub/done_mod/mod_auth/auth_cli"
 	histapi "github.com/hiveot/hub/done_mod/mod_hist/hist_api"
 	"github.com/hiveot/hub/done_tool/buckets"
+	"github.com/hiveot/hub/done_tool/metrics"
 	"github.com/hiveot/hub/done_tool/things"
 )
 
@@ -36,6 +37,31 @@ type HistoryService struct {
 	addHistory *AddHistory
 }
 
+// Collect writes the ingest counts and the size of the history buckets.
+// This implements the metrics.Collector interface.
+func (svc *HistoryService) Collect(mw *metrics.MetricWriter) {
+	if svc.addHistory != nil {
+		svc.addHistory.Collect(mw)
+	}
+	infoList, err := svc.bucketStore.BucketsInfo()
+	if err != nil {
+		slog.Error("failed reading the history buckets info", "err", err.Error())
+		return
+	}
+	mw.WriteFamily("hiveot_history_bucket_records", metrics.TypeGauge,
+		"Number of records in the history bucket of a Thing")
+	for _, info := range infoList {
+		mw.WriteSample("hiveot_history_bucket_records", float64(info.NrRecords),
+			metrics.Label{Name: "bucket", Value: info.Id})
+	}
+	mw.WriteFamily("hiveot_history_bucket_size_bytes", metrics.TypeGauge,
+		"Size of the data in the history bucket of a Thing")
+	for _, info := range infoList {
+		mw.WriteSample("hiveot_history_bucket_size_bytes", float64(info.DataSize),
+			metrics.Label{Name: "bucket", Value: info.Id})
+	}
+}
+
 // GetAddHistory returns the handler for adding history.
 // Intended for testing.
 func (svc *HistoryService) GetAddHistory() *AddHistory {
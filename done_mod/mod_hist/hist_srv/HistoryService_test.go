@@ -0,0 +1,81 @@
+package histsrv_test
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	histapi "github.com/hiveot/hub/done_mod/mod_hist/hist_api"
+	histcli "github.com/hiveot/hub/done_mod/mod_hist/hist_cli"
+	histsrv "github.com/hiveot/hub/done_mod/mod_hist/hist_srv"
+	"github.com/hiveot/hub/done_tool/buckets/bolts"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/plugin"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startHistory starts the test hub and the history service
+func startHistory(t *testing.T) (ts *testenv.TestServer, stopFn func()) {
+	logging.SetLogging("warning", "")
+	var store *bolts.BoltStore
+	ts, stopSvc := testenv.StartTestService(t, histapi.ServiceName, func(ts *testenv.TestServer) plugin.IPlugin {
+		store = bolts.NewBoltStore(path.Join(ts.TestDir, "stores", histapi.ServiceName, "history.boltdb"))
+		err := store.Open()
+		require.NoError(t, err)
+		return histsrv.NewHistoryService(store)
+	})
+	return ts, func() {
+		stopSvc()
+		_ = store.Close()
+	}
+}
+
+// Events published by a device are added to the history and can be read by users
+func TestEventHistory(t *testing.T) {
+	const deviceID = "device1"
+	const thingID = "thing1"
+	const eventName = "temperature"
+	ts, stopFn := startHistory(t)
+	defer stopFn()
+
+	device, err := ts.AddConnectDevice(deviceID)
+	require.NoError(t, err)
+	defer device.Disconnect()
+	user, err := ts.AddConnectUser("user1", authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	defer user.Disconnect()
+
+	// the history key has a msec timestamp, so don't publish within the same msec
+	for _, value := range []string{"10", "11", "12"} {
+		err = device.PubEvent(thingID, eventName, []byte(value))
+		require.NoError(t, err)
+		time.Sleep(3 * time.Millisecond)
+	}
+
+	// the history service receives the events asynchronously
+	histCl := histcli.NewReadHistoryClient(user)
+	var latest string
+	for i := 0; i < 20 && latest != "12"; i++ {
+		time.Sleep(50 * time.Millisecond)
+		values, err2 := histCl.GetLatest(deviceID, thingID, []string{eventName})
+		require.NoError(t, err2)
+		if tv := values.Get(eventName); tv != nil {
+			latest = string(tv.Data)
+		}
+	}
+	assert.Equal(t, "12", latest)
+
+	cursor, releaseFn, err := histCl.GetCursor(deviceID, thingID, eventName)
+	require.NoError(t, err)
+	defer releaseFn()
+	tv, valid, err := cursor.First()
+	require.NoError(t, err)
+	require.True(t, valid)
+	assert.Equal(t, eventName, tv.Name)
+	batch, _, err := cursor.NextN(10)
+	require.NoError(t, err)
+	assert.Len(t, batch, 2)
+}
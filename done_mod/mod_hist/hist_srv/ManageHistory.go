@@ -4,6 +4,7 @@ import (
 	"log/slog"
 
 	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	auditcli "github.com/hiveot/hub/done_mod/mod_audit/audit_cli"
 	histapi "github.com/hiveot/hub/done_mod/mod_hist/hist_api"
 	"github.com/hiveot/hub/done_tool/things"
 )
@@ -28,6 +29,8 @@ type ManageHistory struct {
 	rules histapi.RetentionRuleSet
 	//
 	hc *clidone.HubClient
+	// sends audit records of changes
+	audit *auditcli.AuditPublisher
 }
 
 // return the first retention rule that applies to the given value or nil if no rule applies
@@ -126,12 +129,19 @@ func (svc *ManageHistory) Start() (err error) {
 		histapi.SetRetentionRulesMethod: svc.SetRetentionRules,
 	}
 	svc.hc.SetRPCCapability(histapi.ManageHistoryCap, capMethods)
+	// record retention changes in the audit log
+	svc.audit = auditcli.EnableAudit(svc.hc, map[string][]string{
+		histapi.ManageHistoryCap: {histapi.SetRetentionRulesMethod},
+	})
 	return nil
 }
 
 // Stop using the history manager
 func (svc *ManageHistory) Stop() {
-	// nothing to do here
+	if svc.audit != nil {
+		svc.audit.Stop()
+		svc.audit = nil
+	}
 }
 
 // NewManageHistory creates a new instance that implements IManageRetention
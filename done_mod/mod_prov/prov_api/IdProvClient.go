@@ -1,5 +1,11 @@
 package provapi
 
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
 // ProvisioningServerType defines the discovery type for the provisioning
 // this will be published as _provisioning._hiveot._tcp
 const ProvisioningServerType = "idprov"
@@ -45,6 +51,14 @@ type ProvisionRequestArgs struct {
 	MAC string `json:"mac"`
 	// The device or service public key
 	PubKey string `json:"pubKey,omitempty"`
+	// Nonce obtained from the ProvisionNoncePath, when a proof is provided
+	Nonce string `json:"nonce,omitempty"`
+	// Proof of holding the out-of-band secret of a pre-approved client. See CreateProof.
+	// Requests with a valid proof are approved automatically.
+	Proof string `json:"proof,omitempty"`
+	// CertRequest requests a device certificate for mutual TLS authentication.
+	// The public key must be an ECDSA key in PEM format.
+	CertRequest bool `json:"certRequest,omitempty"`
 }
 
 // ProvisionRequestResp holds the response to the request
@@ -54,4 +68,35 @@ type ProvisionRequestResp struct {
 	// Token when approved.
 	// This has a short lifespan and must be refresh immediately after connecting to the clidone.
 	Token string `json:"token,omitempty"`
+	// CertPEM holds the device certificate signed by the Hub CA, when approved and requested.
+	CertPEM string `json:"certPEM,omitempty"`
+	// CaCertPEM holds the Hub CA certificate that signed CertPEM
+	CaCertPEM string `json:"caCertPEM,omitempty"`
+}
+
+// ProvisionNoncePath to obtain a nonce for proving the out-of-band secret.
+// The nonce is valid for a single approved request of the client within NonceValiditySec.
+// A nonce is only consumed by a request with a valid proof.
+//
+//	GET, query parameter: clientID. Response: ProvisionNonceResp
+const ProvisionNoncePath = "/idprov/nonce"
+
+// ParamClientID is the query parameter of the nonce path
+const ParamClientID = "clientID"
+
+// NonceValiditySec is the time in which a nonce must be used
+const NonceValiditySec = 300
+
+// ProvisionNonceResp holds the nonce issued for a client
+type ProvisionNonceResp struct {
+	Nonce string `json:"nonce"`
+}
+
+// CreateProof returns the proof that the client holds the out-of-band secret.
+// This is the base64 encoded HMAC-SHA256 of the public key and nonce, keyed with the secret.
+func CreateProof(secret string, pubKey string, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(pubKey))
+	mac.Write([]byte(nonce))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
 }
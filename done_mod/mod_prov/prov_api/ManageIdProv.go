@@ -17,6 +17,13 @@ type ApproveRequestArgs struct {
 	ClientType string `json:"clientType"`
 }
 
+// RequestPendingEvent is sent when a new provisioning request awaits approval.
+// As the request holds the client's public key and MAC, it is not published as an
+// event but sent as a notification to the inbox of each administrator. Use
+// SubNotifications(ManageProvisioningCap, RequestPendingEvent) to receive it.
+// The notification payload is the ProvisionStatus.
+const RequestPendingEvent = "requestPending"
+
 // GetRequestsMethod returns a list of provisioning requests
 // This is an in-memory list that is cleared when the service restarts
 const GetRequestsMethod = "getRequests"
@@ -46,6 +53,10 @@ type PreApprovedClient struct {
 	MAC string `json:"mac"`
 	// Device or service public key used to issue tokens
 	PubKey string `json:"pubKey"`
+	// Optional out-of-band secret, eg printed on the device label.
+	// When set, requests must include a proof of the secret and the public key
+	// of the request is accepted. See CreateProof.
+	Secret string `json:"secret,omitempty"`
 }
 type PreApproveClientsArgs struct {
 	Approvals []PreApprovedClient `json:"approvals,omitempty"`
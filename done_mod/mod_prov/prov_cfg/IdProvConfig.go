@@ -0,0 +1,27 @@
+package provcfg
+
+// DefaultIDProvPort is the default listening port for https requests
+const DefaultIDProvPort = 9444
+
+// DefaultCertValidityDays is the default validity of issued device certificates
+const DefaultCertValidityDays = 14
+
+// IdProvConfig with the provisioning service configuration
+type IdProvConfig struct {
+	// Port the provisioning server listens on for https requests
+	Port uint `yaml:"port"`
+
+	// CertValidityDays is the validity of the device certificates issued to approved devices.
+	// Devices renew their certificate by submitting a certificate request using a
+	// connection that is authenticated with their current certificate.
+	CertValidityDays int `yaml:"certValidityDays"`
+}
+
+// NewIdProvConfig creates a new config with default values
+func NewIdProvConfig() IdProvConfig {
+	cfg := IdProvConfig{
+		Port:             DefaultIDProvPort,
+		CertValidityDays: DefaultCertValidityDays,
+	}
+	return cfg
+}
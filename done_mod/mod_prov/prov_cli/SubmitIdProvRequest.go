@@ -1,6 +1,9 @@
 package provcli
 
 import (
+	"fmt"
+	"net/url"
+
 	provapi "github.com/hiveot/hub/done_mod/mod_prov/prov_api"
 	"github.com/hiveot/hub/done_tool/ser"
 	"github.com/hiveot/hub/done_tool/tlsclient"
@@ -13,23 +16,72 @@ type IdProvUserClient struct {
 	provServiceURL string
 }
 
+// submitRequest sends a provisioning request to the provisioning server.
+// If a secret is provided then a nonce is obtained to prove the secret.
+func submitRequest(req provapi.ProvisionRequestArgs, secret string,
+	tlsClient *tlsclient.TLSClient) (resp provapi.ProvisionRequestResp, err error) {
+
+	if secret != "" {
+		nonceResp := provapi.ProvisionNonceResp{}
+		noncePath := fmt.Sprintf("%s?%s=%s",
+			provapi.ProvisionNoncePath, provapi.ParamClientID, url.QueryEscape(req.ClientID))
+		nonceData, err := tlsClient.Get(noncePath)
+		if err == nil {
+			err = ser.Unmarshal(nonceData, &nonceResp)
+		}
+		if err != nil {
+			return resp, err
+		}
+		req.Nonce = nonceResp.Nonce
+		req.Proof = provapi.CreateProof(secret, req.PubKey, nonceResp.Nonce)
+	}
+	reqData, _ := ser.Marshal(req)
+	respData, err := tlsClient.Post(provapi.ProvisionRequestPath, reqData)
+	if err != nil {
+		return resp, err
+	}
+	err = ser.Unmarshal(respData, &resp)
+	return resp, err
+}
+
 // SubmitIdProvRequest send a request to provision this client and obtain an auth token
 // This returns the request status, an encrypted token and an error
 // If the status is approved the token will contain the auth token.
 // The token is only usable by the owner of the private key and has a limited lifespan
 // It should immediately be used to connect to the Hub and refresh for a new token with
 // a longer lifespan. JWT decode allows to determine the expiry.
-func SubmitIdProvRequest(clientID string, pubKey string, mac string, tlsClient *tlsclient.TLSClient) (
-	status provapi.ProvisionStatus, token string, err error) {
+//
+// If the client was pre-approved with an out-of-band secret then provide the secret
+// to prove the client holds it. Use "" if no secret is used.
+func SubmitIdProvRequest(clientID string, pubKey string, mac string, secret string,
+	tlsClient *tlsclient.TLSClient) (status provapi.ProvisionStatus, token string, err error) {
 
 	req := provapi.ProvisionRequestArgs{
 		ClientID: clientID,
 		PubKey:   pubKey,
 		MAC:      mac,
 	}
-	reqData, _ := ser.Marshal(req)
-	respData, err := tlsClient.Post(provapi.ProvisionRequestPath, reqData)
-	resp := provapi.ProvisionRequestResp{}
-	err = ser.Unmarshal(respData, &resp)
+	resp, err := submitRequest(req, secret, tlsClient)
 	return resp.Status, resp.Token, err
 }
+
+// SubmitIdProvCertRequest sends a request to provision this device and obtain an auth token
+// and a device certificate for mutual TLS authentication.
+// This is the same as SubmitIdProvRequest, except that the public key must be an ECDSA
+// key in PEM format. When approved, the response contains the token, the certificate
+// and the CA certificate in PEM format.
+//
+// To renew the certificate before it expires, submit the request for the same public key
+// using a tlsClient that is connected with the current certificate. This doesn't require
+// a new approval. See also ConnectWithClientCert.
+func SubmitIdProvCertRequest(clientID string, pubKeyPEM string, mac string, secret string,
+	tlsClient *tlsclient.TLSClient) (resp provapi.ProvisionRequestResp, err error) {
+
+	req := provapi.ProvisionRequestArgs{
+		ClientID:    clientID,
+		PubKey:      pubKeyPEM,
+		MAC:         mac,
+		CertRequest: true,
+	}
+	return submitRequest(req, secret, tlsClient)
+}
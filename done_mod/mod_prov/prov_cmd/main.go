@@ -7,6 +7,7 @@ import (
 	"path"
 
 	donecfg "github.com/hiveot/hub/done_cfg"
+	provcfg "github.com/hiveot/hub/done_mod/mod_prov/prov_cfg"
 	provsrv "github.com/hiveot/hub/done_mod/mod_prov/prov_srv"
 	"github.com/hiveot/hub/done_tool/certs"
 	"github.com/hiveot/hub/done_tool/logging"
@@ -16,9 +17,6 @@ import (
 // TODO: merge the server with a web server that hosts the admin ui server
 // TODO: option to enable/disable the request server
 
-// DefaultIDProvPort is the default listening port for https requests
-const DefaultIDProvPort = 9444
-
 // Start the service.
 // Preconditions:
 //  1. A loginID and keys for this service must already have been added.
@@ -31,19 +29,25 @@ func main() {
 	env := plugin.GetAppEnvironment("", true)
 	logging.SetLogging(env.LogLevel, "")
 	slog.Warn("Starting idprov service", "clientID", env.ClientID, "loglevel", env.LogLevel)
+	cfg := provcfg.NewIdProvConfig()
+	_ = env.LoadConfig(&cfg)
 
 	// load the server cert
 	// TODO: get server cert info from idprov config
 	serverCertPath := path.Join(env.CertsDir, donecfg.DefaultServerCertFile)
 	serverKeyPath := path.Join(env.CertsDir, donecfg.DefaultServerKeyFile)
-	serverCert, err := certs.LoadTLSCertFromPEM(serverCertPath, serverKeyPath)
+	// the core renews the server certificate before it expires
+	certReloader, err := certs.NewTLSCertReloader(serverCertPath, serverKeyPath)
 	if err != nil {
 		slog.Error("idprov: Failed loading server certificate", "err", err)
 		os.Exit(1)
 	}
 
 	// start the service using the connection and hub server certificate
-	svc := provsrv.NewIdProvService(DefaultIDProvPort, serverCert, env.CaCert)
+	storeDir := path.Join(env.StoresDir, env.ClientID)
+	svc := provsrv.NewIdProvService(storeDir, cfg.Port, certReloader.GetTLSCert(), env.CaCert)
+	svc.SetCertificateSource(certReloader.GetCertificate)
+	svc.SetCertValidityDays(cfg.CertValidityDays)
 
 	plugin.StartPlugin(svc, &env)
 }
@@ -1,15 +1,19 @@
 package provsrv
 
 import (
+	"crypto"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 
 	clidone "github.com/hiveot/hub/done_cli/cli_done"
 	provapi "github.com/hiveot/hub/done_mod/mod_prov/prov_api"
+	"github.com/hiveot/hub/done_tool/certs"
+	"github.com/hiveot/hub/done_tool/keys"
 	"github.com/hiveot/hub/done_tool/tlsserver"
 )
 
@@ -39,7 +43,13 @@ func (srv *IdProvHttpServer) handleRequest(w http.ResponseWriter, req *http.Requ
 		return
 	}
 	ctx := clidone.ServiceContext{}
-	resp, err := srv.mng.SubmitRequest(ctx, &args)
+	var resp *provapi.ProvisionRequestResp
+	if args.CertRequest && isDeviceCertOwner(req, args.ClientID, args.PubKey) {
+		// devices renew their certificate without approval
+		resp, err = srv.mng.RenewDeviceCert(args.ClientID, args.PubKey)
+	} else {
+		resp, err = srv.mng.SubmitRequest(ctx, &args)
+	}
 	if err != nil {
 		slog.Warn("idprov handleRequest. refused", "err", err.Error())
 		w.WriteHeader(http.StatusNotAcceptable)
@@ -52,16 +62,61 @@ func (srv *IdProvHttpServer) handleRequest(w http.ResponseWriter, req *http.Requ
 	}
 }
 
+// handleNonce issues a nonce for the client to prove its out-of-band secret
+func (srv *IdProvHttpServer) handleNonce(w http.ResponseWriter, req *http.Request) {
+	clientID := srv.tlsServer.GetQueryString(req, provapi.ParamClientID, "")
+	if clientID == "" {
+		srv.tlsServer.WriteBadRequest(w, "missing clientID")
+		return
+	}
+	nonce, err := srv.mng.CreateNonce(clientID)
+	if err != nil {
+		srv.tlsServer.WriteInternalError(w, err.Error())
+		return
+	}
+	respData, _ := json.Marshal(provapi.ProvisionNonceResp{Nonce: nonce})
+	_, _ = w.Write(respData)
+}
+
+// isDeviceCertOwner returns true if the request is authenticated with a device
+// certificate of the client, issued for the given public key.
+// The TLS server has verified that the certificate is signed by the Hub CA.
+func isDeviceCertOwner(req *http.Request, clientID string, pubKeyPEM string) bool {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return false
+	}
+	cert := req.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName != clientID ||
+		!slices.Contains(cert.Subject.OrganizationalUnit, certs.OUIoTDevice) {
+		return false
+	}
+	pubKey := keys.NewKey(keys.DetermineKeyType(pubKeyPEM))
+	if pubKey == nil || pubKey.ImportPublic(pubKeyPEM) != nil {
+		return false
+	}
+	// the public keys of all key types in the standard library implement Equal
+	certKey, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && certKey.Equal(pubKey.PublicKey())
+}
+
 // StartIdProvHttpServer starts the http server to handle provisioning requests
+//
+//	getCertificate is the optional source of renewed server certificates, or nil
 func StartIdProvHttpServer(
-	port uint, serverCert *tls.Certificate, caCert *x509.Certificate, mng *ManageIdProvService) (*IdProvHttpServer, error) {
+	port uint, serverCert *tls.Certificate,
+	getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error),
+	caCert *x509.Certificate, mng *ManageIdProvService) (*IdProvHttpServer, error) {
 
 	tlsServer := tlsserver.NewTLSServer("", port, serverCert, caCert)
+	if getCertificate != nil {
+		tlsServer.SetCertificateSource(getCertificate)
+	}
 	srv := IdProvHttpServer{
 		tlsServer: tlsServer,
 		mng:       mng,
 	}
 	tlsServer.AddHandlerNoAuth(provapi.ProvisionRequestPath, srv.handleRequest)
+	tlsServer.AddHandlerNoAuth(provapi.ProvisionNoncePath, srv.handleNonce).Methods(http.MethodGet)
 	err := srv.tlsServer.Start()
 	return &srv, err
 }
@@ -4,17 +4,26 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"log/slog"
+	"path"
 
 	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	auditcli "github.com/hiveot/hub/done_mod/mod_audit/audit_cli"
 	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
 	authcli "github.com/hiveot/hub/done_mod/mod_auth/auth_cli"
 	provapi "github.com/hiveot/hub/done_mod/mod_prov/prov_api"
+	"github.com/hiveot/hub/done_tool/buckets/bolts"
 )
 
 const DefaultIoTCertValidityDays = 14
 const ApprovedSecret = "approved"
 const DefaultRetrySec = 12 * 3600
 
+// name of the storage file of the approved and rejected requests
+const storeFile = "idprov.kvbtree"
+
+// RequestsBucketName is the name of the store bucket with the approved and rejected requests
+const RequestsBucketName = "requests"
+
 // IdProvService handles provisioning requests from devices and services.
 // This starts listening on the provisioning port using a server certificate signed by the Hub CA.
 // If enabled, publish the DNS-SD discovery record with the server address and port.
@@ -32,19 +41,41 @@ type IdProvService struct {
 
 	// Hub connection
 	hc *clidone.HubClient
+	// directory of the request store
+	storeDir string
+	// store of the approved and rejected requests
+	store *bolts.BoltStore
 	// the manage service
 	mng *ManageIdProvService
+	// sends audit records of changes
+	audit *auditcli.AuditPublisher
 
 	// server listening port
 	port uint
 	// server TLS certificate
 	serverCert *tls.Certificate
+	// optional source of renewed server certificates
+	getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
 	// hiveot CA that signed the server cert
 	caCert *x509.Certificate
+	// validity of issued device certificates
+	certValidityDays int
 	// the http server that received provisioning requests
 	httpServer *IdProvHttpServer
 }
 
+// SetCertificateSource sets the source of renewed server certificates.
+// Use before Start.
+func (svc *IdProvService) SetCertificateSource(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) {
+	svc.getCertificate = getCertificate
+}
+
+// SetCertValidityDays sets the validity of the device certificates issued to approved devices.
+// The default is DefaultIoTCertValidityDays. Use before Start.
+func (svc *IdProvService) SetCertValidityDays(validityDays int) {
+	svc.certValidityDays = validityDays
+}
+
 // Start the provisioning service
 // 1. start the management service
 // 2. set allowed roles for RPC calls to this service
@@ -55,7 +86,22 @@ func (svc *IdProvService) Start(hc *clidone.HubClient) (err error) {
 	slog.Warn("Starting the provisioning service", "clientID", hc.ClientID())
 	svc.hc = hc
 	//svc.Stop()
-	svc.mng = StartManageIdProvService(svc.hc)
+	svc.store = bolts.NewBoltStore(path.Join(svc.storeDir, storeFile))
+	err = svc.store.Open()
+	if err != nil {
+		return err
+	}
+	svc.mng = StartManageIdProvService(
+		svc.hc, svc.store.GetBucket(RequestsBucketName), svc.certValidityDays)
+	// record provisioning changes in the audit log
+	svc.audit = auditcli.EnableAudit(svc.hc, map[string][]string{
+		provapi.ManageProvisioningCap: {
+			provapi.ApproveRequestMethod,
+			provapi.PreApproveClientsMethod,
+			provapi.RejectRequestMethod,
+			provapi.SubmitRequestMethod,
+		},
+	})
 	if err != nil {
 		return err
 	}
@@ -71,7 +117,8 @@ func (svc *IdProvService) Start(hc *clidone.HubClient) (err error) {
 	}
 
 	// Start the HTTP server
-	svc.httpServer, err = StartIdProvHttpServer(svc.port, svc.serverCert, svc.caCert, svc.mng)
+	svc.httpServer, err = StartIdProvHttpServer(
+		svc.port, svc.serverCert, svc.getCertificate, svc.caCert, svc.mng)
 	return err
 }
 
@@ -86,14 +133,29 @@ func (svc *IdProvService) Stop() {
 		svc.mng.Stop()
 		svc.mng = nil
 	}
+	if svc.audit != nil {
+		svc.audit.Stop()
+		svc.audit = nil
+	}
+	if svc.store != nil {
+		_ = svc.store.Close()
+		svc.store = nil
+	}
 }
 
 // NewIdProvService creates a new provisioning service instance
-func NewIdProvService(port uint, serverCert *tls.Certificate, caCert *x509.Certificate) *IdProvService {
+//
+//	storeDir is the directory of the store with the approved and rejected requests
+//	port is the listening port of the provisioning server
+//	serverCert is the TLS certificate of the server, signed by caCert
+func NewIdProvService(storeDir string,
+	port uint, serverCert *tls.Certificate, caCert *x509.Certificate) *IdProvService {
 	svc := &IdProvService{
-		port:       port,
-		serverCert: serverCert,
-		caCert:     caCert,
+		storeDir:         storeDir,
+		port:             port,
+		serverCert:       serverCert,
+		caCert:           caCert,
+		certValidityDays: DefaultIoTCertValidityDays,
 	}
 
 	return svc
@@ -0,0 +1,394 @@
+package provsrv_test
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	certapi "github.com/hiveot/hub/done_mod/mod_cert/cert_api"
+	certsrv "github.com/hiveot/hub/done_mod/mod_cert/cert_srv"
+	provapi "github.com/hiveot/hub/done_mod/mod_prov/prov_api"
+	provcli "github.com/hiveot/hub/done_mod/mod_prov/prov_cli"
+	provsrv "github.com/hiveot/hub/done_mod/mod_prov/prov_srv"
+	"github.com/hiveot/hub/done_tool/certs"
+	"github.com/hiveot/hub/done_tool/keys"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/plugin"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/hiveot/hub/done_tool/things"
+	"github.com/hiveot/hub/done_tool/tlsclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startIdProv starts the test hub and the provisioning service on a free port.
+// This returns the address of the provisioning endpoint.
+func startIdProv(t *testing.T) (ts *testenv.TestServer, hostPort string, stopFn func()) {
+	logging.SetLogging("warning", "")
+	// the provisioning server needs a known port
+	port, err := testenv.GetFreePort()
+	require.NoError(t, err)
+	ts, stopFn = testenv.StartTestService(t, provapi.ServiceName, func(ts *testenv.TestServer) plugin.IPlugin {
+		storeDir := path.Join(ts.TestDir, provapi.ServiceName)
+		return provsrv.NewIdProvService(storeDir, uint(port), ts.ServerTLS, ts.CaCert)
+	})
+	hostPort = fmt.Sprintf("%s:%d", testenv.TestServerHost, port)
+	return ts, hostPort, stopFn
+}
+
+// startCerts starts the certs service that issues the device certificates
+func startCerts(t *testing.T, ts *testenv.TestServer) (stopFn func()) {
+	stopFn, err := ts.StartService(certapi.ServiceName, certsrv.NewCertsService(ts.CaCert, ts.CaKey))
+	require.NoError(t, err)
+	return stopFn
+}
+
+// A pre-approved device receives a token it can connect with
+func TestPreApprovedDevice(t *testing.T) {
+	const deviceID = "device1"
+	const mac = "00:11:22:33:44:55"
+	ts, hostPort, stopFn := startIdProv(t)
+	defer stopFn()
+
+	admin, err := ts.AddConnectUser("admin1", authapi.ClientRoleAdmin)
+	require.NoError(t, err)
+	defer admin.Disconnect()
+
+	device := clidone.NewHubClient(ts.ServerURL, deviceID, ts.CaCert)
+	kp := device.CreateKeyPair()
+	err = provcli.NewIdProvManageClient(admin).PreApproveDevices([]provapi.PreApprovedClient{{
+		ClientID:   deviceID,
+		ClientType: authapi.ClientTypeDevice,
+		MAC:        mac,
+		PubKey:     kp.ExportPublic(),
+	}})
+	require.NoError(t, err)
+
+	tlsClient := tlsclient.NewTLSClient(hostPort, ts.CaCert)
+	tlsClient.ConnectNoAuth()
+	defer tlsClient.Close()
+	status, token, err := provcli.SubmitIdProvRequest(deviceID, kp.ExportPublic(), mac, "", tlsClient)
+	require.NoError(t, err)
+	assert.False(t, status.Pending)
+	require.NotEmpty(t, token)
+
+	device.SetTokenRefresh(false)
+	err = device.ConnectWithToken(kp, token)
+	require.NoError(t, err)
+	device.Disconnect()
+
+	// a request with a different mac is denied
+	_, token, err = provcli.SubmitIdProvRequest(deviceID, kp.ExportPublic(), "other", "", tlsClient)
+	assert.Error(t, err)
+	assert.Empty(t, token)
+}
+
+// A request that isn't pre-approved is pending until an administrator approves it
+func TestApproveRequest(t *testing.T) {
+	const deviceID = "device2"
+	ts, hostPort, stopFn := startIdProv(t)
+	defer stopFn()
+
+	admin, err := ts.AddConnectUser("admin1", authapi.ClientRoleAdmin)
+	require.NoError(t, err)
+	defer admin.Disconnect()
+	mngCl := provcli.NewIdProvManageClient(admin)
+	// administrators are notified of pending requests
+	notifyChan := make(chan *things.ThingValue, 1)
+	admin.SetEventHandler(func(msg *things.ThingValue) {
+		notifyChan <- msg
+	})
+	err = admin.SubNotifications(provapi.ManageProvisioningCap, provapi.RequestPendingEvent)
+	require.NoError(t, err)
+
+	device := clidone.NewHubClient(ts.ServerURL, deviceID, ts.CaCert)
+	kp := device.CreateKeyPair()
+	tlsClient := tlsclient.NewTLSClient(hostPort, ts.CaCert)
+	tlsClient.ConnectNoAuth()
+	defer tlsClient.Close()
+	status, token, err := provcli.SubmitIdProvRequest(deviceID, kp.ExportPublic(), "", "", tlsClient)
+	require.NoError(t, err)
+	assert.True(t, status.Pending)
+	assert.Empty(t, token)
+	select {
+	case msg := <-notifyChan:
+		assert.Equal(t, provapi.RequestPendingEvent, msg.Name)
+		assert.Contains(t, string(msg.Data), deviceID)
+	case <-time.After(time.Second * 3):
+		t.Error("no pending request notification received")
+	}
+
+	pending, err := mngCl.GetRequests(true, false, false)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, deviceID, pending[0].ClientID)
+
+	err = mngCl.ApproveRequest(deviceID, authapi.ClientTypeDevice)
+	require.NoError(t, err)
+	status, token, err = provcli.SubmitIdProvRequest(deviceID, kp.ExportPublic(), "", "", tlsClient)
+	require.NoError(t, err)
+	assert.False(t, status.Pending)
+	require.NotEmpty(t, token)
+
+	device.SetTokenRefresh(false)
+	err = device.ConnectWithToken(kp, token)
+	require.NoError(t, err)
+	device.Disconnect()
+}
+
+// A device pre-approved with an out-of-band secret must prove it holds the secret
+func TestPreApprovedWithSecret(t *testing.T) {
+	const deviceID = "device3"
+	const secret = "secret123"
+	ts, hostPort, stopFn := startIdProv(t)
+	defer stopFn()
+
+	admin, err := ts.AddConnectUser("admin1", authapi.ClientRoleAdmin)
+	require.NoError(t, err)
+	defer admin.Disconnect()
+	// the public key isn't needed when a secret is used
+	err = provcli.NewIdProvManageClient(admin).PreApproveDevices([]provapi.PreApprovedClient{{
+		ClientID:   deviceID,
+		ClientType: authapi.ClientTypeDevice,
+		Secret:     secret,
+	}})
+	require.NoError(t, err)
+
+	device := clidone.NewHubClient(ts.ServerURL, deviceID, ts.CaCert)
+	kp := device.CreateKeyPair()
+	tlsClient := tlsclient.NewTLSClient(hostPort, ts.CaCert)
+	tlsClient.ConnectNoAuth()
+	defer tlsClient.Close()
+
+	// a request without proof or with the wrong secret is denied
+	_, token, err := provcli.SubmitIdProvRequest(deviceID, kp.ExportPublic(), "", "", tlsClient)
+	assert.Error(t, err)
+	assert.Empty(t, token)
+	_, token, err = provcli.SubmitIdProvRequest(deviceID, kp.ExportPublic(), "", "wrong", tlsClient)
+	assert.Error(t, err)
+	assert.Empty(t, token)
+
+	// a denied request doesn't consume the nonce
+	noncePath := fmt.Sprintf("%s?%s=%s", provapi.ProvisionNoncePath, provapi.ParamClientID, deviceID)
+	nonceData, err := tlsClient.Get(noncePath)
+	require.NoError(t, err)
+	nonceResp := provapi.ProvisionNonceResp{}
+	err = json.Unmarshal(nonceData, &nonceResp)
+	require.NoError(t, err)
+	postRequest := func(proofSecret string) error {
+		req := provapi.ProvisionRequestArgs{
+			ClientID: deviceID,
+			PubKey:   kp.ExportPublic(),
+			Nonce:    nonceResp.Nonce,
+			Proof:    provapi.CreateProof(proofSecret, kp.ExportPublic(), nonceResp.Nonce),
+		}
+		reqData, _ := json.Marshal(req)
+		_, err := tlsClient.Post(provapi.ProvisionRequestPath, reqData)
+		return err
+	}
+	err = postRequest("wrong")
+	assert.Error(t, err)
+	err = postRequest(secret)
+	require.NoError(t, err)
+	// the nonce can only be used once
+	err = postRequest(secret)
+	assert.Error(t, err)
+
+	status, token, err := provcli.SubmitIdProvRequest(deviceID, kp.ExportPublic(), "", secret, tlsClient)
+	require.NoError(t, err)
+	assert.False(t, status.Pending)
+	require.NotEmpty(t, token)
+	device.SetTokenRefresh(false)
+	err = device.ConnectWithToken(kp, token)
+	require.NoError(t, err)
+	device.Disconnect()
+}
+
+// Nonces are not limited, are bound to the client and can't be altered
+func TestNonces(t *testing.T) {
+	const deviceID = "device4"
+	const secret = "secret4"
+	ts, hostPort, stopFn := startIdProv(t)
+	defer stopFn()
+	admin, err := ts.AddConnectUser("admin1", authapi.ClientRoleAdmin)
+	require.NoError(t, err)
+	defer admin.Disconnect()
+	err = provcli.NewIdProvManageClient(admin).PreApproveDevices([]provapi.PreApprovedClient{{
+		ClientID:   deviceID,
+		ClientType: authapi.ClientTypeDevice,
+		Secret:     secret,
+	}})
+	require.NoError(t, err)
+	tlsClient := tlsclient.NewTLSClient(hostPort, ts.CaCert)
+	tlsClient.ConnectNoAuth()
+	defer tlsClient.Close()
+	kp := clidone.NewHubClient(ts.ServerURL, deviceID, ts.CaCert).CreateKeyPair()
+
+	getNonce := func(clientID string) string {
+		nonceData, err := tlsClient.Get(fmt.Sprintf("%s?%s=%s",
+			provapi.ProvisionNoncePath, provapi.ParamClientID, clientID))
+		require.NoError(t, err)
+		nonceResp := provapi.ProvisionNonceResp{}
+		err = json.Unmarshal(nonceData, &nonceResp)
+		require.NoError(t, err)
+		return nonceResp.Nonce
+	}
+	postRequest := func(nonce string) error {
+		req := provapi.ProvisionRequestArgs{
+			ClientID: deviceID,
+			PubKey:   kp.ExportPublic(),
+			Nonce:    nonce,
+			Proof:    provapi.CreateProof(secret, kp.ExportPublic(), nonce),
+		}
+		reqData, _ := json.Marshal(req)
+		_, err := tlsClient.Post(provapi.ProvisionRequestPath, reqData)
+		return err
+	}
+	// nonces are not stored so there is no limit to the nr of nonces
+	for i := 0; i < 20; i++ {
+		getNonce(deviceID)
+	}
+	// the nonce of another client is refused
+	err = postRequest(getNonce("device5"))
+	assert.Error(t, err)
+	// an altered nonce is refused
+	nonce := getNonce(deviceID)
+	err = postRequest("1" + nonce)
+	assert.Error(t, err)
+
+	err = postRequest(nonce)
+	assert.NoError(t, err)
+}
+
+// Approved certificate requests receive a device certificate that can be renewed
+func TestCertRequest(t *testing.T) {
+	const deviceID = "device6"
+	ts, hostPort, stopFn := startIdProv(t)
+	defer stopFn()
+	stopCerts := startCerts(t, ts)
+	defer stopCerts()
+
+	admin, err := ts.AddConnectUser("admin1", authapi.ClientRoleAdmin)
+	require.NoError(t, err)
+	defer admin.Disconnect()
+	kp := keys.NewEcdsaKey()
+	err = provcli.NewIdProvManageClient(admin).PreApproveDevices([]provapi.PreApprovedClient{{
+		ClientID:   deviceID,
+		ClientType: authapi.ClientTypeDevice,
+		PubKey:     kp.ExportPublic(),
+	}})
+	require.NoError(t, err)
+
+	// the approved device receives a certificate for its public key
+	tlsClient := tlsclient.NewTLSClient(hostPort, ts.CaCert)
+	tlsClient.ConnectNoAuth()
+	resp, err := provcli.SubmitIdProvCertRequest(deviceID, kp.ExportPublic(), "", "", tlsClient)
+	tlsClient.Close()
+	require.NoError(t, err)
+	assert.False(t, resp.Status.Pending)
+	assert.NotEmpty(t, resp.Token)
+	require.NotEmpty(t, resp.CertPEM)
+	assert.NotEmpty(t, resp.CaCertPEM)
+	cert, err := certs.X509CertFromPEM(resp.CertPEM)
+	require.NoError(t, err)
+	assert.Equal(t, deviceID, cert.Subject.CommonName)
+	assert.Contains(t, cert.Subject.OrganizationalUnit, certs.OUIoTDevice)
+	assert.True(t, cert.PublicKey.(*ecdsa.PublicKey).Equal(kp.PublicKey()))
+	expiry := time.Now().Add(provsrv.DefaultIoTCertValidityDays * 24 * time.Hour)
+	assert.WithinDuration(t, expiry, cert.NotAfter, time.Hour)
+	_, err = certs.VerifyCert(resp.CertPEM, ts.CaCert)
+	assert.NoError(t, err)
+}
+
+// Devices renew their certificate using a connection authenticated with their certificate
+func TestRenewDeviceCert(t *testing.T) {
+	const deviceID = "device7"
+	ts, hostPort, stopFn := startIdProv(t)
+	defer stopFn()
+	stopCerts := startCerts(t, ts)
+	defer stopCerts()
+
+	// the device holds a certificate that is about to expire, without being approved
+	kp := keys.NewEcdsaKey()
+	oldCert, err := certs.CreateClientCert(deviceID, certs.OUIoTDevice, 1, kp, ts.CaCert, ts.CaKey)
+	require.NoError(t, err)
+	tlsClient := tlsclient.NewTLSClient(hostPort, ts.CaCert)
+	err = tlsClient.ConnectWithClientCert(certs.X509CertToTLS(oldCert, kp))
+	require.NoError(t, err)
+	resp, err := provcli.SubmitIdProvCertRequest(deviceID, kp.ExportPublic(), "", "", tlsClient)
+	require.NoError(t, err)
+	assert.False(t, resp.Status.Pending)
+	require.NotEmpty(t, resp.CertPEM)
+	newCert, err := certs.X509CertFromPEM(resp.CertPEM)
+	require.NoError(t, err)
+	assert.True(t, newCert.NotAfter.After(oldCert.NotAfter))
+
+	// the certificate can't be used to obtain a certificate for another key or device
+	kp2 := keys.NewEcdsaKey()
+	resp, err = provcli.SubmitIdProvCertRequest(deviceID, kp2.ExportPublic(), "", "", tlsClient)
+	require.NoError(t, err)
+	assert.True(t, resp.Status.Pending)
+	assert.Empty(t, resp.CertPEM)
+	resp, err = provcli.SubmitIdProvCertRequest("device8", kp.ExportPublic(), "", "", tlsClient)
+	require.NoError(t, err)
+	assert.True(t, resp.Status.Pending)
+	assert.Empty(t, resp.CertPEM)
+	tlsClient.Close()
+}
+
+// Rejected devices can't renew their certificate, also after a restart of the service
+func TestRejectAfterRestart(t *testing.T) {
+	const deviceID = "device9"
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+	stopCerts := startCerts(t, ts)
+	defer stopCerts()
+	port, err := testenv.GetFreePort()
+	require.NoError(t, err)
+	hostPort := fmt.Sprintf("%s:%d", testenv.TestServerHost, port)
+	storeDir := path.Join(ts.TestDir, provapi.ServiceName)
+	stopProv, err := ts.StartService(provapi.ServiceName,
+		provsrv.NewIdProvService(storeDir, uint(port), ts.ServerTLS, ts.CaCert))
+	require.NoError(t, err)
+
+	admin, err := ts.AddConnectUser("admin1", authapi.ClientRoleAdmin)
+	require.NoError(t, err)
+	defer admin.Disconnect()
+	kp := keys.NewEcdsaKey()
+	mngCl := provcli.NewIdProvManageClient(admin)
+	err = mngCl.PreApproveDevices([]provapi.PreApprovedClient{{
+		ClientID:   deviceID,
+		ClientType: authapi.ClientTypeDevice,
+		PubKey:     kp.ExportPublic(),
+	}})
+	require.NoError(t, err)
+	err = mngCl.RejectRequest(deviceID)
+	require.NoError(t, err)
+	stopProv()
+
+	// the restarted service still knows the device is rejected
+	stopProv, err = ts.StartService(provapi.ServiceName,
+		provsrv.NewIdProvService(storeDir, uint(port), ts.ServerTLS, ts.CaCert))
+	require.NoError(t, err)
+	defer stopProv()
+	rejected, err := mngCl.GetRequests(false, false, true)
+	require.NoError(t, err)
+	require.Len(t, rejected, 1)
+	assert.Equal(t, deviceID, rejected[0].ClientID)
+
+	cert, err := certs.CreateClientCert(deviceID, certs.OUIoTDevice, 1, kp, ts.CaCert, ts.CaKey)
+	require.NoError(t, err)
+	tlsClient := tlsclient.NewTLSClient(hostPort, ts.CaCert)
+	err = tlsClient.ConnectWithClientCert(certs.X509CertToTLS(cert, kp))
+	require.NoError(t, err)
+	defer tlsClient.Close()
+	_, err = provcli.SubmitIdProvCertRequest(deviceID, kp.ExportPublic(), "", "", tlsClient)
+	assert.Error(t, err)
+}
@@ -1,27 +1,58 @@
 package provsrv
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	clidone "github.com/hiveot/hub/done_cli/cli_done"
 	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
 	authcli "github.com/hiveot/hub/done_mod/mod_auth/auth_cli"
+	certcli "github.com/hiveot/hub/done_mod/mod_cert/cert_cli"
 	provapi "github.com/hiveot/hub/done_mod/mod_prov/prov_api"
+	"github.com/hiveot/hub/done_tool/buckets"
+	"github.com/hiveot/hub/done_tool/ser"
 )
 
+// provRecord is the approval state of a client as saved in the store
+type provRecord struct {
+	Status provapi.ProvisionStatus `json:"status"`
+	// Secret is the out-of-band secret of a client pre-approved with a secret
+	Secret string `json:"secret,omitempty"`
+}
+
 type ManageIdProvService struct {
 
 	// request status by deviceID
 	// [deviceID] pub-key simple in-memory store
 	requests map[string]provapi.ProvisionStatus
+	// out-of-band secrets of pre-approved clients by clientID
+	secrets map[string]string
+	// store of the approved and rejected requests, so approvals and rejections survive
+	// a restart. Pending requests are not saved as anyone can submit a request.
+	bucket buckets.IBucket
+	// key used to sign the nonces issued for proving the secret.
+	// Nonces are not stored, so anonymous nonce requests don't use memory.
+	nonceKey []byte
+	// expiry of the nonces that were used with a valid proof, to refuse replays
+	usedNonces map[string]int64
 
 	//
 	hc *clidone.HubClient
 	// client of auth service used to create tokens
 	authSvc *authcli.ManageClients
+	// client of certs service used to create device certificates
+	certsSvc *certcli.CertsClient
+	// validity of issued device certificates
+	certValidityDays int
 	// mutex to guard access to maps
 	mux sync.RWMutex
 }
@@ -46,10 +77,26 @@ func (svc *ManageIdProvService) ApproveRequest(ctx clidone.ServiceContext,
 	status.ApprovedMSE = time.Now().UnixMilli()
 	status.RejectedMSE = 0
 	svc.requests[args.ClientID] = status
-	return nil
+	return svc.saveStatus(status)
 }
 
-// GetRequests returns list of requests since last start
+// CreateNonce issues a nonce for a client to prove its out-of-band secret.
+// The nonce holds the issue time and a random part, signed with the service's nonce
+// key for the client. It is not stored, so anyone can request nonces without
+// exhausting the service. A nonce can be used once with a valid proof.
+func (svc *ManageIdProvService) CreateNonce(clientID string) (string, error) {
+	randBytes := make([]byte, 16)
+	_, err := rand.Read(randBytes)
+	if err != nil {
+		return "", err
+	}
+	issued := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	random := base64.RawURLEncoding.EncodeToString(randBytes)
+	nonce := issued + "." + random + "." + svc.signNonce(clientID, issued, random)
+	return nonce, nil
+}
+
+// GetRequests returns the list of saved requests and the pending requests since last start
 // If args.OnlyPending is set then only return pending requests
 // Note that rejected requests are never returned
 func (svc *ManageIdProvService) GetRequests(ctx clidone.ServiceContext,
@@ -83,7 +130,12 @@ func (svc *ManageIdProvService) PreApproveClients(ctx clidone.ServiceContext,
 		if approval.ClientID == "" {
 			slog.Warn("PreApproval of client without clientID", "clientID", ctx.SenderID)
 		} else {
-			svc.requests[approval.ClientID] = provapi.ProvisionStatus{
+			if approval.Secret != "" {
+				svc.secrets[approval.ClientID] = approval.Secret
+			} else {
+				delete(svc.secrets, approval.ClientID)
+			}
+			status := provapi.ProvisionStatus{
 				ClientID:    approval.ClientID,
 				ClientType:  approval.ClientType,
 				PubKey:      approval.PubKey,
@@ -91,11 +143,65 @@ func (svc *ManageIdProvService) PreApproveClients(ctx clidone.ServiceContext,
 				Pending:     false,
 				ApprovedMSE: time.Now().UnixMilli(),
 			}
+			svc.requests[approval.ClientID] = status
+			if err := svc.saveStatus(status); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
+// loadRecords loads the approved and rejected requests from the store
+func (svc *ManageIdProvService) loadRecords() {
+	// the cursor fails if the bucket doesn't yet exist
+	cursor, err := svc.bucket.Cursor(context.Background())
+	if err != nil {
+		return
+	}
+	defer cursor.Release()
+	for key, val, valid := cursor.First(); valid; key, val, valid = cursor.Next() {
+		rec := provRecord{}
+		err = ser.Unmarshal(val, &rec)
+		if err != nil {
+			slog.Error("loadRecords; invalid record",
+				slog.String("clientID", key), slog.String("err", err.Error()))
+			continue
+		}
+		svc.requests[key] = rec.Status
+		if rec.Secret != "" {
+			svc.secrets[key] = rec.Secret
+		}
+	}
+}
+
+// saveStatus saves the status of an approved or rejected request together with
+// the client's secret. Pending requests are not saved.
+// This must be called with the lock held.
+func (svc *ManageIdProvService) saveStatus(status provapi.ProvisionStatus) error {
+	if status.ApprovedMSE == 0 && status.RejectedMSE == 0 {
+		return nil
+	}
+	rec := provRecord{Status: status, Secret: svc.secrets[status.ClientID]}
+	data, _ := ser.Marshal(rec)
+	err := svc.bucket.Set(status.ClientID, data)
+	if err != nil {
+		err = fmt.Errorf("failed saving the provisioning status of '%s': %w", status.ClientID, err)
+		slog.Error(err.Error())
+	}
+	return err
+}
+
+// removeUsedNonces removes the used nonces that expired before the given time.
+// This must be called with the lock held.
+func (svc *ManageIdProvService) removeUsedNonces(nowMSE int64) {
+	for nonce, expiryMSE := range svc.usedNonces {
+		if expiryMSE < nowMSE {
+			delete(svc.usedNonces, nonce)
+		}
+	}
+}
+
 // RejectRequest rejects a provisioning request
 func (svc *ManageIdProvService) RejectRequest(ctx clidone.ServiceContext,
 	args *provapi.RejectRequestArgs) error {
@@ -112,7 +218,47 @@ func (svc *ManageIdProvService) RejectRequest(ctx clidone.ServiceContext,
 	status.Pending = false
 	status.RejectedMSE = time.Now().UnixMilli()
 	svc.requests[args.ClientID] = status
-	return nil
+	// the secret no longer approves the client
+	delete(svc.secrets, args.ClientID)
+	return svc.saveStatus(status)
+}
+
+// RenewDeviceCert issues a new certificate to a device that authenticated with its current
+// certificate. The new certificate is for the same public key, so the caller must verify
+// that pubKeyPEM is the public key of the current certificate.
+// This allows devices to renew their certificate without a new approval.
+func (svc *ManageIdProvService) RenewDeviceCert(
+	clientID string, pubKeyPEM string) (resp *provapi.ProvisionRequestResp, err error) {
+
+	slog.Info("RenewDeviceCert", slog.String("deviceID", clientID))
+	svc.mux.RLock()
+	status, found := svc.requests[clientID]
+	svc.mux.RUnlock()
+	if found && status.RejectedMSE != 0 {
+		err = fmt.Errorf("renewal of the certificate of '%s' denied as it was rejected", clientID)
+		slog.Warn(err.Error())
+		return nil, err
+	}
+	certPEM, caCertPEM, err := svc.certsSvc.CreateDeviceCert(
+		clientID, pubKeyPEM, svc.certValidityDays)
+	if err != nil {
+		err = fmt.Errorf("renewal of the certificate of '%s' failed: %w", clientID, err)
+		slog.Warn(err.Error())
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	resp = &provapi.ProvisionRequestResp{
+		Status: provapi.ProvisionStatus{
+			ClientID:    clientID,
+			ClientType:  authapi.ClientTypeDevice,
+			PubKey:      pubKeyPEM,
+			ReceivedMSE: now,
+			ApprovedMSE: now,
+		},
+		CertPEM:   certPEM,
+		CaCertPEM: caCertPEM,
+	}
+	return resp, nil
 }
 
 // SubmitRequest creates a provisioning request for a device
@@ -120,11 +266,17 @@ func (svc *ManageIdProvService) RejectRequest(ctx clidone.ServiceContext,
 // If the request is pre-approved a token will be returned if the pubKey and/or
 // MAC matches.
 // If the pre-approval does not include a public key then only match required is the MAC.
+// If the pre-approval includes an out-of-band secret then the request must include a valid
+// proof of the secret. The public key of the request is used in that case.
+//
+// Approved devices that request a certificate also receive a device certificate for
+// their public key, signed by the Hub CA.
 func (svc *ManageIdProvService) SubmitRequest(ctx clidone.ServiceContext,
 	args *provapi.ProvisionRequestArgs) (resp *provapi.ProvisionRequestResp, err error) {
 	svc.mux.Lock()
 	defer svc.mux.Unlock()
 	var token string
+	var certPEM, caCertPEM string
 
 	slog.Info("SubmitRequest",
 		slog.String("senderID", ctx.SenderID),
@@ -143,16 +295,20 @@ func (svc *ManageIdProvService) SubmitRequest(ctx clidone.ServiceContext,
 	} else if status.ApprovedMSE != 0 {
 		// (pre)approved request, add the user and issue a token
 		status.ReceivedMSE = time.Now().UnixMilli()
+		secret, hasSecret := svc.secrets[args.ClientID]
 		// public key or mac must match if provided
-		if status.PubKey != "" && status.PubKey != args.PubKey {
+		if args.PubKey == "" {
 			err = fmt.Errorf(
-				"approval for '%s' denied as public key doesn't match", args.ClientID)
+				"approval for '%s' denied as no public key was provided", args.ClientID)
 		} else if status.MAC != "" && status.MAC != args.MAC {
 			err = fmt.Errorf(
 				"approval for '%s' denied as mac address doesn't match", args.ClientID)
-		} else if args.PubKey == "" {
+		} else if hasSecret {
+			// the secret proves the client owns the public key of the request
+			err = svc.verifyProof(secret, args)
+		} else if status.PubKey != "" && status.PubKey != args.PubKey {
 			err = fmt.Errorf(
-				"approval for '%s' denied as no public key was provided", args.ClientID)
+				"approval for '%s' denied as public key doesn't match", args.ClientID)
 		} else {
 			err = nil
 		}
@@ -162,6 +318,21 @@ func (svc *ManageIdProvService) SubmitRequest(ctx clidone.ServiceContext,
 		}
 
 		status.Pending = false
+		status.PubKey = args.PubKey
+		if args.CertRequest {
+			// create the certificate first so a failure doesn't leave a client without one
+			if status.ClientType == authapi.ClientTypeService {
+				err = fmt.Errorf("certificates are only issued to devices")
+			} else {
+				certPEM, caCertPEM, err = svc.certsSvc.CreateDeviceCert(
+					status.ClientID, status.PubKey, svc.certValidityDays)
+			}
+			if err != nil {
+				err = fmt.Errorf("approval for '%s' failed creating a certificate: %w", args.ClientID, err)
+				slog.Warn(err.Error())
+				return nil, err
+			}
+		}
 		if status.ClientType == authapi.ClientTypeService {
 			token, err = svc.authSvc.AddService(status.ClientID, "service", status.PubKey)
 		} else {
@@ -188,25 +359,135 @@ func (svc *ManageIdProvService) SubmitRequest(ctx clidone.ServiceContext,
 		}
 	}
 	svc.requests[args.ClientID] = status
+	err = svc.saveStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		// let administrators know there is a new request waiting for approval.
+		// this makes requests to the auth service so don't hold up the caller.
+		go svc.notifyAdmins(status)
+	}
 	resp = &provapi.ProvisionRequestResp{
-		Status: status,
-		Token:  token,
+		Status:    status,
+		Token:     token,
+		CertPEM:   certPEM,
+		CaCertPEM: caCertPEM,
 	}
 	return resp, nil
 }
+
+// notifyAdmins sends a RequestPendingEvent notification to the inbox of each administrator.
+// The request holds the client's public key and MAC so it is not published as an event.
+func (svc *ManageIdProvService) notifyAdmins(status provapi.ProvisionStatus) {
+	profiles, err := svc.authSvc.GetProfiles()
+	if err != nil {
+		slog.Warn("notifyAdmins: failed reading client profiles",
+			slog.String("clientID", status.ClientID), slog.String("err", err.Error()))
+		return
+	}
+	payload, _ := ser.Marshal(&status)
+	for _, profile := range profiles {
+		if profile.Role != authapi.ClientRoleAdmin {
+			continue
+		}
+		err = svc.hc.PubNotification(profile.ClientID,
+			provapi.ManageProvisioningCap, provapi.RequestPendingEvent, payload)
+		if err != nil {
+			slog.Warn("notifyAdmins: failed sending pending request notification",
+				slog.String("adminID", profile.ClientID), slog.String("err", err.Error()))
+		}
+	}
+}
+
+// signNonce returns the signature of the parts of a nonce issued to a client
+func (svc *ManageIdProvService) signNonce(clientID string, issued string, random string) string {
+	mac := hmac.New(sha256.New, svc.nonceKey)
+	mac.Write([]byte(clientID + "." + issued + "." + random))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyNonce verifies that the nonce was issued to the client and has not expired.
+// This returns the expiry time of the nonce.
+func (svc *ManageIdProvService) verifyNonce(clientID string, nonce string, nowMSE int64) (int64, error) {
+	parts := strings.Split(nonce, ".")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("malformed nonce")
+	}
+	signature := svc.signNonce(clientID, parts[0], parts[1])
+	if !hmac.Equal([]byte(signature), []byte(parts[2])) {
+		return 0, fmt.Errorf("nonce not issued to this client")
+	}
+	issuedMSE, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed nonce")
+	}
+	expiryMSE := issuedMSE + provapi.NonceValiditySec*1000
+	if expiryMSE < nowMSE {
+		return 0, fmt.Errorf("nonce expired")
+	}
+	return expiryMSE, nil
+}
+
+// verifyProof verifies that the request holds the out-of-band secret of the client.
+// The nonce of the request is only recorded as used if the proof is valid, so a forged
+// request can't invalidate the nonce of the client.
+// This must be called with the lock held.
+func (svc *ManageIdProvService) verifyProof(secret string, args *provapi.ProvisionRequestArgs) error {
+	now := time.Now().UnixMilli()
+	svc.removeUsedNonces(now)
+	if args.Proof == "" {
+		return fmt.Errorf(
+			"approval for '%s' denied as no proof of its secret was provided", args.ClientID)
+	}
+	expiryMSE, err := svc.verifyNonce(args.ClientID, args.Nonce, now)
+	if err != nil {
+		return fmt.Errorf(
+			"approval for '%s' denied as the nonce is invalid: %w", args.ClientID, err)
+	} else if _, used := svc.usedNonces[args.Nonce]; used {
+		return fmt.Errorf(
+			"approval for '%s' denied as the nonce was already used", args.ClientID)
+	}
+	expected := provapi.CreateProof(secret, args.PubKey, args.Nonce)
+	if !hmac.Equal([]byte(expected), []byte(args.Proof)) {
+		return fmt.Errorf(
+			"approval for '%s' denied as the proof doesn't match its secret", args.ClientID)
+	}
+	svc.usedNonces[args.Nonce] = expiryMSE
+	return nil
+}
+
 func (svc *ManageIdProvService) Stop() {
+	_ = svc.bucket.Close()
 }
 
-func StartManageIdProvService(hc *clidone.HubClient) *ManageIdProvService {
+// StartManageIdProvService starts the service that manages provisioning requests.
+//
+//	bucket holds the approved and rejected requests
+//	certValidityDays is the validity of the issued device certificates
+func StartManageIdProvService(
+	hc *clidone.HubClient, bucket buckets.IBucket, certValidityDays int) *ManageIdProvService {
 
+	// nonces issued before a restart are no longer valid
+	nonceKey := make([]byte, 32)
+	_, _ = rand.Read(nonceKey)
 	svc := &ManageIdProvService{
 		// map of requests by SenderID
-		requests: make(map[string]provapi.ProvisionStatus),
-		hc:       hc,
+		requests:   make(map[string]provapi.ProvisionStatus),
+		secrets:    make(map[string]string),
+		nonceKey:   nonceKey,
+		usedNonces: make(map[string]int64),
+		bucket:     bucket,
+		hc:         hc,
+		// issued device certificates
+		certValidityDays: certValidityDays,
 	}
 
+	svc.loadRecords()
 	// the auth service is used to create credentials
 	svc.authSvc = authcli.NewManageClients(svc.hc)
+	// the certs service is used to create device certificates
+	svc.certsSvc = certcli.NewCertsClient(svc.hc)
 
 	svc.hc.SetRPCCapability(provapi.ManageProvisioningCap,
 		map[string]interface{}{
@@ -7,6 +7,7 @@ import (
 	runcfg "github.com/hiveot/hub/done_mod/mod_run/run_cfg"
 	runsrv "github.com/hiveot/hub/done_mod/mod_run/run_srv"
 	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/metrics"
 	"github.com/hiveot/hub/done_tool/plugin"
 )
 
@@ -36,6 +37,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	// serve the resource usage of the plugins
+	if env.MetricsAddr != "" {
+		metrics.DefaultRegistry.Register(svc)
+		_, err = metrics.StartMetricsServer(env.MetricsAddr, metrics.DefaultRegistry)
+		if err != nil {
+			slog.Error("Failed starting metrics server: ", "err", err)
+		}
+	}
+
 	// wait for a stop signal
 	runsrv.WaitForSignal()
 	err = svc.Stop()
@@ -0,0 +1,51 @@
+package runsrv
+
+import (
+	"sort"
+
+	"github.com/hiveot/hub/done_tool/metrics"
+	"github.com/struCoder/pidusage"
+)
+
+// Collect writes the CPU and memory usage of the running plugins.
+// This implements the metrics.Collector interface.
+func (svc *LauncherService) Collect(mw *metrics.MetricWriter) {
+	// reading the process stats is slow, so don't hold the lock
+	pids := make(map[string]int)
+	svc.mux.Lock()
+	for name, pluginInfo := range svc.plugins {
+		if pluginInfo.Running && pluginInfo.PID != 0 {
+			pids[name] = pluginInfo.PID
+		}
+	}
+	svc.mux.Unlock()
+	names := make([]string, 0, len(pids))
+	for name := range pids {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stats := make(map[string]*pidusage.SysInfo, len(pids))
+	for _, name := range names {
+		pidStats, err := pidusage.GetStat(pids[name])
+		if err == nil && pidStats != nil {
+			stats[name] = pidStats
+		}
+	}
+	mw.WriteFamily("hiveot_plugin_cpu_percent", metrics.TypeGauge,
+		"CPU usage of the plugin process")
+	for _, name := range names {
+		if pidStats, found := stats[name]; found {
+			mw.WriteSample("hiveot_plugin_cpu_percent", pidStats.CPU,
+				metrics.Label{Name: "plugin", Value: name})
+		}
+	}
+	mw.WriteFamily("hiveot_plugin_rss_bytes", metrics.TypeGauge,
+		"Resident memory of the plugin process")
+	for _, name := range names {
+		if pidStats, found := stats[name]; found {
+			mw.WriteSample("hiveot_plugin_rss_bytes", pidStats.Memory,
+				metrics.Label{Name: "plugin", Value: name})
+		}
+	}
+}
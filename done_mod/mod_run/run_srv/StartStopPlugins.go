@@ -288,8 +288,12 @@ func (svc *LauncherService) StopPlugin(
 	return resp, err
 }
 
-// updateStatus updates the service  status
+// updateStatus updates the service uptime and resource usage
 func (svc *LauncherService) updateStatus(svcInfo *runapi.PluginInfo) {
+	svcInfo.Uptime = 0
+	if svcInfo.Running && svcInfo.StartTimeMSE != 0 {
+		svcInfo.Uptime = int(time.Since(time.UnixMilli(svcInfo.StartTimeMSE)).Seconds())
+	}
 	if svcInfo.PID != 0 {
 
 		//Option A: use pidusage - doesn't work on Windows though
@@ -0,0 +1,136 @@
+package simcfg
+
+import (
+	"fmt"
+	"slices"
+)
+
+// DefaultIntervalSec is the default interval between sensor updates
+const DefaultIntervalSec = 10
+
+// Kinds of simulated Things
+const (
+	KindDimmer     = "dimmer"
+	KindMeter      = "meter"
+	KindSwitch     = "switch"
+	KindThermostat = "thermostat"
+)
+
+// Sensors of the kinds of simulated Things. The sensor name is also its event name.
+const (
+	SensorHumidity    = "humidity"
+	SensorPower       = "power"
+	SensorTemperature = "temperature"
+)
+
+// KindSensors holds the names of the sensors of each kind of Thing
+var KindSensors = map[string][]string{
+	KindMeter:      {SensorPower},
+	KindThermostat: {SensorTemperature, SensorHumidity},
+}
+
+// Waveforms of simulated sensor values
+const (
+	// WaveConstant stays at the midpoint of min and max
+	WaveConstant = "constant"
+	// WaveSawtooth rises from min to max and drops back each period
+	WaveSawtooth = "sawtooth"
+	// WaveSine follows a sine between min and max. The period is aligned to the clock
+	// so a period of 86400 gives a daily cycle with the minimum at midnight UTC.
+	WaveSine = "sine"
+	// WaveSquare alternates between min and max each half period
+	WaveSquare = "square"
+	// WaveTriangle rises from min to max and back each period
+	WaveTriangle = "triangle"
+	// WaveWalk is a random walk between min and max, with noise as the step size
+	WaveWalk = "walk"
+)
+
+// SensorConfig describes the waveform of a simulated sensor
+type SensorConfig struct {
+	// Waveform of the value. Default is sine.
+	Waveform string `yaml:"waveform,omitempty"`
+	// Min and Max are the range of the waveform, excluding noise
+	Min float64 `yaml:"min"`
+	Max float64 `yaml:"max"`
+	// PeriodSec is the duration of a single cycle of the waveform
+	PeriodSec int `yaml:"periodSec,omitempty"`
+	// Noise is the standard deviation of the random noise added to each value
+	Noise float64 `yaml:"noise,omitempty"`
+}
+
+// DisconnectConfig describes the simulated disconnects of a Thing.
+// A disconnected Thing stops sending events and rejects action and config requests.
+type DisconnectConfig struct {
+	// IntervalSec is the average time between disconnects. 0 to never disconnect.
+	IntervalSec int `yaml:"intervalSec,omitempty"`
+	// DurationSec is the time a Thing stays disconnected
+	DurationSec int `yaml:"durationSec,omitempty"`
+}
+
+// SimThingConfig describes a simulated Thing in the catalogue
+type SimThingConfig struct {
+	// ID of the Thing
+	ID string `yaml:"id"`
+	// Title of the Thing. Default is the ID.
+	Title string `yaml:"title,omitempty"`
+	// Kind of Thing: thermostat, switch, dimmer or meter
+	Kind string `yaml:"kind"`
+	// Sensors replaces the default waveform of sensors by event name.
+	// Thermostats have temperature and humidity sensors. Meters have a power sensor.
+	Sensors map[string]SensorConfig `yaml:"sensors,omitempty"`
+	// Disconnect optionally simulates disconnects of the Thing
+	Disconnect DisconnectConfig `yaml:"disconnect,omitempty"`
+}
+
+// SimConfig holds the catalogue of simulated Things
+type SimConfig struct {
+	// IntervalSec is the interval between sensor updates
+	IntervalSec int `yaml:"intervalSec"`
+	// Things to simulate
+	Things []SimThingConfig `yaml:"things"`
+}
+
+// Validate the catalogue
+func (cfg *SimConfig) Validate() error {
+	if cfg.IntervalSec <= 0 {
+		return fmt.Errorf("intervalSec must be positive")
+	}
+	ids := make(map[string]bool)
+	for _, tc := range cfg.Things {
+		if tc.ID == "" {
+			return fmt.Errorf("thing without ID")
+		} else if ids[tc.ID] {
+			return fmt.Errorf("duplicate thing ID '%s'", tc.ID)
+		}
+		ids[tc.ID] = true
+		switch tc.Kind {
+		case KindDimmer, KindMeter, KindSwitch, KindThermostat:
+		default:
+			return fmt.Errorf("thing '%s' has unknown kind '%s'", tc.ID, tc.Kind)
+		}
+		for name, sc := range tc.Sensors {
+			if !slices.Contains(KindSensors[tc.Kind], name) {
+				return fmt.Errorf("thing '%s' of kind '%s' has no sensor '%s'", tc.ID, tc.Kind, name)
+			} else if sc.Min > sc.Max {
+				return fmt.Errorf("sensor '%s' of thing '%s' has a min above its max", name, tc.ID)
+			}
+			switch sc.Waveform {
+			case "", WaveConstant, WaveSawtooth, WaveSine, WaveSquare, WaveTriangle, WaveWalk:
+			default:
+				return fmt.Errorf("sensor '%s' of thing '%s' has unknown waveform '%s'",
+					name, tc.ID, sc.Waveform)
+			}
+		}
+	}
+	return nil
+}
+
+// NewSimConfig returns a new simulator configuration with defaults and no Things
+func NewSimConfig() SimConfig {
+	cfg := SimConfig{
+		IntervalSec: DefaultIntervalSec,
+		Things:      make([]SimThingConfig, 0),
+	}
+	return cfg
+}
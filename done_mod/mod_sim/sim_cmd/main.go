@@ -0,0 +1,28 @@
+// Package main with the device simulator
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	simcfg "github.com/hiveot/hub/done_mod/mod_sim/sim_cfg"
+	simsrv "github.com/hiveot/hub/done_mod/mod_sim/sim_srv"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/plugin"
+)
+
+// Start the simulator with the catalogue of simulated Things from the configuration
+func main() {
+	env := plugin.GetAppEnvironment("", true)
+	logging.SetLogging(env.LogLevel, "")
+	slog.Warn("Starting device simulator", "clientID", env.ClientID, "loglevel", env.LogLevel)
+
+	cfg := simcfg.NewSimConfig()
+	err := env.LoadConfig(&cfg)
+	if err != nil {
+		slog.Error("sim: Failed loading the catalogue", "err", err)
+		os.Exit(1)
+	}
+	svc := simsrv.NewSimService(cfg)
+	plugin.StartPlugin(svc, &env)
+}
@@ -0,0 +1,181 @@
+package simsrv
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	simcfg "github.com/hiveot/hub/done_mod/mod_sim/sim_cfg"
+	"github.com/hiveot/hub/done_tool/things"
+)
+
+// SimService simulates devices for developing dashboards and testing without hardware.
+//
+// The simulated Things are read from a catalogue. Their TDs are published on start and
+// their sensor events are published periodically. Action and config requests change
+// the state of the Things, which is published as events and properties.
+type SimService struct {
+	cfg simcfg.SimConfig
+	hc  *clidone.HubClient
+	// simulated Things by thingID
+	things map[string]*SimThing
+	// source of noise and disconnects. Only used by the update loop.
+	rnd      *rand.Rand
+	stopChan chan bool
+	// the update loop is done when it no longer uses the hub connection
+	updateWG sync.WaitGroup
+}
+
+// GetThing returns the simulated Thing with the given ID or nil if it doesn't exist
+func (svc *SimService) GetThing(thingID string) *SimThing {
+	return svc.things[thingID]
+}
+
+// onAction changes the state of a simulated Thing and publishes the changed events
+func (svc *SimService) onAction(msg *things.ThingValue) (reply []byte, err error) {
+	st := svc.things[msg.ThingID]
+	if st == nil {
+		err = fmt.Errorf("unknown thing '%s'", msg.ThingID)
+	} else {
+		var events map[string]string
+		reply, events, err = st.HandleAction(msg.Name, msg.Data)
+		if err == nil {
+			err = svc.hc.PubEvents(msg.ThingID, events)
+		}
+	}
+	if err != nil {
+		slog.Warn("onAction failed",
+			slog.String("senderID", msg.SenderID),
+			slog.String("thingID", msg.ThingID),
+			slog.String("name", msg.Name),
+			slog.String("err", err.Error()))
+		return nil, err
+	}
+	slog.Info("onAction",
+		slog.String("senderID", msg.SenderID),
+		slog.String("thingID", msg.ThingID),
+		slog.String("name", msg.Name),
+		slog.String("reply", string(reply)))
+	return reply, nil
+}
+
+// onConfig changes the configuration of a simulated Thing and publishes its properties
+func (svc *SimService) onConfig(msg *things.ThingValue) error {
+	st := svc.things[msg.ThingID]
+	var err error
+	if st == nil {
+		err = fmt.Errorf("unknown thing '%s'", msg.ThingID)
+	} else {
+		var props map[string]string
+		props, err = st.HandleConfig(msg.Name, msg.Data)
+		if err == nil {
+			err = svc.hc.PubProps(msg.ThingID, props)
+		}
+		// the title is part of the TD
+		if err == nil && msg.Name == PropTitle {
+			err = svc.hc.PubTD(st.CreateTD())
+		}
+	}
+	if err != nil {
+		slog.Warn("onConfig failed",
+			slog.String("senderID", msg.SenderID),
+			slog.String("thingID", msg.ThingID),
+			slog.String("name", msg.Name),
+			slog.String("err", err.Error()))
+		return err
+	}
+	slog.Info("onConfig",
+		slog.String("senderID", msg.SenderID),
+		slog.String("thingID", msg.ThingID),
+		slog.String("name", msg.Name))
+	return nil
+}
+
+// update the simulated Things and publish their sensor events and connection changes
+func (svc *SimService) update(now time.Time) {
+	for thingID, st := range svc.things {
+		events, connChanged := st.Update(now, svc.rnd)
+		var err error
+		if connChanged {
+			slog.Info("simulated connection change", "thingID", thingID,
+				"connection", st.Props()[PropConnection])
+			err = svc.hc.PubProps(thingID, st.Props())
+		}
+		if err == nil {
+			err = svc.hc.PubEvents(thingID, events)
+		}
+		if err != nil {
+			slog.Warn("failed publishing simulated values",
+				slog.String("thingID", thingID), slog.String("err", err.Error()))
+		}
+	}
+}
+
+// Start the simulation.
+// This publishes the TD, properties and events of each Thing, handles action and config
+// requests, and starts the periodic sensor updates.
+func (svc *SimService) Start(hc *clidone.HubClient) (err error) {
+	slog.Warn("Starting SimService", "clientID", hc.ClientID(), "nrThings", len(svc.cfg.Things))
+	err = svc.cfg.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid simulator catalogue: %w", err)
+	}
+	svc.hc = hc
+	now := time.Now()
+	for _, thingCfg := range svc.cfg.Things {
+		st := NewSimThing(thingCfg, now)
+		svc.things[thingCfg.ID] = st
+		err = svc.hc.PubTD(st.CreateTD())
+		if err == nil {
+			err = svc.hc.PubProps(thingCfg.ID, st.Props())
+		}
+		if err != nil {
+			return fmt.Errorf("failed publishing thing '%s': %w", thingCfg.ID, err)
+		}
+	}
+	svc.update(now)
+	svc.hc.SetActionHandler(svc.onAction)
+	svc.hc.SetConfigHandler(svc.onConfig)
+
+	stopChan := make(chan bool)
+	svc.stopChan = stopChan
+	svc.updateWG.Add(1)
+	go func() {
+		defer svc.updateWG.Done()
+		ticker := time.NewTicker(time.Duration(svc.cfg.IntervalSec) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				svc.update(now)
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop the simulation.
+// This waits until the update loop has ended, so the hub connection can be closed.
+func (svc *SimService) Stop() {
+	slog.Warn("Stopping SimService")
+	if svc.stopChan != nil {
+		close(svc.stopChan)
+		svc.stopChan = nil
+	}
+	svc.updateWG.Wait()
+}
+
+// NewSimService creates a simulator of the Things in the catalogue
+func NewSimService(cfg simcfg.SimConfig) *SimService {
+	svc := &SimService{
+		cfg:    cfg,
+		things: make(map[string]*SimThing),
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	return svc
+}
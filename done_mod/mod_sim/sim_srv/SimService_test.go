@@ -0,0 +1,169 @@
+package simsrv_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	simcfg "github.com/hiveot/hub/done_mod/mod_sim/sim_cfg"
+	simsrv "github.com/hiveot/hub/done_mod/mod_sim/sim_srv"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/ser"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/hiveot/hub/done_tool/things"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const simID = "sim"
+
+// Actions and config requests change the state of the simulated things
+func TestActionConfig(t *testing.T) {
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+
+	cfg := simcfg.NewSimConfig()
+	cfg.Things = []simcfg.SimThingConfig{
+		{ID: "switch1", Kind: simcfg.KindSwitch},
+		{ID: "dimmer1", Kind: simcfg.KindDimmer},
+		{ID: "thermostat1", Kind: simcfg.KindThermostat},
+	}
+	hc, err := ts.AddConnectDevice(simID)
+	require.NoError(t, err)
+	defer hc.Disconnect()
+	svc := simsrv.NewSimService(cfg)
+	err = svc.Start(hc)
+	require.NoError(t, err)
+	defer svc.Stop()
+
+	// managers can publish actions and configuration
+	user, err := ts.AddConnectUser("user1", authapi.ClientRoleManager)
+	require.NoError(t, err)
+	defer user.Disconnect()
+
+	reply, err := user.PubAction(simID, "switch1", simsrv.ActionSwitch, []byte("true"))
+	require.NoError(t, err)
+	assert.Equal(t, "true", string(reply))
+	assert.Equal(t, "true", svc.GetThing("switch1").Events()[simsrv.EventSwitch])
+
+	reply, err = user.PubAction(simID, "dimmer1", simsrv.ActionDimmer, []byte("150"))
+	require.NoError(t, err)
+	assert.Equal(t, "100", string(reply))
+
+	err = user.PubConfig(simID, "thermostat1", simsrv.PropSetpoint, []byte("22.5"))
+	require.NoError(t, err)
+	assert.Equal(t, "22.5", svc.GetThing("thermostat1").Props()[simsrv.PropSetpoint])
+
+	_, err = user.PubAction(simID, "switch1", simsrv.ActionDimmer, []byte("50"))
+	assert.Error(t, err)
+}
+
+// The TDs, properties and sensor events are published on start
+func TestPublishOnStart(t *testing.T) {
+	logging.SetLogging("warning", "")
+	ts, err := testenv.StartTestServer(t.TempDir())
+	require.NoError(t, err)
+	defer ts.Stop()
+
+	user, err := ts.AddConnectUser("user1", authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	defer user.Disconnect()
+	rxChan := make(chan *things.ThingValue, 20)
+	user.SetEventHandler(func(msg *things.ThingValue) {
+		rxChan <- msg
+	})
+	err = user.SubEvents(simID, "", "")
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+
+	cfg := simcfg.NewSimConfig()
+	cfg.Things = []simcfg.SimThingConfig{
+		{ID: "switch1", Kind: simcfg.KindSwitch},
+		{ID: "meter1", Kind: simcfg.KindMeter},
+	}
+	hc, err := ts.AddConnectDevice(simID)
+	require.NoError(t, err)
+	defer hc.Disconnect()
+	svc := simsrv.NewSimService(cfg)
+	err = svc.Start(hc)
+	require.NoError(t, err)
+	defer svc.Stop()
+
+	expected := []string{
+		"switch1/" + transport.EventNameTD, "switch1/" + transport.EventNameProps,
+		"meter1/" + transport.EventNameTD, "meter1/" + transport.EventNameProps,
+		"meter1/" + simsrv.EventPower,
+	}
+	received := make(map[string]*things.ThingValue)
+	for _, key := range expected {
+		for received[key] == nil {
+			select {
+			case msg := <-rxChan:
+				received[msg.ThingID+"/"+msg.Name] = msg
+			case <-time.After(time.Second):
+				t.Fatalf("event '%s' not received", key)
+			}
+		}
+	}
+	tdMsg := received["meter1/"+transport.EventNameTD]
+	require.NotNil(t, tdMsg)
+	td := things.TD{}
+	err = ser.Unmarshal(tdMsg.Data, &td)
+	require.NoError(t, err)
+	assert.Equal(t, "meter1", td.ID)
+	assert.NotNil(t, td.GetEvent(simsrv.EventPower))
+}
+
+// The catalogue only overrides the sensors of the kind of thing
+func TestValidateCatalogue(t *testing.T) {
+	cfg := simcfg.NewSimConfig()
+	cfg.Things = []simcfg.SimThingConfig{{
+		ID:   "thermostat1",
+		Kind: simcfg.KindThermostat,
+		Sensors: map[string]simcfg.SensorConfig{
+			simsrv.EventTemperature: {Waveform: simcfg.WaveSine, Min: 17, Max: 23},
+		},
+	}}
+	assert.NoError(t, cfg.Validate())
+
+	// thermostats don't have a power sensor
+	cfg.Things[0].Sensors[simsrv.EventPower] = simcfg.SensorConfig{Min: 0, Max: 100}
+	assert.Error(t, cfg.Validate())
+	delete(cfg.Things[0].Sensors, simsrv.EventPower)
+
+	cfg.Things[0].Sensors[simsrv.EventTemperature] = simcfg.SensorConfig{Min: 23, Max: 17}
+	assert.Error(t, cfg.Validate())
+}
+
+// Sensors follow their waveform and disconnected things don't accept requests
+func TestSensorsDisconnect(t *testing.T) {
+	now := time.Now()
+	st := simsrv.NewSimThing(simcfg.SimThingConfig{
+		ID:   "meter1",
+		Kind: simcfg.KindMeter,
+		Sensors: map[string]simcfg.SensorConfig{
+			simsrv.EventPower: {Waveform: simcfg.WaveConstant, Min: 1000, Max: 1000},
+		},
+		Disconnect: simcfg.DisconnectConfig{IntervalSec: 1, DurationSec: 60},
+	}, now)
+
+	// an hour at 1000W is 1kWh. The disconnect interval is shorter so it disconnects.
+	now = now.Add(time.Hour)
+	rnd := rand.New(rand.NewSource(1))
+	events, connChanged := st.Update(now, rnd)
+	assert.True(t, connChanged)
+	assert.Nil(t, events)
+	assert.Equal(t, simsrv.ConnectionDisconnected, st.Props()[simsrv.PropConnection])
+	_, err := st.HandleConfig(simsrv.PropTitle, []byte("meter"))
+	assert.Error(t, err)
+
+	now = now.Add(time.Minute)
+	events, connChanged = st.Update(now, rnd)
+	assert.True(t, connChanged)
+	assert.Equal(t, "1000", events[simsrv.EventPower])
+	assert.Equal(t, "1.017", events[simsrv.EventEnergy])
+}
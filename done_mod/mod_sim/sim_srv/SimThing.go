@@ -0,0 +1,336 @@
+package simsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	vocab "github.com/hiveot/hub/done_api/api_go"
+	simcfg "github.com/hiveot/hub/done_mod/mod_sim/sim_cfg"
+	"github.com/hiveot/hub/done_tool/things"
+)
+
+// Event, action and property names of the simulated Things
+const (
+	EventDimmer      = "dimmer"
+	EventEnergy      = "energy"
+	EventHeating     = "heating"
+	EventHumidity    = simcfg.SensorHumidity
+	EventPower       = simcfg.SensorPower
+	EventSwitch      = "switch"
+	EventTemperature = simcfg.SensorTemperature
+
+	ActionDimmer = "dimmer"
+	ActionSwitch = "switch"
+
+	PropConnection = "connection"
+	PropMake       = "make"
+	PropModel      = "model"
+	PropSetpoint   = "setpoint"
+	PropTitle      = "title"
+)
+
+// Connection status of a simulated Thing
+const (
+	ConnectionConnected    = "connected"
+	ConnectionDisconnected = "disconnected"
+)
+
+// SimMake is the make of all simulated Things
+const SimMake = "hiveot simulator"
+
+// defaultSensors holds the default waveforms of the sensors of each kind of Thing
+var defaultSensors = map[string]map[string]simcfg.SensorConfig{
+	simcfg.KindThermostat: {
+		EventTemperature: {Waveform: simcfg.WaveSine, Min: 18, Max: 22, PeriodSec: 86400, Noise: 0.1},
+		EventHumidity:    {Waveform: simcfg.WaveWalk, Min: 35, Max: 55, Noise: 0.5},
+	},
+	simcfg.KindMeter: {
+		EventPower: {Waveform: simcfg.WaveSine, Min: 200, Max: 2000, PeriodSec: 3600, Noise: 20},
+	},
+}
+
+// SimThing is a simulated Thing with its internal state
+type SimThing struct {
+	cfg simcfg.SimThingConfig
+	// waveforms of the sensors by event name
+	sensors map[string]simcfg.SensorConfig
+
+	mux sync.Mutex
+	// current sensor values by event name
+	values map[string]float64
+	title  string
+	// switch state of switches
+	on bool
+	// level of dimmers, 0-100
+	level int
+	// temperature setpoint of thermostats
+	setpoint float64
+	// accumulated energy of meters, in kWh
+	energy float64
+	// connection status and time of reconnect when disconnected
+	connected    bool
+	reconnectAt  time.Time
+	lastUpdateAt time.Time
+}
+
+// CreateTD returns the TD document describing the Thing
+func (st *SimThing) CreateTD() *things.TD {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+	var td *things.TD
+	switch st.cfg.Kind {
+	case simcfg.KindThermostat:
+		td = things.NewTD(st.cfg.ID, st.title, vocab.ThingControlThermostat)
+		ev := td.AddSensorEvent(EventTemperature, "Temperature")
+		ev.EventType = vocab.PropEnvTemperature
+		ev.Data.AtType = vocab.PropEnvTemperature
+		ev.Data.Unit = vocab.UnitCelcius
+		ev = td.AddSensorEvent(EventHumidity, "Humidity")
+		ev.EventType = vocab.PropEnvHumidity
+		ev.Data.AtType = vocab.PropEnvHumidity
+		ev.Data.Unit = vocab.UnitPercent
+		td.AddEvent(EventHeating, vocab.PropStatusOnOff, "Heating", "",
+			&things.DataSchema{AtType: vocab.PropStatusOnOff, Type: vocab.WoTDataTypeBool})
+		prop := td.AddProperty(PropSetpoint, "", "Temperature setpoint", vocab.WoTDataTypeNumber)
+		prop.ReadOnly = false
+		prop.Unit = vocab.UnitCelcius
+		prop.NumberMinimum = 5
+		prop.NumberMaximum = 30
+	case simcfg.KindSwitch:
+		td = things.NewTD(st.cfg.ID, st.title, vocab.ThingActuatorSwitch)
+		td.AddSwitchEvent(EventSwitch, "Switch")
+		td.AddSwitchAction(ActionSwitch, "Switch on/off")
+	case simcfg.KindDimmer:
+		td = things.NewTD(st.cfg.ID, st.title, vocab.ThingActuatorDimmer)
+		ev := td.AddDimmerEvent(EventDimmer)
+		ev.Title = "Dimmer level"
+		ev.Data.Unit = vocab.UnitPercent
+		act := td.AddDimmerAction(ActionDimmer)
+		act.Title = "Set dimmer level"
+		act.Input.Unit = vocab.UnitPercent
+		act.Input.NumberMinimum = 0
+		act.Input.NumberMaximum = 100
+	default:
+		td = things.NewTD(st.cfg.ID, st.title, vocab.ThingMeterElectric)
+		ev := td.AddSensorEvent(EventPower, "Power")
+		ev.EventType = vocab.PropElectricPower
+		ev.Data.AtType = vocab.PropElectricPower
+		ev.Data.Unit = vocab.UnitWatt
+		ev = td.AddSensorEvent(EventEnergy, "Energy")
+		ev.EventType = vocab.PropElectricEnergy
+		ev.Data.AtType = vocab.PropElectricEnergy
+		ev.Data.Unit = vocab.UnitKilowattHour
+	}
+	prop := td.AddPropertyAsString(PropTitle, vocab.PropDeviceTitle, "Title")
+	prop.ReadOnly = false
+	td.AddPropertyAsString(PropMake, vocab.PropDeviceMake, "Make")
+	td.AddPropertyAsString(PropModel, vocab.PropDeviceModel, "Model")
+	td.AddPropertyAsString(PropConnection, vocab.PropNetConnection, "Connection")
+	return td
+}
+
+// Events returns the current value of the events of the Thing
+func (st *SimThing) Events() map[string]string {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+	return st.events()
+}
+
+// events returns the event values. This must be called with the lock held.
+func (st *SimThing) events() map[string]string {
+	events := make(map[string]string)
+	for name, value := range st.values {
+		events[name] = strconv.FormatFloat(round(value, 1), 'f', -1, 64)
+	}
+	switch st.cfg.Kind {
+	case simcfg.KindThermostat:
+		events[EventHeating] = strconv.FormatBool(st.values[EventTemperature] < st.setpoint)
+	case simcfg.KindSwitch:
+		events[EventSwitch] = strconv.FormatBool(st.on)
+	case simcfg.KindDimmer:
+		events[EventDimmer] = strconv.Itoa(st.level)
+	case simcfg.KindMeter:
+		events[EventEnergy] = strconv.FormatFloat(round(st.energy, 3), 'f', -1, 64)
+	}
+	return events
+}
+
+// HandleAction changes the state of the Thing as requested.
+// This returns the new state and the events to publish.
+func (st *SimThing) HandleAction(name string, data []byte) (reply []byte, events map[string]string, err error) {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+	if !st.connected {
+		return nil, nil, fmt.Errorf("thing '%s' is disconnected", st.cfg.ID)
+	}
+	if st.cfg.Kind == simcfg.KindSwitch && name == ActionSwitch {
+		st.on, err = parseBool(data)
+		reply = []byte(strconv.FormatBool(st.on))
+		events = map[string]string{EventSwitch: string(reply)}
+	} else if st.cfg.Kind == simcfg.KindDimmer && name == ActionDimmer {
+		var level float64
+		level, err = parseNumber(data)
+		if err == nil {
+			st.level = int(math.Max(0, math.Min(100, math.Round(level))))
+		}
+		reply = []byte(strconv.Itoa(st.level))
+		events = map[string]string{EventDimmer: string(reply)}
+	} else {
+		err = fmt.Errorf("thing '%s' has no action '%s'", st.cfg.ID, name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return reply, events, nil
+}
+
+// HandleConfig changes the configuration of the Thing as requested.
+// This returns the changed properties to publish.
+func (st *SimThing) HandleConfig(name string, data []byte) (props map[string]string, err error) {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+	if !st.connected {
+		return nil, fmt.Errorf("thing '%s' is disconnected", st.cfg.ID)
+	}
+	if name == PropTitle {
+		st.title = parseString(data)
+	} else if st.cfg.Kind == simcfg.KindThermostat && name == PropSetpoint {
+		var setpoint float64
+		setpoint, err = parseNumber(data)
+		if err == nil && (setpoint < 5 || setpoint > 30) {
+			err = fmt.Errorf("setpoint %v is outside the range 5-30", setpoint)
+		}
+		if err == nil {
+			st.setpoint = setpoint
+		}
+	} else {
+		err = fmt.Errorf("thing '%s' has no configurable property '%s'", st.cfg.ID, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return st.props(), nil
+}
+
+// Props returns the current property values of the Thing
+func (st *SimThing) Props() map[string]string {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+	return st.props()
+}
+
+// props returns the property values. This must be called with the lock held.
+func (st *SimThing) props() map[string]string {
+	connection := ConnectionConnected
+	if !st.connected {
+		connection = ConnectionDisconnected
+	}
+	props := map[string]string{
+		PropConnection: connection,
+		PropMake:       SimMake,
+		PropModel:      st.cfg.Kind,
+		PropTitle:      st.title,
+	}
+	if st.cfg.Kind == simcfg.KindThermostat {
+		props[PropSetpoint] = strconv.FormatFloat(st.setpoint, 'f', -1, 64)
+	}
+	return props
+}
+
+// Update the sensor values and the connection status of the Thing.
+// This returns the events to publish, which is nil while disconnected, and whether the
+// connection status has changed.
+func (st *SimThing) Update(now time.Time, rnd *rand.Rand) (events map[string]string, connChanged bool) {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+	elapsed := now.Sub(st.lastUpdateAt)
+	st.lastUpdateAt = now
+
+	// disconnects are random with the configured average interval
+	dc := st.cfg.Disconnect
+	if st.connected && dc.IntervalSec > 0 &&
+		rnd.Float64() < elapsed.Seconds()/float64(dc.IntervalSec) {
+		st.connected = false
+		st.reconnectAt = now.Add(time.Duration(dc.DurationSec) * time.Second)
+		connChanged = true
+	} else if !st.connected && !now.Before(st.reconnectAt) {
+		st.connected = true
+		connChanged = true
+	}
+
+	for name, sensorCfg := range st.sensors {
+		st.values[name] = waveValue(sensorCfg, now, st.values[name], rnd)
+	}
+	if st.cfg.Kind == simcfg.KindMeter {
+		st.energy += math.Max(0, st.values[EventPower]) * elapsed.Hours() / 1000
+	}
+	if !st.connected {
+		return nil, connChanged
+	}
+	return st.events(), connChanged
+}
+
+// parseBool parses a switch value: true, false, on, off, 1 or 0, optionally JSON encoded
+func parseBool(data []byte) (bool, error) {
+	text := strings.ToLower(parseString(data))
+	switch text {
+	case "true", "on", "1":
+		return true, nil
+	case "false", "off", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("'%s' is not an on/off value", text)
+}
+
+// parseNumber parses a number, optionally JSON encoded
+func parseNumber(data []byte) (float64, error) {
+	text := parseString(data)
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a number", text)
+	}
+	return value, nil
+}
+
+// parseString returns the text of a JSON encoded string or the raw text
+func parseString(data []byte) string {
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		return text
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// NewSimThing creates a simulated Thing with the sensors of its kind
+//
+//	cfg is the catalogue entry of the Thing
+//	now is the time of the initial sensor values
+func NewSimThing(cfg simcfg.SimThingConfig, now time.Time) *SimThing {
+	st := &SimThing{
+		cfg:          cfg,
+		sensors:      make(map[string]simcfg.SensorConfig),
+		values:       make(map[string]float64),
+		title:        cfg.Title,
+		setpoint:     20,
+		connected:    true,
+		lastUpdateAt: now,
+	}
+	if st.title == "" {
+		st.title = cfg.ID
+	}
+	for name, sensorCfg := range defaultSensors[cfg.Kind] {
+		if override, found := cfg.Sensors[name]; found {
+			sensorCfg = override
+		}
+		st.sensors[name] = sensorCfg
+		// the random walk starts halfway
+		st.values[name] = (sensorCfg.Min + sensorCfg.Max) / 2
+	}
+	return st
+}
@@ -0,0 +1,56 @@
+package simsrv
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	simcfg "github.com/hiveot/hub/done_mod/mod_sim/sim_cfg"
+)
+
+// waveValue returns the value of a sensor waveform at the given time, including noise.
+//
+//	cfg is the waveform of the sensor
+//	now is the time of the value. Waveforms are aligned to the clock.
+//	prev is the previous value, used by the random walk
+//	rnd is the source of noise
+func waveValue(cfg simcfg.SensorConfig, now time.Time, prev float64, rnd *rand.Rand) float64 {
+	span := cfg.Max - cfg.Min
+	if cfg.Waveform == simcfg.WaveWalk {
+		value := prev + rnd.NormFloat64()*cfg.Noise
+		return math.Max(cfg.Min, math.Min(cfg.Max, value))
+	}
+	// position in the current period, 0-1
+	phase := 0.0
+	if cfg.PeriodSec > 0 {
+		periodMSec := int64(cfg.PeriodSec) * 1000
+		phase = float64(now.UnixMilli()%periodMSec) / float64(periodMSec)
+	}
+	// level is the relative position between min and max, 0-1
+	var level float64
+	switch cfg.Waveform {
+	case simcfg.WaveConstant:
+		level = 0.5
+	case simcfg.WaveSawtooth:
+		level = phase
+	case simcfg.WaveSquare:
+		if phase >= 0.5 {
+			level = 1
+		}
+	case simcfg.WaveTriangle:
+		level = 1 - math.Abs(2*phase-1)
+	default:
+		level = (1 - math.Cos(2*math.Pi*phase)) / 2
+	}
+	value := cfg.Min + span*level
+	if cfg.Noise > 0 {
+		value += rnd.NormFloat64() * cfg.Noise
+	}
+	return value
+}
+
+// round a value to the given number of decimals
+func round(value float64, decimals int) float64 {
+	pow := math.Pow(10, float64(decimals))
+	return math.Round(value*pow) / pow
+}
@@ -10,14 +10,18 @@ const StorageCap = "store"
 const DeleteMethod = "delete"
 
 type DeleteArgs struct {
-	Key string `json:"key"`
+	// Bucket is the name of a shared bucket or "" for the client's own bucket
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key"`
 }
 
 // GetMethod reads a record from the store
 const GetMethod = "get"
 
 type GetArgs struct {
-	Key string `json:"key"`
+	// Bucket is the name of a shared bucket or "" for the client's own bucket
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key"`
 }
 
 type GetResp struct {
@@ -33,7 +37,9 @@ type GetResp struct {
 const GetMultipleMethod = "getMultiple"
 
 type GetMultipleArgs struct {
-	Keys []string `json:"keys"`
+	// Bucket is the name of a shared bucket or "" for the client's own bucket
+	Bucket string   `json:"bucket,omitempty"`
+	Keys   []string `json:"keys"`
 }
 
 type GetMultipleResp struct {
@@ -45,13 +51,111 @@ type GetMultipleResp struct {
 const SetMethod = "set"
 
 type SetArgs struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	// Bucket is the name of a shared bucket or "" for the client's own bucket
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
 }
 
 // SetMultipleMethod writes multiple records to the store
 const SetMultipleMethod = "setMultiple"
 
 type SetMultipleArgs struct {
-	KV map[string]string `json:"kv"`
+	// Bucket is the name of a shared bucket or "" for the client's own bucket
+	Bucket string            `json:"bucket,omitempty"`
+	KV     map[string]string `json:"kv"`
+}
+
+// UnwatchMethod removes a watch on a key prefix of the client's store
+const UnwatchMethod = "unwatch"
+
+type UnwatchArgs struct {
+	// Bucket is the name of a shared bucket or "" for the client's own bucket
+	Bucket string `json:"bucket,omitempty"`
+	// Prefix as provided to Watch
+	Prefix string `json:"prefix"`
+	// WatcherID as provided to Watch
+	WatcherID string `json:"watcherID"`
+}
+
+// WatchMethod requests notification of changes to keys under the given prefix.
+// Changes are sent as a StateChangedEvent notification to the inbox of the client
+// that registered the watch. Watches are held in memory and expire after
+// WatchLeaseSec unless renewed by repeating the watch request. This removes watches
+// of clients that have disconnected and restores watches after a service restart.
+const WatchMethod = "watch"
+
+// WatchLeaseSec is the lifetime of a watch in seconds
+const WatchLeaseSec = 300
+
+type WatchArgs struct {
+	// Bucket is the name of a shared bucket or "" for the client's own bucket
+	Bucket string `json:"bucket,omitempty"`
+	// Prefix of the keys to watch or "" for all keys
+	Prefix string `json:"prefix"`
+	// WatcherID identifies the watcher when a client has multiple connections.
+	// Each connection should use its own ID so unwatch doesn't affect the others.
+	WatcherID string `json:"watcherID"`
+}
+
+// StateChangedEvent is the name of the notification sent when a watched key is set or deleted.
+// The notification is sent by the state service to the inbox of the watching client,
+// with the bucketID as thingID. The bucketID is the owner's clientID or
+// SharedBucketPrefix+bucket name for shared buckets:
+//
+//	_INBOX.{clientID}.{bucketID}.stateChanged.{serviceID}
+const StateChangedEvent = "stateChanged"
+
+// StateChangedMsg is the payload of the StateChangedEvent.
+// The value itself is not included. Watchers read it when needed.
+type StateChangedMsg struct {
+	// Bucket is the name of the shared bucket or "" for the client's own bucket
+	Bucket string `json:"bucket,omitempty"`
+	// Key that was changed
+	Key string `json:"key"`
+	// Deleted is set when the record was removed
+	Deleted bool `json:"deleted"`
+}
+
+// ManageBucketsCap is the capability to manage shared buckets.
+// Only administrators can use this capability.
+const ManageBucketsCap = "manageBuckets"
+
+// DefaultSharedBucket is the shared bucket that is created when none exist.
+// Operators can read and managers can write to it.
+const DefaultSharedBucket = "household"
+
+// SharedBucketPrefix is the prefix of the bucket ID of shared buckets.
+// This separates shared buckets from the client's own bucket.
+const SharedBucketPrefix = "$shared-"
+
+// SharedBucket describes a named bucket that is shared between clients
+type SharedBucket struct {
+	// Name of the bucket
+	Name string `json:"name"`
+	// ReadRoles are the client roles that can read from the bucket
+	ReadRoles []string `json:"readRoles"`
+	// WriteRoles are the client roles that can write to the bucket
+	WriteRoles []string `json:"writeRoles"`
+}
+
+// GetSharedBucketsMethod returns the list of shared buckets
+const GetSharedBucketsMethod = "getSharedBuckets"
+
+type GetSharedBucketsResp struct {
+	Buckets []SharedBucket `json:"buckets"`
+}
+
+// RemoveSharedBucketMethod removes a shared bucket including its records
+const RemoveSharedBucketMethod = "removeSharedBucket"
+
+type RemoveSharedBucketArgs struct {
+	Name string `json:"name"`
+}
+
+// SetSharedBucketMethod adds or updates a shared bucket and its roles
+const SetSharedBucketMethod = "setSharedBucket"
+
+type SetSharedBucketArgs struct {
+	Bucket SharedBucket `json:"bucket"`
 }
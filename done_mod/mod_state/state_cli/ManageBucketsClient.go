@@ -0,0 +1,61 @@
+package statecli
+
+import (
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	stateapi "github.com/hiveot/hub/done_mod/mod_state/state_api"
+)
+
+// ManageBucketsClient is a marshaller for managing shared state buckets.
+// The caller must be an administrator.
+type ManageBucketsClient struct {
+	// ID of the service that handles the requests
+	agentID string
+	// Shared bucket management capability
+	capID string
+	// Connection to the hub
+	hc *clidone.HubClient
+}
+
+// GetSharedBuckets returns the list of shared buckets
+func (cl *ManageBucketsClient) GetSharedBuckets() ([]stateapi.SharedBucket, error) {
+	resp := stateapi.GetSharedBucketsResp{}
+	err := cl.hc.PubRPCRequest(
+		cl.agentID, cl.capID, stateapi.GetSharedBucketsMethod, nil, &resp)
+	return resp.Buckets, err
+}
+
+// RemoveSharedBucket removes a shared bucket and its records
+func (cl *ManageBucketsClient) RemoveSharedBucket(name string) error {
+	req := stateapi.RemoveSharedBucketArgs{Name: name}
+	err := cl.hc.PubRPCRequest(
+		cl.agentID, cl.capID, stateapi.RemoveSharedBucketMethod, &req, nil)
+	return err
+}
+
+// SetSharedBucket adds or updates a shared bucket
+//
+//	name of the bucket
+//	readRoles are the client roles that can read the bucket
+//	writeRoles are the client roles that can write to the bucket
+func (cl *ManageBucketsClient) SetSharedBucket(name string, readRoles []string, writeRoles []string) error {
+	req := stateapi.SetSharedBucketArgs{Bucket: stateapi.SharedBucket{
+		Name:       name,
+		ReadRoles:  readRoles,
+		WriteRoles: writeRoles,
+	}}
+	err := cl.hc.PubRPCRequest(
+		cl.agentID, cl.capID, stateapi.SetSharedBucketMethod, &req, nil)
+	return err
+}
+
+// NewManageBucketsClient returns a client to manage shared state buckets
+//
+//	hc is the hub client connection to use.
+func NewManageBucketsClient(hc *clidone.HubClient) *ManageBucketsClient {
+	cl := ManageBucketsClient{
+		hc:      hc,
+		agentID: stateapi.ServiceName,
+		capID:   stateapi.ManageBucketsCap,
+	}
+	return &cl
+}
@@ -1,9 +1,17 @@
 package statecli
 
 import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
 	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
 	stateapi "github.com/hiveot/hub/done_mod/mod_state/state_api"
 	"github.com/hiveot/hub/done_tool/ser"
+	"github.com/hiveot/hub/done_tool/things"
 )
 
 // StateClient is a marshaller for service messages using a provided hub connection.
@@ -13,14 +21,35 @@ type StateClient struct {
 	agentID string
 	// State storage capability
 	capID string
+	// Name of the shared bucket or "" for the client's own bucket
+	bucket string
 	// Connection to the hub
 	hc *clidone.HubClient
+
+	// ID of this client's watches, unique to this client instance
+	watcherID string
+	// handlers of watched key prefixes
+	watchers map[string]func(msg stateapi.StateChangedMsg)
+	// the state change notifications are subscribed to
+	subscribed bool
+	// timer that renews the watches before their lease expires
+	renewTimer *time.Timer
+	// mutex to protect the watchers, subscription and timer
+	mux sync.RWMutex
+}
+
+// bucketID returns the ID of the bucket used as thingID in change events
+func (cl *StateClient) bucketID() string {
+	if cl.bucket == "" {
+		return cl.hc.ClientID()
+	}
+	return stateapi.SharedBucketPrefix + cl.bucket
 }
 
 // Delete removes the record with the given key.
 func (cl *StateClient) Delete(key string) error {
 
-	req := stateapi.DeleteArgs{Key: key}
+	req := stateapi.DeleteArgs{Key: key, Bucket: cl.bucket}
 	err := cl.hc.PubRPCRequest(
 		cl.agentID, cl.capID, stateapi.DeleteMethod, &req, nil)
 	return err
@@ -30,7 +59,7 @@ func (cl *StateClient) Delete(key string) error {
 // If the key doesn't exist this returns an empty record.
 func (cl *StateClient) Get(key string, record interface{}) (found bool, err error) {
 
-	req := stateapi.GetArgs{Key: key}
+	req := stateapi.GetArgs{Key: key, Bucket: cl.bucket}
 	resp := stateapi.GetResp{}
 	err = cl.hc.PubRPCRequest(
 		cl.agentID, cl.capID, stateapi.GetMethod, &req, &resp)
@@ -47,7 +76,7 @@ func (cl *StateClient) Get(key string, record interface{}) (found bool, err erro
 // This marshalling and unmarshalling is up to the caller.
 func (cl *StateClient) GetMultiple(keys []string) (values map[string]string, err error) {
 
-	req := stateapi.GetMultipleArgs{Keys: keys}
+	req := stateapi.GetMultipleArgs{Keys: keys, Bucket: cl.bucket}
 	resp := stateapi.GetMultipleResp{}
 	err = cl.hc.PubRPCRequest(
 		cl.agentID, cl.capID, stateapi.GetMultipleMethod, &req, &resp)
@@ -63,7 +92,7 @@ func (cl *StateClient) Set(key string, record interface{}) error {
 	if err != nil {
 		return err
 	}
-	req := stateapi.SetArgs{Key: key, Value: string(value)}
+	req := stateapi.SetArgs{Key: key, Value: string(value), Bucket: cl.bucket}
 	err = cl.hc.PubRPCRequest(
 		cl.agentID, cl.capID, stateapi.SetMethod, &req, nil)
 	return err
@@ -71,21 +100,143 @@ func (cl *StateClient) Set(key string, record interface{}) error {
 
 // SetMultiple writes multiple record
 func (cl *StateClient) SetMultiple(kv map[string]string) error {
-	req := stateapi.SetMultipleArgs{KV: kv}
+	req := stateapi.SetMultipleArgs{KV: kv, Bucket: cl.bucket}
 	err := cl.hc.PubRPCRequest(
 		cl.agentID, cl.capID, stateapi.SetMultipleMethod, &req, nil)
 	return err
 }
 
+// HandleEvent passes a state change notification to the handlers of watched prefixes.
+// This returns false if the message is not a state change notification of this client.
+//
+// The hub client supports a single event handler. Applications that set their own
+// event handler must pass events to HandleEvent to receive watch notifications.
+func (cl *StateClient) HandleEvent(msg *things.ThingValue) bool {
+	if msg.ValueType != transport.MessageTypeINBOX || msg.SenderID != cl.agentID ||
+		msg.ThingID != cl.bucketID() || msg.Name != stateapi.StateChangedEvent {
+		return false
+	}
+	changeMsg := stateapi.StateChangedMsg{}
+	err := ser.Unmarshal(msg.Data, &changeMsg)
+	if err != nil {
+		return true
+	}
+	// handlers can make requests of their own so don't hold the lock
+	handlers := make([]func(msg stateapi.StateChangedMsg), 0, 1)
+	cl.mux.RLock()
+	for prefix, handler := range cl.watchers {
+		if strings.HasPrefix(changeMsg.Key, prefix) {
+			handlers = append(handlers, handler)
+		}
+	}
+	cl.mux.RUnlock()
+	for _, handler := range handlers {
+		handler(changeMsg)
+	}
+	return true
+}
+
+// onRenewTimer renews the watches before their lease expires.
+// Renewal stops when there are no more watches or renewal fails, eg after disconnect.
+func (cl *StateClient) onRenewTimer() {
+	cl.mux.Lock()
+	prefixes := make([]string, 0, len(cl.watchers))
+	for prefix := range cl.watchers {
+		prefixes = append(prefixes, prefix)
+	}
+	cl.mux.Unlock()
+	for _, prefix := range prefixes {
+		req := stateapi.WatchArgs{Prefix: prefix, Bucket: cl.bucket, WatcherID: cl.watcherID}
+		err := cl.hc.PubRPCRequest(
+			cl.agentID, cl.capID, stateapi.WatchMethod, &req, nil)
+		if err != nil {
+			slog.Warn("onRenewTimer; renewing watch failed. Renewal stopped.",
+				slog.String("prefix", prefix), slog.String("err", err.Error()))
+			cl.mux.Lock()
+			cl.renewTimer = nil
+			cl.mux.Unlock()
+			return
+		}
+	}
+	cl.mux.Lock()
+	defer cl.mux.Unlock()
+	if len(cl.watchers) == 0 {
+		cl.renewTimer = nil
+	} else if cl.renewTimer != nil {
+		cl.renewTimer.Reset(time.Second * stateapi.WatchLeaseSec / 2)
+	}
+}
+
+// Unwatch stops watching the given key prefix
+func (cl *StateClient) Unwatch(prefix string) error {
+	cl.mux.Lock()
+	delete(cl.watchers, prefix)
+	if len(cl.watchers) == 0 && cl.renewTimer != nil {
+		cl.renewTimer.Stop()
+		cl.renewTimer = nil
+	}
+	cl.mux.Unlock()
+	req := stateapi.UnwatchArgs{Prefix: prefix, Bucket: cl.bucket, WatcherID: cl.watcherID}
+	err := cl.hc.PubRPCRequest(
+		cl.agentID, cl.capID, stateapi.UnwatchMethod, &req, nil)
+	return err
+}
+
+// Watch invokes the handler when a key with the given prefix is set or deleted.
+//
+// This subscribes to state change notifications sent to this client. The hub client's
+// event handler must pass received events to HandleEvent.
+// The watch is renewed periodically until Unwatch is called or the connection is closed.
+//
+//	prefix of the keys to watch or "" for all keys
+//	handler is invoked with the changed key
+func (cl *StateClient) Watch(prefix string, handler func(msg stateapi.StateChangedMsg)) error {
+	cl.mux.Lock()
+	needsSub := !cl.subscribed
+	cl.subscribed = true
+	cl.watchers[prefix] = handler
+	if cl.renewTimer == nil {
+		cl.renewTimer = time.AfterFunc(time.Second*stateapi.WatchLeaseSec/2, cl.onRenewTimer)
+	}
+	cl.mux.Unlock()
+
+	if needsSub {
+		err := cl.hc.SubNotifications(cl.bucketID(), stateapi.StateChangedEvent)
+		if err != nil {
+			cl.mux.Lock()
+			cl.subscribed = false
+			cl.mux.Unlock()
+			return err
+		}
+	}
+	req := stateapi.WatchArgs{Prefix: prefix, Bucket: cl.bucket, WatcherID: cl.watcherID}
+	err := cl.hc.PubRPCRequest(
+		cl.agentID, cl.capID, stateapi.WatchMethod, &req, nil)
+	return err
+}
+
 // NewStateClient returns a client to access state
 //
 //	hc is the hub client connection to use.
 func NewStateClient(hc *clidone.HubClient) *StateClient {
 	agentID := stateapi.ServiceName
 	cl := StateClient{
-		hc:      hc,
-		agentID: agentID,
-		capID:   stateapi.StorageCap,
+		hc:        hc,
+		agentID:   agentID,
+		capID:     stateapi.StorageCap,
+		watcherID: uuid.NewString(),
+		watchers:  make(map[string]func(msg stateapi.StateChangedMsg)),
 	}
 	return &cl
 }
+
+// NewSharedStateClient returns a client to access state in a shared bucket.
+// Access to the bucket depends on the client's role.
+//
+//	hc is the hub client connection to use.
+//	bucket is the name of the shared bucket, eg stateapi.DefaultSharedBucket
+func NewSharedStateClient(hc *clidone.HubClient, bucket string) *StateClient {
+	cl := NewStateClient(hc)
+	cl.bucket = bucket
+	return cl
+}
@@ -0,0 +1,218 @@
+package statesrv
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	authcli "github.com/hiveot/hub/done_mod/mod_auth/auth_cli"
+	stateapi "github.com/hiveot/hub/done_mod/mod_state/state_api"
+	"github.com/hiveot/hub/done_tool/ser"
+)
+
+// sharedBucketsID is the ID of the bucket that holds the shared bucket definitions
+const sharedBucketsID = "$sharedBuckets"
+
+// roleCacheValidity is the time a client's role is cached before it is read again
+const roleCacheValidity = time.Minute
+
+// cachedRole holds the role of a client as read from the auth service
+type cachedRole struct {
+	role   string
+	expiry time.Time
+}
+
+// getBucketID returns the storage ID of the bucket to use for a request.
+// If no bucket name is given this returns the client's own bucket.
+// For shared buckets the client's role must be allowed to read or write to the bucket.
+//
+// Client IDs starting with '$' are refused as the client's own bucket would collide
+// with the shared buckets and their definitions.
+//
+//	clientID is the sender of the request
+//	name is the name of the shared bucket or "" for the client's own bucket
+//	write is true when the request modifies the bucket
+func (svc *StateService) getBucketID(clientID string, name string, write bool) (string, error) {
+	if name == "" {
+		if clientID == "" || strings.HasPrefix(clientID, "$") {
+			return "", fmt.Errorf("client ID '%s' can't be used as bucket", clientID)
+		}
+		return clientID, nil
+	}
+	svc.sharedMux.RLock()
+	sb, found := svc.sharedBuckets[name]
+	svc.sharedMux.RUnlock()
+	if !found {
+		return "", fmt.Errorf("unknown shared bucket '%s'", name)
+	}
+	role, err := svc.getClientRole(clientID)
+	if err != nil {
+		return "", fmt.Errorf("unable to determine role of client '%s': %w", clientID, err)
+	}
+	allowedRoles := sb.ReadRoles
+	if write {
+		allowedRoles = sb.WriteRoles
+	}
+	if !slices.Contains(allowedRoles, role) {
+		slog.Warn("getBucketID; access denied",
+			slog.String("clientID", clientID),
+			slog.String("role", role),
+			slog.String("bucket", name),
+			slog.Bool("write", write))
+		return "", fmt.Errorf("client '%s' has no access to shared bucket '%s'", clientID, name)
+	}
+	return stateapi.SharedBucketPrefix + name, nil
+}
+
+// getClientRole returns the role of a client from its profile.
+// Roles are cached for roleCacheValidity to avoid a request to the auth service on
+// each access to a shared bucket. Role changes take effect when the cache expires.
+func (svc *StateService) getClientRole(clientID string) (string, error) {
+	now := time.Now()
+	svc.roleMux.Lock()
+	cr, found := svc.roleCache[clientID]
+	svc.roleMux.Unlock()
+	if found && now.Before(cr.expiry) {
+		return cr.role, nil
+	}
+	mngClients := authcli.NewManageClients(svc.hc)
+	prof, err := mngClients.GetProfile(clientID)
+	if err != nil {
+		return "", err
+	}
+	svc.roleMux.Lock()
+	defer svc.roleMux.Unlock()
+	// remove expired entries so the cache doesn't grow with clients that are gone
+	for id, entry := range svc.roleCache {
+		if now.After(entry.expiry) {
+			delete(svc.roleCache, id)
+		}
+	}
+	svc.roleCache[clientID] = cachedRole{role: prof.Role, expiry: now.Add(roleCacheValidity)}
+	return prof.Role, nil
+}
+
+// GetSharedBuckets returns the list of shared buckets
+func (svc *StateService) GetSharedBuckets() (resp *stateapi.GetSharedBucketsResp, err error) {
+	svc.sharedMux.RLock()
+	defer svc.sharedMux.RUnlock()
+	resp = &stateapi.GetSharedBucketsResp{
+		Buckets: make([]stateapi.SharedBucket, 0, len(svc.sharedBuckets)),
+	}
+	for _, sb := range svc.sharedBuckets {
+		resp.Buckets = append(resp.Buckets, sb)
+	}
+	return resp, nil
+}
+
+// loadSharedBuckets loads the shared bucket definitions from the store.
+// If none exist then the default shared bucket is added.
+func (svc *StateService) loadSharedBuckets() error {
+	bucket := svc.store.GetBucket(sharedBucketsID)
+	defer bucket.Close()
+
+	svc.sharedMux.Lock()
+	defer svc.sharedMux.Unlock()
+	// the cursor fails if the bucket doesn't yet exist
+	cursor, err := bucket.Cursor(context.Background())
+	if err == nil {
+		for k, v, valid := cursor.First(); valid; k, v, valid = cursor.Next() {
+			sb := stateapi.SharedBucket{}
+			err2 := ser.Unmarshal(v, &sb)
+			if err2 != nil {
+				slog.Error("loadSharedBuckets; invalid bucket definition",
+					slog.String("name", k), slog.String("err", err2.Error()))
+				continue
+			}
+			svc.sharedBuckets[sb.Name] = sb
+		}
+		cursor.Release()
+	}
+	err = nil
+
+	if len(svc.sharedBuckets) == 0 {
+		// operators can read and managers can write the default shared bucket
+		sb := stateapi.SharedBucket{
+			Name: stateapi.DefaultSharedBucket,
+			ReadRoles: []string{
+				authapi.ClientRoleOperator,
+				authapi.ClientRoleManager,
+				authapi.ClientRoleAdmin,
+				authapi.ClientRoleService},
+			WriteRoles: []string{
+				authapi.ClientRoleManager,
+				authapi.ClientRoleAdmin,
+				authapi.ClientRoleService},
+		}
+		value, _ := ser.Marshal(&sb)
+		err = bucket.Set(sb.Name, value)
+		svc.sharedBuckets[sb.Name] = sb
+	}
+	return err
+}
+
+// RemoveSharedBucket removes a shared bucket and deletes its records
+func (svc *StateService) RemoveSharedBucket(
+	ctx clidone.ServiceContext, args *stateapi.RemoveSharedBucketArgs) error {
+
+	slog.Info("RemoveSharedBucket",
+		slog.String("senderID", ctx.SenderID), slog.String("name", args.Name))
+	svc.sharedMux.Lock()
+	defer svc.sharedMux.Unlock()
+	if _, found := svc.sharedBuckets[args.Name]; !found {
+		return fmt.Errorf("unknown shared bucket '%s'", args.Name)
+	}
+	defBucket := svc.store.GetBucket(sharedBucketsID)
+	err := defBucket.Delete(args.Name)
+	_ = defBucket.Close()
+	if err != nil {
+		return err
+	}
+	delete(svc.sharedBuckets, args.Name)
+
+	// delete the records of the bucket
+	bucket := svc.store.GetBucket(stateapi.SharedBucketPrefix + args.Name)
+	defer bucket.Close()
+	cursor, err := bucket.Cursor(context.Background())
+	if err != nil {
+		// the bucket has no records
+		return nil
+	}
+	keys := make([]string, 0)
+	for k, _, valid := cursor.First(); valid; k, _, valid = cursor.Next() {
+		keys = append(keys, k)
+	}
+	cursor.Release()
+	for _, k := range keys {
+		err = bucket.Delete(k)
+	}
+	return err
+}
+
+// SetSharedBucket adds or updates a shared bucket
+func (svc *StateService) SetSharedBucket(
+	ctx clidone.ServiceContext, args *stateapi.SetSharedBucketArgs) error {
+
+	sb := args.Bucket
+	slog.Info("SetSharedBucket",
+		slog.String("senderID", ctx.SenderID), slog.String("name", sb.Name),
+		slog.Any("readRoles", sb.ReadRoles), slog.Any("writeRoles", sb.WriteRoles))
+	if sb.Name == "" {
+		return fmt.Errorf("SetSharedBucket: missing bucket name")
+	}
+	value, _ := ser.Marshal(&sb)
+	bucket := svc.store.GetBucket(sharedBucketsID)
+	err := bucket.Set(sb.Name, value)
+	_ = bucket.Close()
+	if err == nil {
+		svc.sharedMux.Lock()
+		svc.sharedBuckets[sb.Name] = sb
+		svc.sharedMux.Unlock()
+	}
+	return err
+}
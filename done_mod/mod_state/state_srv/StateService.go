@@ -3,6 +3,9 @@ package statesrv
 import (
 	"log/slog"
 	"path"
+	"strings"
+	"sync"
+	"time"
 
 	clidone "github.com/hiveot/hub/done_cli/cli_done"
 	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
@@ -10,8 +13,15 @@ import (
 	stateapi "github.com/hiveot/hub/done_mod/mod_state/state_api"
 	"github.com/hiveot/hub/done_tool/buckets"
 	"github.com/hiveot/hub/done_tool/buckets/bolts"
+	"github.com/hiveot/hub/done_tool/ser"
 )
 
+// stateWatcher identifies a watch registration of a client connection
+type stateWatcher struct {
+	clientID  string
+	watcherID string
+}
+
 // StateService handles storage of client data records
 type StateService struct {
 	// Hub connection
@@ -19,17 +29,44 @@ type StateService struct {
 	// backend storage
 	storeDir string
 	store    buckets.IBucketStore
+
+	// watched key prefixes of each bucket with the lease expiry of each watcher:
+	// map[bucketID]map[prefix]map[watcher]expiry
+	watches map[string]map[string]map[stateWatcher]time.Time
+	// mutex to protect the watches
+	mux sync.RWMutex
+
+	// shared buckets by name
+	sharedBuckets map[string]stateapi.SharedBucket
+	// mutex to protect the shared buckets
+	sharedMux sync.RWMutex
+
+	// roles of clients that access shared buckets
+	roleCache map[string]cachedRole
+	// mutex to protect the role cache
+	roleMux sync.Mutex
 }
 
 func (svc *StateService) Delete(ctx clidone.ServiceContext, args *stateapi.DeleteArgs) (err error) {
-	bucket := svc.store.GetBucket(ctx.SenderID)
+	bucketID, err := svc.getBucketID(ctx.SenderID, args.Bucket, true)
+	if err != nil {
+		return err
+	}
+	bucket := svc.store.GetBucket(bucketID)
 	err = bucket.Delete(args.Key)
 	_ = bucket.Close()
+	if err == nil {
+		svc.notifyChange(bucketID, args.Bucket, args.Key, true)
+	}
 	return err
 }
 
 func (svc *StateService) Get(ctx clidone.ServiceContext, args *stateapi.GetArgs) (resp *stateapi.GetResp, err error) {
-	bucket := svc.store.GetBucket(ctx.SenderID)
+	bucketID, err := svc.getBucketID(ctx.SenderID, args.Bucket, false)
+	if err != nil {
+		return nil, err
+	}
+	bucket := svc.store.GetBucket(bucketID)
 	value, err := bucket.Get(args.Key)
 	// bucket returns an error if key is not found.
 	found := err == nil
@@ -38,17 +75,18 @@ func (svc *StateService) Get(ctx clidone.ServiceContext, args *stateapi.GetArgs)
 		Found: found,
 		Value: string(value)}
 
-	err2 := bucket.Close()
-	if err == nil {
-		err = err2
-	}
+	err = bucket.Close()
 	return resp, err
 }
 
 func (svc *StateService) GetMultiple(
 	ctx clidone.ServiceContext, args *stateapi.GetMultipleArgs) (resp *stateapi.GetMultipleResp, err error) {
 
-	bucket := svc.store.GetBucket(ctx.SenderID)
+	bucketID, err := svc.getBucketID(ctx.SenderID, args.Bucket, false)
+	if err != nil {
+		return nil, err
+	}
+	bucket := svc.store.GetBucket(bucketID)
 	kvbyte, _ := bucket.GetMultiple(args.Keys)
 	err = bucket.Close()
 	// convert values back to string
@@ -61,34 +99,145 @@ func (svc *StateService) GetMultiple(
 	return resp, err
 }
 
+// notifyChange notifies the clients that watch the key of a change.
+// The notification is sent to the inbox of each watching client, with the bucketID
+// as the thingID. Watches whose lease has expired are removed.
+//
+//	bucketID is the storage ID of the bucket
+//	bucketName is the name of the shared bucket or "" for a client's own bucket
+func (svc *StateService) notifyChange(bucketID string, bucketName string, key string, deleted bool) {
+	now := time.Now()
+	clientIDs := make(map[string]bool)
+	svc.mux.Lock()
+	prefixes := svc.watches[bucketID]
+	for prefix, watchers := range prefixes {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		for watcher, expiry := range watchers {
+			if now.After(expiry) {
+				delete(watchers, watcher)
+			} else {
+				clientIDs[watcher.clientID] = true
+			}
+		}
+		if len(watchers) == 0 {
+			delete(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		delete(svc.watches, bucketID)
+	}
+	svc.mux.Unlock()
+
+	if len(clientIDs) == 0 {
+		return
+	}
+	msg := stateapi.StateChangedMsg{Bucket: bucketName, Key: key, Deleted: deleted}
+	payload, _ := ser.Marshal(&msg)
+	for clientID := range clientIDs {
+		err := svc.hc.PubNotification(clientID, bucketID, stateapi.StateChangedEvent, payload)
+		if err != nil {
+			slog.Warn("notifyChange; failed sending change notification",
+				slog.String("clientID", clientID),
+				slog.String("bucketID", bucketID), slog.String("err", err.Error()))
+		}
+	}
+}
+
 func (svc *StateService) Set(
 	ctx clidone.ServiceContext, args *stateapi.SetArgs) (err error) {
 	slog.Info("Set", slog.String("key", args.Key))
-	bucket := svc.store.GetBucket(ctx.SenderID)
+	bucketID, err := svc.getBucketID(ctx.SenderID, args.Bucket, true)
+	if err != nil {
+		return err
+	}
+	bucket := svc.store.GetBucket(bucketID)
 	// bucket returns an error if key is invalid
 	err = bucket.Set(args.Key, []byte(args.Value))
 	if err != nil {
 		slog.Warn("Set; Invalid key", slog.String("key", args.Key))
 	}
 	_ = bucket.Close()
+	if err == nil {
+		svc.notifyChange(bucketID, args.Bucket, args.Key, false)
+	}
 	return err
 }
 
 func (svc *StateService) SetMultiple(
 	ctx clidone.ServiceContext, args *stateapi.SetMultipleArgs) (err error) {
 	slog.Info("SetMultiple", slog.Int("count", len(args.KV)))
+	bucketID, err := svc.getBucketID(ctx.SenderID, args.Bucket, true)
+	if err != nil {
+		return err
+	}
 	// convert to string :(
 	storage := make(map[string][]byte)
 	for k, v := range args.KV {
 		storage[k] = []byte(v)
 	}
 
-	bucket := svc.store.GetBucket(ctx.SenderID)
+	bucket := svc.store.GetBucket(bucketID)
 	err = bucket.SetMultiple(storage)
 	_ = bucket.Close()
+	if err == nil {
+		for k := range args.KV {
+			svc.notifyChange(bucketID, args.Bucket, k, false)
+		}
+	}
 	return err
 }
 
+// Unwatch removes a watched key prefix of a client's watcher
+func (svc *StateService) Unwatch(
+	ctx clidone.ServiceContext, args *stateapi.UnwatchArgs) (err error) {
+	bucketID, err := svc.getBucketID(ctx.SenderID, args.Bucket, false)
+	if err != nil {
+		return err
+	}
+	svc.mux.Lock()
+	defer svc.mux.Unlock()
+	prefixes := svc.watches[bucketID]
+	watchers := prefixes[args.Prefix]
+	delete(watchers, stateWatcher{clientID: ctx.SenderID, watcherID: args.WatcherID})
+	if len(watchers) == 0 {
+		delete(prefixes, args.Prefix)
+	}
+	if len(prefixes) == 0 {
+		delete(svc.watches, bucketID)
+	}
+	return nil
+}
+
+// Watch adds or renews a watch of a key prefix of a bucket.
+// The watch expires after stateapi.WatchLeaseSec unless it is renewed.
+// Watching a shared bucket requires read access to the bucket.
+func (svc *StateService) Watch(
+	ctx clidone.ServiceContext, args *stateapi.WatchArgs) (err error) {
+	slog.Info("Watch", slog.String("clientID", ctx.SenderID),
+		slog.String("bucket", args.Bucket), slog.String("prefix", args.Prefix))
+	bucketID, err := svc.getBucketID(ctx.SenderID, args.Bucket, false)
+	if err != nil {
+		return err
+	}
+	svc.mux.Lock()
+	defer svc.mux.Unlock()
+	prefixes := svc.watches[bucketID]
+	if prefixes == nil {
+		prefixes = make(map[string]map[stateWatcher]time.Time)
+		svc.watches[bucketID] = prefixes
+	}
+	watchers := prefixes[args.Prefix]
+	if watchers == nil {
+		watchers = make(map[stateWatcher]time.Time)
+		prefixes[args.Prefix] = watchers
+	}
+	watcher := stateWatcher{clientID: ctx.SenderID, watcherID: args.WatcherID}
+	watchers[watcher] = time.Now().Add(time.Second * stateapi.WatchLeaseSec)
+	return nil
+}
+
 // Start the service
 // This sets the permission for roles (any) that can use the state store and opens the store
 func (svc *StateService) Start(hc *clidone.HubClient) (err error) {
@@ -110,7 +259,16 @@ func (svc *StateService) Start(hc *clidone.HubClient) (err error) {
 	if err != nil {
 		return err
 	}
+	// only administrators can manage shared buckets
+	err = serviceProfile.SetServicePermissions(stateapi.ManageBucketsCap, []string{
+		authapi.ClientRoleAdmin})
+	if err != nil {
+		return err
+	}
 	err = svc.store.Open()
+	if err == nil {
+		err = svc.loadSharedBuckets()
+	}
 
 	if err == nil {
 		// register the handler
@@ -121,6 +279,14 @@ func (svc *StateService) Start(hc *clidone.HubClient) (err error) {
 				stateapi.GetMultipleMethod: svc.GetMultiple,
 				stateapi.SetMethod:         svc.Set,
 				stateapi.SetMultipleMethod: svc.SetMultiple,
+				stateapi.UnwatchMethod:     svc.Unwatch,
+				stateapi.WatchMethod:       svc.Watch,
+			})
+		svc.hc.SetRPCCapability(stateapi.ManageBucketsCap,
+			map[string]interface{}{
+				stateapi.GetSharedBucketsMethod:   svc.GetSharedBuckets,
+				stateapi.RemoveSharedBucketMethod: svc.RemoveSharedBucket,
+				stateapi.SetSharedBucketMethod:    svc.SetSharedBucket,
 			})
 	}
 
@@ -137,7 +303,10 @@ func (svc *StateService) Stop() {
 func NewStateService(storeDir string) *StateService {
 
 	svc := &StateService{
-		storeDir: storeDir,
+		storeDir:      storeDir,
+		watches:       make(map[string]map[string]map[stateWatcher]time.Time),
+		sharedBuckets: make(map[string]stateapi.SharedBucket),
+		roleCache:     make(map[string]cachedRole),
 	}
 
 	return svc
@@ -0,0 +1,204 @@
+package statesrv_test
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	stateapi "github.com/hiveot/hub/done_mod/mod_state/state_api"
+	statecli "github.com/hiveot/hub/done_mod/mod_state/state_cli"
+	statesrv "github.com/hiveot/hub/done_mod/mod_state/state_srv"
+	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/plugin"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/hiveot/hub/done_tool/things"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startState starts the test hub and the state service
+func startState(t *testing.T) (ts *testenv.TestServer, stopFn func()) {
+	logging.SetLogging("warning", "")
+	return testenv.StartTestService(t, stateapi.ServiceName, func(ts *testenv.TestServer) plugin.IPlugin {
+		return statesrv.NewStateService(path.Join(ts.TestDir, "stores", stateapi.ServiceName))
+	})
+}
+
+// Clients read and write records in their own bucket
+func TestSetGetDelete(t *testing.T) {
+	ts, stopFn := startState(t)
+	defer stopFn()
+
+	user1, err := ts.AddConnectUser("user1", authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	defer user1.Disconnect()
+	user2, err := ts.AddConnectUser("user2", authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	defer user2.Disconnect()
+
+	type record struct {
+		Name string
+	}
+	cl1 := statecli.NewStateClient(user1)
+	err = cl1.Set("key1", record{Name: "value1"})
+	require.NoError(t, err)
+
+	var rec record
+	found, err := cl1.Get("key1", &rec)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "value1", rec.Name)
+
+	// buckets are private to the client
+	found, err = statecli.NewStateClient(user2).Get("key1", &rec)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	err = cl1.SetMultiple(map[string]string{"key2": `"value2"`, "key3": `"value3"`})
+	require.NoError(t, err)
+	kv, err := cl1.GetMultiple([]string{"key2", "key3", "key4"})
+	require.NoError(t, err)
+	assert.Len(t, kv, 2)
+
+	err = cl1.Delete("key1")
+	require.NoError(t, err)
+	found, err = cl1.Get("key1", &rec)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+// Shared buckets are accessible by role and notify watchers of changes
+func TestSharedBucketWatch(t *testing.T) {
+	const bucketName = "shared1"
+	ts, stopFn := startState(t)
+	defer stopFn()
+
+	admin, err := ts.AddConnectUser("admin1", authapi.ClientRoleAdmin)
+	require.NoError(t, err)
+	defer admin.Disconnect()
+	viewer, err := ts.AddConnectUser("viewer1", authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	defer viewer.Disconnect()
+
+	err = statecli.NewManageBucketsClient(admin).SetSharedBucket(bucketName,
+		[]string{authapi.ClientRoleViewer}, []string{authapi.ClientRoleAdmin})
+	require.NoError(t, err)
+
+	// the viewer watches the bucket
+	changes := make(chan stateapi.StateChangedMsg, 1)
+	viewerCl := statecli.NewSharedStateClient(viewer, bucketName)
+	viewer.SetEventHandler(func(msg *things.ThingValue) {
+		viewerCl.HandleEvent(msg)
+	})
+	err = viewerCl.Watch("", func(msg stateapi.StateChangedMsg) {
+		changes <- msg
+	})
+	require.NoError(t, err)
+
+	adminCl := statecli.NewSharedStateClient(admin, bucketName)
+	err = adminCl.Set("key1", "value1")
+	require.NoError(t, err)
+	select {
+	case msg := <-changes:
+		assert.Equal(t, "key1", msg.Key)
+	case <-time.After(time.Second):
+		assert.Fail(t, "no change notification received")
+	}
+	var value string
+	found, err := viewerCl.Get("key1", &value)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "value1", value)
+
+	// viewers can't write to the bucket
+	err = viewerCl.Set("key2", "value2")
+	assert.Error(t, err)
+}
+
+// Watches are private to the client and independent for each of its connections
+func TestWatchPerConnection(t *testing.T) {
+	ts, stopFn := startState(t)
+	defer stopFn()
+
+	// two connections of the same user, eg two browser tabs
+	kp, token, err := ts.AddClient(authapi.ClientTypeUser, "user1", authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	user1a := clidone.NewHubClient(ts.ServerURL, "user1", ts.CaCert)
+	err = user1a.ConnectWithToken(kp, token)
+	require.NoError(t, err)
+	defer user1a.Disconnect()
+	user1b := clidone.NewHubClient(ts.ServerURL, "user1", ts.CaCert)
+	err = user1b.ConnectWithToken(kp, token)
+	require.NoError(t, err)
+	defer user1b.Disconnect()
+
+	// another viewer listens to all events
+	user2, err := ts.AddConnectUser("user2", authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	defer user2.Disconnect()
+	eavesdropped := make(chan *things.ThingValue, 10)
+	user2.SetEventHandler(func(msg *things.ThingValue) {
+		eavesdropped <- msg
+	})
+	err = user2.SubEvents("", "", "")
+	require.NoError(t, err)
+
+	watch := func(hc *clidone.HubClient) (*statecli.StateClient, chan stateapi.StateChangedMsg) {
+		changes := make(chan stateapi.StateChangedMsg, 10)
+		cl := statecli.NewStateClient(hc)
+		hc.SetEventHandler(func(msg *things.ThingValue) {
+			cl.HandleEvent(msg)
+		})
+		err := cl.Watch("key", func(msg stateapi.StateChangedMsg) {
+			changes <- msg
+		})
+		require.NoError(t, err)
+		return cl, changes
+	}
+	cla, changesA := watch(user1a)
+	clb, changesB := watch(user1b)
+
+	err = cla.Set("key1", "value1")
+	require.NoError(t, err)
+	for _, changes := range []chan stateapi.StateChangedMsg{changesA, changesB} {
+		select {
+		case msg := <-changes:
+			assert.Equal(t, "key1", msg.Key)
+		case <-time.After(time.Second):
+			assert.Fail(t, "no change notification received")
+		}
+	}
+
+	// unwatch by one connection doesn't affect the other
+	err = cla.Unwatch("key")
+	require.NoError(t, err)
+	err = clb.Set("key2", "value2")
+	require.NoError(t, err)
+	select {
+	case msg := <-changesB:
+		assert.Equal(t, "key2", msg.Key)
+	case <-time.After(time.Second):
+		assert.Fail(t, "no change notification received after unwatch of other connection")
+	}
+	assert.Len(t, changesA, 0)
+
+	// other clients don't see the changes
+	time.Sleep(time.Millisecond * 10)
+	assert.Len(t, eavesdropped, 0)
+}
+
+// Client IDs that collide with shared buckets can't use their own bucket
+func TestReservedClientID(t *testing.T) {
+	ts, stopFn := startState(t)
+	defer stopFn()
+
+	user1, err := ts.AddConnectUser(stateapi.SharedBucketPrefix+stateapi.DefaultSharedBucket,
+		authapi.ClientRoleViewer)
+	require.NoError(t, err)
+	defer user1.Disconnect()
+
+	err = statecli.NewStateClient(user1).Set("key1", "value1")
+	assert.Error(t, err)
+}
@@ -1,5 +1,6 @@
 // List of web components used in this project
 // import "../static/hyperscript.org@0.9.12.js"
+import "../webcomp/h-bind.js";
 import "../webcomp/h-brand.js";
 import "../webcomp/h-dark-toggle.js";
 import "../webcomp/h-device-icon.js";
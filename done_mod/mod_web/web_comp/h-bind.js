@@ -0,0 +1,57 @@
+/* h-bind
+ * Data binding of thing values that are received through the SSE stream.
+ *
+ * The server sends a 'thingValue' SSE event for each event or property value
+ * with a JSON payload (see websession.SSEThingValue):
+ *   {"agentID", "thingID", "name", "value", "data", "updated", "senderID"}
+ *
+ * Elements bind to a value using its address "{agentID}/{thingID}/{name}".
+ * Bound elements are updated in place, so the page layout, including the open state
+ * of details, is preserved.
+ *
+ * Usage:
+ *   HTMX: <div sse-swap="thingValue" hx-swap="none"></div>  (once, in the sse-connect element)
+ *   <span data-bind-value="{addr}"></span>      replace the text with the formatted value
+ *   <div data-bind-updated="{addr}"></div>      replace the text with the updated time
+ *   <div data-bind-reload="{addr}" hx-trigger="bind-reload" hx-get="...">
+ *                                               reload the fragment when the value changes
+ */
+const THING_VALUE_EVENT = "thingValue"
+const BIND_VALUE = "data-bind-value"
+const BIND_UPDATED = "data-bind-updated"
+const BIND_RELOAD = "data-bind-reload"
+const RELOAD_EVENT = "bind-reload"
+
+// return all elements whose bind attribute has the given value address
+const findBound = (attr, addr) => {
+    return document.querySelectorAll("[" + attr + "=\"" + CSS.escape(addr) + "\"]")
+}
+
+// onThingValue updates the elements bound to the value in the sse message
+const onThingValue = (ev) => {
+    let msg = ev.detail
+    if (!msg || msg.type !== THING_VALUE_EVENT) {
+        return
+    }
+    let tv
+    try {
+        tv = JSON.parse(msg.data)
+    } catch (e) {
+        console.error("h-bind: invalid thingValue payload:", msg.data, e)
+        return
+    }
+    let addr = tv.agentID + "/" + tv.thingID + "/" + tv.name
+    findBound(BIND_VALUE, addr).forEach((el) => {
+        el.textContent = tv.value
+    })
+    findBound(BIND_UPDATED, addr).forEach((el) => {
+        el.textContent = tv.updated
+        el.title = "Updated: " + tv.updated + " by " + tv.senderID
+    })
+    findBound(BIND_RELOAD, addr).forEach((el) => {
+        htmx.trigger(el, RELOAD_EVENT)
+    })
+}
+
+// sse.js triggers htmx:sseMessage on each received message, which bubbles up to the document
+document.addEventListener("htmx:sseMessage", onThingValue)
@@ -9,6 +9,10 @@ import (
 
 	clidone "github.com/hiveot/hub/done_cli/cli_done"
 	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	authcli "github.com/hiveot/hub/done_mod/mod_auth/auth_cli"
+	provapi "github.com/hiveot/hub/done_mod/mod_prov/prov_api"
+	stateapi "github.com/hiveot/hub/done_mod/mod_state/state_api"
 	statecli "github.com/hiveot/hub/done_mod/mod_state/state_cli"
 	"github.com/hiveot/hub/done_tool/things"
 )
@@ -18,6 +22,27 @@ type SSEEvent struct {
 	Payload string
 }
 
+// ThingValueEvent is the name of the SSE event that carries a SSEThingValue payload
+const ThingValueEvent = "thingValue"
+
+// SSEThingValue is the JSON payload of a ThingValueEvent SSE event.
+// It holds a single event or property value. Elements in the browser bind to the
+// value using its address "{agentID}/{thingID}/{name}", see web_comp/h-bind.js.
+type SSEThingValue struct {
+	AgentID string `json:"agentID"`
+	ThingID string `json:"thingID"`
+	// Name of the event or property
+	Name string `json:"name"`
+	// Value formatted using the TD schema, without unit
+	Value string `json:"value"`
+	// Data is the value as published
+	Data string `json:"data"`
+	// Updated is the time the value was created, formatted for presentation
+	Updated string `json:"updated"`
+	// SenderID is the client that published the value
+	SenderID string `json:"senderID"`
+}
+
 // DefaultExpiryHours TODO: set default expiry in config
 const DefaultExpiryHours = 72
 
@@ -31,6 +56,8 @@ type ClientSession struct {
 
 	// ClientID is the login ID of the user
 	clientID string
+	// role of the user, used to show the administration pages. Guarded by mux.
+	role string
 	// RemoteAddr of the user
 	remoteAddr string
 
@@ -38,6 +65,10 @@ type ClientSession struct {
 
 	// The associated hub client for pub/sub
 	hc *clidone.HubClient
+	// state client used to watch for changes to the client model by other sessions
+	stateCl *statecli.StateClient
+	// TDs of things whose values are sent to the browser, used for formatting
+	tdCache *TDCache
 	// session mutex for updating sse and activity
 	mux sync.RWMutex
 
@@ -81,22 +112,58 @@ func (cs *ClientSession) Close() {
 //	 * connecting or disconnected when not connected
 //	info with a human description
 func (cs *ClientSession) GetStatus() transport.HubTransportStatus {
-	status := cs.hc.GetStatus()
+	status := cs.GetHubClient().GetStatus()
 	return status
 }
 
+// GetDashboard returns the dashboard definition with the given name from the
+// client model. This returns an empty dashboard if the name is not defined.
+func (cs *ClientSession) GetDashboard(name string) DashboardDefinition {
+	cs.mux.RLock()
+	defer cs.mux.RUnlock()
+	for _, d := range cs.clientModel.Dashboard {
+		if d.Name == name {
+			return d
+		}
+	}
+	return DashboardDefinition{Name: name, Tiles: make([]DashboardTile, 0)}
+}
+
 // GetHubClient returns the hub client connection for use in pub/sub
 func (cs *ClientSession) GetHubClient() *clidone.HubClient {
+	cs.mux.RLock()
+	defer cs.mux.RUnlock()
 	return cs.hc
 }
 
+// GetRole returns the role of the user of this session
+func (cs *ClientSession) GetRole() string {
+	cs.mux.RLock()
+	defer cs.mux.RUnlock()
+	return cs.role
+}
+
+// GetTD returns the cached TD of a thing, for formatting its values.
+// This returns an empty TD if the TD is not available.
+func (cs *ClientSession) GetTD(agentID, thingID string) *things.TD {
+	cs.mux.RLock()
+	tdCache := cs.tdCache
+	cs.mux.RUnlock()
+	return tdCache.Get(agentID, thingID)
+}
+
 // IsActive returns whether the session has a connection to the Hub or is in the process of connecting.
 func (cs *ClientSession) IsActive() bool {
-	status := cs.hc.GetStatus()
+	status := cs.GetHubClient().GetStatus()
 	return status.ConnectionStatus == transport.Connected ||
 		status.ConnectionStatus == transport.Connecting
 }
 
+// IsAdmin returns true if the user of this session has the administrator role
+func (cs *ClientSession) IsAdmin() bool {
+	return cs.GetRole() == authapi.ClientRoleAdmin
+}
+
 // onConnectChange is invoked on disconnect/reconnect
 func (cs *ClientSession) onConnectChange(stat transport.HubTransportStatus) {
 	slog.Info("connection change",
@@ -112,70 +179,129 @@ func (cs *ClientSession) onConnectChange(stat transport.HubTransportStatus) {
 }
 
 // onEvent passes incoming events from the Hub to the SSE client(s)
+//
+// TD events are sent as an SSE event named after the thing address. The UI that
+// displays the TD can use this as a trigger to reload its fragment:
+//
+//	hx-trigger="sse:{{.Thing.AgentID}}/{{.Thing.ThingID}}"
+//
+// Event and property values are sent as a ThingValueEvent SSE event. The h-bind
+// component updates the elements that are bound to the value address, without
+// reloading fragments. See SSEThingValue for details.
 func (cs *ClientSession) onEvent(msg *things.ThingValue) {
+	// the clients are replaced when the hub connection is replaced
 	cs.mux.RLock()
-	defer cs.mux.RUnlock()
-	// FIXME: HOW TO IMPLEMENT DATA BINDING WITH HTMX fragments?
-	// A: use alpine.js databinding. Include JS objects that the element binds to
-	//    and use sse events to trigger a reload of the object.
-	//
-	//    pro: * one and two-way data binding provided by Alpine
-	//    con: * risk duplicating server/client state
-	//         * dependent on the Alpine-js kitchen sink
-	//
-	// B: use sse event to reload data associated fragments.
-	//    (one event can affect multiple fragments)
-	//
-	//    pro: * isolation between data updates and fragment reload (separation of concerns)
-	//         * support 1-many relationship for data-fragments
-	//    con: * have to manually manage many fragments and event names
-	//         * all fragments must have unique IDs
-	//         * fragment reloads can cause unintended side effects like layout changes.
-	//           for example the open/close state of a 'details' element is reset after reload.
-	//
-	// Q: is there a need for client side state to bind to?
-	// Q: does htmx has an extension to facilitate data binding?
-	//		hx-trigger="customers from:body" ??? how to trigger specific TD ID?
-	//      ? hx-trigger="sse:<thingID>" could this work?
-
+	stateCl := cs.stateCl
+	tdCache := cs.tdCache
+	cs.mux.RUnlock()
+	if stateCl.HandleEvent(msg) {
+		return
+	}
 	slog.Info("received event", slog.String("thingID", msg.ThingID),
 		slog.String("id", msg.Name))
 	if msg.Name == transport.EventNameTD {
-		// Publish sse event indicating the Thing TD has changed.
-		// The UI that displays this event can use this as a trigger to reload the
-		// fragment that displays this TD:
-		//    hx-trigger="sse:{{.Thing.AgentID}}/{{.Thing.ThingID}}"
+		// values are formatted using the new TD
+		tdCache.Remove(msg.AgentID, msg.ThingID)
 		thingAddr := fmt.Sprintf("%s/%s", msg.AgentID, msg.ThingID)
 		_ = cs.SendSSE(thingAddr, "")
 	} else if msg.Name == transport.EventNameProps {
-		// Publish an sse event for each of the properties
-		// The UI that displays this event can use this as a trigger to load the
-		// property value:
-		//    hx-trigger="sse:{{.Thing.AgentID}}/{{.Thing.ThingID}}/{{k}}"
+		// send a value event for each of the properties
 		props := make(map[string]string)
 		err := json.Unmarshal(msg.Data, &props)
 		if err == nil {
+			td := tdCache.Get(msg.AgentID, msg.ThingID)
 			for k, v := range props {
-				thingAddr := fmt.Sprintf("%s/%s/%s", msg.AgentID, msg.ThingID, k)
-				_ = cs.SendSSE(thingAddr, v)
-				thingAddr = fmt.Sprintf("%s/%s/%s/updated", msg.AgentID, msg.ThingID, k)
-				_ = cs.SendSSE(thingAddr, msg.GetUpdated())
+				propValue := *msg
+				propValue.Name = k
+				propValue.Data = []byte(v)
+				cs.sendThingValue(td, &propValue)
 			}
 		}
+	} else if msg.ValueType == transport.MessageTypeINBOX {
+		if msg.SenderID == provapi.ServiceName && msg.Name == provapi.RequestPendingEvent {
+			// notify administrators of a new provisioning request
+			status := provapi.ProvisionStatus{}
+			_ = json.Unmarshal(msg.Data, &status)
+			_ = cs.SendSSE("notify", fmt.Sprintf(
+				"info:Device '%s' requests provisioning", status.ClientID))
+			// trigger a reload of the provisioning page, which binds to the service address
+			pending := *msg
+			pending.AgentID = provapi.ServiceName
+			pending.Data = nil
+			cs.sendThingValue(nil, &pending)
+		}
 	} else {
-		// Publish sse event indicating the event affordance or value has changed.
-		// The UI that displays this event can use this as a trigger to reload the
-		// fragment that displays this event:
-		//    hx-trigger="sse:{{.Thing.AgentID}}/{{.Thing.ThingID}}/{{$k}}"
-		// where $k is the event ID
-		thingAddr := fmt.Sprintf("%s/%s/%s", msg.AgentID, msg.ThingID, msg.Name)
-		_ = cs.SendSSE(thingAddr, string(msg.Data))
-		// TODO: improve on this crude way to update the 'updated' field
-		// Can the value contain an object with a value and updated field instead?
-		// htmx sse-swap does allow cherry picking the content unfortunately.
-		thingAddr = fmt.Sprintf("%s/%s/%s/updated", msg.AgentID, msg.ThingID, msg.Name)
-		_ = cs.SendSSE(thingAddr, msg.GetUpdated())
+		td := tdCache.Get(msg.AgentID, msg.ThingID)
+		cs.sendThingValue(td, msg)
+	}
+}
+
+// sendThingValue sends a ThingValueEvent SSE event with the value formatted using the TD
+// The value is sent as-is if td is nil.
+func (cs *ClientSession) sendThingValue(td *things.TD, tv *things.ThingValue) {
+	value := string(tv.Data)
+	if td != nil {
+		if schema := td.GetValueSchema(tv.Name); schema != nil {
+			value = schema.FormatValue(tv.Data)
+		}
+	}
+	payload, _ := json.Marshal(SSEThingValue{
+		AgentID:  tv.AgentID,
+		ThingID:  tv.ThingID,
+		Name:     tv.Name,
+		Value:    value,
+		Data:     string(tv.Data),
+		Updated:  tv.GetUpdated(),
+		SenderID: tv.SenderID,
+	})
+	_ = cs.SendSSE(ThingValueEvent, string(payload))
+}
+
+// ClientModelKeySep separates the clientID from the name of the client model key.
+// This prevents watching the client's model from matching other keys that start
+// with the clientID.
+const ClientModelKeySep = "/"
+
+// clientModelKey returns the state key under which the client's data model is stored
+func clientModelKey(clientID string) string {
+	return clientID + ClientModelKeySep + "model"
+}
+
+// loadRole reads the role of the user from the auth service
+func (cs *ClientSession) loadRole() {
+	hc := cs.GetHubClient()
+	profile, err := authcli.NewProfileClient(hc).GetProfile()
+	if err != nil {
+		slog.Warn("loadRole; failed reading the client profile",
+			slog.String("clientID", cs.clientID), slog.String("err", err.Error()))
+		return
 	}
+	cs.mux.Lock()
+	cs.role = profile.Role
+	cs.mux.Unlock()
+	if profile.Role == authapi.ClientRoleAdmin {
+		// administrators are notified of provisioning requests
+		_ = hc.SubNotifications(provapi.ManageProvisioningCap, provapi.RequestPendingEvent)
+	}
+}
+
+// onStateChanged reloads the client model after it was changed by another session
+func (cs *ClientSession) onStateChanged(msg stateapi.StateChangedMsg) {
+	clientModel := ClientModel{}
+	if !msg.Deleted {
+		cs.mux.RLock()
+		stateCl := cs.stateCl
+		cs.mux.RUnlock()
+		_, err := stateCl.Get(msg.Key, &clientModel)
+		if err != nil {
+			slog.Warn("onStateChanged; failed reloading client model",
+				slog.String("clientID", cs.clientID), slog.String("err", err.Error()))
+			return
+		}
+	}
+	cs.mux.Lock()
+	cs.clientModel = clientModel
+	cs.mux.Unlock()
 }
 
 func (cs *ClientSession) RemoveSSEClient(c chan SSEEvent) {
@@ -191,22 +317,35 @@ func (cs *ClientSession) RemoveSSEClient(c chan SSEEvent) {
 }
 
 // ReplaceHubClient replaces this session's hub client
+// The clients are swapped under the session lock as events of the old connection
+// can still be handled.
 func (cs *ClientSession) ReplaceHubClient(newHC *clidone.HubClient) {
+	stateCl := statecli.NewStateClient(newHC)
+	cs.mux.Lock()
+	oldHC := cs.hc
+	cs.hc = newHC
+	cs.stateCl = stateCl
+	cs.tdCache = NewTDCache(newHC)
+	cs.mux.Unlock()
 	// ensure the old client is disconnected
-	if cs.hc != nil {
-		cs.hc.Disconnect()
-		cs.hc.SetEventHandler(nil)
-		cs.hc.SetConnectionHandler(nil)
+	if oldHC != nil {
+		oldHC.Disconnect()
+		oldHC.SetEventHandler(nil)
+		oldHC.SetConnectionHandler(nil)
 	}
-	cs.hc = newHC
-	cs.hc.SetConnectionHandler(cs.onConnectChange)
-	cs.hc.SetEventHandler(cs.onEvent)
+	newHC.SetConnectionHandler(cs.onConnectChange)
+	newHC.SetEventHandler(cs.onEvent)
+	_ = stateCl.Watch(cs.clientID+ClientModelKeySep, cs.onStateChanged)
+	cs.loadRole()
 }
 
 // SaveState stores the current model to the server
 func (cs *ClientSession) SaveState() error {
-	stateCl := statecli.NewStateClient(cs.GetHubClient())
-	err := stateCl.Set(cs.clientID, &cs.clientModel)
+	cs.mux.RLock()
+	stateCl := cs.stateCl
+	clientModel := cs.clientModel
+	cs.mux.RUnlock()
+	err := stateCl.Set(clientModelKey(cs.clientID), &clientModel)
 	//if err != nil {
 	//	slog.Error("unable to save session state",
 	//		slog.String("clientID", cs.clientID),
@@ -242,15 +381,22 @@ func NewClientSession(sessionID string, hc *clidone.HubClient, remoteAddr string
 		// TODO: assess need for buffering
 		sseClients:   make([]chan SSEEvent, 0),
 		lastActivity: time.Now(),
+		stateCl:      statecli.NewStateClient(hc),
+		tdCache:      NewTDCache(hc),
 	}
 	hc.SetEventHandler(cs.onEvent)
 	hc.SetConnectionHandler(cs.onConnectChange)
 
-	// restore the session data model
-	stateCl := statecli.NewStateClient(hc)
-	found, err := stateCl.Get(hc.ClientID(), &cs.clientModel)
+	// restore the session data model and watch for changes by other sessions
+	found, err := cs.stateCl.Get(clientModelKey(cs.clientID), &cs.clientModel)
+	if err == nil && !found {
+		// models saved before the key had a separator are stored under the clientID
+		found, err = cs.stateCl.Get(cs.clientID, &cs.clientModel)
+	}
 	_ = found
 	_ = err
+	_ = cs.stateCl.Watch(cs.clientID+ClientModelKeySep, cs.onStateChanged)
+	cs.loadRole()
 	if len(cs.clientModel.Agents) > 0 {
 		for _, agent := range cs.clientModel.Agents {
 			// subscribe to TD and value events
@@ -78,3 +78,21 @@ func GetSessionFromContext(r *http.Request) (*ClientSession, error) {
 	}
 	return ctxSession.(*ClientSession), nil
 }
+
+// RequireAdmin middleware only passes requests of sessions with the administrator role.
+// This must be used after AddSessionToContext.
+func RequireAdmin() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cs, err := GetSessionFromContext(r)
+			if err != nil || !cs.IsAdmin() {
+				slog.Warn("RequireAdmin: request denied",
+					slog.String("remoteAddr", r.RemoteAddr),
+					slog.String("url", r.URL.String()))
+				http.Error(w, "administrator role required", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
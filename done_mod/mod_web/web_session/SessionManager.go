@@ -34,6 +34,9 @@ type SessionManager struct {
 
 	// keys to use for clients that have no public key set
 	tokenKP keys.IHiveKey
+
+	// service connection used to verify login passwords with the auth service
+	hc *clidone.HubClient
 }
 
 // ActivateNewSession (re)activates a new session for a newly connected hub client.
@@ -177,13 +180,28 @@ func (sm *SessionManager) GetSessionFromCookie(r *http.Request) (*ClientSession,
 //	signingKey for cookies
 //	caCert of the messaging server
 //	tokenKP optional keys to use for refreshing tokens of authenticated users
+//	hc optional service connection used to verify login passwords
 func (sm *SessionManager) Init(hubURL string,
 	signingKey *ecdsa.PrivateKey, caCert *x509.Certificate,
-	tokenKP keys.IHiveKey) {
+	tokenKP keys.IHiveKey, hc *clidone.HubClient) {
 	sm.hubURL = hubURL
 	sm.caCert = caCert
 	sm.signingKey = signingKey
 	sm.tokenKP = tokenKP
+	sm.hc = hc
+}
+
+// VerifyLogin verifies the login password with the auth service before connecting.
+// The auth service counts failed attempts per account and remote address and refuses
+// further attempts during a lockout.
+// If no service connection is set then this is skipped.
+func (sm *SessionManager) VerifyLogin(loginID string, password string, remoteAddr string) error {
+	if sm.hc == nil {
+		return nil
+	}
+	mngClients := authcli.NewManageClients(sm.hc)
+	err := mngClients.VerifyLogin(loginID, password, remoteAddr)
+	return err
 }
 
 // The global session manager instance.
@@ -0,0 +1,75 @@
+package websession
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	dircli "github.com/hiveot/hub/done_mod/mod_dir/dir_cli"
+	"github.com/hiveot/hub/done_tool/things"
+)
+
+// TDRetryInterval is the time after which a TD that could not be loaded is
+// requested again. This avoids a directory request for each value of an unknown
+// thing, while still picking up the TD once the directory has it.
+const TDRetryInterval = 30 * time.Second
+
+// cachedTD is a TD in the cache.
+type cachedTD struct {
+	td *things.TD
+	// expiry of an empty TD whose lookup failed. Zero for loaded TDs.
+	expiry time.Time
+}
+
+// TDCache holds the TDs of things whose values are sent to the browser.
+// TDs are loaded from the directory on first use and removed when the thing
+// publishes a new TD. Failed lookups are retried after TDRetryInterval.
+type TDCache struct {
+	hc  *clidone.HubClient
+	tds map[string]cachedTD
+	mux sync.RWMutex
+}
+
+// Get returns the TD of a thing, loading it from the directory if not cached.
+// This returns an empty TD if the TD is not available.
+func (c *TDCache) Get(agentID, thingID string) *things.TD {
+	thingAddr := agentID + "/" + thingID
+	c.mux.RLock()
+	entry, found := c.tds[thingAddr]
+	c.mux.RUnlock()
+	if found && (entry.expiry.IsZero() || time.Now().Before(entry.expiry)) {
+		return entry.td
+	}
+	entry = cachedTD{td: &things.TD{}}
+	tv, err := dircli.NewReadDirectoryClient(c.hc).GetTD(agentID, thingID)
+	if err == nil {
+		err = json.Unmarshal(tv.Data, entry.td)
+	}
+	if err != nil {
+		// the empty TD is only used until the retry interval has passed
+		slog.Warn("TDCache.Get; TD not available",
+			slog.String("thingAddr", thingAddr), slog.String("err", err.Error()))
+		entry = cachedTD{td: &things.TD{}, expiry: time.Now().Add(TDRetryInterval)}
+	}
+	c.mux.Lock()
+	c.tds[thingAddr] = entry
+	c.mux.Unlock()
+	return entry.td
+}
+
+// Remove the TD of a thing from the cache
+func (c *TDCache) Remove(agentID, thingID string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	delete(c.tds, agentID+"/"+thingID)
+}
+
+// NewTDCache creates a TD cache that loads TDs using the given hub connection
+func NewTDCache(hc *clidone.HubClient) *TDCache {
+	return &TDCache{
+		hc:  hc,
+		tds: make(map[string]cachedTD),
+	}
+}
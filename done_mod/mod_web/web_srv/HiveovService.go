@@ -25,6 +25,7 @@ import (
 	websession "github.com/hiveot/hub/done_mod/mod_web/web_session"
 	webview "github.com/hiveot/hub/done_mod/mod_web/web_view"
 	"github.com/hiveot/hub/done_mod/mod_web/web_view/about"
+	"github.com/hiveot/hub/done_mod/mod_web/web_view/admin"
 	"github.com/hiveot/hub/done_mod/mod_web/web_view/app"
 	"github.com/hiveot/hub/done_mod/mod_web/web_view/dashboard"
 	"github.com/hiveot/hub/done_mod/mod_web/web_view/directory"
@@ -123,7 +124,28 @@ func (svc *HiveovService) createRoutes(rootPath string) http.Handler {
 		r.Get("/app/thing/{agentID}/{thingID}", thing.RenderThingDetails)
 		r.Get("/app/thing/editConfig", thing.RenderEditThingConfig)
 		r.Post("/app/thing/{agentID}/{thingID}/{propKey}", thing.PostThingConfig)
+		r.Get("/app/thing/{agentID}/{thingID}/action/{actionKey}", thing.RenderActionRequest)
+		r.Post("/app/thing/{agentID}/{thingID}/action/{actionKey}", thing.PostActionRequest)
+		r.Get("/app/thing/{agentID}/{thingID}/history/{name}", thing.RenderHistory)
+		r.Get("/app/thing/{agentID}/{thingID}/history/{name}/data", thing.RenderHistoryData)
+		r.Get("/app/thing/{agentID}/{thingID}/history/{name}/csv", thing.DownloadHistoryCSV)
 		r.Get("/app/status", status.RenderStatus)
+
+		// administration pages are only available to administrators
+		r.Group(func(r chi.Router) {
+			r.Use(websession.RequireAdmin())
+			r.Get("/app/clients", admin.RenderClients)
+			r.Post("/app/clients", admin.PostAddClient)
+			r.Post("/app/clients/{clientID}/role", admin.PostClientRole)
+			r.Post("/app/clients/{clientID}/password", admin.PostClientPassword)
+			r.Delete("/app/clients/{clientID}", admin.DeleteClient)
+			r.Get("/app/provisioning", admin.RenderProvisioning)
+			r.Post("/app/provisioning/{clientID}/approve", admin.PostApproveRequest)
+			r.Post("/app/provisioning/{clientID}/reject", admin.PostRejectRequest)
+			r.Get("/app/plugins", admin.RenderPlugins)
+			r.Post("/app/plugins/{name}/start", admin.PostStartPlugin)
+			r.Post("/app/plugins/{name}/stop", admin.PostStopPlugin)
+		})
 	})
 
 	return router
@@ -170,7 +192,7 @@ func (svc *HiveovService) Start(hc *clidone.HubClient) error {
 	// Setup the handling of incoming web sessions
 	sm := websession.GetSessionManager()
 	connStat := hc.GetStatus()
-	sm.Init(connStat.HubURL, svc.signingKey, connStat.CaCert, svc.hc.ClientKP())
+	sm.Init(connStat.HubURL, svc.signingKey, connStat.CaCert, svc.hc.ClientKP(), svc.hc)
 
 	// parse the templates
 	svc.tm.ParseAllTemplates()
@@ -0,0 +1,189 @@
+package admin
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	authcli "github.com/hiveot/hub/done_mod/mod_auth/auth_cli"
+	websession "github.com/hiveot/hub/done_mod/mod_web/web_session"
+	"github.com/hiveot/hub/done_mod/mod_web/web_view/app"
+)
+
+const ClientsTemplate = "clients.gohtml"
+
+// UserRoles are the roles that can be assigned to users
+var UserRoles = []string{
+	authapi.ClientRoleViewer,
+	authapi.ClientRoleOperator,
+	authapi.ClientRoleManager,
+	authapi.ClientRoleAdmin,
+}
+
+// ClientTypes are the types of clients that can be added
+var ClientTypes = []string{
+	authapi.ClientTypeUser,
+	authapi.ClientTypeDevice,
+	authapi.ClientTypeService,
+}
+
+// ClientsTemplateData holds the data of the client management page
+type ClientsTemplateData struct {
+	// Clients sorted by type and ID
+	Clients     []authapi.ClientProfile
+	UserRoles   []string
+	ClientTypes []string
+	// NewClientID and NewToken hold the token issued to a newly added device or service
+	NewClientID string
+	NewToken    string
+}
+
+// renderClients renders the client management page with an optional newly issued token
+func renderClients(w http.ResponseWriter, r *http.Request, newClientID string, newToken string) {
+	data := make(map[string]any)
+	clientsData := ClientsTemplateData{
+		UserRoles:   UserRoles,
+		ClientTypes: ClientTypes,
+		NewClientID: newClientID,
+		NewToken:    newToken,
+	}
+	mySession, err := websession.GetSessionFromContext(r)
+	if err == nil {
+		mngClients := authcli.NewManageClients(mySession.GetHubClient())
+		clientsData.Clients, err = mngClients.GetProfiles()
+	}
+	if err != nil {
+		slog.Error("RenderClients: unable to load clients", slog.String("err", err.Error()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(clientsData.Clients, func(i, j int) bool {
+		c1 := clientsData.Clients[i]
+		c2 := clientsData.Clients[j]
+		return c1.ClientType+c1.ClientID < c2.ClientType+c2.ClientID
+	})
+	data["Clients"] = &clientsData
+	app.RenderAppOrFragment(w, r, ClientsTemplate, data)
+}
+
+// notifyResult notifies the browser of the result of an administration request
+// and logs the error if failed. This returns true if err is nil.
+//
+//	method is the name of the handler used in logging
+//	id of the client, request or plugin the request applies to
+func notifyResult(w http.ResponseWriter, r *http.Request, method string, id string, err error, success string) bool {
+	mySession, err2 := websession.GetSessionFromContext(r)
+	if err != nil {
+		slog.Warn(method+" failed",
+			slog.String("remoteAddr", r.RemoteAddr),
+			slog.String("id", id),
+			slog.String("err", err.Error()))
+		if err2 == nil {
+			// notify UI via SSE. This is handled by a toast component.
+			_ = mySession.SendSSE("notify", "error:"+err.Error())
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err2 == nil {
+		_ = mySession.SendSSE("notify", "success: "+success)
+	}
+	return true
+}
+
+// RenderClients renders the page for managing users, devices and services.
+func RenderClients(w http.ResponseWriter, r *http.Request) {
+	renderClients(w, r, "", "")
+}
+
+// PostAddClient adds a user, device or service.
+// Devices and services that are added with a public key receive a token which is shown once.
+// Form fields:
+// @param clientType is one of ClientTypes
+// @param clientID of the new client
+// @param displayName of the new client
+// @param role of a user
+// @param password of a user
+// @param pubKey optional public key of a device or service
+func PostAddClient(w http.ResponseWriter, r *http.Request) {
+	var token string
+	clientType := r.FormValue("clientType")
+	clientID := r.FormValue("clientID")
+	displayName := r.FormValue("displayName")
+	pubKey := r.FormValue("pubKey")
+
+	mySession, err := websession.GetSessionFromContext(r)
+	if err == nil {
+		mngClients := authcli.NewManageClients(mySession.GetHubClient())
+		switch clientType {
+		case authapi.ClientTypeDevice:
+			token, err = mngClients.AddDevice(clientID, displayName, pubKey)
+		case authapi.ClientTypeService:
+			token, err = mngClients.AddService(clientID, displayName, pubKey)
+		default:
+			// the token of a user is not needed as they login with their password
+			_, err = mngClients.AddUser(clientID, displayName,
+				r.FormValue("password"), "", r.FormValue("role"))
+		}
+	}
+	if notifyResult(w, r, "PostAddClient", clientID, err, "Added "+clientType+" '"+clientID+"'") {
+		renderClients(w, r, clientID, token)
+	}
+}
+
+// PostClientRole changes the role of a client.
+// URL parameters:
+// @param clientID of the client to update
+// Form fields:
+// @param role to assign
+func PostClientRole(w http.ResponseWriter, r *http.Request) {
+	clientID := chi.URLParam(r, "clientID")
+	role := r.FormValue("role")
+
+	mySession, err := websession.GetSessionFromContext(r)
+	if err == nil {
+		err = authcli.NewManageClients(mySession.GetHubClient()).UpdateClientRole(clientID, role)
+	}
+	if notifyResult(w, r, "PostClientRole", clientID, err, "Role of '"+clientID+"' changed to "+role) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// PostClientPassword resets the password of a user.
+// The new password is provided in the HX-Prompt header.
+// URL parameters:
+// @param clientID of the user
+func PostClientPassword(w http.ResponseWriter, r *http.Request) {
+	clientID := chi.URLParam(r, "clientID")
+	newPassword := r.Header.Get("HX-Prompt")
+
+	mySession, err := websession.GetSessionFromContext(r)
+	if err == nil && newPassword == "" {
+		err = errors.New("a new password is required")
+	}
+	if err == nil {
+		err = authcli.NewManageClients(mySession.GetHubClient()).SetClientPassword(clientID, newPassword)
+	}
+	if notifyResult(w, r, "PostClientPassword", clientID, err, "Password of '"+clientID+"' was reset") {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// DeleteClient removes a client and revokes its tokens.
+// URL parameters:
+// @param clientID of the client to remove
+func DeleteClient(w http.ResponseWriter, r *http.Request) {
+	clientID := chi.URLParam(r, "clientID")
+
+	mySession, err := websession.GetSessionFromContext(r)
+	if err == nil {
+		err = authcli.NewManageClients(mySession.GetHubClient()).RemoveClient(clientID)
+	}
+	if notifyResult(w, r, "DeleteClient", clientID, err, "Removed '"+clientID+"'") {
+		renderClients(w, r, "", "")
+	}
+}
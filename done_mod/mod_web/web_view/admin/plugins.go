@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	runapi "github.com/hiveot/hub/done_mod/mod_run/run_api"
+	runcli "github.com/hiveot/hub/done_mod/mod_run/run_cli"
+	websession "github.com/hiveot/hub/done_mod/mod_web/web_session"
+	"github.com/hiveot/hub/done_mod/mod_web/web_view/app"
+)
+
+const PluginsTemplate = "plugins.gohtml"
+
+// PluginsRefreshInterval is the interval in which the plugins page reloads itself
+const PluginsRefreshInterval = "10s"
+
+// PluginEntry is the status of a plugin for presentation
+type PluginEntry struct {
+	runapi.PluginInfo
+	// Memory usage in MB
+	Memory string
+	// Uptime as a duration, eg 1h2m3s
+	Uptime string
+	// Since is the formatted time the plugin was started or stopped
+	Since string
+}
+
+// PluginsTemplateData holds the data of the plugin manager page
+type PluginsTemplateData struct {
+	Plugins         []PluginEntry
+	RefreshInterval string
+}
+
+// RenderPlugins renders the page with the plugins of the launcher and their status.
+func RenderPlugins(w http.ResponseWriter, r *http.Request) {
+	var infoList []runapi.PluginInfo
+	data := make(map[string]any)
+
+	mySession, err := websession.GetSessionFromContext(r)
+	if err == nil {
+		infoList, err = runcli.NewLauncherClient("", mySession.GetHubClient()).List(false)
+	}
+	if err != nil {
+		slog.Error("RenderPlugins: unable to load plugins", slog.String("err", err.Error()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pluginsData := &PluginsTemplateData{
+		Plugins:         make([]PluginEntry, 0, len(infoList)),
+		RefreshInterval: PluginsRefreshInterval,
+	}
+	for _, info := range infoList {
+		entry := PluginEntry{
+			PluginInfo: info,
+			Memory:     fmt.Sprintf("%d MB", info.RSS/1024/1024),
+		}
+		if info.Running {
+			entry.Uptime = (time.Duration(info.Uptime) * time.Second).String()
+			entry.Since = time.UnixMilli(info.StartTimeMSE).Local().Format(time.RFC822)
+		} else if info.StopTimeMSE != 0 {
+			entry.Since = time.UnixMilli(info.StopTimeMSE).Local().Format(time.RFC822)
+		}
+		pluginsData.Plugins = append(pluginsData.Plugins, entry)
+	}
+	data["Plugins"] = pluginsData
+	app.RenderAppOrFragment(w, r, PluginsTemplate, data)
+}
+
+// PostStartPlugin starts a plugin.
+// URL parameters:
+// @param name of the plugin to start
+func PostStartPlugin(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	mySession, err := websession.GetSessionFromContext(r)
+	if err == nil {
+		_, err = runcli.NewLauncherClient("", mySession.GetHubClient()).StartPlugin(name)
+	}
+	if notifyResult(w, r, "PostStartPlugin", name, err, "Started plugin '"+name+"'") {
+		RenderPlugins(w, r)
+	}
+}
+
+// PostStopPlugin stops a running plugin.
+// URL parameters:
+// @param name of the plugin to stop
+func PostStopPlugin(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	mySession, err := websession.GetSessionFromContext(r)
+	if err == nil {
+		_, err = runcli.NewLauncherClient("", mySession.GetHubClient()).StopPlugin(name)
+	}
+	if notifyResult(w, r, "PostStopPlugin", name, err, "Stopped plugin '"+name+"'") {
+		RenderPlugins(w, r)
+	}
+}
@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	provapi "github.com/hiveot/hub/done_mod/mod_prov/prov_api"
+	provcli "github.com/hiveot/hub/done_mod/mod_prov/prov_cli"
+	websession "github.com/hiveot/hub/done_mod/mod_web/web_session"
+	"github.com/hiveot/hub/done_mod/mod_web/web_view/app"
+)
+
+const ProvisioningTemplate = "provisioning.gohtml"
+
+// ProvisioningRequest is a provisioning request for presentation
+type ProvisioningRequest struct {
+	provapi.ProvisionStatus
+	// Received is the formatted time the request was last received
+	Received string
+}
+
+// ProvisioningTemplateData holds the data of the provisioning page
+type ProvisioningTemplateData struct {
+	// Pending requests, newest first
+	Pending []ProvisioningRequest
+	// Approved requests, newest first
+	Approved []ProvisioningRequest
+	// ClientTypes that can be approved
+	ClientTypes []string
+	// PendingEvent is the address of the value event that is sent when a new request is received
+	PendingEvent string
+}
+
+// toRequests converts the provisioning status list to sorted requests for presentation
+func toRequests(statusList []provapi.ProvisionStatus) []ProvisioningRequest {
+	requests := make([]ProvisioningRequest, 0, len(statusList))
+	for _, status := range statusList {
+		received := time.UnixMilli(status.ReceivedMSE).Local()
+		requests = append(requests, ProvisioningRequest{
+			ProvisionStatus: status,
+			Received:        received.Format(time.RFC822),
+		})
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].ReceivedMSE > requests[j].ReceivedMSE
+	})
+	return requests
+}
+
+// RenderProvisioning renders the page with pending and approved provisioning requests.
+// The page reloads when a new request is received.
+func RenderProvisioning(w http.ResponseWriter, r *http.Request) {
+	var pending, approved []provapi.ProvisionStatus
+	data := make(map[string]any)
+
+	mySession, err := websession.GetSessionFromContext(r)
+	if err == nil {
+		provCl := provcli.NewIdProvManageClient(mySession.GetHubClient())
+		pending, err = provCl.GetRequests(true, false, false)
+		if err == nil {
+			approved, err = provCl.GetRequests(false, true, false)
+		}
+	}
+	if err != nil {
+		slog.Error("RenderProvisioning: unable to load requests", slog.String("err", err.Error()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data["Provisioning"] = &ProvisioningTemplateData{
+		Pending:     toRequests(pending),
+		Approved:    toRequests(approved),
+		ClientTypes: []string{authapi.ClientTypeDevice, authapi.ClientTypeService},
+		// the session passes events as {agentID}/{thingID}/{name}
+		PendingEvent: provapi.ServiceName + "/" + provapi.ManageProvisioningCap + "/" + provapi.RequestPendingEvent,
+	}
+	app.RenderAppOrFragment(w, r, ProvisioningTemplate, data)
+}
+
+// PostApproveRequest approves a pending provisioning request.
+// URL parameters:
+// @param clientID of the request to approve
+// Form fields:
+// @param clientType of the client, device or service
+func PostApproveRequest(w http.ResponseWriter, r *http.Request) {
+	clientID := chi.URLParam(r, "clientID")
+	clientType := r.FormValue("clientType")
+
+	mySession, err := websession.GetSessionFromContext(r)
+	if err == nil {
+		err = provcli.NewIdProvManageClient(mySession.GetHubClient()).ApproveRequest(clientID, clientType)
+	}
+	if notifyResult(w, r, "PostApproveRequest", clientID, err, "Approved '"+clientID+"'") {
+		RenderProvisioning(w, r)
+	}
+}
+
+// PostRejectRequest rejects a pending provisioning request.
+// URL parameters:
+// @param clientID of the request to reject
+func PostRejectRequest(w http.ResponseWriter, r *http.Request) {
+	clientID := chi.URLParam(r, "clientID")
+
+	mySession, err := websession.GetSessionFromContext(r)
+	if err == nil {
+		err = provcli.NewIdProvManageClient(mySession.GetHubClient()).RejectRequest(clientID)
+	}
+	if notifyResult(w, r, "PostRejectRequest", clientID, err, "Rejected '"+clientID+"'") {
+		RenderProvisioning(w, r)
+	}
+}
@@ -3,6 +3,7 @@ package app
 import (
 	"net/http"
 
+	websession "github.com/hiveot/hub/done_mod/mod_web/web_session"
 	webview "github.com/hiveot/hub/done_mod/mod_web/web_view"
 )
 
@@ -33,6 +34,9 @@ func RenderAppPages(w http.ResponseWriter, r *http.Request, data map[string]any)
 	}
 	GetAppHeadProps(data, "HiveOT", "/static/logo.svg")
 	data["Status"] = GetConnectStatus(r)
+	// administration pages are only shown to administrators
+	mySession, err := websession.GetSessionFromContext(r)
+	data["IsAdmin"] = err == nil && mySession.IsAdmin()
 
 	//render the full page base > app.html
 	webview.TM.RenderFull(w, AppTemplate, data)
@@ -1,15 +1,75 @@
 package dashboard
 
 import (
+	"log/slog"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	histcli "github.com/hiveot/hub/done_mod/mod_hist/hist_cli"
 	websession "github.com/hiveot/hub/done_mod/mod_web/web_session"
 	"github.com/hiveot/hub/done_mod/mod_web/web_view/app"
 )
 
 const DashboardTemplate = "dashboard.gohtml"
 
+// TileValue is the value of a tile source, formatted using the TD schema of the thing
+type TileValue struct {
+	// Address of the value "{agentID}/{thingID}/{name}" for binding to updates
+	Address string
+	// Title of the value from the TD
+	Title string
+	// Value formatted using the TD schema, without unit
+	Value string
+	// Unit symbol of the value
+	Unit string
+}
+
+// TileData is a dashboard tile with the latest values of its sources
+type TileData struct {
+	websession.DashboardTile
+	Values []TileValue
+}
+
+// DashboardData is the dashboard definition with the values of its tiles
+type DashboardData struct {
+	Name  string
+	Tiles []TileData
+}
+
+// getTileValues returns the latest values of the tile sources, formatted using the
+// TD of their thing. Sources whose value can't be read are shown without a value.
+func getTileValues(mySession *websession.ClientSession, tile websession.DashboardTile) []TileValue {
+	rh := histcli.NewReadHistoryClient(mySession.GetHubClient())
+	values := make([]TileValue, 0, len(tile.Sources))
+	for _, src := range tile.Sources {
+		tileValue := TileValue{
+			Address: src.AgentID + "/" + src.ThingID + "/" + src.PropertyName,
+			Title:   src.PropertyName,
+		}
+		latest, err := rh.GetLatest(src.AgentID, src.ThingID, []string{src.PropertyName})
+		if err != nil {
+			slog.Warn("getTileValues failed",
+				slog.String("address", tileValue.Address), slog.String("err", err.Error()))
+		}
+		tv := latest.Get(src.PropertyName)
+		if tv != nil {
+			tileValue.Value = string(tv.Data)
+		}
+		td := mySession.GetTD(src.AgentID, src.ThingID)
+		if schema := td.GetValueSchema(src.PropertyName); schema != nil {
+			if schema.Title != "" {
+				tileValue.Title = schema.Title
+			}
+			if tv != nil {
+				tileValue.Value = schema.FormatValue(tv.Data)
+			}
+			tileValue.Unit = schema.UnitSymbol()
+		}
+		values = append(values, tileValue)
+	}
+	return values
+}
+
 // RenderDashboard renders the dashboard page or fragment
 // This is intended for use from a htmx-get request with a target selector
 func RenderDashboard(w http.ResponseWriter, r *http.Request) {
@@ -20,13 +80,25 @@ func RenderDashboard(w http.ResponseWriter, r *http.Request) {
 		// when used without htmx there is no page, use the default page
 		pageName = "default"
 	}
-	// TODO: load the dashboard tile configuration for the page name
-	// use the session storage
-	tiles := make([]websession.DashboardTile, 0)
-	data["Dashboard"] = &websession.DashboardDefinition{
-		Name:  pageName, // or use the default
-		Tiles: tiles,
+	mySession, err := websession.GetSessionFromContext(r)
+	if err != nil {
+		slog.Info("failed getting session. Redirecting to login", "err", err.Error())
+		websession.SessionLogout(w, r)
+		return
+	}
+	// the dashboard tile configuration is stored in the client model
+	dashboard := mySession.GetDashboard(pageName)
+	dashData := &DashboardData{
+		Name:  dashboard.Name,
+		Tiles: make([]TileData, 0, len(dashboard.Tiles)),
+	}
+	for _, tile := range dashboard.Tiles {
+		dashData.Tiles = append(dashData.Tiles, TileData{
+			DashboardTile: tile,
+			Values:        getTileValues(mySession, tile),
+		})
 	}
+	data["Dashboard"] = dashData
 
 	// full render or fragment render
 	app.RenderAppOrFragment(w, r, DashboardTemplate, data)
@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"sort"
 
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
 	dircli "github.com/hiveot/hub/done_mod/mod_dir/dir_cli"
+	histcli "github.com/hiveot/hub/done_mod/mod_hist/hist_cli"
 	websession "github.com/hiveot/hub/done_mod/mod_web/web_session"
 	"github.com/hiveot/hub/done_mod/mod_web/web_view/app"
 	"github.com/hiveot/hub/done_tool/things"
@@ -17,7 +19,49 @@ const DirectoryTemplate = "directory.gohtml"
 
 type DirGroup struct {
 	AgentID string
-	Things  []*things.TD
+	Things  []*DirThing
+}
+
+// DirThing is a thing in the directory with its most recently updated value
+type DirThing struct {
+	*things.TD
+	// Latest is the name of the most recently updated event or property, if any
+	Latest string
+	// LatestTitle is the title of the latest value
+	LatestTitle string
+	// LatestValue is the latest value formatted using its schema
+	LatestValue string
+	// LatestUnit is the unit symbol of the latest value
+	LatestUnit string
+}
+
+// setLatest sets the most recently updated value of the thing, formatted using
+// its schema. The TD and properties events are not values of the thing.
+func (dt *DirThing) setLatest(values things.ThingValueMap) {
+	var latest *things.ThingValue
+	for _, tv := range values {
+		if tv.Name == transport.EventNameTD || tv.Name == transport.EventNameProps {
+			continue
+		}
+		if latest == nil || tv.CreatedMSec > latest.CreatedMSec {
+			latest = tv
+		}
+	}
+	if latest == nil {
+		return
+	}
+	dt.Latest = latest.Name
+	dt.LatestTitle = latest.Name
+	dt.LatestValue = string(latest.Data)
+	if ev := dt.GetEvent(latest.Name); ev != nil && ev.Title != "" {
+		dt.LatestTitle = ev.Title
+	} else if prop := dt.GetProperty(latest.Name); prop != nil && prop.Title != "" {
+		dt.LatestTitle = prop.Title
+	}
+	if schema := dt.GetValueSchema(latest.Name); schema != nil {
+		dt.LatestValue = schema.FormatValue(latest.Data)
+		dt.LatestUnit = schema.UnitSymbol()
+	}
 }
 
 type DirectoryData struct {
@@ -42,14 +86,14 @@ func sortByPublisher(tvList []things.ThingValue) *DirectoryData {
 		if !found {
 			tplGroup = &DirGroup{
 				AgentID: tv.SenderID,
-				Things:  make([]*things.TD, 0),
+				Things:  make([]*DirThing, 0),
 			}
 			dirData.Groups[tv.SenderID] = tplGroup
 		}
 		td := things.TD{}
 		err := json.Unmarshal(tv.Data, &td)
 		if err == nil {
-			tplGroup.Things = append(tplGroup.Things, &td)
+			tplGroup.Things = append(tplGroup.Things, &DirThing{TD: &td})
 			if len(tplGroup.Things) == 0 {
 				slog.Error("append failed")
 			}
@@ -58,6 +102,22 @@ func sortByPublisher(tvList []things.ThingValue) *DirectoryData {
 	return dirData
 }
 
+// loadLatestValues sets the latest value of each thing in the directory.
+// Things whose values can't be read are shown without a value.
+func loadLatestValues(rh *histcli.ReadHistoryClient, dirData *DirectoryData) {
+	for _, grp := range dirData.Groups {
+		for _, dt := range grp.Things {
+			values, err := rh.GetLatest(grp.AgentID, dt.ID, nil)
+			if err != nil {
+				slog.Warn("loadLatestValues failed",
+					slog.String("thingID", dt.ID), slog.String("err", err.Error()))
+				continue
+			}
+			dt.setLatest(values)
+		}
+	}
+}
+
 // RenderDirectory renders the directory of Things.
 //
 // This supports both a full and fragment rendering.
@@ -76,6 +136,7 @@ func RenderDirectory(w http.ResponseWriter, r *http.Request) {
 		err = err2
 		if err == nil {
 			dirGroups := sortByPublisher(thingsList)
+			loadLatestValues(histcli.NewReadHistoryClient(hc), dirGroups)
 			data["Directory"] = dirGroups
 		} else {
 			// the 'Directory' attribute is used by html know if to reload
@@ -0,0 +1,29 @@
+package directory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	vocab "github.com/hiveot/hub/done_api/api_go"
+	"github.com/hiveot/hub/done_cli/cli_done/transport"
+	"github.com/hiveot/hub/done_tool/things"
+)
+
+func TestSetLatest(t *testing.T) {
+	td := things.NewTD("thing1", "Thing 1", vocab.ThingSensor)
+	td.AddEvent("temp", "", "Temperature", "",
+		&things.DataSchema{Type: vocab.WoTDataTypeNumber, Unit: vocab.UnitCelcius, NumberMultipleOf: 0.1})
+	values := things.NewThingValueMap()
+	values.Set("temp", &things.ThingValue{Name: "temp", Data: []byte("21.456"), CreatedMSec: 10})
+	// the TD event is not a value of the thing even if it is newer
+	values.Set(transport.EventNameTD, &things.ThingValue{
+		Name: transport.EventNameTD, Data: []byte("{}"), CreatedMSec: 20})
+
+	dt := &DirThing{TD: td}
+	dt.setLatest(values)
+	assert.Equal(t, "temp", dt.Latest)
+	assert.Equal(t, "Temperature", dt.LatestTitle)
+	assert.Equal(t, "21.5", dt.LatestValue)
+	assert.Equal(t, vocab.UnitClassesMap[vocab.UnitCelcius].Symbol, dt.LatestUnit)
+}
@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"net/http"
 
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
 	websession "github.com/hiveot/hub/done_mod/mod_web/web_session"
 )
 
@@ -27,7 +28,12 @@ func PostLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// step 1: authenticate with the password
-	hc, err := sm.ConnectWithPassword(loginID, password)
+	// the auth service verifies the password first to protect against password guessing
+	err := sm.VerifyLogin(loginID, password, r.RemoteAddr)
+	var hc *clidone.HubClient
+	if err == nil {
+		hc, err = sm.ConnectWithPassword(loginID, password)
+	}
 	if err != nil {
 		slog.Warn("PostLogin failed",
 			slog.String("remoteAddr", r.RemoteAddr),
@@ -0,0 +1,299 @@
+package thing
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	vocab "github.com/hiveot/hub/done_api/api_go"
+	dircli "github.com/hiveot/hub/done_mod/mod_dir/dir_cli"
+	websession "github.com/hiveot/hub/done_mod/mod_web/web_session"
+	"github.com/hiveot/hub/done_mod/mod_web/web_view/app"
+	"github.com/hiveot/hub/done_tool/things"
+)
+
+const ActionRequestTemplateFile = "actionRequest.gohtml"
+
+// inputFieldName is the form field name of the action input value.
+// Fields of an object input are named 'value.{property}', nested as needed.
+const inputFieldName = "value"
+
+// FieldOption is a selectable value of an enum or oneOf input field
+type FieldOption struct {
+	Value string
+	Title string
+}
+
+// SchemaField describes a form input field generated from an action input DataSchema.
+// Object schemas are flattened into a heading followed by the fields of its properties.
+type SchemaField struct {
+	// Name of the form field
+	Name string
+	// Title and Description of the field
+	Title       string
+	Description string
+	// Type is the DataSchema type: object, boolean, number, integer or string
+	Type string
+	// Depth of nesting in objects. 0 for the top level
+	Depth int
+	// Options holds the values to choose from, if restricted
+	Options []FieldOption
+	// Min and Max hold the range of numbers, if defined
+	Min string
+	Max string
+	// Unit of the value
+	Unit string
+	// Default is the initial value of the field
+	Default string
+	// Required is set for mandatory properties of an object
+	Required bool
+}
+
+// getActionTD returns the TD and action affordance of the thing action
+func getActionTD(r *http.Request, agentID, thingID, actionKey string) (
+	*websession.ClientSession, *things.ActionAffordance, error) {
+
+	mySession, err := websession.GetSessionFromContext(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	td := things.TD{}
+	rd := dircli.NewReadDirectoryClient(mySession.GetHubClient())
+	tv, err := rd.GetTD(agentID, thingID)
+	if err == nil {
+		err = json.Unmarshal(tv.Data, &td)
+	}
+	if err != nil {
+		return mySession, nil, err
+	}
+	action := td.GetAction(actionKey)
+	if action == nil {
+		return mySession, nil, fmt.Errorf("thing '%s' has no action '%s'", thingID, actionKey)
+	}
+	return mySession, action, nil
+}
+
+// makeSchemaFields returns the form fields for entering a value of the given schema.
+//
+//	name of the form field of the value
+//	title of the field if the schema has no title
+//	required is set if the value is a required property
+//	depth of nesting within objects
+func makeSchemaFields(schema *things.DataSchema, name string, title string, required bool, depth int) []SchemaField {
+	field := SchemaField{
+		Name:        name,
+		Title:       schema.Title,
+		Description: schema.Description,
+		Type:        schema.Type,
+		Depth:       depth,
+		Unit:        schema.Unit,
+		Required:    required,
+	}
+	if field.Title == "" {
+		field.Title = title
+	}
+	if schema.Default != nil {
+		field.Default = fmt.Sprint(schema.Default)
+	}
+	// a limit of 0 is indistinguishable from no limit
+	if schema.NumberMinimum != 0 {
+		field.Min = strconv.FormatFloat(schema.NumberMinimum, 'f', -1, 64)
+	} else if schema.Type == vocab.WoTDataTypeUnsignedInt {
+		field.Min = "0"
+	}
+	if schema.NumberMaximum != 0 {
+		field.Max = strconv.FormatFloat(schema.NumberMaximum, 'f', -1, 64)
+	}
+	for _, option := range schema.OneOf {
+		optionValue := fmt.Sprint(option.Const)
+		optionTitle := option.Title
+		if optionTitle == "" {
+			optionTitle = optionValue
+		}
+		field.Options = append(field.Options, FieldOption{Value: optionValue, Title: optionTitle})
+	}
+	for _, enumValue := range schema.Enum {
+		optionValue := fmt.Sprint(enumValue)
+		field.Options = append(field.Options, FieldOption{Value: optionValue, Title: optionValue})
+	}
+	fields := []SchemaField{field}
+	if schema.Type == vocab.WoTDataTypeObject {
+		// sort by property key for a stable presentation
+		keys := make([]string, 0, len(schema.Properties))
+		for key := range schema.Properties {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			propSchema := schema.Properties[key]
+			propRequired := slices.Contains(schema.PropertiesRequired, key)
+			fields = append(fields, makeSchemaFields(
+				&propSchema, name+"."+key, key, propRequired, depth+1)...)
+		}
+	}
+	return fields
+}
+
+// parseSchemaValue converts the posted form values into a value of the given schema.
+// This returns nil if no value was provided and the value isn't required, or an
+// error if a required value is missing.
+// Optional objects without any property values and unchecked optional booleans
+// are omitted.
+//
+//	required is set if a value must be provided
+func parseSchemaValue(schema *things.DataSchema, name string, required bool, form url.Values) (interface{}, error) {
+	if schema.Type == vocab.WoTDataTypeObject {
+		obj := make(map[string]interface{})
+		for key, propSchema := range schema.Properties {
+			propRequired := slices.Contains(schema.PropertiesRequired, key)
+			propValue, err := parseSchemaValue(&propSchema, name+"."+key, propRequired, form)
+			if err != nil {
+				return nil, err
+			}
+			if propValue != nil {
+				obj[key] = propValue
+			}
+		}
+		if len(obj) == 0 && !required {
+			return nil, nil
+		}
+		for _, key := range schema.PropertiesRequired {
+			if _, found := obj[key]; !found {
+				return nil, fmt.Errorf("missing value for '%s'", key)
+			}
+		}
+		return obj, nil
+	} else if schema.Type == vocab.WoTDataTypeBool {
+		// unchecked checkboxes are not posted
+		checked := form.Get(name) != ""
+		if !checked && !required {
+			return nil, nil
+		}
+		return checked, nil
+	}
+	text := form.Get(name)
+	if text == "" {
+		if required {
+			// report the property key instead of the full field name
+			key := name[strings.LastIndex(name, ".")+1:]
+			return nil, fmt.Errorf("missing value for '%s'", key)
+		}
+		return nil, nil
+	}
+	switch schema.Type {
+	case vocab.WoTDataTypeInteger, vocab.WoTDataTypeUnsignedInt, vocab.WoTDataTypeNumber:
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a number", text)
+		}
+		if err = schema.ValidateNumber(number); err != nil {
+			return nil, err
+		}
+		if schema.Type == vocab.WoTDataTypeNumber {
+			return number, nil
+		}
+		// ValidateNumber rejects fractions so this doesn't truncate
+		return int64(number), nil
+	}
+	return text, nil
+}
+
+// RenderActionRequest renders the modal for entering the input of an action request.
+// URL parameters:
+// @param agentID of the thing publisher
+// @param thingID of the thing
+// @param actionKey of the action to request
+func RenderActionRequest(w http.ResponseWriter, r *http.Request) {
+	agentID := chi.URLParam(r, "agentID")
+	thingID := chi.URLParam(r, "thingID")
+	actionKey := chi.URLParam(r, "actionKey")
+	data := make(map[string]any)
+
+	_, action, err := getActionTD(r, agentID, thingID, actionKey)
+	if err != nil {
+		slog.Warn("RenderActionRequest failed",
+			slog.String("thingID", thingID),
+			slog.String("actionKey", actionKey),
+			slog.String("err", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data["AgentID"] = agentID
+	data["ThingID"] = thingID
+	data["Key"] = actionKey
+	data["Action"] = action
+	if action.Input != nil {
+		data["Fields"] = makeSchemaFields(action.Input, inputFieldName, actionKey, true, 0)
+	}
+	app.RenderAppOrFragment(w, r, ActionRequestTemplateFile, data)
+}
+
+// PostActionRequest handles posting of an action request.
+// The form values are converted according to the action input schema. Objects are
+// sent as JSON while other values are sent as text, similar to configuration values.
+// The reply or error is shown to the user through a SSE notify event.
+// URL parameters:
+// @param agentID of the thing publisher
+// @param thingID of the thing
+// @param actionKey of the action to request
+func PostActionRequest(w http.ResponseWriter, r *http.Request) {
+	var payload []byte
+	var reply []byte
+	agentID := chi.URLParam(r, "agentID")
+	thingID := chi.URLParam(r, "thingID")
+	actionKey := chi.URLParam(r, "actionKey")
+
+	mySession, action, err := getActionTD(r, agentID, thingID, actionKey)
+	if err == nil {
+		err = r.ParseForm()
+	}
+	if err == nil && action.Input != nil {
+		var value interface{}
+		value, err = parseSchemaValue(action.Input, inputFieldName, true, r.Form)
+		if err == nil && value != nil {
+			// enum, oneOf and string constraints are checked by the schema
+			err = action.Input.Validate(value)
+		}
+		if err == nil && value != nil {
+			if action.Input.Type == vocab.WoTDataTypeObject {
+				payload, _ = json.Marshal(value)
+			} else {
+				payload = []byte(fmt.Sprint(value))
+			}
+		}
+	}
+	if err == nil {
+		slog.Info("Requesting action",
+			slog.String("agentID", agentID),
+			slog.String("thingID", thingID),
+			slog.String("actionKey", actionKey))
+		reply, err = mySession.GetHubClient().PubAction(agentID, thingID, actionKey, payload)
+	}
+	if err != nil {
+		slog.Warn("PostActionRequest failed",
+			slog.String("remoteAddr", r.RemoteAddr),
+			slog.String("agentID", agentID),
+			slog.String("thingID", thingID),
+			slog.String("actionKey", actionKey),
+			slog.String("err", err.Error()))
+		if mySession != nil {
+			// notify UI via SSE. This is handled by a toast component.
+			_ = mySession.SendSSE("notify", "error:"+err.Error())
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	notification := "success: Action '" + actionKey + "' completed"
+	if len(reply) > 0 {
+		notification += ": " + string(reply)
+	}
+	_ = mySession.SendSSE("notify", notification)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,60 @@
+package thing
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	vocab "github.com/hiveot/hub/done_api/api_go"
+	"github.com/hiveot/hub/done_tool/things"
+)
+
+func TestParseSchemaValue(t *testing.T) {
+	schema := &things.DataSchema{
+		Type: vocab.WoTDataTypeObject,
+		Properties: map[string]things.DataSchema{
+			"name":  {Type: vocab.WoTDataTypeString},
+			"level": {Type: vocab.WoTDataTypeInteger},
+		},
+		PropertiesRequired: []string{"name"},
+	}
+	form := url.Values{}
+	form.Set("value.level", "3")
+
+	// a missing required property is an error
+	_, err := parseSchemaValue(schema, inputFieldName, true, form)
+	assert.ErrorContains(t, err, "'name'")
+
+	form.Set("value.name", "bob")
+	value, err := parseSchemaValue(schema, inputFieldName, true, form)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "bob", "level": int64(3)}, value)
+
+	// a missing required scalar is an error, an optional one is omitted
+	scalar := &things.DataSchema{Type: vocab.WoTDataTypeString}
+	_, err = parseSchemaValue(scalar, inputFieldName, true, url.Values{})
+	assert.Error(t, err)
+	value, err = parseSchemaValue(scalar, inputFieldName, false, url.Values{})
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+}
+
+func TestValidateEnumInput(t *testing.T) {
+	schema := &things.DataSchema{
+		Type: vocab.WoTDataTypeString,
+		Enum: []interface{}{"on", "off"},
+	}
+	form := url.Values{}
+	form.Set(inputFieldName, "dim")
+	value, err := parseSchemaValue(schema, inputFieldName, true, form)
+	require.NoError(t, err)
+	// values outside the enum are rejected by the schema
+	assert.Error(t, schema.Validate(value))
+
+	form.Set(inputFieldName, "on")
+	value, err = parseSchemaValue(schema, inputFieldName, true, form)
+	require.NoError(t, err)
+	assert.NoError(t, schema.Validate(value))
+}
@@ -0,0 +1,296 @@
+package thing
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	vocab "github.com/hiveot/hub/done_api/api_go"
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	dircli "github.com/hiveot/hub/done_mod/mod_dir/dir_cli"
+	histcli "github.com/hiveot/hub/done_mod/mod_hist/hist_cli"
+	websession "github.com/hiveot/hub/done_mod/mod_web/web_session"
+	"github.com/hiveot/hub/done_mod/mod_web/web_view/app"
+	"github.com/hiveot/hub/done_tool/things"
+)
+
+const HistoryTemplateFile = "history.gohtml"
+const HistoryDataTemplateFile = "historyData.gohtml"
+
+// DefaultHistoryRange is the time range shown when none is selected
+const DefaultHistoryRange = "24h"
+
+// historyRanges are the selectable time ranges of the history view
+var historyRanges = []string{"1h", "6h", "24h", "7d", "30d"}
+
+// historyMaxValues is the maximum number of values to read for a single view
+const historyMaxValues = 10000
+
+// historyBatchSize is the number of values to read per cursor request
+const historyBatchSize = 500
+
+// chart dimensions in svg viewBox units
+const chartWidth = 1000
+const chartHeight = 300
+
+// HistoryValue is a single entry of the history table
+type HistoryValue struct {
+	Time  string
+	Value string
+}
+
+// HistoryTemplateData holds the history of a single event or property
+type HistoryTemplateData struct {
+	AgentID string
+	ThingID string
+	// Name of the event or property
+	Name  string
+	Title string
+	Unit  string
+	// TimeRange is the selected range, eg "24h"
+	TimeRange  string
+	TimeRanges []string
+	// StartTime and EndTime of the time range
+	StartTime string
+	EndTime   string
+	// Values for the table, newest first
+	Values []HistoryValue
+	// ChartPoints holds the svg polyline points of the chart, if any
+	ChartPoints string
+	// ChartWidth and ChartHeight are the dimensions of the chart viewBox
+	ChartWidth  int
+	ChartHeight int
+	// MinValue and MaxValue are the limits of the chart y-axis
+	MinValue string
+	MaxValue string
+}
+
+// isNumericSchema returns true if the schema describes a numeric value
+func isNumericSchema(schema *things.DataSchema) bool {
+	if schema == nil {
+		return false
+	}
+	return schema.Type == vocab.WoTDataTypeNumber ||
+		schema.Type == vocab.WoTDataTypeInteger ||
+		schema.Type == vocab.WoTDataTypeUnsignedInt
+}
+
+// parseHistoryRange returns the duration of a time range, eg "24h" or "7d"
+func parseHistoryRange(timeRange string) (time.Duration, error) {
+	if strings.HasSuffix(timeRange, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(timeRange, "d"))
+		return time.Duration(days) * 24 * time.Hour, err
+	}
+	return time.ParseDuration(timeRange)
+}
+
+// readHistory returns the values of an event or property within the time range, oldest first.
+// This reads up to historyMaxValues values.
+func readHistory(hc *clidone.HubClient, agentID, thingID, name string, startTime, endTime time.Time) (
+	[]*things.ThingValue, error) {
+
+	values := make([]*things.ThingValue, 0)
+	rh := histcli.NewReadHistoryClient(hc)
+	cursor, releaseFn, err := rh.GetCursor(agentID, thingID, name)
+	if err != nil {
+		return values, err
+	}
+	defer releaseFn()
+	tv, valid, err := cursor.Seek(startTime.UnixMilli())
+	endMSE := endTime.UnixMilli()
+	for valid && err == nil && len(values) < historyMaxValues {
+		if tv.CreatedMSec > endMSE {
+			break
+		}
+		values = append(values, tv)
+		var batch []*things.ThingValue
+		batch, valid, err = cursor.NextN(historyBatchSize)
+		for _, tv2 := range batch {
+			if tv2.CreatedMSec > endMSE {
+				return values, err
+			}
+			values = append(values, tv2)
+		}
+		// continue with the next value after the batch
+		if valid && err == nil {
+			tv, valid, err = cursor.Next()
+		}
+	}
+	return values, err
+}
+
+// getHistoryData reads the TD and history of an event or property for the history view.
+// URL parameters:
+// @param agentID of the thing publisher
+// @param thingID of the thing
+// @param name of the event or property
+// Query parameters:
+// @param range of the history, eg "24h". See historyRanges.
+func getHistoryData(r *http.Request) (*HistoryTemplateData, []*things.ThingValue, error) {
+	data := &HistoryTemplateData{
+		AgentID:     chi.URLParam(r, "agentID"),
+		ThingID:     chi.URLParam(r, "thingID"),
+		Name:        chi.URLParam(r, "name"),
+		TimeRange:   r.URL.Query().Get("range"),
+		TimeRanges:  historyRanges,
+		ChartWidth:  chartWidth,
+		ChartHeight: chartHeight,
+	}
+	if data.TimeRange == "" {
+		data.TimeRange = DefaultHistoryRange
+	}
+	duration, err := parseHistoryRange(data.TimeRange)
+	if err != nil || duration <= 0 {
+		return data, nil, fmt.Errorf("invalid time range '%s'", data.TimeRange)
+	}
+	mySession, err := websession.GetSessionFromContext(r)
+	if err != nil {
+		return data, nil, err
+	}
+	hc := mySession.GetHubClient()
+
+	// the title and unit are taken from the TD
+	td := things.TD{}
+	rd := dircli.NewReadDirectoryClient(hc)
+	tv, err := rd.GetTD(data.AgentID, data.ThingID)
+	if err == nil {
+		err = json.Unmarshal(tv.Data, &td)
+	}
+	if err != nil {
+		return data, nil, err
+	}
+	data.Title = data.Name
+	if ev := td.GetEvent(data.Name); ev != nil {
+		data.Title = ev.Title
+	} else if prop := td.GetProperty(data.Name); prop != nil {
+		data.Title = prop.Title
+	}
+	schema := td.GetValueSchema(data.Name)
+	if schema == nil {
+		schema = &things.DataSchema{}
+	}
+	data.Unit = schema.UnitSymbol()
+
+	endTime := time.Now()
+	startTime := endTime.Add(-duration)
+	data.StartTime = startTime.Format(time.RFC822)
+	data.EndTime = endTime.Format(time.RFC822)
+	values, err := readHistory(hc, data.AgentID, data.ThingID, data.Name, startTime, endTime)
+	if err != nil {
+		return data, values, err
+	}
+	data.Values = make([]HistoryValue, 0, len(values))
+	for i := len(values) - 1; i >= 0; i-- {
+		data.Values = append(data.Values, HistoryValue{
+			Time:  values[i].GetUpdated(),
+			Value: schema.FormatValue(values[i].Data),
+		})
+	}
+	makeChart(data, values, startTime, endTime)
+	return data, values, nil
+}
+
+// makeChart sets the chart polyline of the numeric values in the time range.
+// Values that are not numeric are skipped.
+func makeChart(data *HistoryTemplateData, values []*things.ThingValue, startTime, endTime time.Time) {
+	type point struct {
+		t int64
+		v float64
+	}
+	points := make([]point, 0, len(values))
+	for _, tv := range values {
+		v, err := strconv.ParseFloat(strings.TrimSpace(string(tv.Data)), 64)
+		if err == nil {
+			points = append(points, point{tv.CreatedMSec, v})
+		}
+	}
+	if len(points) == 0 {
+		return
+	}
+	minValue, maxValue := points[0].v, points[0].v
+	for _, p := range points {
+		minValue = min(minValue, p.v)
+		maxValue = max(maxValue, p.v)
+	}
+	if minValue == maxValue {
+		// show a flat line in the middle
+		minValue -= 1
+		maxValue += 1
+	}
+	startMSE := startTime.UnixMilli()
+	spanMSE := float64(endTime.UnixMilli() - startMSE)
+	sb := strings.Builder{}
+	for _, p := range points {
+		x := float64(p.t-startMSE) / spanMSE * chartWidth
+		y := chartHeight - (p.v-minValue)/(maxValue-minValue)*chartHeight
+		sb.WriteString(fmt.Sprintf("%.1f,%.1f ", x, y))
+	}
+	data.ChartPoints = sb.String()
+	data.MinValue = strconv.FormatFloat(minValue, 'f', -1, 64)
+	data.MaxValue = strconv.FormatFloat(maxValue, 'f', -1, 64)
+}
+
+// RenderHistory renders the history view of an event or property, with a chart and
+// table of its values.
+func RenderHistory(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]any)
+	histData, _, err := getHistoryData(r)
+	if err != nil {
+		slog.Warn("RenderHistory failed",
+			slog.String("thingID", histData.ThingID),
+			slog.String("name", histData.Name),
+			slog.String("err", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data["History"] = histData
+	app.RenderAppOrFragment(w, r, HistoryTemplateFile, data)
+}
+
+// RenderHistoryData renders the chart and table of the history view.
+// This is used to change the time range and to refresh on new values.
+func RenderHistoryData(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]any)
+	histData, _, err := getHistoryData(r)
+	if err != nil {
+		slog.Warn("RenderHistoryData failed",
+			slog.String("thingID", histData.ThingID),
+			slog.String("name", histData.Name),
+			slog.String("err", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data["History"] = histData
+	app.RenderAppOrFragment(w, r, HistoryDataTemplateFile, data)
+}
+
+// DownloadHistoryCSV writes the values of the history time range as a CSV file.
+// Each row holds the timestamp in RFC3339 format and the value.
+func DownloadHistoryCSV(w http.ResponseWriter, r *http.Request) {
+	histData, values, err := getHistoryData(r)
+	if err != nil {
+		slog.Warn("DownloadHistoryCSV failed",
+			slog.String("thingID", histData.ThingID),
+			slog.String("name", histData.Name),
+			slog.String("err", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fileName := fmt.Sprintf("%s-%s-%s.csv", histData.ThingID, histData.Name, histData.TimeRange)
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	csvWriter := csv.NewWriter(w)
+	_ = csvWriter.Write([]string{"time", histData.Name})
+	for _, tv := range values {
+		created := time.UnixMilli(tv.CreatedMSec).Format(time.RFC3339)
+		_ = csvWriter.Write([]string{created, string(tv.Data)})
+	}
+	csvWriter.Flush()
+}
@@ -31,6 +31,35 @@ type DetailsTemplateData struct {
 	Values     things.ThingValueMap
 }
 
+// FormatValue returns the latest value of an event or property formatted using its schema,
+// or "" if it doesn't exist. The unit is not included.
+// intended for use in template as .FormatValue $key
+func (dt *DetailsTemplateData) FormatValue(key string) string {
+	tv := dt.Values.Get(key)
+	if tv == nil {
+		return ""
+	}
+	schema := dt.TD.GetValueSchema(key)
+	if schema == nil {
+		return string(tv.Data)
+	}
+	return schema.FormatValue(tv.Data)
+}
+
+// HasEventHistory returns true if the event has numeric values that can be charted
+// intended for use in template as .HasEventHistory $key
+func (dt *DetailsTemplateData) HasEventHistory(key string) bool {
+	ev := dt.TD.GetEvent(key)
+	return ev != nil && isNumericSchema(ev.Data)
+}
+
+// HasPropertyHistory returns true if the property has numeric values that can be charted
+// intended for use in template as .HasPropertyHistory $key
+func (dt *DetailsTemplateData) HasPropertyHistory(key string) bool {
+	prop := dt.TD.GetProperty(key)
+	return prop != nil && isNumericSchema(&prop.DataSchema)
+}
+
 // return a map with the latest property values of a thing or nil if failed
 func getLatest(agentID string, thingID string, hc *clidone.HubClient) (things.ThingValueMap, error) {
 	data := things.NewThingValueMap()
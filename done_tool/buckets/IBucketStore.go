@@ -38,6 +38,11 @@ type BucketStoreInfo struct {
 //
 // TODO: add refcount for multiple consumers of the store so it can be closed when done.
 type IBucketStore interface {
+	// BucketsInfo returns the information of each bucket in the store.
+	// Intended for monitoring the size of the store. The information can be cached
+	// by the store, as collecting it can be expensive.
+	BucketsInfo() ([]*BucketStoreInfo, error)
+
 	// GetBucket returns a bucket to use.
 	// This creates the bucket if it doesn't exist.
 	// Use bucket.Close() to close the bucket and release its resources.
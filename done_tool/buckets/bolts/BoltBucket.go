@@ -112,11 +112,13 @@ func (bb *BoltBucket) Get(key string) (val []byte, err error) {
 		v := bboltBucket.Get([]byte(key))
 		if v != nil {
 			byteValue = bytes.NewBuffer(v).Bytes() //copy the buffer
-		} else {
-			err = fmt.Errorf("key '%s' not found", key)
 		}
-		return err
+		return nil
 	})
+	// also not found if the bucket doesn't yet exist
+	if err == nil && byteValue == nil {
+		err = fmt.Errorf("key '%s' not found", key)
+	}
 	return byteValue, err
 }
 
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"path"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -43,6 +44,10 @@ import (
 //   Dataset 1M         1.7 us/op
 //
 
+// BucketsInfoMaxAge is the time the bucket information is cached.
+// Collecting the information traverses all pages of the buckets.
+const BucketsInfoMaxAge = time.Minute
+
 type BoltStore struct {
 	// the underlying database
 	boltDB *bbolt.DB
@@ -50,6 +55,39 @@ type BoltStore struct {
 	storePath string
 	// for preventing deadlocks when closing the store. panic instead
 	bucketRefCount int32
+
+	// cached bucket information and the time it was collected
+	bucketsInfo     []*buckets.BucketStoreInfo
+	bucketsInfoTime time.Time
+	infoMux         sync.Mutex
+}
+
+// BucketsInfo returns the information of each bucket in the store.
+// The information is cached for BucketsInfoMaxAge as collecting it traverses the buckets.
+func (store *BoltStore) BucketsInfo() (infoList []*buckets.BucketStoreInfo, err error) {
+	store.infoMux.Lock()
+	defer store.infoMux.Unlock()
+	if store.bucketsInfo != nil && time.Since(store.bucketsInfoTime) < BucketsInfoMaxAge {
+		return store.bucketsInfo, nil
+	}
+	infoList = make([]*buckets.BucketStoreInfo, 0)
+	err = store.boltDB.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+			bucketStats := bucket.Stats()
+			infoList = append(infoList, &buckets.BucketStoreInfo{
+				DataSize:  int64(bucketStats.LeafInuse),
+				Engine:    buckets.BackendBBolt,
+				Id:        string(name),
+				NrRecords: int64(bucketStats.KeyN),
+			})
+			return nil
+		})
+	})
+	if err == nil {
+		store.bucketsInfo = infoList
+		store.bucketsInfoTime = time.Now()
+	}
+	return infoList, err
 }
 
 // Close the store and flush changes to disk
@@ -0,0 +1,172 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hiveot/hub/done_tool/keys"
+)
+
+// DefaultRenewBeforeDays is the nr of days before expiry at which the server certificate is renewed
+const DefaultRenewBeforeDays = 30
+
+// DefaultRenewCheckInterval is the interval at which the server certificate expiry is checked
+const DefaultRenewCheckInterval = time.Hour
+
+// ServerCertManager manages the server certificate of the Hub.
+// It renews the certificate before it expires, signs it with the local CA, and saves it.
+//
+// Servers use GetCertificate in their tls.Config to pick up the renewed certificate
+// without restarting.
+type ServerCertManager struct {
+	// parameters for creating the certificate. See CreateServerCert.
+	serverID     string
+	ou           string
+	names        []string
+	validityDays int
+	serverKey    keys.IHiveKey
+	caCert       *x509.Certificate
+	caKey        keys.IHiveKey
+	// file to save the renewed certificate to, or "" to not save it
+	certPath string
+	// renew the certificate when it expires within this duration
+	renewBefore time.Duration
+
+	cert           *x509.Certificate
+	tlsCert        *tls.Certificate
+	renewedHandler func(cert *x509.Certificate)
+	mux            sync.RWMutex
+	stopChan       chan bool
+}
+
+// CheckRenewal renews the certificate if it expires within the renewal period.
+// This returns true if the certificate was renewed.
+func (m *ServerCertManager) CheckRenewal() (renewed bool, err error) {
+	m.mux.RLock()
+	cert := m.cert
+	m.mux.RUnlock()
+	if cert != nil && time.Until(cert.NotAfter) > m.renewBefore {
+		return false, nil
+	}
+	err = m.Renew()
+	return err == nil, err
+}
+
+// GetCertificate returns the current server certificate.
+// Intended for use as tls.Config.GetCertificate so renewed certificates are used
+// for new connections.
+func (m *ServerCertManager) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.GetTLSCert(), nil
+}
+
+// GetTLSCert returns the current TLS server certificate, or nil if none has been created
+func (m *ServerCertManager) GetTLSCert() *tls.Certificate {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	return m.tlsCert
+}
+
+// Renew creates a new server certificate, signed by the CA, and saves it.
+// The renewed handler is notified of the new certificate.
+func (m *ServerCertManager) Renew() error {
+	cert, err := CreateServerCert(
+		m.serverID, m.ou, m.validityDays, m.serverKey, m.names, m.caCert, m.caKey)
+	if err != nil {
+		slog.Error("Renew: unable to create a server cert", "err", err.Error())
+		return err
+	}
+	if m.certPath != "" {
+		slog.Warn("Writing server cert", "serverCertPath", m.certPath)
+		err = SaveX509CertToPEM(cert, m.certPath)
+		if err != nil {
+			slog.Error("writing server cert failed: ", "err", err.Error())
+		}
+	}
+	m.mux.Lock()
+	m.cert = cert
+	m.tlsCert = X509CertToTLS(cert, m.serverKey)
+	handler := m.renewedHandler
+	m.mux.Unlock()
+
+	slog.Warn("Server certificate renewed",
+		slog.String("serverID", m.serverID),
+		slog.Time("notAfter", cert.NotAfter))
+	if handler != nil {
+		handler(cert)
+	}
+	return nil
+}
+
+// SetRenewedHandler sets the handler that is notified after the certificate is renewed
+func (m *ServerCertManager) SetRenewedHandler(handler func(cert *x509.Certificate)) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.renewedHandler = handler
+}
+
+// Start periodically checking the certificate for renewal.
+//
+//	checkInterval is the interval between checks. Use 0 for DefaultRenewCheckInterval
+func (m *ServerCertManager) Start(checkInterval time.Duration) {
+	if checkInterval == 0 {
+		checkInterval = DefaultRenewCheckInterval
+	}
+	m.stopChan = make(chan bool)
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_, _ = m.CheckRenewal()
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the periodic renewal check
+func (m *ServerCertManager) Stop() {
+	if m.stopChan != nil {
+		close(m.stopChan)
+		m.stopChan = nil
+	}
+}
+
+// NewServerCertManager creates a manager for the server certificate.
+// Use Renew to create the first certificate and Start to check for renewal.
+//
+//	serverID, ou, names: the certificate CN, OU and SAN names. See CreateServerCert
+//	validityDays is the validity of each certificate. Use 0 for default.
+//	serverKey is the server's key pair, reused for each renewal
+//	caCert and caKey of the CA that signs the certificate
+//	certPath is the file to save the certificate to, or "" to not save it
+//	renewBeforeDays is the nr of days before expiry at which to renew. Use 0 for default.
+func NewServerCertManager(
+	serverID string, ou string, names []string, validityDays int,
+	serverKey keys.IHiveKey, caCert *x509.Certificate, caKey keys.IHiveKey,
+	certPath string, renewBeforeDays int) *ServerCertManager {
+
+	if validityDays == 0 {
+		validityDays = DefaultServerCertValidityDays
+	}
+	if renewBeforeDays == 0 {
+		renewBeforeDays = DefaultRenewBeforeDays
+	}
+	m := &ServerCertManager{
+		serverID:     serverID,
+		ou:           ou,
+		names:        names,
+		validityDays: validityDays,
+		serverKey:    serverKey,
+		caCert:       caCert,
+		caKey:        caKey,
+		certPath:     certPath,
+		renewBefore:  time.Duration(renewBeforeDays) * 24 * time.Hour,
+	}
+	return m
+}
@@ -0,0 +1,65 @@
+package certs_test
+
+import (
+	"crypto/x509"
+	"path"
+	"testing"
+
+	"github.com/hiveot/hub/done_tool/certs"
+	"github.com/hiveot/hub/done_tool/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A certificate that expires within the renewal period is renewed and saved
+func TestRenewNearExpiry(t *testing.T) {
+	certPath := path.Join(t.TempDir(), "hubCert.pem")
+	caCert, caKey, err := certs.CreateCA("testca", 1)
+	require.NoError(t, err)
+	serverKey := keys.NewEcdsaKey()
+
+	// the certificate is valid for 10 days and renewed 30 days before it expires
+	m := certs.NewServerCertManager("hub", certs.OUService, nil, 10,
+		serverKey, caCert, caKey, certPath, 30)
+	var renewedCert *x509.Certificate
+	m.SetRenewedHandler(func(cert *x509.Certificate) {
+		renewedCert = cert
+	})
+	// without a certificate a new one is created
+	renewed, err := m.CheckRenewal()
+	require.NoError(t, err)
+	assert.True(t, renewed)
+	require.NotNil(t, renewedCert)
+	cert1 := renewedCert
+
+	renewed, err = m.CheckRenewal()
+	require.NoError(t, err)
+	assert.True(t, renewed)
+	assert.NotSame(t, cert1, renewedCert)
+
+	// the renewed certificate is served and saved
+	tlsCert, err := m.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, renewedCert.Raw, tlsCert.Certificate[0])
+	savedCert, err := certs.LoadX509CertFromPEM(certPath)
+	require.NoError(t, err)
+	assert.Equal(t, renewedCert.Raw, savedCert.Raw)
+}
+
+// A certificate that is valid beyond the renewal period is left alone
+func TestKeepValidCert(t *testing.T) {
+	caCert, caKey, err := certs.CreateCA("testca", 1)
+	require.NoError(t, err)
+	serverKey := keys.NewEcdsaKey()
+
+	m := certs.NewServerCertManager("hub", certs.OUService, nil, 60,
+		serverKey, caCert, caKey, "", 30)
+	err = m.Renew()
+	require.NoError(t, err)
+	cert1 := m.GetTLSCert()
+
+	renewed, err := m.CheckRenewal()
+	require.NoError(t, err)
+	assert.False(t, renewed)
+	assert.Same(t, cert1, m.GetTLSCert())
+}
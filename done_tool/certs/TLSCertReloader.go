@@ -0,0 +1,91 @@
+package certs
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultReloadCheckInterval is the minimum time between checks for a changed certificate file
+const DefaultReloadCheckInterval = 10 * time.Second
+
+// TLSCertReloader provides a TLS certificate from PEM files and reloads it when
+// the certificate file changes.
+// Intended for plugins that use the Hub server certificate, which is renewed by the
+// Hub core, so they pick up the renewed certificate without restarting.
+type TLSCertReloader struct {
+	certPath string
+	keyPath  string
+	// minimum time between checks for a changed certificate file
+	checkInterval time.Duration
+
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+	mux       sync.Mutex
+}
+
+// GetCertificate returns the certificate, reloading it if the file has changed.
+// Intended for use as tls.Config.GetCertificate.
+func (r *TLSCertReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if time.Since(r.lastCheck) < r.checkInterval {
+		return r.cert, nil
+	}
+	r.lastCheck = time.Now()
+	stat, err := os.Stat(r.certPath)
+	if err != nil || !stat.ModTime().After(r.modTime) {
+		return r.cert, nil
+	}
+	cert, err := LoadTLSCertFromPEM(r.certPath, r.keyPath)
+	if err != nil {
+		// the file might be in the middle of being written. Try again later.
+		slog.Warn("GetCertificate: reloading certificate failed",
+			slog.String("certPath", r.certPath), slog.String("err", err.Error()))
+		return r.cert, nil
+	}
+	slog.Warn("GetCertificate: certificate reloaded", slog.String("certPath", r.certPath))
+	r.cert = cert
+	r.modTime = stat.ModTime()
+	return r.cert, nil
+}
+
+// GetTLSCert returns the currently loaded certificate
+func (r *TLSCertReloader) GetTLSCert() *tls.Certificate {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.cert
+}
+
+// SetCheckInterval sets the minimum time between checks for a changed certificate file.
+// The default is DefaultReloadCheckInterval.
+func (r *TLSCertReloader) SetCheckInterval(interval time.Duration) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.checkInterval = interval
+}
+
+// NewTLSCertReloader loads the TLS certificate from PEM files and returns its reloader.
+// This returns an error if the initial certificate can't be loaded.
+func NewTLSCertReloader(certPath, keyPath string) (*TLSCertReloader, error) {
+	stat, err := os.Stat(certPath)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := LoadTLSCertFromPEM(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	r := &TLSCertReloader{
+		certPath:      certPath,
+		keyPath:       keyPath,
+		checkInterval: DefaultReloadCheckInterval,
+		cert:          cert,
+		modTime:       stat.ModTime(),
+		lastCheck:     time.Now(),
+	}
+	return r, nil
+}
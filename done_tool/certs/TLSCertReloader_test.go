@@ -0,0 +1,80 @@
+package certs_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hiveot/hub/done_tool/certs"
+	"github.com/hiveot/hub/done_tool/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The reloader serves the new certificate after the certificate file changed
+func TestReloadChangedCert(t *testing.T) {
+	testDir := t.TempDir()
+	certPath := path.Join(testDir, "hubCert.pem")
+	keyPath := path.Join(testDir, "hubKey.pem")
+	caCert, caKey, err := certs.CreateCA("testca", 1)
+	require.NoError(t, err)
+	serverKey := keys.NewEcdsaKey()
+	err = serverKey.ExportPrivateToFile(keyPath)
+	require.NoError(t, err)
+	cert1, err := certs.CreateServerCert("hub", certs.OUService, 1, serverKey, nil, caCert, caKey)
+	require.NoError(t, err)
+	err = certs.SaveX509CertToPEM(cert1, certPath)
+	require.NoError(t, err)
+
+	r, err := certs.NewTLSCertReloader(certPath, keyPath)
+	require.NoError(t, err)
+	r.SetCheckInterval(0)
+	tlsCert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, cert1.Raw, tlsCert.Certificate[0])
+
+	// renew the certificate file, with a later modification time
+	cert2, err := certs.CreateServerCert("hub", certs.OUService, 1, serverKey, nil, caCert, caKey)
+	require.NoError(t, err)
+	err = certs.SaveX509CertToPEM(cert2, certPath)
+	require.NoError(t, err)
+	modTime := time.Now().Add(time.Minute)
+	err = os.Chtimes(certPath, modTime, modTime)
+	require.NoError(t, err)
+
+	tlsCert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, cert2.Raw, tlsCert.Certificate[0])
+	assert.Same(t, tlsCert, r.GetTLSCert())
+}
+
+// Changes are not noticed until the check interval has passed
+func TestReloadCheckInterval(t *testing.T) {
+	testDir := t.TempDir()
+	certPath := path.Join(testDir, "hubCert.pem")
+	keyPath := path.Join(testDir, "hubKey.pem")
+	caCert, caKey, err := certs.CreateCA("testca", 1)
+	require.NoError(t, err)
+	serverKey := keys.NewEcdsaKey()
+	err = serverKey.ExportPrivateToFile(keyPath)
+	require.NoError(t, err)
+	cert1, err := certs.CreateServerCert("hub", certs.OUService, 1, serverKey, nil, caCert, caKey)
+	require.NoError(t, err)
+	err = certs.SaveX509CertToPEM(cert1, certPath)
+	require.NoError(t, err)
+
+	r, err := certs.NewTLSCertReloader(certPath, keyPath)
+	require.NoError(t, err)
+	cert2, err := certs.CreateServerCert("hub", certs.OUService, 1, serverKey, nil, caCert, caKey)
+	require.NoError(t, err)
+	err = certs.SaveX509CertToPEM(cert2, certPath)
+	require.NoError(t, err)
+	modTime := time.Now().Add(time.Minute)
+	err = os.Chtimes(certPath, modTime, modTime)
+	require.NoError(t, err)
+
+	tlsCert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, cert1.Raw, tlsCert.Certificate[0])
+}
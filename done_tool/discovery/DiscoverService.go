@@ -11,6 +11,20 @@ import (
 
 const HIVEOT_DNSSD_TYPE = "_hiveot._tcp"
 
+// Discovery parameters published in the TXT record of the hiveot service
+const (
+	// ParamCore is the messaging core, eg "nats"
+	ParamCore = "core"
+	// ParamRawURL is the full tcp/tls URL of the Hub
+	ParamRawURL = "rawurl"
+	// ParamWSSURL is the full websocket URL of the Hub, if enabled
+	ParamWSSURL = "wssurl"
+	// ParamWSSPort is the websocket port of the Hub, if enabled
+	ParamWSSPort = "wss"
+	// ParamWSSPath is the websocket path
+	ParamWSSPath = "path"
+)
+
 // DiscoverService searches for services with the given type and returns all its instances.
 // This is a wrapper around various means of discovering services and supports the discovery of multiple
 // instances of the same service (name). The serviceName must contain the simple name of the Hub service.
@@ -64,11 +78,12 @@ func DiscoverService(serviceType string, waitTime time.Duration, firstResult boo
 	return address, rec0.Port, params, records, nil
 }
 
-// LocateHub determines the nats URL to use.
-// This first checks if a local connection can be made on the default port.
-// Secondly, perform a DNS-SD search.
+// LocateHub determines the URL to connect to the Hub.
+// This performs a DNS-SD search for the hiveot service.
 // If firstResult is set then return immediately after the first result or searchTime
-func LocateHub(searchTime time.Duration, firstResult bool) (fullURL string, core string) {
+// If preferWSS is set and the Hub has websockets enabled then this returns the
+// websocket URL, for clients that can't use tcp connections.
+func LocateHub(searchTime time.Duration, firstResult bool, preferWSS bool) (fullURL string, core string) {
 	if searchTime <= 0 {
 		searchTime = time.Second * 3
 	}
@@ -82,14 +97,21 @@ func LocateHub(searchTime time.Duration, firstResult bool) (fullURL string, core
 		slog.Warn("LocateHub: Hub not found")
 		return "", ""
 	}
-	core = params["core"]
-	rawURL, found := params["rawurl"]
+	core = params[ParamCore]
+	fullURL, found := params[ParamRawURL]
 	if !found {
-		rawURL = fmt.Sprintf("tcp://%s:%d%s", addr, port, params["path"])
+		fullURL = fmt.Sprintf("tcp://%s:%d%s", addr, port, params[ParamWSSPath])
+	}
+	if preferWSS {
+		if wssURL, found := params[ParamWSSURL]; found {
+			fullURL = wssURL
+		} else if wssPort, found := params[ParamWSSPort]; found {
+			fullURL = fmt.Sprintf("wss://%s:%s%s", addr, wssPort, params[ParamWSSPath])
+		}
 	}
 	slog.Info("LocateHub",
 		slog.Int("Nr records", len(records)),
 		slog.String("fullURL", fullURL),
 		slog.String("core", core))
-	return rawURL, core
+	return fullURL, core
 }
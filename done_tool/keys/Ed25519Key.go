@@ -0,0 +1,129 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"reflect"
+)
+
+// Ed25519Key implements the Ed25519 key.
+// This implements the IHiveKeys interface.
+//
+// Keys are stored as native values, not as pointers. The PEM export is the same as
+// that of RSA keys, using PKCS8 for the private key and PKIX for the public key.
+type Ed25519Key struct {
+	// Reuse RSA functionality
+	RsaKey
+}
+
+// ImportPrivate reads the key-pair from the PEM private key.
+// This returns an error if the PEM is not a valid Ed25519 key.
+func (k *Ed25519Key) ImportPrivate(privatePEM string) (err error) {
+	derBytes, _ := k._importDer(privatePEM)
+	rawPrivateKey, err := x509.ParsePKCS8PrivateKey(derBytes)
+	if err != nil {
+		return err
+	}
+
+	privKey, valid := rawPrivateKey.(ed25519.PrivateKey)
+	if !valid {
+		keyType := reflect.TypeOf(rawPrivateKey)
+		return fmt.Errorf("not an Ed25519 private key. It looks to be a '%s'", keyType)
+	}
+	k.privKeyPtr = privKey
+	k.pubKeyPtr = privKey.Public()
+	return err
+}
+
+// ImportPrivateFromFile loads public/private key pair from PEM file
+func (k *Ed25519Key) ImportPrivateFromFile(pemPath string) (err error) {
+	pemEncodedPriv, err := os.ReadFile(pemPath)
+	if err != nil {
+		return err
+	}
+	err = k.ImportPrivate(string(pemEncodedPriv))
+	return err
+}
+
+// ImportPublic reads the public key from the PEM data.
+// This returns an error if the PEM is not a valid public key
+//
+// publicPEM must contain either a PEM encoded string, or its base64 encoded content
+func (k *Ed25519Key) ImportPublic(publicPEM string) (err error) {
+	derBytes, _ := k._importDer(publicPEM)
+
+	k.pubKeyPtr, err = x509.ParsePKIXPublicKey(derBytes)
+	k.privKeyPtr = nil
+	_, valid := k.pubKeyPtr.(ed25519.PublicKey)
+	if !valid {
+		keyType := reflect.TypeOf(k.pubKeyPtr)
+		return fmt.Errorf("not an Ed25519 public key. It looks to be a '%s'", keyType)
+	}
+	return err
+}
+
+// ImportPublicFromFile loads Ed25519 public key from PEM file
+func (k *Ed25519Key) ImportPublicFromFile(pemPath string) (err error) {
+	pemEncodedPub, err := os.ReadFile(pemPath)
+	if err != nil {
+		return err
+	}
+	err = k.ImportPublic(string(pemEncodedPub))
+	return err
+}
+
+// Initialize generates a new key
+func (k *Ed25519Key) Initialize() IHiveKey {
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic("unable to create Ed25519 key")
+	}
+	k.privKeyPtr = privKey
+	k.pubKeyPtr = pubKey
+	return k
+}
+
+// KeyType returns this key's type, eg ed25519
+func (k *Ed25519Key) KeyType() KeyType {
+	return KeyTypeEd25519
+}
+
+// Sign returns the signature of a message signed using this key
+// Ed25519 signs the message itself, not its hash.
+// this requires a private key to be created or imported
+func (k *Ed25519Key) Sign(msg []byte) (signature []byte, err error) {
+	privKey := k.privKeyPtr.(ed25519.PrivateKey)
+	signature = ed25519.Sign(privKey, msg)
+	return signature, nil
+}
+
+// Verify the signature of a message using this key's public key
+// this requires a public key to be created or imported
+// returns true if the signature is valid for the message
+func (k *Ed25519Key) Verify(msg []byte, signature []byte) (valid bool) {
+	pubKey := k.pubKeyPtr.(ed25519.PublicKey)
+	valid = ed25519.Verify(pubKey, msg, signature)
+	return valid
+}
+
+// NewEd25519Key creates and initialize a Ed25519 key
+func NewEd25519Key() IHiveKey {
+	k := &Ed25519Key{}
+	k.Initialize()
+	return k
+}
+
+// NewEd25519KeyFromPrivate creates and initialize a IHiveKey object from an existing Ed25519 private key.
+func NewEd25519KeyFromPrivate(privKey ed25519.PrivateKey) IHiveKey {
+	k := &Ed25519Key{
+		// reuse RSA
+		RsaKey{
+			privKeyPtr: privKey,
+			pubKeyPtr:  privKey.Public(),
+		},
+	}
+	return k
+}
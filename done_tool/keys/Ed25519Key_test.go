@@ -0,0 +1,53 @@
+package keys_test
+
+import (
+	"path"
+	"testing"
+
+	"github.com/hiveot/hub/done_tool/keys"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Ed25519 keys survive a save and load through PEM files
+func TestEd25519SaveLoad(t *testing.T) {
+	testDir := t.TempDir()
+	keyFile := path.Join(testDir, "client1.key")
+	pubFile := path.Join(testDir, "client1.pub")
+	msg := []byte("hello world")
+
+	k1 := keys.NewKey(keys.KeyTypeEd25519)
+	require.NotNil(t, k1)
+	assert.Equal(t, keys.KeyTypeEd25519, k1.KeyType())
+	err := k1.ExportPrivateToFile(keyFile)
+	require.NoError(t, err)
+	err = k1.ExportPublicToFile(pubFile)
+	require.NoError(t, err)
+	assert.Equal(t, keys.KeyTypeEd25519, keys.DetermineKeyType(k1.ExportPrivate()))
+	assert.Equal(t, keys.KeyTypeEd25519, keys.DetermineKeyType(k1.ExportPublic()))
+
+	// the loaded key pair signs like the original
+	k2, err := keys.NewKeyFromFile(keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, keys.KeyTypeEd25519, k2.KeyType())
+	assert.Equal(t, k1.ExportPublic(), k2.ExportPublic())
+	sig, err := k2.Sign(msg)
+	require.NoError(t, err)
+	assert.True(t, k1.Verify(msg, sig))
+
+	// the loaded public key verifies signatures of the original
+	k3 := keys.NewKey(keys.KeyTypeEd25519)
+	err = k3.ImportPublicFromFile(pubFile)
+	require.NoError(t, err)
+	sig, err = k1.Sign(msg)
+	require.NoError(t, err)
+	assert.True(t, k3.Verify(msg, sig))
+	assert.False(t, k3.Verify([]byte("other message"), sig))
+
+	// keys of another type are refused
+	ecdsaKey := keys.NewKey(keys.KeyTypeECDSA)
+	err = k3.ImportPublic(ecdsaKey.ExportPublic())
+	assert.Error(t, err)
+	err = k3.ImportPrivate(ecdsaKey.ExportPrivate())
+	assert.Error(t, err)
+}
@@ -7,6 +7,7 @@ type KeyType string
 
 const (
 	KeyTypeECDSA   KeyType = "ecdsa"
+	KeyTypeEd25519 KeyType = "ed25519"
 	KeyTypeRSA     KeyType = "rsa"
 	KeyTypeNKey    KeyType = "nkey"
 	KeyTypeUnknown         = ""
@@ -19,8 +20,7 @@ type IHiveKey interface {
 
 	// ExportPrivate returns the serialized private key if available
 	// This defaults to PEM encoding unless the key type doesn't support it.
-	//  key type ecdsa, rsa use PEM encoding
-	//  key type ed25519 encodes it to base64
+	//  key type ecdsa, ed25519, rsa use PEM encoding
 	//  key type nkeys encodes when generating its seed
 	ExportPrivate() string
 
@@ -48,7 +48,7 @@ type IHiveKey interface {
 	ImportPublic(publicEnc string) error
 
 	// ImportPublicFromFile reads the public key from file.
-	// The encoding depends on the key type. ecdsa and rsa uses pem format.
+	// The encoding depends on the key type. ecdsa, ed25519 and rsa use pem format.
 	// Intended for verifying signatures using the public key.
 	// This returns an error if the file cannot be read or is not a valid public key
 	// Note that after ImportPublicFrom...(), the private key is not available.
@@ -3,6 +3,7 @@ package keys
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
@@ -37,6 +38,8 @@ func DetermineKeyType(encKey string) KeyType {
 		switch genericPublicKey.(type) {
 		case *ecdsa.PublicKey:
 			return KeyTypeECDSA
+		case ed25519.PublicKey:
+			return KeyTypeEd25519
 		case *rsa.PublicKey:
 			return KeyTypeRSA
 		}
@@ -53,6 +56,8 @@ func DetermineKeyType(encKey string) KeyType {
 		switch rawPrivateKey.(type) {
 		case *ecdsa.PrivateKey:
 			return KeyTypeECDSA
+		case ed25519.PrivateKey:
+			return KeyTypeEd25519
 		case *rsa.PrivateKey:
 			return KeyTypeRSA
 		default:
@@ -68,6 +73,8 @@ func NewKey(keyType KeyType) IHiveKey {
 	switch keyType {
 	case KeyTypeECDSA:
 		return NewEcdsaKey()
+	case KeyTypeEd25519:
+		return NewEd25519Key()
 	case KeyTypeNKey:
 		return NewNkeysKey()
 	case KeyTypeRSA:
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// labelKey returns the key of the label values in the sample map
+func labelKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+// makeLabels pairs the label names with their values
+func makeLabels(labelNames []string, labelValues []string) []Label {
+	labels := make([]Label, 0, len(labelNames)+1)
+	for i, name := range labelNames {
+		value := ""
+		if i < len(labelValues) {
+			value = labelValues[i]
+		}
+		labels = append(labels, Label{Name: name, Value: value})
+	}
+	return labels
+}
+
+// sortedKeys returns the keys of the samples in order, for a stable output
+func sortedKeys[T any](samples map[string]T) []string {
+	keys := make([]string, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Counter is a counter metric family with a sample for each combination of label values.
+// Counters only go up.
+type Counter struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mux     sync.Mutex
+	samples map[string]*counterSample
+}
+
+type counterSample struct {
+	labelValues []string
+	value       float64
+}
+
+// Add adds a positive value to the counter with the given label values.
+// Negative values are ignored.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	key := labelKey(labelValues)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	sample, found := c.samples[key]
+	if !found {
+		sample = &counterSample{labelValues: labelValues}
+		c.samples[key] = sample
+	}
+	sample.value += value
+}
+
+// Collect writes the counter family
+func (c *Counter) Collect(mw *MetricWriter) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	mw.WriteFamily(c.name, TypeCounter, c.help)
+	for _, key := range sortedKeys(c.samples) {
+		sample := c.samples[key]
+		mw.WriteSample(c.name+"_total", sample.value, makeLabels(c.labelNames, sample.labelValues)...)
+	}
+}
+
+// Inc increments the counter with the given label values by 1
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the counter value with the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	sample, found := c.samples[labelKey(labelValues)]
+	if !found {
+		return 0
+	}
+	return sample.value
+}
+
+// NewCounter creates a counter metric family
+//
+//	name of the family without the _total suffix, eg hiveot_rpc_requests
+//	help describes the counter
+//	labelNames are the names of the labels whose values are provided with Add or Inc
+func NewCounter(name string, help string, labelNames ...string) *Counter {
+	c := &Counter{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		samples:    make(map[string]*counterSample),
+	}
+	return c
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the upper bounds in seconds of the buckets of latency histograms
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram is a histogram metric family with a sample for each combination of label values.
+// Observed values are counted in the buckets with an upper bound of at least the value.
+type Histogram struct {
+	name       string
+	help       string
+	labelNames []string
+	// sorted upper bounds of the buckets, excluding +Inf
+	bounds []float64
+
+	mux     sync.Mutex
+	samples map[string]*histogramSample
+}
+
+type histogramSample struct {
+	labelValues []string
+	// count of observations for each bucket bound, not cumulative
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Collect writes the histogram family with cumulative bucket counts
+func (h *Histogram) Collect(mw *MetricWriter) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	mw.WriteFamily(h.name, TypeHistogram, h.help)
+	for _, key := range sortedKeys(h.samples) {
+		sample := h.samples[key]
+		labels := makeLabels(h.labelNames, sample.labelValues)
+		cumulative := uint64(0)
+		for i, bound := range h.bounds {
+			cumulative += sample.counts[i]
+			mw.WriteSample(h.name+"_bucket", float64(cumulative),
+				append(labels, Label{Name: "le", Value: formatValue(bound)})...)
+		}
+		mw.WriteSample(h.name+"_bucket", float64(sample.count),
+			append(labels, Label{Name: "le", Value: formatValue(math.Inf(1))})...)
+		mw.WriteSample(h.name+"_sum", sample.sum, labels...)
+		mw.WriteSample(h.name+"_count", float64(sample.count), labels...)
+	}
+}
+
+// Observe adds an observed value to the histogram with the given label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	sample, found := h.samples[key]
+	if !found {
+		sample = &histogramSample{
+			labelValues: labelValues,
+			counts:      make([]uint64, len(h.bounds)),
+		}
+		h.samples[key] = sample
+	}
+	i := sort.SearchFloat64s(h.bounds, value)
+	if i < len(h.bounds) {
+		sample.counts[i]++
+	}
+	sample.count++
+	sample.sum += value
+}
+
+// NewHistogram creates a histogram metric family
+//
+//	name of the family, eg hiveot_rpc_duration_seconds
+//	help describes the histogram
+//	buckets are the upper bounds of the buckets, or nil for DefaultLatencyBuckets
+//	labelNames are the names of the labels whose values are provided with Observe
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultLatencyBuckets
+	}
+	bounds := make([]float64, 0, len(buckets))
+	for _, bound := range buckets {
+		if !math.IsInf(bound, 1) {
+			bounds = append(bounds, bound)
+		}
+	}
+	sort.Float64s(bounds)
+	h := &Histogram{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		bounds:     bounds,
+		samples:    make(map[string]*histogramSample),
+	}
+	return h
+}
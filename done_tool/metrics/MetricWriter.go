@@ -0,0 +1,112 @@
+// Package metrics provides metrics in the OpenMetrics text format for scraping by
+// Prometheus or compatible tools.
+//
+// Metric families are collected from the collectors that are registered with a Registry.
+// Services typically register counters and histograms with the DefaultRegistry, and
+// collector functions for values that are read when scraped.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// OpenMetrics metric family types
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// ContentType of the OpenMetrics text format
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Label is a metric label name and value
+type Label struct {
+	Name  string
+	Value string
+}
+
+// MetricWriter writes metric families in the OpenMetrics text format.
+// Each family starts with WriteFamily, followed by its samples.
+type MetricWriter struct {
+	w   io.Writer
+	err error
+}
+
+// formatValue returns the OpenMetrics representation of a sample value
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeLabel escapes the backslash, double-quote and line feed in a label value
+var escapeLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeHelp escapes the backslash and line feed in a help text
+var escapeHelp = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// Err returns the first error that occurred while writing
+func (mw *MetricWriter) Err() error {
+	return mw.err
+}
+
+// printf writes to the output unless a previous write failed
+func (mw *MetricWriter) printf(format string, args ...interface{}) {
+	if mw.err == nil {
+		_, mw.err = fmt.Fprintf(mw.w, format, args...)
+	}
+}
+
+// WriteCounter writes a counter family with a single sample
+func (mw *MetricWriter) WriteCounter(name string, help string, value float64, labels ...Label) {
+	mw.WriteFamily(name, TypeCounter, help)
+	mw.WriteSample(name+"_total", value, labels...)
+}
+
+// WriteFamily writes the metadata of a metric family.
+//
+//	name of the family, eg hiveot_rpc_requests
+//	metricType is one of TypeCounter, TypeGauge or TypeHistogram
+//	help is the description of the metric
+func (mw *MetricWriter) WriteFamily(name string, metricType string, help string) {
+	mw.printf("# TYPE %s %s\n", name, metricType)
+	if help != "" {
+		mw.printf("# HELP %s %s\n", name, escapeHelp.Replace(help))
+	}
+}
+
+// WriteGauge writes a gauge family with a single sample
+func (mw *MetricWriter) WriteGauge(name string, help string, value float64, labels ...Label) {
+	mw.WriteFamily(name, TypeGauge, help)
+	mw.WriteSample(name, value, labels...)
+}
+
+// WriteSample writes a sample of the current metric family.
+// Counter samples use the _total suffix, histogram samples the _bucket, _sum and _count suffixes.
+func (mw *MetricWriter) WriteSample(name string, value float64, labels ...Label) {
+	if len(labels) == 0 {
+		mw.printf("%s %s\n", name, formatValue(value))
+		return
+	}
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		parts = append(parts, l.Name+`="`+escapeLabel.Replace(l.Value)+`"`)
+	}
+	mw.printf("%s{%s} %s\n", name, strings.Join(parts, ","), formatValue(value))
+}
+
+// NewMetricWriter returns a writer of metrics to the given output
+func NewMetricWriter(w io.Writer) *MetricWriter {
+	return &MetricWriter{w: w}
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultPath is the path of the metrics endpoint
+const DefaultPath = "/metrics"
+
+// Collector writes one or more metric families when the metrics are scraped
+type Collector interface {
+	Collect(mw *MetricWriter)
+}
+
+// CollectorFunc is a function that implements the Collector interface.
+// Intended for reading values, like server statistics, at the time they are scraped.
+type CollectorFunc func(mw *MetricWriter)
+
+// Collect invokes the function
+func (f CollectorFunc) Collect(mw *MetricWriter) {
+	f(mw)
+}
+
+// Registry holds the collectors of the metrics of a process
+type Registry struct {
+	mux        sync.RWMutex
+	collectors []Collector
+}
+
+// DefaultRegistry is the registry served by the plugin metrics endpoint
+var DefaultRegistry = NewRegistry()
+
+// Register adds a collector. Collectors are written in the order they are registered.
+func (reg *Registry) Register(c Collector) {
+	reg.mux.Lock()
+	defer reg.mux.Unlock()
+	reg.collectors = append(reg.collectors, c)
+}
+
+// ServeHTTP writes the metrics of all collectors in the OpenMetrics text format
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// collect first, so a failed collection doesn't result in a partial response
+	buf := &bytes.Buffer{}
+	err := reg.Write(buf)
+	if err != nil {
+		slog.Error("failed writing metrics", "err", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// Write the metrics of all collectors to the writer, terminated with the EOF marker
+func (reg *Registry) Write(w io.Writer) error {
+	reg.mux.RLock()
+	collectors := append([]Collector{}, reg.collectors...)
+	reg.mux.RUnlock()
+
+	mw := NewMetricWriter(w)
+	for _, c := range collectors {
+		c.Collect(mw)
+	}
+	mw.printf("# EOF\n")
+	return mw.Err()
+}
+
+// localAddress returns the address with the loopback host if no host is given.
+// This fails if the host isn't a loopback address.
+func localAddress(address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	} else if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return "", fmt.Errorf("metrics are only served on localhost, not on '%s'", host)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// StartMetricsServer serves the metrics of the registry on a plain http listener.
+// The metrics include Thing and client IDs, so they are only served on the loopback
+// interface. Use a local scraper or a TLS proxy to collect them remotely.
+// Use Close() on the returned server to stop it. Its Addr holds the listening address.
+//
+//	address to listen on, eg ":9100" or "127.0.0.1:9100". Without host this listens on 127.0.0.1.
+//	reg is the registry to serve, or nil for the DefaultRegistry
+func StartMetricsServer(address string, reg *Registry) (*http.Server, error) {
+	if reg == nil {
+		reg = DefaultRegistry
+	}
+	address, err := localAddress(address)
+	if err != nil {
+		return nil, fmt.Errorf("StartMetricsServer: %w", err)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("StartMetricsServer: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(DefaultPath, reg)
+	srv := &http.Server{
+		Addr:              listener.Addr().String(),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		err2 := srv.Serve(listener)
+		if err2 != nil && !errors.Is(err2, http.ErrServerClosed) {
+			slog.Error("metrics server stopped", "err", err2.Error())
+		}
+	}()
+	slog.Info("serving metrics", "address", listener.Addr().String(), "path", DefaultPath)
+	return srv, nil
+}
+
+// NewRegistry returns a new empty registry
+func NewRegistry() *Registry {
+	return &Registry{collectors: make([]Collector, 0)}
+}
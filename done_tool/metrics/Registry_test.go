@@ -0,0 +1,81 @@
+package metrics_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hiveot/hub/done_tool/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The registry writes the collected families in the OpenMetrics text format
+func TestOpenMetricsFormat(t *testing.T) {
+	reg := metrics.NewRegistry()
+	counter := metrics.NewCounter("test_requests", "Handled requests", "method")
+	histogram := metrics.NewHistogram("test_duration_seconds", "", []float64{0.1, 1}, "method")
+	reg.Register(counter)
+	reg.Register(histogram)
+	reg.Register(metrics.CollectorFunc(func(mw *metrics.MetricWriter) {
+		mw.WriteGauge("test_connections", "Open\nconnections", 3,
+			metrics.Label{Name: "server", Value: `hub "1"`})
+	}))
+	counter.Inc("list")
+	counter.Add(2, "get")
+	histogram.Observe(0.05, "get")
+	histogram.Observe(0.5, "get")
+	histogram.Observe(5, "get")
+
+	buf := &bytes.Buffer{}
+	err := reg.Write(buf)
+	require.NoError(t, err)
+	expected := `# TYPE test_requests counter
+# HELP test_requests Handled requests
+test_requests_total{method="get"} 2
+test_requests_total{method="list"} 1
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="get",le="0.1"} 1
+test_duration_seconds_bucket{method="get",le="1"} 2
+test_duration_seconds_bucket{method="get",le="+Inf"} 3
+test_duration_seconds_sum{method="get"} 5.55
+test_duration_seconds_count{method="get"} 3
+# TYPE test_connections gauge
+# HELP test_connections Open\nconnections
+test_connections{server="hub \"1\""} 3
+# EOF
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+// The metrics endpoint returns the OpenMetrics content type
+func TestMetricsServer(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.Register(metrics.NewCounter("test_requests", "Handled requests"))
+	// without host the metrics are served on localhost
+	srv, err := metrics.StartMetricsServer(":0", reg)
+	require.NoError(t, err)
+	defer srv.Close()
+	assert.True(t, strings.HasPrefix(srv.Addr, "127.0.0.1:"))
+
+	resp, err := http.Get("http://" + srv.Addr + metrics.DefaultPath)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, metrics.ContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "# TYPE test_requests counter\n# HELP test_requests Handled requests\n# EOF\n", string(body))
+}
+
+// Metrics are not served on other interfaces
+func TestMetricsServerNotLocal(t *testing.T) {
+	reg := metrics.NewRegistry()
+	_, err := metrics.StartMetricsServer("0.0.0.0:0", reg)
+	assert.Error(t, err)
+	_, err = metrics.StartMetricsServer("hub.local:0", reg)
+	assert.Error(t, err)
+	srv, err := metrics.StartMetricsServer("localhost:0", reg)
+	require.NoError(t, err)
+	srv.Close()
+}
@@ -34,6 +34,9 @@ type AppEnvironment struct {
 	//Core string `yaml:"core"` // core to use, "nats" or "mqtt". empty for auto-detect
 	ServerURL string `yaml:"serverURL,omitempty"` // server address
 
+	// Metrics
+	MetricsAddr string `yaml:"metricsAddr,omitempty"` // localhost address of the metrics endpoint, eg ":9100". Default "" is disabled
+
 	// Credentials
 	CaCert    *x509.Certificate `yaml:"-"`         // default cert if loaded
 	ClientID  string            `yaml:"clientID"`  // the clientID based on the application binary name
@@ -77,6 +80,7 @@ func (env *AppEnvironment) LoadConfig(cfg interface{}) error {
 //	-loglevel   debug, info, warning (default), error
 //	-server     optional server URL or "" for auto-detect
 //	-core       optional server core or "" for auto-detect
+//	-metrics    optional localhost address to serve OpenMetrics on, eg ":9100". Default is disabled
 //
 // The default 'user based' structure is:
 //
@@ -121,6 +125,7 @@ func GetAppEnvironment(homeDir string, withFlags bool) AppEnvironment {
 		logLevel = "warning"
 	}
 	serverURL := ""
+	metricsAddr := ""
 	os.Environ()
 
 	// default home folder is the parent of the core or plugin binary
@@ -140,6 +145,7 @@ func GetAppEnvironment(homeDir string, withFlags bool) AppEnvironment {
 		flag.StringVar(&clientID, "clientID", clientID, "Application clientID to authenticate with")
 		flag.StringVar(&logLevel, "logLevel", logLevel, "logging level: debug, warning, info, error")
 		flag.StringVar(&serverURL, "server", serverURL, "server URL or empty for auto-detect")
+		flag.StringVar(&metricsAddr, "metrics", metricsAddr, "localhost address to serve metrics on, eg :9100. Default is disabled")
 		if flag.Usage == nil {
 			flag.Usage = func() {
 				fmt.Println("Usage: " + clientID + " [options] ")
@@ -197,19 +203,20 @@ func GetAppEnvironment(homeDir string, withFlags bool) AppEnvironment {
 	keyFile := path.Join(certsDir, clientID+".key")
 
 	return AppEnvironment{
-		BinDir:     binDir,
-		PluginsDir: pluginsDir,
-		HomeDir:    homeDir,
-		ConfigDir:  configDir,
-		ConfigFile: configFile,
-		CertsDir:   certsDir,
-		LogsDir:    logsDir,
-		LogLevel:   logLevel,
-		StoresDir:  storesDir,
-		ClientID:   clientID,
-		KeyFile:    keyFile,
-		TokenFile:  tokenFile,
-		CaCert:     caCert,
-		ServerURL:  serverURL,
+		BinDir:      binDir,
+		PluginsDir:  pluginsDir,
+		HomeDir:     homeDir,
+		ConfigDir:   configDir,
+		ConfigFile:  configFile,
+		CertsDir:    certsDir,
+		LogsDir:     logsDir,
+		LogLevel:    logLevel,
+		StoresDir:   storesDir,
+		ClientID:    clientID,
+		KeyFile:     keyFile,
+		TokenFile:   tokenFile,
+		CaCert:      caCert,
+		ServerURL:   serverURL,
+		MetricsAddr: metricsAddr,
 	}
 }
@@ -6,6 +6,7 @@ import (
 
 	clidone "github.com/hiveot/hub/done_cli/cli_done"
 	"github.com/hiveot/hub/done_tool/logging"
+	"github.com/hiveot/hub/done_tool/metrics"
 )
 
 type PluginConfig struct {
@@ -45,6 +46,14 @@ func StartPlugin(plugin IPlugin, env *AppEnvironment) {
 		slog.Error("failed starting service", "err", err.Error())
 		os.Exit(1)
 	}
+	// optionally serve the metrics of the plugin and its RPC requests
+	if env.MetricsAddr != "" {
+		metrics.DefaultRegistry.Register(hc)
+		_, err = metrics.StartMetricsServer(env.MetricsAddr, metrics.DefaultRegistry)
+		if err != nil {
+			slog.Error("failed starting metrics server", "err", err.Error())
+		}
+	}
 	WaitForSignal()
 	plugin.Stop()
 
@@ -0,0 +1,193 @@
+// Package testenv with an embedded hub for integration testing of services.
+//
+// The test server runs the messaging server and the auth service in-process, using
+// a random port and a temporary directory with a new CA and keys. Clients are added
+// with the auth service and connected with their token.
+package testenv
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+
+	clidone "github.com/hiveot/hub/done_cli/cli_done"
+	authapi "github.com/hiveot/hub/done_mod/mod_auth/auth_api"
+	authcfg "github.com/hiveot/hub/done_mod/mod_auth/auth_cfg"
+	authservice "github.com/hiveot/hub/done_mod/mod_auth/auth_srv"
+	buscfg "github.com/hiveot/hub/done_mod/mod_bus/bus_cfg"
+	bussrv "github.com/hiveot/hub/done_mod/mod_bus/bus_srv"
+	"github.com/hiveot/hub/done_tool/certs"
+	"github.com/hiveot/hub/done_tool/keys"
+)
+
+// TestServerHost is the address the test server listens on
+const TestServerHost = "127.0.0.1"
+
+// TestServer is an in-process hub with messaging server and auth service
+type TestServer struct {
+	// TestDir is the temporary directory with the keys and stores of the hub
+	TestDir string
+	// CaCert and CaKey of the test CA
+	CaCert *x509.Certificate
+	CaKey  keys.IHiveKey
+	// ServerURL is the URL clients connect to
+	ServerURL string
+	// WSServerURL is the wss:// URL of the websocket listener
+	WSServerURL string
+	// ServerTLS is the server certificate signed by the test CA, for services with a TLS endpoint
+	ServerTLS *tls.Certificate
+
+	MsgServer   *bussrv.NatsMsgServer
+	AuthService *authservice.AuthService
+
+	// the test directory is removed on stop if it was created by the server
+	removeTestDir bool
+}
+
+// AddClient adds a client of the given type to the auth service and returns its
+// new key pair and auth token.
+//
+//	clientType is one of authapi.ClientTypeDevice, ClientTypeService or ClientTypeUser
+//	clientID is the login ID of the client
+//	role of the user. Devices and services have a fixed role.
+func (ts *TestServer) AddClient(clientType string, clientID string, role string) (
+	kp keys.IHiveKey, token string, err error) {
+
+	hc := clidone.NewHubClient(ts.ServerURL, clientID, ts.CaCert)
+	kp = hc.CreateKeyPair()
+	pubKey := kp.ExportPublic()
+	ctx := clidone.ServiceContext{SenderID: authapi.DefaultAdminUserID}
+	mngClients := ts.AuthService.MngClients
+
+	switch clientType {
+	case authapi.ClientTypeDevice:
+		resp, err2 := mngClients.AddDevice(ctx, authapi.AddDeviceArgs{
+			DeviceID: clientID, DisplayName: clientID, PubKey: pubKey})
+		token, err = resp.Token, err2
+	case authapi.ClientTypeService:
+		resp, err2 := mngClients.AddService(ctx, authapi.AddServiceArgs{
+			ServiceID: clientID, DisplayName: clientID, PubKey: pubKey})
+		token, err = resp.Token, err2
+	case authapi.ClientTypeUser:
+		resp, err2 := mngClients.AddUser(ctx, authapi.AddUserArgs{
+			UserID: clientID, DisplayName: clientID, PubKey: pubKey, Role: role})
+		token, err = resp.Token, err2
+	default:
+		err = fmt.Errorf("AddClient: unknown client type '%s'", clientType)
+	}
+	return kp, token, err
+}
+
+// AddConnectClient adds a client and returns its connection to the hub.
+// The token is not refreshed automatically.
+func (ts *TestServer) AddConnectClient(clientType string, clientID string, role string) (
+	*clidone.HubClient, error) {
+
+	kp, token, err := ts.AddClient(clientType, clientID, role)
+	if err != nil {
+		return nil, err
+	}
+	hc := clidone.NewHubClient(ts.ServerURL, clientID, ts.CaCert)
+	hc.SetTokenRefresh(false)
+	err = hc.ConnectWithToken(kp, token)
+	if err != nil {
+		return nil, fmt.Errorf("AddConnectClient '%s': %w", clientID, err)
+	}
+	return hc, nil
+}
+
+// AddConnectDevice adds a device and returns its connection to the hub
+func (ts *TestServer) AddConnectDevice(deviceID string) (*clidone.HubClient, error) {
+	return ts.AddConnectClient(authapi.ClientTypeDevice, deviceID, authapi.ClientRoleDevice)
+}
+
+// AddConnectService adds a service and returns its connection to the hub
+func (ts *TestServer) AddConnectService(serviceID string) (*clidone.HubClient, error) {
+	return ts.AddConnectClient(authapi.ClientTypeService, serviceID, authapi.ClientRoleService)
+}
+
+// AddConnectUser adds a user with the given role and returns its connection to the hub
+func (ts *TestServer) AddConnectUser(userID string, role string) (*clidone.HubClient, error) {
+	return ts.AddConnectClient(authapi.ClientTypeUser, userID, role)
+}
+
+// Stop the auth service and messaging server, and remove the test directory if it
+// was created by the server.
+func (ts *TestServer) Stop() {
+	if ts.AuthService != nil {
+		ts.AuthService.Stop()
+	}
+	if ts.MsgServer != nil {
+		ts.MsgServer.Stop()
+	}
+	if ts.removeTestDir {
+		_ = os.RemoveAll(ts.TestDir)
+	}
+}
+
+// StartTestServer starts an in-process hub on a random port, with a new CA and keys.
+// Use Stop() to shut it down.
+//
+//	testDir is the directory for keys and stores, or "" to use a new temporary directory
+func StartTestServer(testDir string) (ts *TestServer, err error) {
+	ts = &TestServer{TestDir: testDir}
+	if testDir == "" {
+		ts.TestDir, err = os.MkdirTemp("", "hiveot-testenv-")
+		if err != nil {
+			return nil, fmt.Errorf("StartTestServer: %w", err)
+		}
+		ts.removeTestDir = true
+	}
+	keysDir := path.Join(ts.TestDir, "certs")
+	storesDir := path.Join(ts.TestDir, "stores")
+	err = os.MkdirAll(keysDir, 0700)
+	if err != nil {
+		ts.Stop()
+		return nil, fmt.Errorf("StartTestServer: %w", err)
+	}
+	ts.CaCert, ts.CaKey, err = certs.CreateCA("hiveot-test", 1)
+	if err != nil {
+		ts.Stop()
+		return nil, fmt.Errorf("StartTestServer: %w", err)
+	}
+	// the server listens on a random port
+	serverCfg := &buscfg.NatsServerConfig{
+		Host:   TestServerHost,
+		Port:   -1,
+		CaCert: ts.CaCert,
+		CaKey:  ts.CaKey,
+	}
+	// the websocket listener doesn't support random ports
+	serverCfg.WSPort, err = GetFreePort()
+	if err == nil {
+		err = serverCfg.Setup(keysDir, storesDir, false)
+	}
+	if err == nil {
+		ts.MsgServer = bussrv.NewNatsMsgServer(serverCfg, authapi.DefaultRolePermissions)
+		err = ts.MsgServer.Start()
+	}
+	if err != nil {
+		ts.Stop()
+		return nil, fmt.Errorf("StartTestServer: failed starting the server: %w", err)
+	}
+	ts.ServerURL, ts.WSServerURL, _ = ts.MsgServer.GetServerURLs()
+	ts.ServerTLS = serverCfg.ServerTLS
+
+	authCfg := authcfg.AuthConfig{}
+	err = authCfg.Setup(keysDir, storesDir)
+	if err == nil {
+		err = os.MkdirAll(path.Dir(authCfg.PasswordFile), 0700)
+	}
+	if err == nil {
+		ts.AuthService, err = authservice.StartAuthService(authCfg, ts.MsgServer, ts.CaCert)
+	}
+	if err != nil {
+		ts.Stop()
+		return nil, fmt.Errorf("StartTestServer: failed starting the auth service: %w", err)
+	}
+	slog.Info("StartTestServer", "serverURL", ts.ServerURL, "testDir", ts.TestDir)
+	return ts, nil
+}
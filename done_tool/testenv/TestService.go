@@ -0,0 +1,68 @@
+package testenv
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hiveot/hub/done_tool/plugin"
+)
+
+// GetFreePort returns a free port on the test server host.
+// Intended for services that run their own listener, like the gateway.
+func GetFreePort() (int, error) {
+	listener, err := net.Listen("tcp", TestServerHost+":0")
+	if err != nil {
+		return 0, fmt.Errorf("GetFreePort: %w", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+	return port, nil
+}
+
+// StartService adds a service client with the given ID and starts the service with
+// its connection. This waits briefly for the service subscriptions to reach the server.
+// Use the returned function to stop the service and disconnect its client.
+func (ts *TestServer) StartService(serviceID string, svc plugin.IPlugin) (stopFn func(), err error) {
+	hc, err := ts.AddConnectService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	err = svc.Start(hc)
+	if err != nil {
+		hc.Disconnect()
+		return nil, fmt.Errorf("StartService '%s': %w", serviceID, err)
+	}
+	// allow the subscriptions to reach the server
+	time.Sleep(10 * time.Millisecond)
+	return func() {
+		svc.Stop()
+		hc.Disconnect()
+	}, nil
+}
+
+// StartTestService starts a test server in a temporary directory of the test and
+// runs the service on it. The test fails if either can't be started.
+// Use the returned function to stop the service and the test server.
+//
+//	serviceID is the clientID of the service
+//	newService creates the service once the test server runs
+func StartTestService(t testing.TB, serviceID string, newService func(ts *TestServer) plugin.IPlugin) (
+	ts *TestServer, stopFn func()) {
+
+	t.Helper()
+	ts, err := StartTestServer(t.TempDir())
+	if err != nil {
+		t.Fatalf("StartTestService: %s", err)
+	}
+	stopSvc, err := ts.StartService(serviceID, newService(ts))
+	if err != nil {
+		ts.Stop()
+		t.Fatalf("StartTestService: %s", err)
+	}
+	return ts, func() {
+		stopSvc()
+		ts.Stop()
+	}
+}
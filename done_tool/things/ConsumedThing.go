@@ -0,0 +1,248 @@
+package things
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	apigo "github.com/hiveot/hub/done_api/api_go"
+)
+
+// propertiesEventName is the name of the event that carries a map of property values.
+// This must match transport.EventNameProps, which can't be imported here.
+const propertiesEventName = "$properties"
+
+// IConsumerClient is the part of the Hub client used by a ConsumedThing.
+// This is implemented by HubClient.
+type IConsumerClient interface {
+	PubAction(agentID string, thingID string, name string, payload []byte) ([]byte, error)
+	PubConfig(agentID string, thingID string, propName string, payload []byte) error
+	SubEvents(agentID string, thingID string, eventName string) error
+}
+
+// IValueReader reads the latest values of a Thing.
+// This is implemented by the history client, eg histcli.ReadHistoryClient.
+type IValueReader interface {
+	GetLatest(agentID string, thingID string, names []string) (ThingValueMap, error)
+}
+
+// ConsumedThing is the consumer's view of a Thing, based on its TD.
+// This follows the WoT Scripting API for reading and writing properties, invoking
+// actions and subscribing to events. See https://www.w3.org/TR/wot-scripting-api/#the-consumedthing-interface
+//
+// Inputs are validated against the affordance DataSchema before they are published,
+// and outputs are returned as InteractionOutput with the affordance schema.
+//
+// The Hub client has a single event handler, so events are not received directly.
+// The consumer's event handler passes the events of this Thing to HandleEvent.
+type ConsumedThing struct {
+	// agent that publishes the Thing
+	agentID string
+	td      *TD
+	hc      IConsumerClient
+	// optional reader of the latest values, used when no property event was received
+	reader IValueReader
+
+	// latest property values by name, received through HandleEvent or the reader
+	propValues map[string]*ThingValue
+	// event listeners by event name
+	eventListeners map[string][]func(*InteractionOutput)
+	mux            sync.RWMutex
+}
+
+// encodePayload serializes a value for publication.
+// Like the web viewer, objects and arrays are sent as JSON and other values as text.
+func encodePayload(schema *DataSchema, value interface{}) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if schema != nil && (schema.Type == apigo.WoTDataTypeObject || schema.Type == apigo.WoTDataTypeArray) {
+		return json.Marshal(value)
+	}
+	return []byte(fmt.Sprint(value)), nil
+}
+
+// newOutput returns the interaction output for the given data.
+// Data without value results in an output with a nil value.
+func newOutput(data []byte, schema *DataSchema) *InteractionOutput {
+	if len(data) == 0 {
+		return &InteractionOutput{Schema: schema}
+	}
+	return NewInteractionOutputFromJson(data, schema)
+}
+
+// GetTD returns the TD document this consumed thing is based on
+func (ct *ConsumedThing) GetTD() *TD {
+	return ct.td
+}
+
+// HandleEvent updates the property values and notifies the event listeners.
+// Events of other Things are ignored.
+// Intended to be called from the Hub client's event handler.
+func (ct *ConsumedThing) HandleEvent(tv *ThingValue) {
+	if tv.AgentID != ct.agentID || tv.ThingID != ct.td.ID {
+		return
+	}
+	if tv.Name == propertiesEventName {
+		props := make(map[string]string)
+		err := json.Unmarshal(tv.Data, &props)
+		if err != nil {
+			slog.Warn("HandleEvent; invalid properties event",
+				slog.String("thingID", tv.ThingID), slog.String("err", err.Error()))
+			return
+		}
+		ct.mux.Lock()
+		for name, value := range props {
+			propValue := *tv
+			propValue.Name = name
+			propValue.Data = []byte(value)
+			ct.propValues[name] = &propValue
+		}
+		ct.mux.Unlock()
+		return
+	}
+	ct.mux.Lock()
+	// properties can also be published as events with the same name
+	if ct.td.GetProperty(tv.Name) != nil {
+		ct.propValues[tv.Name] = tv
+	}
+	listeners := ct.eventListeners[tv.Name]
+	ct.mux.Unlock()
+
+	if len(listeners) > 0 {
+		output := newOutput(tv.Data, ct.td.GetValueSchema(tv.Name))
+		for _, listener := range listeners {
+			listener(output)
+		}
+	}
+}
+
+// InvokeAction requests an action on the Thing and returns the reply.
+// The params are validated against the action input schema.
+//
+//	name of the action as defined in the TD
+//	params is the native action input value, or nil if the action has no input
+func (ct *ConsumedThing) InvokeAction(name string, params interface{}) (*InteractionOutput, error) {
+	action := ct.td.GetAction(name)
+	if action == nil {
+		return nil, fmt.Errorf("InvokeAction: Thing '%s' has no action '%s'", ct.td.ID, name)
+	}
+	if action.Input != nil {
+		err := action.Input.Validate(params)
+		if err != nil {
+			return nil, fmt.Errorf("InvokeAction '%s': %w", name, err)
+		}
+	}
+	payload, err := encodePayload(action.Input, params)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := ct.hc.PubAction(ct.agentID, ct.td.ID, name, payload)
+	if err != nil {
+		return nil, err
+	}
+	return newOutput(reply, action.Output), nil
+}
+
+// ObserveProperties subscribes to the property events of the Thing.
+// The received property values are available through ReadProperty.
+func (ct *ConsumedThing) ObserveProperties() error {
+	return ct.hc.SubEvents(ct.agentID, ct.td.ID, propertiesEventName)
+}
+
+// ReadProperty returns the latest known value of a property.
+// Property values are obtained from the events passed to HandleEvent. Use ObserveProperties
+// to subscribe to property events. Until a property event is received, the value is
+// read using the value reader, if set. See SetValueReader.
+// This returns an error if the value is not known.
+func (ct *ConsumedThing) ReadProperty(name string) (*InteractionOutput, error) {
+	prop := ct.td.GetProperty(name)
+	if prop == nil {
+		return nil, fmt.Errorf("ReadProperty: Thing '%s' has no property '%s'", ct.td.ID, name)
+	}
+	if prop.WriteOnly {
+		return nil, fmt.Errorf("ReadProperty: property '%s' is write-only", name)
+	}
+	ct.mux.RLock()
+	tv, found := ct.propValues[name]
+	reader := ct.reader
+	ct.mux.RUnlock()
+	if !found && reader != nil {
+		latest, err := reader.GetLatest(ct.agentID, ct.td.ID, []string{name})
+		if err != nil {
+			return nil, fmt.Errorf("ReadProperty '%s': %w", name, err)
+		}
+		tv = latest.Get(name)
+		found = tv != nil
+		if found {
+			ct.mux.Lock()
+			// don't replace a value that was received in the meantime
+			if _, received := ct.propValues[name]; !received {
+				ct.propValues[name] = tv
+			}
+			ct.mux.Unlock()
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("ReadProperty: no value known for property '%s'", name)
+	}
+	return newOutput(tv.Data, &prop.DataSchema), nil
+}
+
+// SetValueReader sets the reader of the latest values, used by ReadProperty for
+// properties whose value hasn't been received, eg the history client.
+func (ct *ConsumedThing) SetValueReader(reader IValueReader) {
+	ct.mux.Lock()
+	ct.reader = reader
+	ct.mux.Unlock()
+}
+
+// SubscribeEvent subscribes to an event of the Thing.
+// The listener is invoked with the event value each time the event is received.
+func (ct *ConsumedThing) SubscribeEvent(name string, listener func(*InteractionOutput)) error {
+	if ct.td.GetEvent(name) == nil {
+		return fmt.Errorf("SubscribeEvent: Thing '%s' has no event '%s'", ct.td.ID, name)
+	}
+	ct.mux.Lock()
+	ct.eventListeners[name] = append(ct.eventListeners[name], listener)
+	ct.mux.Unlock()
+	return ct.hc.SubEvents(ct.agentID, ct.td.ID, name)
+}
+
+// WriteProperty requests a change to a property configuration of the Thing.
+// The value is validated against the property schema.
+func (ct *ConsumedThing) WriteProperty(name string, value interface{}) error {
+	prop := ct.td.GetProperty(name)
+	if prop == nil {
+		return fmt.Errorf("WriteProperty: Thing '%s' has no property '%s'", ct.td.ID, name)
+	}
+	if prop.ReadOnly {
+		return fmt.Errorf("WriteProperty: property '%s' is read-only", name)
+	}
+	err := prop.DataSchema.Validate(value)
+	if err != nil {
+		return fmt.Errorf("WriteProperty '%s': %w", name, err)
+	}
+	payload, err := encodePayload(&prop.DataSchema, value)
+	if err != nil {
+		return err
+	}
+	return ct.hc.PubConfig(ct.agentID, ct.td.ID, name, payload)
+}
+
+// NewConsumedThing creates a consumer's view of a Thing
+//
+//	agentID of the device or service that publishes the Thing
+//	td is the Thing's TD document, obtained from the directory
+//	hc is the Hub client used to publish requests, eg HubClient
+func NewConsumedThing(agentID string, td *TD, hc IConsumerClient) *ConsumedThing {
+	ct := &ConsumedThing{
+		agentID:        agentID,
+		td:             td,
+		hc:             hc,
+		propValues:     make(map[string]*ThingValue),
+		eventListeners: make(map[string][]func(*InteractionOutput)),
+	}
+	return ct
+}
@@ -0,0 +1,151 @@
+package things
+
+import (
+	"fmt"
+	"testing"
+
+	vocab "github.com/hiveot/hub/done_api/api_go"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAgentID = "agent1"
+const testThingID = "thing1"
+
+// fakeConsumerClient records the requests of a ConsumedThing
+type fakeConsumerClient struct {
+	actions       map[string]string
+	configs       map[string]string
+	subscriptions []string
+	// latest values returned by GetLatest
+	latest ThingValueMap
+}
+
+func (cl *fakeConsumerClient) PubAction(agentID string, thingID string, name string, payload []byte) ([]byte, error) {
+	cl.actions[name] = string(payload)
+	return []byte(`"done"`), nil
+}
+
+func (cl *fakeConsumerClient) PubConfig(agentID string, thingID string, propName string, payload []byte) error {
+	cl.configs[propName] = string(payload)
+	return nil
+}
+
+func (cl *fakeConsumerClient) SubEvents(agentID string, thingID string, eventName string) error {
+	cl.subscriptions = append(cl.subscriptions, eventName)
+	return nil
+}
+
+func (cl *fakeConsumerClient) GetLatest(agentID string, thingID string, names []string) (ThingValueMap, error) {
+	if agentID != testAgentID || thingID != testThingID {
+		return nil, fmt.Errorf("unknown thing")
+	}
+	values := make(ThingValueMap)
+	for _, name := range names {
+		if tv := cl.latest.Get(name); tv != nil {
+			values[name] = tv
+		}
+	}
+	return values, nil
+}
+
+func newFakeConsumerClient() *fakeConsumerClient {
+	return &fakeConsumerClient{
+		actions: make(map[string]string),
+		configs: make(map[string]string),
+		latest:  make(ThingValueMap),
+	}
+}
+
+// createTestTD returns a TD with a level property, a temperature event and a dim action
+func createTestTD() *TD {
+	td := NewTD(testThingID, "test thing", "")
+	level := td.AddProperty("level", "", "Level", vocab.WoTDataTypeInteger)
+	level.ReadOnly = false
+	level.NumberMaximum = 100
+	td.AddEvent("temperature", "", "Temperature", "",
+		&DataSchema{Type: vocab.WoTDataTypeNumber})
+	td.AddAction("dim", "", "Dim", "",
+		&DataSchema{Type: vocab.WoTDataTypeInteger, NumberMinimum: 1})
+	return td
+}
+
+func TestInvokeActionAndWriteProperty(t *testing.T) {
+	cl := newFakeConsumerClient()
+	ct := NewConsumedThing(testAgentID, createTestTD(), cl)
+
+	output, err := ct.InvokeAction("dim", 50)
+	require.NoError(t, err)
+	assert.Equal(t, "done", output.ValueAsString())
+	assert.Equal(t, "50", cl.actions["dim"])
+	// the minimum applies without a maximum
+	_, err = ct.InvokeAction("dim", 0)
+	assert.Error(t, err)
+	_, err = ct.InvokeAction("unknown", 1)
+	assert.Error(t, err)
+
+	err = ct.WriteProperty("level", 100)
+	require.NoError(t, err)
+	assert.Equal(t, "100", cl.configs["level"])
+	// the maximum applies without a minimum
+	err = ct.WriteProperty("level", 101)
+	assert.Error(t, err)
+	assert.Equal(t, "100", cl.configs["level"])
+}
+
+func TestReadProperty(t *testing.T) {
+	cl := newFakeConsumerClient()
+	ct := NewConsumedThing(testAgentID, createTestTD(), cl)
+
+	// without a value reader the value is unknown until an event is received
+	_, err := ct.ReadProperty("level")
+	assert.Error(t, err)
+
+	// the initial value is read from the value reader
+	cl.latest["level"] = &ThingValue{
+		AgentID: testAgentID, ThingID: testThingID, Name: "level", Data: []byte("20")}
+	ct.SetValueReader(cl)
+	output, err := ct.ReadProperty("level")
+	require.NoError(t, err)
+	assert.Equal(t, 20, output.ValueAsInt())
+
+	// property events update the value
+	err = ct.ObserveProperties()
+	require.NoError(t, err)
+	assert.Contains(t, cl.subscriptions, propertiesEventName)
+	ct.HandleEvent(&ThingValue{AgentID: testAgentID, ThingID: testThingID,
+		Name: propertiesEventName, Data: []byte(`{"level":"30"}`)})
+	output, err = ct.ReadProperty("level")
+	require.NoError(t, err)
+	assert.Equal(t, 30, output.ValueAsInt())
+
+	// events of other things are ignored
+	ct.HandleEvent(&ThingValue{AgentID: testAgentID, ThingID: "thing2",
+		Name: propertiesEventName, Data: []byte(`{"level":"40"}`)})
+	output, err = ct.ReadProperty("level")
+	require.NoError(t, err)
+	assert.Equal(t, 30, output.ValueAsInt())
+
+	_, err = ct.ReadProperty("unknown")
+	assert.Error(t, err)
+}
+
+func TestSubscribeEvent(t *testing.T) {
+	cl := newFakeConsumerClient()
+	ct := NewConsumedThing(testAgentID, createTestTD(), cl)
+	var received *InteractionOutput
+
+	err := ct.SubscribeEvent("temperature", func(output *InteractionOutput) {
+		received = output
+	})
+	require.NoError(t, err)
+	assert.Contains(t, cl.subscriptions, "temperature")
+	err = ct.SubscribeEvent("unknown", func(output *InteractionOutput) {})
+	assert.Error(t, err)
+
+	ct.HandleEvent(&ThingValue{AgentID: testAgentID, ThingID: testThingID,
+		Name: "temperature", Data: []byte("21.5")})
+	require.NotNil(t, received)
+	assert.Equal(t, "21.5", received.ValueAsString())
+}
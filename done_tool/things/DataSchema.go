@@ -78,6 +78,8 @@ type DataSchema struct {
 	NumberMaximum float64 `json:"maximum,omitempty"`
 	// Minimum specifies a minimum numeric value representing a lower limit
 	NumberMinimum float64 `json:"minimum,omitempty"`
+	// MultipleOf specifies the resolution of the value, eg 0.1. Used as the display precision.
+	NumberMultipleOf float64 `json:"multipleOf,omitempty"`
 
 	// IntegerSchema with metadata describing data of type integer.
 	// This Subclass is indicated by the value integer assigned to type in DataSchema instances.
@@ -52,3 +52,71 @@ func TestObjectSchema(t *testing.T) {
 	assert.Equal(t, 10, int(as.Properties["intProp"].NumberMinimum))
 
 }
+
+func TestFormatValue(t *testing.T) {
+	ns := DataSchema{
+		Type: vocab.WoTDataTypeNumber,
+		Unit: vocab.UnitCelcius,
+	}
+	assert.Equal(t, "23.46 C", ns.FormatValueWithUnit([]byte("23.456789")))
+	ns.NumberMultipleOf = 0.1
+	assert.Equal(t, "23.5", ns.FormatValue([]byte("23.456789")))
+
+	is := DataSchema{Type: vocab.WoTDataTypeInteger}
+	assert.Equal(t, "42", is.FormatValue([]byte("42.0")))
+	assert.Equal(t, "", is.FormatValueWithUnit([]byte("")))
+
+	es := DataSchema{Type: vocab.WoTDataTypeString}
+	es.SetEnumValues([]DataSchema{{Const: "on", Title: "Switched on"}})
+	assert.Equal(t, "Switched on", es.FormatValue([]byte("on")))
+	assert.Equal(t, "Switched on", es.FormatValue([]byte(`"on"`)))
+	assert.Equal(t, "off", es.FormatValue([]byte("off")))
+
+	ts := DataSchema{Type: vocab.WoTDataTypeDateTime}
+	assert.NotEqual(t, "1700000000000", ts.FormatValue([]byte("1700000000000")))
+	assert.Equal(t, "not a time", ts.FormatValue([]byte("not a time")))
+}
+
+func TestValidate(t *testing.T) {
+	ds := DataSchema{
+		Type:               vocab.WoTDataTypeObject,
+		Properties:         make(map[string]DataSchema),
+		PropertiesRequired: []string{"level"},
+	}
+	ds.Properties["level"] = DataSchema{
+		Type:          vocab.WoTDataTypeInteger,
+		NumberMinimum: 0,
+		NumberMaximum: 100,
+	}
+	ds.Properties["mode"] = DataSchema{
+		Type: vocab.WoTDataTypeString,
+		Enum: []interface{}{"on", "off"},
+	}
+	assert.NoError(t, ds.Validate(map[string]interface{}{"level": 50, "mode": "on"}))
+	assert.Error(t, ds.Validate(map[string]interface{}{"mode": "on"}))
+	assert.Error(t, ds.Validate(map[string]interface{}{"level": 101}))
+	assert.Error(t, ds.Validate(map[string]interface{}{"level": 1.5}))
+	assert.Error(t, ds.Validate(map[string]interface{}{"level": 1, "mode": "auto"}))
+	assert.Error(t, ds.Validate("text"))
+}
+
+func TestValidateNumber(t *testing.T) {
+	minOnly := DataSchema{Type: vocab.WoTDataTypeNumber, NumberMinimum: 10}
+	assert.NoError(t, minOnly.ValidateNumber(1000))
+	assert.Error(t, minOnly.ValidateNumber(9.9))
+
+	maxOnly := DataSchema{Type: vocab.WoTDataTypeNumber, NumberMaximum: -5}
+	assert.NoError(t, maxOnly.ValidateNumber(-10))
+	assert.Error(t, maxOnly.ValidateNumber(0))
+
+	step := DataSchema{Type: vocab.WoTDataTypeNumber, NumberMultipleOf: 0.1}
+	assert.NoError(t, step.ValidateNumber(0.3))
+	assert.Error(t, step.ValidateNumber(0.35))
+
+	uint1 := DataSchema{Type: vocab.WoTDataTypeUnsignedInt}
+	assert.NoError(t, uint1.ValidateNumber(3))
+	assert.Error(t, uint1.ValidateNumber(-1))
+	assert.Error(t, uint1.ValidateNumber(2.5))
+	// numbers provided as text use the same checks
+	assert.Error(t, minOnly.Validate("5"))
+}
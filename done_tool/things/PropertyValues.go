@@ -29,8 +29,10 @@ func (pv *PropertyValues) GetValues(onlyChanges bool) (v map[string]string) {
 		v = pv.GetChanged(true)
 	} else {
 		v = pv.GetLatest()
+		pv.mux.Lock()
+		pv.changed = make(map[string]string)
+		pv.mux.Unlock()
 	}
-	pv.changed = make(map[string]string)
 	return v
 }
 
@@ -53,11 +55,23 @@ func (pv *PropertyValues) HasChanges() bool {
 	return len(pv.changed) > 0
 }
 
+// ClearChanged removes the given values from the changed values, once they are published.
+// Values that changed again since are kept.
+func (pv *PropertyValues) ClearChanged(published map[string]string) {
+	pv.mux.Lock()
+	defer pv.mux.Unlock()
+	for k, v := range published {
+		if changedValue, found := pv.changed[k]; found && changedValue == v {
+			delete(pv.changed, k)
+		}
+	}
+}
+
 // GetChanged returns a copy of the map of changed property values
 // clear will clear the changed values
 func (pv *PropertyValues) GetChanged(clear bool) map[string]string {
-	pv.mux.RLock()
-	defer pv.mux.RUnlock()
+	pv.mux.Lock()
+	defer pv.mux.Unlock()
 	changedValues := pv.changed
 	if clear {
 		pv.changed = make(map[string]string)
@@ -0,0 +1,25 @@
+package things
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Published changes are cleared while values that changed again are kept
+func TestClearChanged(t *testing.T) {
+	pv := NewPropertyValues()
+	pv.SetValue("level", "1")
+	pv.SetValue("name", "a")
+
+	changed := pv.GetChanged(false)
+	assert.Len(t, changed, 2)
+	// a change after reading the changed values but before publication completed
+	pv.SetValue("level", "2")
+	pv.ClearChanged(changed)
+
+	assert.True(t, pv.HasChanges())
+	assert.Equal(t, map[string]string{"level": "2"}, pv.GetChanged(false))
+	pv.ClearChanged(pv.GetChanged(false))
+	assert.False(t, pv.HasChanges())
+}
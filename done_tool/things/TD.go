@@ -338,6 +338,21 @@ func (tdoc *TD) GetPropertyOfType(atType string) (string, *PropertyAffordance) {
 	return "", nil
 }
 
+// GetValueSchema returns the schema of the event or property value with the given name.
+// Events take precedence as values are published as events.
+// This returns nil if the name is not an event with data or a property.
+func (tdoc *TD) GetValueSchema(name string) *DataSchema {
+	ev := tdoc.GetEvent(name)
+	if ev != nil && ev.Data != nil {
+		return ev.Data
+	}
+	prop := tdoc.GetProperty(name)
+	if prop != nil {
+		return &prop.DataSchema
+	}
+	return nil
+}
+
 // GetUpdated is a helper function to return the formatted time the thing was last updated.
 // This uses the time format RFC822 ("02 Jan 06 15:04 MST")
 func (tdoc *TD) GetUpdated() string {
@@ -0,0 +1,93 @@
+package things
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	apigo "github.com/hiveot/hub/done_api/api_go"
+)
+
+// DefaultNumberPrecision is the nr of decimals shown for numbers without a MultipleOf hint
+const DefaultNumberPrecision = 2
+
+// DataFormatDateTime is the schema format of timestamp values
+const DataFormatDateTime = "date-time"
+
+// Precision returns the nr of decimals to show for numeric values of this schema.
+// Integers have no decimals. Numbers use the MultipleOf resolution if provided.
+func (ds *DataSchema) Precision() int {
+	if ds.Type == apigo.WoTDataTypeInteger || ds.Type == apigo.WoTDataTypeUnsignedInt {
+		return 0
+	}
+	if ds.NumberMultipleOf > 0 {
+		decimals := int(math.Ceil(-math.Log10(ds.NumberMultipleOf)))
+		return max(decimals, 0)
+	}
+	return DefaultNumberPrecision
+}
+
+// FormatValue returns the human readable presentation of a value of this schema,
+// without its unit.
+//
+//   - enum values defined with oneOf are shown by their title
+//   - numbers are rounded to the schema precision
+//   - timestamps are shown in local time; numeric timestamps are in msec since epoch
+//   - other values are shown as-is
+//
+// data is the value as published, either as text or JSON encoded.
+func (ds *DataSchema) FormatValue(data []byte) string {
+	text := strings.TrimSpace(string(data))
+	// strings can be JSON encoded
+	if strings.HasPrefix(text, "\"") {
+		var s string
+		if json.Unmarshal([]byte(text), &s) == nil {
+			text = s
+		}
+	}
+	if text == "" {
+		return ""
+	}
+	for _, option := range ds.OneOf {
+		if option.Title != "" && fmt.Sprint(option.Const) == text {
+			return option.Title
+		}
+	}
+	if ds.Type == apigo.WoTDataTypeDateTime || ds.Format == DataFormatDateTime {
+		return formatTimestamp(text)
+	}
+	switch ds.Type {
+	case apigo.WoTDataTypeNumber, apigo.WoTDataTypeInteger, apigo.WoTDataTypeUnsignedInt:
+		number, err := strconv.ParseFloat(text, 64)
+		if err == nil {
+			return strconv.FormatFloat(number, 'f', ds.Precision(), 64)
+		}
+	}
+	return text
+}
+
+// FormatValueWithUnit returns the human readable presentation of a value of this
+// schema followed by its unit symbol, if any.
+func (ds *DataSchema) FormatValueWithUnit(data []byte) string {
+	value := ds.FormatValue(data)
+	unit := ds.UnitSymbol()
+	if value == "" || unit == "" {
+		return value
+	}
+	return value + " " + unit
+}
+
+// formatTimestamp returns the timestamp in local time, using RFC822 like ThingValue.GetUpdated.
+// This accepts RFC3339 and msec since epoch timestamps. Other text is returned as-is.
+func formatTimestamp(text string) string {
+	if msec, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return time.UnixMilli(msec).Local().Format(time.RFC822)
+	}
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t.Local().Format(time.RFC822)
+	}
+	return text
+}
@@ -0,0 +1,219 @@
+package things
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	apigo "github.com/hiveot/hub/done_api/api_go"
+)
+
+// normalizeValue converts a native value into its JSON representation, eg float64,
+// string, bool, map[string]interface{} or []interface{}, for validation.
+func normalizeValue(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var norm interface{}
+	err = json.Unmarshal(data, &norm)
+	return norm, err
+}
+
+// Validate returns an error if the value doesn't match the schema.
+// This checks the type, enum and oneOf constants, number limits, string length
+// and pattern, array size, and the object's required properties.
+// Unknown types are not validated.
+//
+//	value is the native value to validate, eg 42, "text", true, or a map or struct for objects.
+func (ds *DataSchema) Validate(value interface{}) error {
+	norm, err := normalizeValue(value)
+	if err != nil {
+		return fmt.Errorf("value can't be serialized: %w", err)
+	}
+	return ds.validateNormalized(norm)
+}
+
+// ValidateData returns an error if the serialized data doesn't match the schema.
+// Data is serialized as JSON, except for text that isn't valid JSON, which is
+// treated as a string. This matches the way values are published.
+func (ds *DataSchema) ValidateData(data []byte) error {
+	if len(data) == 0 {
+		return ds.validateNormalized(nil)
+	}
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	_, isString := value.(string)
+	if err != nil || (ds.Type == apigo.WoTDataTypeString && !isString) {
+		// unquoted text, eg a string that looks like a number
+		value = string(data)
+	}
+	return ds.validateNormalized(value)
+}
+
+// validateNormalized validates a JSON normalized value
+func (ds *DataSchema) validateNormalized(value interface{}) error {
+	if value == nil {
+		if ds.Type == apigo.WoTDataTypeNone || ds.Type == "null" {
+			return nil
+		}
+		return fmt.Errorf("missing value of type '%s'", ds.Type)
+	}
+	err := ds.validateType(value)
+	if err != nil {
+		return err
+	}
+	if ds.Const != nil {
+		constNorm, _ := normalizeValue(ds.Const)
+		if fmt.Sprint(constNorm) != fmt.Sprint(value) {
+			return fmt.Errorf("value '%v' differs from constant '%v'", value, ds.Const)
+		}
+	}
+	if len(ds.Enum) > 0 || len(ds.OneOf) > 0 {
+		if !ds.isEnumValue(value) {
+			return fmt.Errorf("value '%v' is not one of the allowed values", value)
+		}
+	}
+	return nil
+}
+
+// isEnumValue returns true if the value is one of the enum or oneOf constant values
+func (ds *DataSchema) isEnumValue(value interface{}) bool {
+	valueStr := fmt.Sprint(value)
+	for _, e := range ds.Enum {
+		enumNorm, _ := normalizeValue(e)
+		if fmt.Sprint(enumNorm) == valueStr {
+			return true
+		}
+	}
+	for _, option := range ds.OneOf {
+		if option.Const != nil {
+			constNorm, _ := normalizeValue(option.Const)
+			if fmt.Sprint(constNorm) == valueStr {
+				return true
+			}
+		} else if option.validateNormalized(value) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validateType checks the value against the schema type and its type specific constraints
+func (ds *DataSchema) validateType(value interface{}) error {
+	switch ds.Type {
+	case apigo.WoTDataTypeBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("value '%v' is not a boolean", value)
+		}
+	case apigo.WoTDataTypeNumber, apigo.WoTDataTypeInteger, apigo.WoTDataTypeUnsignedInt:
+		return ds.validateNumber(value)
+	case apigo.WoTDataTypeString, apigo.WoTDataTypeDateTime, apigo.WoTDataTypeAnyURI:
+		return ds.validateString(value)
+	case apigo.WoTDataTypeArray:
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("value '%v' is not an array", value)
+		}
+		if ds.ArrayMinItems > 0 && uint(len(arr)) < ds.ArrayMinItems {
+			return fmt.Errorf("array has less than %d items", ds.ArrayMinItems)
+		}
+		if ds.ArrayMaxItems > 0 && uint(len(arr)) > ds.ArrayMaxItems {
+			return fmt.Errorf("array has more than %d items", ds.ArrayMaxItems)
+		}
+	case apigo.WoTDataTypeObject:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("value '%v' is not an object", value)
+		}
+		for _, key := range ds.PropertiesRequired {
+			if _, found := obj[key]; !found {
+				return fmt.Errorf("object is missing required property '%s'", key)
+			}
+		}
+		for key, propValue := range obj {
+			propSchema, found := ds.Properties[key]
+			if found {
+				if err := propSchema.validateNormalized(propValue); err != nil {
+					return fmt.Errorf("property '%s': %w", key, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateNumber checks if the value is a number within the schema limits.
+// Numbers provided as text are accepted if they can be parsed.
+func (ds *DataSchema) validateNumber(value interface{}) error {
+	var num float64
+	switch v := value.(type) {
+	case float64:
+		num = v
+	case string:
+		var err error
+		num, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("value '%s' is not a number", v)
+		}
+	default:
+		return fmt.Errorf("value '%v' is not a number", value)
+	}
+	return ds.ValidateNumber(num)
+}
+
+// ValidateNumber returns an error if the number doesn't match the numeric schema.
+// Integer types must be whole numbers and unsigned integers can't be negative.
+// As the schema has no way to tell an unset limit from a limit of 0, the minimum,
+// maximum and multipleOf only apply when they are not 0. Each limit applies on its own.
+func (ds *DataSchema) ValidateNumber(num float64) error {
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return fmt.Errorf("value '%v' is not a number", num)
+	}
+	if ds.Type != apigo.WoTDataTypeNumber && num != math.Trunc(num) {
+		return fmt.Errorf("value '%v' is not an integer", num)
+	}
+	if ds.Type == apigo.WoTDataTypeUnsignedInt && num < 0 {
+		return fmt.Errorf("value '%v' is negative", num)
+	}
+	if ds.NumberMinimum != 0 && num < ds.NumberMinimum {
+		return fmt.Errorf("value '%v' is less than the minimum %v", num, ds.NumberMinimum)
+	}
+	if ds.NumberMaximum != 0 && num > ds.NumberMaximum {
+		return fmt.Errorf("value '%v' is more than the maximum %v", num, ds.NumberMaximum)
+	}
+	if ds.NumberMultipleOf > 0 {
+		// allow for floating point rounding, eg 0.3 is a multiple of 0.1
+		steps := num / ds.NumberMultipleOf
+		if math.Abs(steps-math.Round(steps)) > 1e-9 {
+			return fmt.Errorf("value '%v' is not a multiple of %v", num, ds.NumberMultipleOf)
+		}
+	}
+	return nil
+}
+
+// validateString checks if the value is a string with the length and pattern of the schema
+func (ds *DataSchema) validateString(value interface{}) error {
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("value '%v' is not a string", value)
+	}
+	if ds.StringMinLength > 0 && uint(len(s)) < ds.StringMinLength {
+		return fmt.Errorf("text is shorter than %d characters", ds.StringMinLength)
+	}
+	if ds.StringMaxLength > 0 && uint(len(s)) > ds.StringMaxLength {
+		return fmt.Errorf("text is longer than %d characters", ds.StringMaxLength)
+	}
+	if ds.StringPattern != "" {
+		re, err := regexp.Compile(ds.StringPattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern '%s' in schema: %w", ds.StringPattern, err)
+		}
+		if !re.MatchString(s) {
+			return fmt.Errorf("text '%s' doesn't match pattern '%s'", s, ds.StringPattern)
+		}
+	}
+	return nil
+}
@@ -44,7 +44,7 @@ func (jauth *JWTAuthenticator) AuthenticateRequest(resp http.ResponseWriter, req
 	if err != nil {
 		// token needs a refresh
 		slog.Info("JWTAuthenticator: Invalid access token in request",
-			"method", req.Method, "uri", req.RequestURI, "remoteAddr", req.RemoteAddr, err)
+			"method", req.Method, "uri", req.RequestURI, "remoteAddr", req.RemoteAddr, "err", err.Error())
 		return "", false
 	}
 	// TODO: verify claims: iat, iss, aud
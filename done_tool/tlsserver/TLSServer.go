@@ -20,10 +20,12 @@ import (
 
 // TLSServer is a simple TLS MsgServer supporting BASIC, Jwt and client certificate authentication
 type TLSServer struct {
-	address           string
-	port              uint
-	caCert            *x509.Certificate
-	serverCert        *tls.Certificate
+	address    string
+	port       uint
+	caCert     *x509.Certificate
+	serverCert *tls.Certificate
+	// optional source of the server certificate, for hot swapping renewed certificates
+	getCertificate    func(*tls.ClientHelloInfo) (*tls.Certificate, error)
 	httpServer        *http.Server
 	router            *mux.Router
 	httpAuthenticator *HttpAuthenticator
@@ -119,6 +121,14 @@ func (srv *TLSServer) EnableJwtAuth(verificationKey *ecdsa.PublicKey) {
 	srv.httpAuthenticator.EnableJwtAuth(verificationKey)
 }
 
+// SetCertificateSource sets the function that provides the server certificate for
+// each new connection, instead of the certificate provided on creation.
+// Intended to use renewed certificates without restarting the server.
+// This must be called before Start.
+func (srv *TLSServer) SetCertificateSource(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) {
+	srv.getCertificate = getCertificate
+}
+
 // Start the TLS server using the provided CA and MsgServer certificates.
 // If a client certificate is provided it must be valid.
 // This configures handling of CORS requests to allow:
@@ -130,7 +140,7 @@ func (srv *TLSServer) Start() error {
 	var mutex = sync.Mutex{}
 
 	slog.Info("Starting TLS server", "address", srv.address, "port", srv.port)
-	if srv.caCert == nil || srv.serverCert == nil {
+	if srv.caCert == nil || (srv.serverCert == nil && srv.getCertificate == nil) {
 		err := fmt.Errorf("missing CA or server certificate")
 		slog.Error(err.Error())
 		return err
@@ -139,8 +149,14 @@ func (srv *TLSServer) Start() error {
 	caCertPool := x509.NewCertPool()
 	caCertPool.AddCert(srv.caCert)
 
+	getCertificate := srv.getCertificate
+	if getCertificate == nil {
+		getCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return srv.serverCert, nil
+		}
+	}
 	serverTLSConf := &tls.Config{
-		Certificates:       []tls.Certificate{*srv.serverCert},
+		GetCertificate:     getCertificate,
 		ClientAuth:         tls.VerifyClientCertIfGiven,
 		ClientCAs:          caCertPool,
 		MinVersion:         tls.VersionTLS12,
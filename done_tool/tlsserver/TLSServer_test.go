@@ -0,0 +1,73 @@
+package tlsserver_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hiveot/hub/done_tool/certs"
+	"github.com/hiveot/hub/done_tool/keys"
+	"github.com/hiveot/hub/done_tool/testenv"
+	"github.com/hiveot/hub/done_tool/tlsserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getPeerCert returns the certificate presented by the server in a TLS handshake
+func getPeerCert(t *testing.T, addr string, caCert *x509.Certificate) *x509.Certificate {
+	caCertPool := x509.NewCertPool()
+	caCertPool.AddCert(caCert)
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: caCertPool})
+	require.NoError(t, err)
+	defer conn.Close()
+	peerCerts := conn.ConnectionState().PeerCertificates
+	require.NotEmpty(t, peerCerts)
+	return peerCerts[0]
+}
+
+// New connections receive the reloaded server certificate without restarting the server
+func TestCertificateSource(t *testing.T) {
+	testDir := t.TempDir()
+	certPath := path.Join(testDir, "hubCert.pem")
+	keyPath := path.Join(testDir, "hubKey.pem")
+	caCert, caKey, err := certs.CreateCA("testca", 1)
+	require.NoError(t, err)
+	serverKey := keys.NewEcdsaKey()
+	err = serverKey.ExportPrivateToFile(keyPath)
+	require.NoError(t, err)
+	cert1, err := certs.CreateServerCert("hub", certs.OUService, 1, serverKey, nil, caCert, caKey)
+	require.NoError(t, err)
+	err = certs.SaveX509CertToPEM(cert1, certPath)
+	require.NoError(t, err)
+	certReloader, err := certs.NewTLSCertReloader(certPath, keyPath)
+	require.NoError(t, err)
+	certReloader.SetCheckInterval(0)
+
+	port, err := testenv.GetFreePort()
+	require.NoError(t, err)
+	addr := fmt.Sprintf("%s:%d", testenv.TestServerHost, port)
+	srv := tlsserver.NewTLSServer(testenv.TestServerHost, uint(port), nil, caCert)
+	srv.SetCertificateSource(certReloader.GetCertificate)
+	err = srv.Start()
+	require.NoError(t, err)
+	defer srv.Stop()
+
+	peerCert := getPeerCert(t, addr, caCert)
+	assert.Equal(t, cert1.Raw, peerCert.Raw)
+
+	// renew the certificate file, with a later modification time
+	cert2, err := certs.CreateServerCert("hub", certs.OUService, 1, serverKey, nil, caCert, caKey)
+	require.NoError(t, err)
+	err = certs.SaveX509CertToPEM(cert2, certPath)
+	require.NoError(t, err)
+	modTime := time.Now().Add(time.Minute)
+	err = os.Chtimes(certPath, modTime, modTime)
+	require.NoError(t, err)
+
+	peerCert = getPeerCert(t, addr, caCert)
+	assert.Equal(t, cert2.Raw, peerCert.Raw)
+}